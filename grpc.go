@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/reflection"
+
+	"github.com/s1natex/tasks-api-GO/internal/middleware"
+	"github.com/s1natex/tasks-api-GO/internal/tasks"
+	"github.com/s1natex/tasks-api-GO/internal/tasksv1"
+)
+
+// newGRPCServer serves TasksService together with the health and
+// reflection services. Health checks need no credentials.
+func newGRPCServer(repo tasks.Repository, broker *tasks.Broker, authCfg middleware.AuthConfig) (*grpc.Server, *health.Server) {
+	authCfg.SkipPaths = nil
+	authCfg.SkipPrefixes = []string{"/grpc.health.v1.Health/"}
+	authUnary, authStream := middleware.GRPCAuthInterceptors(authCfg)
+	traceUnary, traceStream := middleware.GRPCTracingInterceptors()
+
+	srv := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(traceUnary, authUnary),
+		grpc.ChainStreamInterceptor(traceStream, authStream),
+	)
+	tasksv1.RegisterTasksServiceServer(srv, tasks.NewGRPCService(repo, broker))
+
+	hs := health.NewServer()
+	hs.SetServingStatus(tasksv1.TasksService_ServiceDesc.ServiceName, healthpb.HealthCheckResponse_SERVING)
+	healthpb.RegisterHealthServer(srv, hs)
+	reflection.Register(srv)
+	return srv, hs
+}
+
+// newGateway translates REST calls under /v1/ into calls to the gRPC
+// server at addr, passing the caller's credentials on.
+func newGateway(ctx context.Context, addr string) (http.Handler, error) {
+	if strings.HasPrefix(addr, ":") {
+		addr = "localhost" + addr
+	}
+	conn, err := grpc.NewClient(addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return nil, err
+	}
+	context.AfterFunc(ctx, func() { _ = conn.Close() })
+
+	mux := runtime.NewServeMux(runtime.WithIncomingHeaderMatcher(func(key string) (string, bool) {
+		if strings.EqualFold(key, "X-API-Key") {
+			return "x-api-key", true
+		}
+		return runtime.DefaultHeaderMatcher(key)
+	}))
+	if err := tasksv1.RegisterTasksServiceHandlerClient(ctx, mux, tasksv1.NewTasksServiceClient(conn)); err != nil {
+		return nil, err
+	}
+	return mux, nil
+}
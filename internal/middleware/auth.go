@@ -1,9 +1,11 @@
 package middleware
 
 import (
+	"context"
 	"crypto/subtle"
 	"encoding/json"
 	"net/http"
+	"slices"
 	"strings"
 )
 
@@ -20,57 +22,152 @@ type AuthConfig struct {
 	APIKey      string
 	BearerToken string
 	SkipPaths   []string
+	// SkipPrefixes leaves every path under these prefixes open, for
+	// routes that carry their own credential in the URL.
+	SkipPrefixes []string
+	// BasicPrefixes also accept HTTP Basic authentication under these
+	// prefixes, with the credential as the password, for clients such as
+	// CalDAV apps that cannot send other headers.
+	BasicPrefixes []string
+	// Lookup resolves per-user credentials sent in the same header as the
+	// shared secret. The shared secret itself authenticates as an admin.
+	// WebSocket handshakes may send either as the access_token query
+	// parameter instead.
+	Lookup PrincipalLookup
 }
 
+// Principal is the authenticated caller. UserID and WorkspaceID are zero
+// for the shared secret, which is not tied to a user account and acts in
+// the default workspace.
+type Principal struct {
+	UserID      int64
+	WorkspaceID int64
+	Name        string
+	Admin       bool
+}
+
+// PrincipalLookup reports the principal owning credential, or false if
+// there is none.
+type PrincipalLookup func(ctx context.Context, credential string) (Principal, bool, error)
+
+type principalKey struct{}
+
+// WithPrincipal returns a copy of ctx carrying p.
+func WithPrincipal(ctx context.Context, p Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// PrincipalFromContext returns the principal placed on ctx by
+// AuthMiddleware. It reports false when authentication is disabled.
+func PrincipalFromContext(ctx context.Context) (Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(Principal)
+	return p, ok
+}
+
+var sharedSecretPrincipal = Principal{Name: "admin", Admin: true}
+
 type authErr struct {
 	Error string `json:"error"`
 }
 
 func AuthMiddleware(cfg AuthConfig) func(http.Handler) http.Handler {
-	// normalize skip path set
-	skip := make(map[string]struct{}, len(cfg.SkipPaths))
-	for _, p := range cfg.SkipPaths {
-		skip[p] = struct{}{}
-	}
-
 	return func(next http.Handler) http.Handler {
 		if cfg.Mode == AuthNone {
 			return next
 		}
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			if _, ok := skip[r.URL.Path]; ok {
+			if cfg.skips(r.URL.Path) {
 				next.ServeHTTP(w, r)
 				return
 			}
 
+			var (
+				credential, challenge string
+				present               bool
+			)
 			switch cfg.Mode {
 			case AuthAPIKey:
 				// Header: X-API-Key: <key>
-				got := r.Header.Get("X-API-Key")
-				if constantTimeEq(got, cfg.APIKey) {
-					next.ServeHTTP(w, r)
-					return
-				}
-				unauthorized(w, `ApiKey realm="tasks", header="X-API-Key"`)
-				return
+				credential, present = r.Header.Get("X-API-Key"), true
+				challenge = `ApiKey realm="tasks", header="X-API-Key"`
 
 			case AuthBearer:
 				// Header: Authorization: Bearer <token>
-				authz := r.Header.Get("Authorization")
-				if token := strings.TrimPrefix(authz, "Bearer "); token != authz && constantTimeEq(strings.TrimSpace(token), cfg.BearerToken) {
-					next.ServeHTTP(w, r)
-					return
-				}
-				unauthorized(w, `Bearer realm="tasks"`)
-				return
+				credential, present = bearerToken(r.Header.Get("Authorization"))
+				challenge = `Bearer realm="tasks"`
 
 			default:
 				next.ServeHTTP(w, r)
+				return
+			}
+			// browsers cannot set headers on a WebSocket handshake
+			if credential == "" && isWebSocket(r) {
+				if token := r.URL.Query().Get("access_token"); token != "" {
+					credential, present = token, true
+				}
 			}
+			for _, prefix := range cfg.BasicPrefixes {
+				if strings.HasPrefix(r.URL.Path, prefix) {
+					challenge = `Basic realm="tasks"`
+					if _, password, ok := r.BasicAuth(); ok {
+						credential, present = password, true
+					}
+					break
+				}
+			}
+
+			if present {
+				p, ok, err := cfg.authenticate(r.Context(), credential)
+				if err != nil {
+					w.Header().Set("Content-Type", "application/json")
+					w.WriteHeader(http.StatusInternalServerError)
+					_ = json.NewEncoder(w).Encode(authErr{Error: "unexpected_error"})
+					return
+				}
+				if ok {
+					next.ServeHTTP(w, r.WithContext(WithPrincipal(r.Context(), p)))
+					return
+				}
+			}
+			unauthorized(w, challenge)
 		})
 	}
 }
 
+// skips reports whether path, or a gRPC method's full name, is left
+// open by SkipPaths or SkipPrefixes.
+func (cfg AuthConfig) skips(path string) bool {
+	return slices.Contains(cfg.SkipPaths, path) ||
+		slices.ContainsFunc(cfg.SkipPrefixes, func(prefix string) bool { return strings.HasPrefix(path, prefix) })
+}
+
+// authenticate resolves a credential sent in the header of cfg.Mode: the
+// shared secret, or else a per-user credential through Lookup. An empty
+// credential never authenticates, and an empty secret is not set.
+func (cfg AuthConfig) authenticate(ctx context.Context, credential string) (Principal, bool, error) {
+	if credential == "" {
+		return Principal{}, false, nil
+	}
+	secret := cfg.APIKey
+	if cfg.Mode == AuthBearer {
+		secret = cfg.BearerToken
+	}
+	if secret != "" && constantTimeEq(credential, secret) {
+		return sharedSecretPrincipal, true, nil
+	}
+	if cfg.Lookup == nil {
+		return Principal{}, false, nil
+	}
+	return cfg.Lookup(ctx, credential)
+}
+
+// bearerToken returns the token of an Authorization value and whether it
+// has the Bearer scheme.
+func bearerToken(authz string) (string, bool) {
+	token := strings.TrimPrefix(authz, "Bearer ")
+	return strings.TrimSpace(token), token != authz
+}
+
 func constantTimeEq(a, b string) bool {
 	if len(a) != len(b) {
 		return false
@@ -86,3 +183,7 @@ func unauthorized(w http.ResponseWriter, challenge string) {
 	w.WriteHeader(http.StatusUnauthorized)
 	_ = json.NewEncoder(w).Encode(authErr{Error: "unauthorized"})
 }
+
+func isWebSocket(r *http.Request) bool {
+	return strings.EqualFold(r.Header.Get("Upgrade"), "websocket")
+}
@@ -1,6 +1,9 @@
 package middleware_test
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"testing"
@@ -13,11 +16,13 @@ import (
 func TestAuth_APIKey(t *testing.T) {
 	r := chi.NewRouter()
 	r.Use(appmw.AuthMiddleware(appmw.AuthConfig{
-		Mode:      appmw.AuthAPIKey,
-		APIKey:    "secret123",
-		SkipPaths: []string{"/health"},
+		Mode:         appmw.AuthAPIKey,
+		APIKey:       "secret123",
+		SkipPaths:    []string{"/health"},
+		SkipPrefixes: []string{"/ical/"},
 	}))
 	r.Get("/health", func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(200) })
+	r.Get("/ical/{file}", func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(200) })
 	r.Get("/tasks", func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(200) })
 
 	rec := httptest.NewRecorder()
@@ -41,6 +46,13 @@ func TestAuth_APIKey(t *testing.T) {
 	if rec.Code != http.StatusOK {
 		t.Fatalf("skip path should be open, got %d", rec.Code)
 	}
+
+	rec = httptest.NewRecorder()
+	req = httptest.NewRequest("GET", "/ical/feed.ics", nil)
+	r.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("skip prefix should be open, got %d", rec.Code)
+	}
 }
 
 func TestAuth_Bearer(t *testing.T) {
@@ -66,3 +78,163 @@ func TestAuth_Bearer(t *testing.T) {
 		t.Fatalf("expected 200 with bearer, got %d", rec.Code)
 	}
 }
+
+func TestAuth_WebSocketQueryToken(t *testing.T) {
+	r := chi.NewRouter()
+	r.Use(appmw.AuthMiddleware(appmw.AuthConfig{
+		Mode:        appmw.AuthBearer,
+		BearerToken: "tok_abc",
+	}))
+	r.Get("/ws", func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(200) })
+
+	tests := []struct {
+		name    string
+		upgrade bool
+		want    int
+	}{
+		{"websocket handshake", true, http.StatusOK},
+		{"plain request", false, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			req := httptest.NewRequest("GET", "/ws?access_token=tok_abc", nil)
+			if tt.upgrade {
+				req.Header.Set("Upgrade", "websocket")
+			}
+			r.ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Fatalf("expected %d, got %d", tt.want, rec.Code)
+			}
+		})
+	}
+}
+
+func TestAuth_Basic(t *testing.T) {
+	r := chi.NewRouter()
+	r.Use(appmw.AuthMiddleware(appmw.AuthConfig{
+		Mode:          appmw.AuthBearer,
+		BearerToken:   "tok_abc",
+		BasicPrefixes: []string{"/caldav/"},
+	}))
+	r.Get("/caldav/", func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(200) })
+	r.Get("/tasks", func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(200) })
+
+	tests := []struct {
+		path, password string
+		wantCode       int
+		wantChallenge  string
+	}{
+		{"/caldav/", "tok_abc", http.StatusOK, ""},
+		{"/caldav/", "wrong", http.StatusUnauthorized, `Basic realm="tasks"`},
+		{"/tasks", "tok_abc", http.StatusUnauthorized, `Bearer realm="tasks"`},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", tt.path, nil)
+		req.SetBasicAuth("alice", tt.password)
+		r.ServeHTTP(rec, req)
+		if rec.Code != tt.wantCode || rec.Header().Get("WWW-Authenticate") != tt.wantChallenge {
+			t.Fatalf("%s with %s: expected %d %q, got %d %q", tt.path, tt.password, tt.wantCode, tt.wantChallenge, rec.Code, rec.Header().Get("WWW-Authenticate"))
+		}
+	}
+
+	// bearer tokens keep working under the prefix
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/caldav/", nil)
+	req.Header.Set("Authorization", "Bearer tok_abc")
+	r.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200 with bearer, got %d", rec.Code)
+	}
+}
+
+func TestAuth_LookupPrincipal(t *testing.T) {
+	lookup := func(_ context.Context, credential string) (appmw.Principal, bool, error) {
+		switch credential {
+		case "tsk_alice":
+			return appmw.Principal{UserID: 7, Name: "alice"}, true, nil
+		case "tsk_broken":
+			return appmw.Principal{}, false, errors.New("db down")
+		}
+		return appmw.Principal{}, false, nil
+	}
+	r := chi.NewRouter()
+	r.Use(appmw.AuthMiddleware(appmw.AuthConfig{
+		Mode:        appmw.AuthBearer,
+		BearerToken: "tok_abc",
+		Lookup:      lookup,
+	}))
+	r.Get("/me", func(w http.ResponseWriter, r *http.Request) {
+		p, ok := appmw.PrincipalFromContext(r.Context())
+		if !ok {
+			w.WriteHeader(http.StatusTeapot)
+			return
+		}
+		_, _ = fmt.Fprintf(w, "%d:%s:%t", p.UserID, p.Name, p.Admin)
+	})
+
+	tests := []struct {
+		token    string
+		wantCode int
+		wantBody string
+	}{
+		{"tok_abc", http.StatusOK, "0:admin:true"},
+		{"tsk_alice", http.StatusOK, "7:alice:false"},
+		{"tsk_nobody", http.StatusUnauthorized, ""},
+		{"tsk_broken", http.StatusInternalServerError, ""},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/me", nil)
+		req.Header.Set("Authorization", "Bearer "+tt.token)
+		r.ServeHTTP(rec, req)
+		if rec.Code != tt.wantCode {
+			t.Fatalf("%s: expected %d, got %d", tt.token, tt.wantCode, rec.Code)
+		}
+		if tt.wantBody != "" && rec.Body.String() != tt.wantBody {
+			t.Fatalf("%s: expected principal %q, got %q", tt.token, tt.wantBody, rec.Body.String())
+		}
+	}
+}
+
+func TestAuth_UnsetSecret(t *testing.T) {
+	lookup := func(_ context.Context, credential string) (appmw.Principal, bool, error) {
+		if credential == "tsk_alice" {
+			return appmw.Principal{UserID: 7, Name: "alice"}, true, nil
+		}
+		return appmw.Principal{}, false, nil
+	}
+	handler := func(mode appmw.AuthMode) http.Handler {
+		r := chi.NewRouter()
+		r.Use(appmw.AuthMiddleware(appmw.AuthConfig{
+			Mode:          mode,
+			Lookup:        lookup,
+			BasicPrefixes: []string{"/caldav/"},
+		}))
+		r.Get("/*", func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(200) })
+		return r
+	}
+
+	tests := []struct {
+		name     string
+		mode     appmw.AuthMode
+		path     string
+		header   func(*http.Request)
+		wantCode int
+	}{
+		{"empty bearer", appmw.AuthBearer, "/tasks", func(r *http.Request) { r.Header.Set("Authorization", "Bearer ") }, http.StatusUnauthorized},
+		{"no api key", appmw.AuthAPIKey, "/tasks", func(*http.Request) {}, http.StatusUnauthorized},
+		{"empty basic password", appmw.AuthBearer, "/caldav/", func(r *http.Request) { r.SetBasicAuth("alice", "") }, http.StatusUnauthorized},
+		{"user token", appmw.AuthBearer, "/tasks", func(r *http.Request) { r.Header.Set("Authorization", "Bearer tsk_alice") }, http.StatusOK},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", tt.path, nil)
+		tt.header(req)
+		handler(tt.mode).ServeHTTP(rec, req)
+		if rec.Code != tt.wantCode {
+			t.Fatalf("%s: expected %d, got %d", tt.name, tt.wantCode, rec.Code)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package middleware
+
+import (
+	"context"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// GRPCAuthInterceptors authenticate gRPC calls like AuthMiddleware does
+// requests. The credential is the x-api-key or authorization metadata,
+// depending on cfg.Mode, and SkipPaths and SkipPrefixes match full method
+// names such as "/grpc.health.v1.Health/Check". BasicPrefixes do not
+// apply.
+func GRPCAuthInterceptors(cfg AuthConfig) (grpc.UnaryServerInterceptor, grpc.StreamServerInterceptor) {
+	auth := func(ctx context.Context, method string) (context.Context, error) {
+		if cfg.Mode == AuthNone || cfg.skips(method) {
+			return ctx, nil
+		}
+		md, _ := metadata.FromIncomingContext(ctx)
+		first := func(key string) string {
+			if vs := md.Get(key); len(vs) > 0 {
+				return vs[0]
+			}
+			return ""
+		}
+		var (
+			credential string
+			present    bool
+		)
+		switch cfg.Mode {
+		case AuthAPIKey:
+			credential, present = first("x-api-key"), true
+		case AuthBearer:
+			credential, present = bearerToken(first("authorization"))
+		default:
+			return ctx, nil
+		}
+		if present {
+			p, ok, err := cfg.authenticate(ctx, credential)
+			if err != nil {
+				return nil, status.Error(codes.Internal, "unexpected_error")
+			}
+			if ok {
+				return WithPrincipal(ctx, p), nil
+			}
+		}
+		return nil, status.Error(codes.Unauthenticated, "unauthorized")
+	}
+
+	unary := func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		ctx, err := auth(ctx, info.FullMethod)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+	stream := func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := auth(ss.Context(), info.FullMethod)
+		if err != nil {
+			return err
+		}
+		return handler(srv, &contextStream{ServerStream: ss, ctx: ctx})
+	}
+	return unary, stream
+}
+
+// GRPCTracingInterceptors start a span per call like TracingMiddleware,
+// and send its trace id back in the trace-id header.
+func GRPCTracingInterceptors() (grpc.UnaryServerInterceptor, grpc.StreamServerInterceptor) {
+	tr := otel.Tracer("grpc")
+	trace := func(ctx context.Context, method string, call func(context.Context) error) error {
+		start := time.Now()
+		ctx, span := tr.Start(ctx, method)
+		defer span.End()
+		if sc := span.SpanContext(); sc.IsValid() {
+			_ = grpc.SetHeader(ctx, metadata.Pairs("trace-id", sc.TraceID().String()))
+		}
+
+		err := call(ctx)
+
+		span.SetAttributes(
+			attribute.String("rpc.system", "grpc"),
+			attribute.String("rpc.method", method),
+			attribute.String("rpc.grpc.status_code", status.Code(err).String()),
+			attribute.Int64("rpc.duration_ms", time.Since(start).Milliseconds()),
+		)
+		return err
+	}
+
+	unary := func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		var resp any
+		err := trace(ctx, info.FullMethod, func(ctx context.Context) error {
+			var err error
+			resp, err = handler(ctx, req)
+			return err
+		})
+		return resp, err
+	}
+	stream := func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		return trace(ss.Context(), info.FullMethod, func(ctx context.Context) error {
+			return handler(srv, &contextStream{ServerStream: ss, ctx: ctx})
+		})
+	}
+	return unary, stream
+}
+
+// contextStream replaces the context of a server stream.
+type contextStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *contextStream) Context() context.Context { return s.ctx }
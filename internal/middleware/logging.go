@@ -30,6 +30,21 @@ func (w *statusWriter) Write(b []byte) (int, error) {
 	return n, err
 }
 
+// Unwrap lets http.ResponseController reach the wrapped writer, so
+// streaming handlers can flush through this middleware.
+func (w *statusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// Flush implements http.Flusher for handlers that assert it instead of
+// using http.ResponseController, such as the gRPC gateway's streams.
+func (w *statusWriter) Flush() {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	_ = http.NewResponseController(w.ResponseWriter).Flush()
+}
+
 // RequestLogger logs method, path, status, duration, size, ip, user-agent, and request_id.
 // {"time":"...","level":"INFO","msg":"http_request","req_id":"7b3a...","method":"GET","path":"/tasks","status":200,"duration_ms":1.23,"size":123,"ip":"127.0.0.1:54321","ua":"curl/8.6.0"}
 func RequestLogger(logger *slog.Logger) func(http.Handler) http.Handler {
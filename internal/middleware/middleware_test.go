@@ -6,6 +6,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	chimw "github.com/go-chi/chi/v5/middleware"
@@ -33,3 +34,110 @@ func TestRecoveryMiddleware_Returns500(t *testing.T) {
 		t.Fatalf("expected status 500, got %d (body=%s)", rec.Code, rec.Body.String())
 	}
 }
+
+func TestRequestLogger_Flushes(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(io.Discard, &slog.HandlerOptions{}))
+
+	r := chi.NewRouter()
+	r.Use(appmw.RequestLogger(logger))
+	r.Use(appmw.MetricsMiddleware)
+
+	r.Get("/stream", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "line\n")
+		if err := http.NewResponseController(w).Flush(); err != nil {
+			t.Errorf("flush through middleware: %v", err)
+		}
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/stream", nil)
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+
+	if !rec.Flushed {
+		t.Fatalf("expected the response to be flushed")
+	}
+}
+
+func TestRequestLogger_IsFlusher(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(io.Discard, &slog.HandlerOptions{}))
+
+	r := chi.NewRouter()
+	r.Use(appmw.RequestLogger(logger))
+	r.Use(appmw.TracingMiddleware)
+	r.Use(appmw.MetricsMiddleware)
+
+	r.Get("/stream", func(w http.ResponseWriter, r *http.Request) {
+		f, ok := w.(http.Flusher)
+		if !ok {
+			t.Fatalf("expected the writer to implement http.Flusher")
+		}
+		_, _ = io.WriteString(w, "line\n")
+		f.Flush()
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/stream", nil)
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+
+	if !rec.Flushed {
+		t.Fatalf("expected the response to be flushed")
+	}
+}
+
+func TestTimeout_SkipsStreams(t *testing.T) {
+	r := chi.NewRouter()
+	r.Use(appmw.Timeout(time.Millisecond,
+		appmw.StreamRoute{Path: "/tasks/events"},
+		appmw.StreamRoute{Path: "/ws"},
+		appmw.StreamRoute{Path: "/watch/*"},
+		appmw.StreamRoute{Method: http.MethodGet, Path: "/tasks", Accept: "application/x-ndjson"},
+	))
+	r.Post("/*", func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(20 * time.Millisecond)
+		if r.Context().Err() != nil {
+			w.WriteHeader(http.StatusGatewayTimeout)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+	r.Get("/*", func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(20 * time.Millisecond)
+		if r.Context().Err() != nil {
+			w.WriteHeader(http.StatusGatewayTimeout)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		header http.Header
+		want   int
+	}{
+		{"plain request", http.MethodGet, "/tasks", nil, http.StatusGatewayTimeout},
+		{"event stream", http.MethodGet, "/tasks/events", http.Header{"Accept": {"text/event-stream"}}, http.StatusOK},
+		{"ndjson stream", http.MethodGet, "/tasks", http.Header{"Accept": {"application/x-ndjson"}}, http.StatusOK},
+		{"websocket", http.MethodGet, "/ws", http.Header{"Upgrade": {"websocket"}}, http.StatusOK},
+		{"stream path pattern", http.MethodGet, "/watch/7", nil, http.StatusOK},
+		// headers do not lift the timeout off other routes
+		{"event stream header elsewhere", http.MethodGet, "/stats", http.Header{"Accept": {"text/event-stream"}}, http.StatusGatewayTimeout},
+		{"ndjson header elsewhere", http.MethodPost, "/import", http.Header{"Accept": {"application/x-ndjson"}}, http.StatusGatewayTimeout},
+		{"ndjson header on another method", http.MethodPost, "/tasks", http.Header{"Accept": {"application/x-ndjson"}}, http.StatusGatewayTimeout},
+		{"websocket header elsewhere", http.MethodGet, "/tasks", http.Header{"Upgrade": {"websocket"}}, http.StatusGatewayTimeout},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			for k, v := range tt.header {
+				req.Header[k] = v
+			}
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Fatalf("expected %d, got %d", tt.want, rec.Code)
+			}
+		})
+	}
+}
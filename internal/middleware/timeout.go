@@ -0,0 +1,48 @@
+package middleware
+
+import (
+	"net/http"
+	"path"
+	"slices"
+	"strings"
+	"time"
+
+	chimw "github.com/go-chi/chi/v5/middleware"
+)
+
+// StreamRoute is a route whose requests stay open for as long as the
+// client does. Path is a path.Match pattern; Method and Accept, if set,
+// limit the route to requests of that method and to those accepting that
+// media type, for routes that only stream when the client asks for it.
+type StreamRoute struct {
+	Method string
+	Path   string
+	Accept string
+}
+
+func (s StreamRoute) matches(r *http.Request) bool {
+	if ok, _ := path.Match(s.Path, r.URL.Path); !ok {
+		return false
+	}
+	if s.Method != "" && r.Method != s.Method {
+		return false
+	}
+	return s.Accept == "" || strings.Contains(r.Header.Get("Accept"), s.Accept)
+}
+
+// Timeout cancels the context of a request after d like chi's Timeout,
+// except for requests to one of streams. Headers alone never lift the
+// timeout: an event stream or WebSocket is only exempt on its own route.
+func Timeout(d time.Duration, streams ...StreamRoute) func(http.Handler) http.Handler {
+	timeout := chimw.Timeout(d)
+	return func(next http.Handler) http.Handler {
+		limited := timeout(next)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if slices.ContainsFunc(streams, func(s StreamRoute) bool { return s.matches(r) }) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			limited.ServeHTTP(w, r)
+		})
+	}
+}
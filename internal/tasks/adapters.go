@@ -0,0 +1,284 @@
+package tasks
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// foreignExport is what an adapter reads from another service's export:
+// the projects to import into, the tasks and whatever had no place in
+// them.
+type foreignExport struct {
+	projects []foreignProject
+	tasks    []foreignTask
+	unmapped []unmappedItem
+}
+
+// foreignProject is a Trello board or Todoist project. Its lists or
+// sections become the options of the enum field named group.
+type foreignProject struct {
+	name   string
+	group  string
+	groups []string
+}
+
+// fields are the custom fields a new project gets.
+func (p foreignProject) fields() []FieldDef {
+	if len(p.groups) == 0 {
+		return nil
+	}
+	return []FieldDef{{Name: p.group, Type: FieldEnum, Options: p.groups}}
+}
+
+// foreignTask is a Trello card or Todoist item. project indexes
+// foreignExport.projects and parent, if set, an earlier task.
+type foreignTask struct {
+	source    string // kind and id in the export, e.g. card:5f1a
+	uid       string // stored as ical_uid, so a second import finds it
+	title     string
+	done      bool
+	project   int
+	group     string
+	parent    *int
+	tags      []string
+	checklist []ChecklistItem
+	dueAt     *time.Time
+	priority  int
+}
+
+// unmappedItem is part of a foreign export the import left out or cut.
+type unmappedItem struct {
+	Source string `json:"source"`
+	Title  string `json:"title,omitempty"`
+	Reason string `json:"reason"`
+}
+
+// importProject reports the project a foreign project was imported into.
+type importProject struct {
+	Name   string `json:"name"`
+	ID     int64  `json:"id,omitempty"`
+	Action string `json:"action"` // created or existing
+}
+
+// skip notes that source was left out.
+func (e *foreignExport) skip(source, title, reason string) {
+	e.unmapped = append(e.unmapped, unmappedItem{Source: source, Title: title, Reason: reason})
+}
+
+// add appends t, cutting what exceeds the limits POST /tasks enforces.
+// It returns the index of t.
+func (e *foreignExport) add(t foreignTask) int {
+	if len(t.title) > maxTitleLen {
+		e.skip(t.source, t.title, fmt.Sprintf("title shortened to %d characters", maxTitleLen))
+		t.title = shorten(t.title, maxTitleLen)
+	}
+	if strings.TrimSpace(t.title) == "" {
+		t.title = "(untitled)"
+	}
+	var tags []string
+	for _, tag := range t.tags {
+		if tag = foreignTag(tag); tag != "" && !slices.Contains(tags, tag) {
+			tags = append(tags, tag)
+		}
+	}
+	if len(tags) > maxTags {
+		e.skip(t.source, t.title, fmt.Sprintf("%d tags left out, at most %d are allowed", len(tags)-maxTags, maxTags))
+		tags = tags[:maxTags]
+	}
+	t.tags = tags
+	if len(t.checklist) > maxChecklistItems {
+		e.skip(t.source, t.title, fmt.Sprintf("%d checklist items left out, at most %d are allowed", len(t.checklist)-maxChecklistItems, maxChecklistItems))
+		t.checklist = t.checklist[:maxChecklistItems]
+	}
+	for i, it := range t.checklist {
+		if len(it.Text) > maxChecklistTextLen {
+			e.skip(t.source, t.title, fmt.Sprintf("checklist item shortened to %d characters", maxChecklistTextLen))
+			t.checklist[i].Text = shorten(it.Text, maxChecklistTextLen)
+		}
+		if strings.TrimSpace(it.Text) == "" {
+			t.checklist[i].Text = "(empty)"
+		}
+	}
+	e.tasks = append(e.tasks, t)
+	return len(e.tasks) - 1
+}
+
+// project returns the index of the project named name, adding it first if
+// needed.
+func (e *foreignExport) project(name, group string) int {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		name = "Imported"
+	}
+	name = shorten(name, maxProjectNameLen)
+	if i := slices.IndexFunc(e.projects, func(p foreignProject) bool { return p.name == name }); i >= 0 {
+		return i
+	}
+	e.projects = append(e.projects, foreignProject{name: name, group: group})
+	return len(e.projects) - 1
+}
+
+// addGroup adds a list or section to project i, once.
+func (e *foreignExport) addGroup(i int, group string) {
+	p := &e.projects[i]
+	if group = strings.TrimSpace(group); group != "" && !slices.Contains(p.groups, group) {
+		p.groups = append(p.groups, group)
+	}
+}
+
+// foreignTag turns a label into a tag: lowercase, without commas and with
+// dashes for spaces, cut to the tag length limit.
+func foreignTag(label string) string {
+	label = strings.ToLower(strings.ReplaceAll(label, ",", " "))
+	return shorten(strings.Join(strings.Fields(label), "-"), maxTagLen)
+}
+
+// shorten cuts s to at most n bytes without splitting a character.
+func shorten(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
+
+var errNoUpload = errors.New("no file part")
+
+// readUpload returns the uploaded export: the "file" part of a multipart
+// form, or else the request body itself.
+func readUpload(w http.ResponseWriter, r *http.Request) (io.Reader, error) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportBytes)
+	if mt, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mt != "multipart/form-data" {
+		return r.Body, nil
+	}
+	mr, err := r.MultipartReader()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		part, err := mr.NextPart()
+		if errors.Is(err, io.EOF) {
+			return nil, errNoUpload
+		}
+		if err != nil {
+			return nil, err
+		}
+		if part.FormName() == "file" {
+			return part, nil
+		}
+	}
+}
+
+// importForeign imports another service's JSON export, read by parse.
+// Projects are matched to visible projects by name or created; creating
+// them is not part of the import's transaction, so a failed import leaves
+// them behind for the next attempt to reuse. Tasks are validated and
+// imported like POST /import rows, and their ids in the export become
+// ical_uid so a repeated import conflicts with them.
+func importForeign(repo Repository, parse func(io.Reader) (foreignExport, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		strategy, dryRun, vErrs := parseImportParams(r.URL.Query())
+		if len(vErrs) > 0 {
+			writeValidation(w, vErrs)
+			return
+		}
+		body, err := readUpload(w, r)
+		var exp foreignExport
+		if err == nil {
+			exp, err = parse(body)
+		}
+		var sizeErr *http.MaxBytesError
+		switch {
+		case errors.As(err, &sizeErr):
+			writeJSON(w, http.StatusRequestEntityTooLarge, errResponse{Error: "too_large"})
+			return
+		case errors.Is(err, errNoUpload):
+			writeJSON(w, http.StatusBadRequest, errResponse{Error: "invalid_body"})
+			return
+		case err != nil:
+			writeJSON(w, http.StatusBadRequest, errResponse{Error: "invalid_json"})
+			return
+		}
+
+		ctx := r.Context()
+		s := callerScope(ctx)
+		existing, err := repo.ListProjects(ctx, s)
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, errResponse{Error: "unexpected_error"})
+			return
+		}
+		report := importReport{DryRun: dryRun, Strategy: strategy, Unmapped: exp.unmapped}
+		// ID stays 0 for a project a dry run would create
+		projects := make([]Project, len(exp.projects))
+		for i, fp := range exp.projects {
+			j := slices.IndexFunc(existing, func(p Project) bool { return strings.EqualFold(p.Name, fp.name) })
+			switch {
+			case j >= 0:
+				projects[i] = existing[j]
+				report.Projects = append(report.Projects, importProject{Name: fp.name, ID: existing[j].ID, Action: "existing"})
+			case dryRun:
+				projects[i] = Project{Name: fp.name, Fields: fp.fields()}
+				report.Projects = append(report.Projects, importProject{Name: fp.name, Action: "created"})
+			default:
+				p, err := repo.CreateProject(ctx, s, fp.name, fp.fields())
+				if err != nil {
+					writeJSON(w, http.StatusInternalServerError, errResponse{Error: "unexpected_error"})
+					return
+				}
+				projects[i] = p
+				report.Projects = append(report.Projects, importProject{Name: fp.name, ID: p.ID, Action: "created"})
+			}
+		}
+
+		records := make([]importRecord, 0, len(exp.tasks))
+		sources := make([]string, 0, len(exp.tasks))
+		for _, t := range exp.tasks {
+			v := map[string]any{
+				"title":     t.title,
+				"done":      t.done,
+				"tags":      t.tags,
+				"checklist": t.checklist,
+				"due_at":    t.dueAt,
+				"priority":  t.priority,
+				"ical_uid":  t.uid,
+			}
+			p := projects[t.project]
+			if p.ID != 0 {
+				v["project_id"] = p.ID
+			}
+			if group := exp.projects[t.project].group; t.group != "" && p.ID != 0 {
+				def, ok := findField(p.Fields, group)
+				if ok && (def.Type == FieldText || def.Type == FieldEnum && slices.Contains(def.Options, t.group)) {
+					v["fields"] = map[string]any{group: t.group}
+				} else {
+					report.Unmapped = append(report.Unmapped, unmappedItem{
+						Source: t.source, Title: t.title,
+						Reason: fmt.Sprintf("%s %q: project %s has no %s field with that option", group, t.group, p.Name, group),
+					})
+				}
+			}
+			if t.parent != nil {
+				v["parent_row"] = *t.parent + 1
+			}
+			rec, err := newImportRecord(v)
+			if err != nil {
+				writeJSON(w, http.StatusInternalServerError, errResponse{Error: "unexpected_error"})
+				return
+			}
+			records = append(records, rec)
+			sources = append(sources, t.source)
+		}
+		runImport(w, r, repo, report, records, nil, strategy, sources)
+	}
+}
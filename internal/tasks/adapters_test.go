@@ -0,0 +1,186 @@
+package tasks
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+)
+
+const testTrelloBoard = `{
+	"name": "Website",
+	"labels": [{"id": "l1", "name": "Bug Fix", "color": "red"}, {"id": "l2", "name": "", "color": "green"}],
+	"lists": [
+		{"id": "L2", "name": "Done", "pos": 2},
+		{"id": "L1", "name": "To Do", "pos": 1},
+		{"id": "L3", "name": "Old", "closed": true, "pos": 3}
+	],
+	"cards": [
+		{"id": "c2", "name": "fix footer", "idList": "L2", "pos": 1, "idLabels": ["l1"]},
+		{"id": "c1", "name": "new landing page", "desc": "see doc", "idList": "L1", "pos": 2, "idLabels": ["l1", "l2"],
+		 "due": "2030-05-01T12:00:00.000Z", "idMembers": ["m1"]},
+		{"id": "c3", "name": "typo", "idList": "L1", "pos": 1, "dueComplete": true},
+		{"id": "c4", "name": "archived", "idList": "L1", "pos": 3, "closed": true},
+		{"id": "c5", "name": "in old list", "idList": "L3", "pos": 1}
+	],
+	"checklists": [
+		{"id": "k2", "idCard": "c1", "pos": 2, "checkItems": [{"name": "deploy", "state": "incomplete", "pos": 1}]},
+		{"id": "k1", "idCard": "c1", "pos": 1, "checkItems": [
+			{"name": "copy", "state": "complete", "pos": 2},
+			{"name": "hero image", "state": "incomplete", "pos": 1}
+		]}
+	],
+	"actions": [
+		{"type": "commentCard", "data": {"card": {"id": "c1"}}},
+		{"type": "updateCard", "data": {"card": {"id": "c1"}}}
+	]
+}`
+
+const testTodoistExport = `{
+	"projects": [
+		{"id": "2203306141", "name": "Inbox", "child_order": 0},
+		{"id": 2203306142, "name": "Home", "child_order": 1},
+		{"id": "9", "name": "Old", "is_archived": true}
+	],
+	"sections": [{"id": "s1", "name": "Garden", "project_id": "2203306142", "section_order": 1}],
+	"items": [
+		{"id": "i3", "content": "buy seeds", "project_id": "2203306142", "section_id": "s1", "parent_id": "i2", "child_order": 1, "priority": 1},
+		{"id": "i2", "content": "plant tomatoes", "project_id": "2203306142", "section_id": "s1", "labels": ["Weekend"],
+		 "priority": 4, "due": {"date": "2030-04-01"}, "child_order": 1},
+		{"id": "i1", "content": "call mom", "project_id": "2203306141", "priority": 2, "checked": true, "description": "about easter",
+		 "due": {"date": "2030-03-01T18:00:00", "is_recurring": true, "string": "every sunday 6pm"}, "child_order": 2},
+		{"id": "i4", "content": "gone", "project_id": "2203306141", "is_deleted": true},
+		{"id": "i5", "content": "in archive", "project_id": "9"}
+	],
+	"notes": [{"item_id": "i2"}, {"item_id": "i2"}]
+}`
+
+func listTasksJSON(t *testing.T, r http.Handler) []Task {
+	t.Helper()
+	var list []Task
+	if err := json.Unmarshal(doJSON(t, r, http.MethodGet, "/tasks", "").Body.Bytes(), &list); err != nil {
+		t.Fatalf("failed to parse JSON: %v", err)
+	}
+	return list
+}
+
+func TestImport_Trello(t *testing.T) {
+	forEachRepo(t, func(t *testing.T, repo Repository) {
+		r := newTestServer(repo)
+
+		code, rep := doImport(t, r, "/trello?dry_run=true", "application/json", testTrelloBoard)
+		if code != http.StatusOK || rep.Created != 3 || len(rep.Projects) != 1 || rep.Projects[0].Action != "created" || len(listTitles(t, r)) != 0 {
+			t.Fatalf("dry run: unexpected report %d %+v", code, rep)
+		}
+
+		code, rep = doImport(t, r, "/trello", "application/json", testTrelloBoard)
+		if code != http.StatusOK || rep.Created != 3 || rep.Rows[0].Source != "card:c3" {
+			t.Fatalf("import: unexpected report %d %+v", code, rep)
+		}
+		if len(rep.Unmapped) != 6 {
+			t.Fatalf("expected 6 unmapped items, got %+v", rep.Unmapped)
+		}
+		var p Project
+		if err := json.Unmarshal(doJSON(t, r, http.MethodGet, "/projects/1", "").Body.Bytes(), &p); err != nil {
+			t.Fatalf("failed to parse JSON: %v", err)
+		}
+		if p.Name != "Website" || len(p.Fields) != 1 || !slices.Equal(p.Fields[0].Options, []string{"To Do", "Done"}) {
+			t.Fatalf("unexpected project %+v", p)
+		}
+
+		list := listTasksJSON(t, r)
+		if len(list) != 3 {
+			t.Fatalf("expected 3 tasks, got %+v", list)
+		}
+		typo, landing, footer := list[0], list[1], list[2]
+		if typo.Title != "typo" || !typo.Done || typo.Fields["list"] != "To Do" {
+			t.Fatalf("unexpected task %+v", typo)
+		}
+		wantDue := time.Date(2030, 5, 1, 12, 0, 0, 0, time.UTC)
+		wantChecklist := []ChecklistItem{{Text: "hero image"}, {Text: "copy", Done: true}, {Text: "deploy"}}
+		if landing.Done || !slices.Equal(landing.Tags, []string{"bug-fix", "green"}) || landing.DueAt == nil ||
+			!landing.DueAt.Equal(wantDue) || !slices.Equal(landing.Checklist, wantChecklist) || *landing.ProjectID != p.ID {
+			t.Fatalf("unexpected task %+v", landing)
+		}
+		if footer.Title != "fix footer" || !footer.Done || footer.Fields["list"] != "Done" {
+			t.Fatalf("unexpected task %+v", footer)
+		}
+
+		// a second import finds the project and the cards again
+		code, rep = doImport(t, r, "/trello", "application/json", testTrelloBoard)
+		if code != http.StatusOK || rep.Skipped != 3 || rep.Projects[0].Action != "existing" || rep.Projects[0].ID != p.ID {
+			t.Fatalf("reimport: unexpected report %d %+v", code, rep)
+		}
+	})
+}
+
+func TestImport_TrelloExistingProject(t *testing.T) {
+	r := newTestServer(NewInMemoryRepo())
+	doJSON(t, r, http.MethodPost, "/projects", `{"name":"website"}`)
+
+	// the upload may also come from a form
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	fw, _ := mw.CreateFormFile("file", "board.json")
+	fw.Write([]byte(testTrelloBoard))
+	mw.Close()
+	req := httptest.NewRequest(http.MethodPost, "/import/trello", &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	var rep importReport
+	if err := json.Unmarshal(rec.Body.Bytes(), &rep); err != nil || rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d, body=%s", rec.Code, rec.Body.String())
+	}
+	// the project has no list field to keep the lists in
+	if rep.Created != 3 || rep.Projects[0].Action != "existing" || len(rep.Unmapped) != 9 {
+		t.Fatalf("unexpected report %+v", rep)
+	}
+
+	for _, body := range []string{`{"cards": 1}`, `not json`} {
+		if code, _ := doImport(t, r, "/trello", "application/json", body); code != http.StatusBadRequest {
+			t.Fatalf("%s: expected 400, got %d", body, code)
+		}
+	}
+}
+
+func TestImport_Todoist(t *testing.T) {
+	forEachRepo(t, func(t *testing.T, repo Repository) {
+		r := newTestServer(repo)
+
+		code, rep := doImport(t, r, "/todoist", "application/json", testTodoistExport)
+		if code != http.StatusOK || rep.Created != 3 || len(rep.Projects) != 2 {
+			t.Fatalf("import: unexpected report %d %+v", code, rep)
+		}
+		if len(rep.Unmapped) != 4 {
+			t.Fatalf("expected 4 unmapped items, got %+v", rep.Unmapped)
+		}
+
+		list := listTasksJSON(t, r)
+		if len(list) != 3 {
+			t.Fatalf("expected 3 tasks, got %+v", list)
+		}
+		plant, seeds, mom := list[0], list[1], list[2]
+		wantDue := time.Date(2030, 4, 1, 0, 0, 0, 0, time.UTC)
+		if plant.Title != "plant tomatoes" || plant.Priority != 1 || !slices.Equal(plant.Tags, []string{"weekend"}) ||
+			plant.DueAt == nil || !plant.DueAt.Equal(wantDue) || plant.Fields["section"] != "Garden" {
+			t.Fatalf("unexpected task %+v", plant)
+		}
+		if seeds.ParentID == nil || *seeds.ParentID != plant.ID || seeds.Priority != 0 || *seeds.ProjectID != *plant.ProjectID {
+			t.Fatalf("expected seeds under plant, got %+v", seeds)
+		}
+		wantDue = time.Date(2030, 3, 1, 18, 0, 0, 0, time.UTC)
+		if !mom.Done || mom.Priority != 3 || mom.DueAt == nil || !mom.DueAt.Equal(wantDue) || *mom.ProjectID == *plant.ProjectID {
+			t.Fatalf("unexpected task %+v", mom)
+		}
+
+		code, rep = doImport(t, r, "/todoist?on_conflict=overwrite", "application/json", testTodoistExport)
+		if code != http.StatusOK || rep.Updated != 3 || len(listTitles(t, r)) != 3 {
+			t.Fatalf("reimport: unexpected report %d %+v", code, rep)
+		}
+	})
+}
@@ -0,0 +1,141 @@
+package tasks
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+)
+
+type assignRequest struct {
+	UserID int64 `json:"user_id"`
+}
+
+// assignTask adds an assignee to a task. Assigning someone twice is not an
+// error. Assignees see the task even without a role on its project.
+func assignTask(repo Repository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		id, ok := pathID(r, "id")
+		if !ok {
+			writeJSON(w, http.StatusNotFound, errResponse{Error: "not_found"})
+			return
+		}
+		var req assignRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeJSON(w, http.StatusBadRequest, errResponse{Error: "invalid_json"})
+			return
+		}
+		if !writeTaskWritable(w, r, repo, id) {
+			return
+		}
+		if _, err := repo.GetUser(r.Context(), callerScope(r.Context()), req.UserID); errors.Is(err, ErrNotFound) {
+			writeValidation(w, []fieldError{{Field: "user_id", Message: "user not found"}})
+			return
+		} else if err != nil {
+			writeJSON(w, http.StatusInternalServerError, errResponse{Error: "unexpected_error"})
+			return
+		}
+
+		t, err := repo.Assign(r.Context(), callerScope(r.Context()), id, req.UserID)
+		if errors.Is(err, ErrNotFound) {
+			writeJSON(w, http.StatusNotFound, errResponse{Error: "not_found"})
+			return
+		}
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, errResponse{Error: "unexpected_error"})
+			return
+		}
+		writeJSON(w, http.StatusOK, t)
+	}
+}
+
+// unassignTask removes an assignee. Removing someone who is not assigned
+// is not an error.
+func unassignTask(repo Repository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		id, ok := pathID(r, "id")
+		if !ok {
+			writeJSON(w, http.StatusNotFound, errResponse{Error: "not_found"})
+			return
+		}
+		userID, ok := pathID(r, "user_id")
+		if !ok {
+			writeJSON(w, http.StatusNotFound, errResponse{Error: "not_found"})
+			return
+		}
+		if !writeTaskWritable(w, r, repo, id) {
+			return
+		}
+
+		t, err := repo.Unassign(r.Context(), callerScope(r.Context()), id, userID)
+		if errors.Is(err, ErrNotFound) {
+			writeJSON(w, http.StatusNotFound, errResponse{Error: "not_found"})
+			return
+		}
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, errResponse{Error: "unexpected_error"})
+			return
+		}
+		writeJSON(w, http.StatusOK, t)
+	}
+}
+
+// writeTaskWritable answers the request and returns false unless the caller
+// may change the task.
+func writeTaskWritable(w http.ResponseWriter, r *http.Request, repo Repository, id int64) bool {
+	err := checkTaskWritable(r.Context(), repo, id)
+	switch {
+	case errors.Is(err, ErrNotFound):
+		writeJSON(w, http.StatusNotFound, errResponse{Error: "not_found"})
+	case errors.Is(err, errForbidden):
+		writeJSON(w, http.StatusForbidden, errResponse{Error: "forbidden"})
+	case err != nil:
+		writeJSON(w, http.StatusInternalServerError, errResponse{Error: "unexpected_error"})
+	default:
+		return true
+	}
+	return false
+}
+
+// listMyTasks lists the tasks the caller owns or is assigned to, with the
+// filters and sorting of GET /tasks. The shared secret and disabled
+// authentication have no account and get 404, like GET /me.
+func listMyTasks(repo Repository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		me := callerID(r.Context())
+		if me == nil {
+			writeJSON(w, http.StatusNotFound, errResponse{Error: "not_found"})
+			return
+		}
+		q, vErrs, err := parseListQuery(r, repo, r.URL.Query())
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, errResponse{Error: "unexpected_error"})
+			return
+		}
+		proj, pErrs := parseProjection(r.URL.Query())
+		if vErrs = append(vErrs, pErrs...); len(vErrs) > 0 {
+			writeValidation(w, vErrs)
+			return
+		}
+		q.InvolvedUserID = me
+		q.Select = proj.selection()
+
+		s := callerScope(r.Context())
+		tasks, err := repo.List(r.Context(), s, q)
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, errResponse{Error: "unexpected_error"})
+			return
+		}
+		out, err := proj.render(r.Context(), repo, s, tasks)
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, errResponse{Error: "unexpected_error"})
+			return
+		}
+		writeJSON(w, http.StatusOK, out)
+	}
+}
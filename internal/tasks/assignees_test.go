@@ -0,0 +1,83 @@
+package tasks
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"testing"
+)
+
+func TestAssignees(t *testing.T) {
+	forEachRepo(t, func(t *testing.T, repo Repository) {
+		r := newAuthServer(repo)
+		alice := createTestUser(t, r, "alice", false)
+		bob := createTestUser(t, r, "bob", false)
+		carol := createTestUser(t, r, "carol", false)
+		aliceID, bobID, carolID := testUserID(t, r, alice), testUserID(t, r, bob), testUserID(t, r, carol)
+
+		project := createdID(t, r, alice, "/projects", `{"name":"launch"}`)
+		doAs(t, r, alice, http.MethodPost, fmt.Sprintf("/projects/%d/members", project), fmt.Sprintf(`{"user_id":%d,"role":"viewer"}`, carolID))
+		task := createdID(t, r, alice, "/tasks", fmt.Sprintf(`{"title":"ship","project_id":%d,"assignee_ids":[%d,%d,%d]}`, project, aliceID, aliceID, carolID))
+		createdID(t, r, bob, "/tasks", `{"title":"bob's own"}`)
+		assign := fmt.Sprintf("/tasks/%d/assignees", task)
+		bobBody := fmt.Sprintf(`{"user_id":%d}`, bobID)
+
+		tests := []struct {
+			name     string
+			token    string
+			method   string
+			path     string
+			body     string
+			wantCode int
+			wantIDs  []int64 // assignee_ids of a task, or ids of listed tasks
+		}{
+			{"created with assignees", alice, http.MethodGet, fmt.Sprintf("/tasks/%d", task), "", http.StatusOK, []int64{aliceID, carolID}},
+			{"outsider cannot see task", bob, http.MethodGet, fmt.Sprintf("/tasks/%d", task), "", http.StatusNotFound, nil},
+			{"outsider cannot assign", bob, http.MethodPost, assign, bobBody, http.StatusNotFound, nil},
+			{"viewer cannot assign", carol, http.MethodPost, assign, bobBody, http.StatusForbidden, nil},
+			{"unknown user", alice, http.MethodPost, assign, `{"user_id":999}`, http.StatusUnprocessableEntity, nil},
+			{"owner assigns", alice, http.MethodPost, assign, bobBody, http.StatusOK, []int64{aliceID, bobID, carolID}},
+			{"assigning twice is a no-op", alice, http.MethodPost, assign, bobBody, http.StatusOK, []int64{aliceID, bobID, carolID}},
+			{"assignee sees task", bob, http.MethodGet, fmt.Sprintf("/tasks/%d", task), "", http.StatusOK, []int64{aliceID, bobID, carolID}},
+			{"assignee lists own and assigned", bob, http.MethodGet, "/me/tasks", "", http.StatusOK, []int64{task, task + 1}},
+			{"me/tasks excludes other tasks", alice, http.MethodGet, "/me/tasks", "", http.StatusOK, []int64{task}},
+			{"filter by assignee", alice, http.MethodGet, fmt.Sprintf("/tasks?assignee_id=%d", bobID), "", http.StatusOK, []int64{task}},
+			{"assignee updates task", bob, http.MethodPatch, fmt.Sprintf("/tasks/%d", task), `{"done":true}`, http.StatusOK, []int64{aliceID, bobID, carolID}},
+			{"me/tasks filters", bob, http.MethodGet, "/me/tasks?done=true", "", http.StatusOK, []int64{task}},
+			{"owner unassigns", alice, http.MethodDelete, fmt.Sprintf("%s/%d", assign, bobID), "", http.StatusOK, []int64{aliceID, carolID}},
+			{"unassigning twice is a no-op", alice, http.MethodDelete, fmt.Sprintf("%s/%d", assign, bobID), "", http.StatusOK, []int64{aliceID, carolID}},
+			{"former assignee loses access", bob, http.MethodGet, fmt.Sprintf("/tasks/%d", task), "", http.StatusNotFound, nil},
+			{"shared secret has no tasks of its own", testRootToken, http.MethodGet, "/me/tasks", "", http.StatusNotFound, nil},
+			{"bad assignee filter", alice, http.MethodGet, "/me/tasks?assignee_id=x", "", http.StatusUnprocessableEntity, nil},
+			{"quick-add assigns the handle", alice, http.MethodPost, "/tasks/quick", `{"text":"review @bob"}`, http.StatusCreated, []int64{bobID}},
+			{"quick-added task in me/tasks", bob, http.MethodGet, "/me/tasks", "", http.StatusOK, []int64{task + 1, task + 2}},
+			{"assignee handle assigns", alice, http.MethodPatch, fmt.Sprintf("/tasks/%d", task), `{"assignee":"bob"}`, http.StatusOK, []int64{aliceID, bobID, carolID}},
+		}
+		for _, tt := range tests {
+			rec := doAs(t, r, tt.token, tt.method, tt.path, tt.body)
+			if rec.Code != tt.wantCode {
+				t.Fatalf("%s: expected %d, got %d, body=%s", tt.name, tt.wantCode, rec.Code, rec.Body.String())
+			}
+			if tt.wantIDs == nil {
+				continue
+			}
+			var got []int64
+			var list []Task
+			if err := json.Unmarshal(rec.Body.Bytes(), &list); err == nil {
+				for _, task := range list {
+					got = append(got, task.ID)
+				}
+			} else {
+				var one Task
+				if err := json.Unmarshal(rec.Body.Bytes(), &one); err != nil {
+					t.Fatalf("%s: failed to parse JSON: %v", tt.name, err)
+				}
+				got = one.AssigneeIDs
+			}
+			if !slices.Equal(got, tt.wantIDs) {
+				t.Fatalf("%s: expected %v, got %s", tt.name, tt.wantIDs, rec.Body.String())
+			}
+		}
+	})
+}
@@ -0,0 +1,780 @@
+package tasks
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/s1natex/tasks-api-GO/internal/middleware"
+)
+
+// A minimal CalDAV server (RFC 4791) so calendar and reminder apps can
+// sync tasks both ways. Every project the caller can see is a calendar
+// collection of VTODO resources:
+//
+//	/caldav/                          the caller's principal
+//	/caldav/projects/                 calendar home
+//	/caldav/projects/{id}/            one calendar per project
+//	/caldav/projects/{id}/{uid}.ics   one task, named after its UID
+//
+// Tasks without a project are not published. calendar-query understands
+// the VTODO component filter and a COMPLETED prop-filter; time ranges are
+// not evaluated, so clients get every matching to-do and filter further.
+
+const (
+	nsDAV    = "DAV:"
+	nsCalDAV = "urn:ietf:params:xml:ns:caldav"
+	nsCS     = "http://calendarserver.org/ns/"
+
+	davPrincipal  = "/caldav/"
+	davHome       = "/caldav/projects/"
+	davObjectType = "text/calendar; charset=utf-8; component=vtodo"
+	maxDAVBody    = 1 << 20
+)
+
+func init() {
+	chi.RegisterMethod("PROPFIND")
+	chi.RegisterMethod("REPORT")
+}
+
+func davName(local string) xml.Name    { return xml.Name{Space: nsDAV, Local: local} }
+func calDAVName(local string) xml.Name { return xml.Name{Space: nsCalDAV, Local: local} }
+
+// davProp is one property; Inner is XML, so text must be escaped first.
+type davProp struct {
+	XMLName xml.Name
+	Inner   string `xml:",innerxml"`
+}
+
+type davPropList struct {
+	Props []davProp
+}
+
+type davPropstat struct {
+	Prop   davPropList `xml:"DAV: prop"`
+	Status string      `xml:"DAV: status"`
+}
+
+type davResponse struct {
+	Href     string        `xml:"DAV: href"`
+	Propstat []davPropstat `xml:"DAV: propstat,omitempty"`
+	Status   string        `xml:"DAV: status,omitempty"`
+}
+
+type davMultistatus struct {
+	XMLName   xml.Name      `xml:"DAV: multistatus"`
+	Responses []davResponse `xml:"DAV: response"`
+}
+
+// davNames collects the property names listed in a DAV:prop element.
+type davNames struct {
+	Names []struct {
+		XMLName xml.Name
+	} `xml:",any"`
+}
+
+func (n *davNames) list() []xml.Name {
+	if n == nil {
+		return nil
+	}
+	out := make([]xml.Name, len(n.Names))
+	for i, e := range n.Names {
+		out[i] = e.XMLName
+	}
+	return out
+}
+
+type davPropfindRequest struct {
+	AllProp *struct{} `xml:"DAV: allprop"`
+	Prop    *davNames `xml:"DAV: prop"`
+}
+
+type davCompFilter struct {
+	Name  string          `xml:"name,attr"`
+	Comps []davCompFilter `xml:"urn:ietf:params:xml:ns:caldav comp-filter"`
+	Props []struct {
+		Name         string    `xml:"name,attr"`
+		IsNotDefined *struct{} `xml:"urn:ietf:params:xml:ns:caldav is-not-defined"`
+	} `xml:"urn:ietf:params:xml:ns:caldav prop-filter"`
+}
+
+// davReportRequest is a calendar-query or a calendar-multiget.
+type davReportRequest struct {
+	XMLName xml.Name
+	Prop    *davNames      `xml:"DAV: prop"`
+	Hrefs   []string       `xml:"DAV: href"`
+	Filter  *davCompFilter `xml:"urn:ietf:params:xml:ns:caldav filter>comp-filter"`
+}
+
+// davResource is a response's href and the properties it has.
+type davResource struct {
+	href  string
+	props []davProp
+}
+
+// response reports the wanted properties, or all of them when want is nil;
+// those the resource lacks are listed as 404.
+func (res davResource) response(want []xml.Name) davResponse {
+	out := davResponse{Href: res.href}
+	found, missing := res.props, []davProp(nil)
+	if want != nil {
+		found = nil
+		for _, name := range want {
+			i := slices.IndexFunc(res.props, func(p davProp) bool { return p.XMLName == name })
+			if i >= 0 {
+				found = append(found, res.props[i])
+			} else {
+				missing = append(missing, davProp{XMLName: name})
+			}
+		}
+	}
+	if len(found) > 0 {
+		out.Propstat = append(out.Propstat, davPropstat{Prop: davPropList{found}, Status: davStatus(http.StatusOK)})
+	}
+	if len(missing) > 0 {
+		out.Propstat = append(out.Propstat, davPropstat{Prop: davPropList{missing}, Status: davStatus(http.StatusNotFound)})
+	}
+	return out
+}
+
+func davStatus(code int) string {
+	return fmt.Sprintf("HTTP/1.1 %d %s", code, http.StatusText(code))
+}
+
+func davText(s string) string {
+	var b strings.Builder
+	_ = xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+func davHref(href string) string {
+	return `<href xmlns="DAV:">` + davText(href) + `</href>`
+}
+
+func davCalendarHref(projectID int64) string {
+	return davHome + strconv.FormatInt(projectID, 10) + "/"
+}
+
+// davObjectName is the resource name of t: its UID, escaped, plus .ics.
+func davObjectName(t Task) string {
+	return url.PathEscape(icalUID(t)) + ".ics"
+}
+
+// davObject renders t as a calendar object resource. The rendering is
+// stable, so its hash serves as the ETag.
+func davObject(t Task) (data, etag string) {
+	var b bytes.Buffer
+	enc := newICSEncoder(&b, time.Time{}, false)
+	_ = enc.encode(t) // a bytes.Buffer does not fail
+	_ = enc.end()
+	sum := sha256.Sum256(b.Bytes())
+	return b.String(), `"` + hex.EncodeToString(sum[:8]) + `"`
+}
+
+func principalResource(ctx context.Context) davResource {
+	name := "tasks"
+	if p, ok := middleware.PrincipalFromContext(ctx); ok && p.Name != "" {
+		name = p.Name
+	}
+	return davResource{href: davPrincipal, props: []davProp{
+		{XMLName: davName("resourcetype"), Inner: `<collection xmlns="DAV:"/><principal xmlns="DAV:"/>`},
+		{XMLName: davName("displayname"), Inner: davText(name)},
+		{XMLName: davName("current-user-principal"), Inner: davHref(davPrincipal)},
+		{XMLName: davName("principal-URL"), Inner: davHref(davPrincipal)},
+		{XMLName: calDAVName("calendar-home-set"), Inner: davHref(davHome)},
+	}}
+}
+
+func homeResource() davResource {
+	return davResource{href: davHome, props: []davProp{
+		{XMLName: davName("resourcetype"), Inner: `<collection xmlns="DAV:"/>`},
+		{XMLName: davName("displayname"), Inner: "Projects"},
+		{XMLName: davName("current-user-principal"), Inner: davHref(davPrincipal)},
+	}}
+}
+
+// calendarResource describes project p as a calendar. Its ctag changes
+// whenever any of its tasks does, so clients know when to sync.
+func calendarResource(ctx context.Context, repo Repository, s Scope, p Project) (davResource, error) {
+	h := sha256.New()
+	err := repo.Stream(ctx, s, ListQuery{ProjectID: &p.ID}, func(t Task) error {
+		_, etag := davObject(t)
+		_, err := io.WriteString(h, etag)
+		return err
+	})
+	if err != nil {
+		return davResource{}, err
+	}
+	role, err := repo.ProjectRole(ctx, s, p.ID)
+	if err != nil {
+		return davResource{}, err
+	}
+	privileges := `<privilege xmlns="DAV:"><read/></privilege>`
+	if role.atLeast(RoleEditor) {
+		privileges += `<privilege xmlns="DAV:"><write/></privilege><privilege xmlns="DAV:"><write-content/></privilege>` +
+			`<privilege xmlns="DAV:"><bind/></privilege><privilege xmlns="DAV:"><unbind/></privilege>`
+	}
+	return davResource{href: davCalendarHref(p.ID), props: []davProp{
+		{XMLName: davName("resourcetype"), Inner: `<collection xmlns="DAV:"/><calendar xmlns="` + nsCalDAV + `"/>`},
+		{XMLName: davName("displayname"), Inner: davText(p.Name)},
+		{XMLName: davName("current-user-principal"), Inner: davHref(davPrincipal)},
+		{XMLName: davName("current-user-privilege-set"), Inner: privileges},
+		{XMLName: calDAVName("supported-calendar-component-set"), Inner: `<comp xmlns="` + nsCalDAV + `" name="VTODO"/>`},
+		{XMLName: xml.Name{Space: nsCS, Local: "getctag"}, Inner: hex.EncodeToString(h.Sum(nil)[:8])},
+	}}, nil
+}
+
+// objectResource describes t; withData adds calendar-data, which REPORT
+// returns but PROPFIND does not.
+func objectResource(t Task, withData bool) davResource {
+	data, etag := davObject(t)
+	props := []davProp{
+		{XMLName: davName("resourcetype")},
+		{XMLName: davName("getetag"), Inner: davText(etag)},
+		{XMLName: davName("getcontenttype"), Inner: davObjectType},
+	}
+	if withData {
+		props = append(props, davProp{XMLName: calDAVName("calendar-data"), Inner: davText(data)})
+	}
+	return davResource{href: davCalendarHref(*t.ProjectID) + davObjectName(t), props: props}
+}
+
+func writeMultistatus(w http.ResponseWriter, responses []davResponse) {
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	w.WriteHeader(http.StatusMultiStatus)
+	_, _ = io.WriteString(w, xml.Header)
+	_ = xml.NewEncoder(w).Encode(davMultistatus{Responses: responses})
+}
+
+// davError fails a request on a WebDAV precondition, such as
+// CALDAV:supported-calendar-component.
+func davError(w http.ResponseWriter, status int, precondition xml.Name) {
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	w.WriteHeader(status)
+	_, _ = fmt.Fprintf(w, `%s<error xmlns="DAV:"><%s xmlns="%s"/></error>`, xml.Header, precondition.Local, precondition.Space)
+}
+
+// readDAVBody decodes an XML request body; an empty body leaves v alone.
+func readDAVBody(r *http.Request, v any) error {
+	err := xml.NewDecoder(io.LimitReader(r.Body, maxDAVBody)).Decode(v)
+	if err == io.EOF {
+		return nil
+	}
+	return err
+}
+
+// propfindNames reads a PROPFIND body; nil means all properties.
+func propfindNames(w http.ResponseWriter, r *http.Request) ([]xml.Name, bool) {
+	var req davPropfindRequest
+	if err := readDAVBody(r, &req); err != nil {
+		writeJSON(w, http.StatusBadRequest, errResponse{Error: "invalid_body"})
+		return nil, false
+	}
+	if req.AllProp != nil {
+		return nil, true
+	}
+	return req.Prop.list(), true
+}
+
+// davDepth reads the Depth header; infinity is treated as 1.
+func davDepth(r *http.Request) int {
+	if r.Header.Get("Depth") == "0" {
+		return 0
+	}
+	return 1
+}
+
+// davProject resolves the {project} of the URL to a visible project.
+func davProject(r *http.Request, repo Repository) (Project, error) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "project"), 10, 64)
+	if err != nil {
+		return Project{}, ErrNotFound
+	}
+	return repo.GetProject(r.Context(), callerScope(r.Context()), id)
+}
+
+// davUID is the UID a resource name stands for, the inverse of
+// davObjectName.
+func davUID(name string, escaped bool) (string, bool) {
+	if escaped {
+		var err error
+		if name, err = url.PathUnescape(name); err != nil {
+			return "", false
+		}
+	}
+	uid, ok := strings.CutSuffix(name, ".ics")
+	return uid, ok && uid != ""
+}
+
+// davLookup finds the task with the UID in the project.
+func davLookup(ctx context.Context, repo Repository, s Scope, projectID int64, uid string) (Task, error) {
+	if m := icalOwnUID.FindStringSubmatch(uid); m != nil {
+		id, _ := strconv.ParseInt(m[1], 10, 64)
+		t, err := repo.Get(ctx, s, id)
+		if err == nil && t.ICalUID == "" && t.ProjectID != nil && *t.ProjectID == projectID {
+			return t, nil
+		}
+		if err != nil && !errors.Is(err, ErrNotFound) {
+			return Task{}, err
+		}
+		// a client created the task under a name of this form
+	}
+	ts, err := repo.List(ctx, s, ListQuery{ProjectID: &projectID, ICalUID: uid})
+	if err != nil {
+		return Task{}, err
+	}
+	if len(ts) == 0 {
+		return Task{}, ErrNotFound
+	}
+	return ts[0], nil
+}
+
+// davObjectTask resolves the resource of the URL.
+func davObjectTask(r *http.Request, repo Repository) (Task, error) {
+	p, err := davProject(r, repo)
+	if err != nil {
+		return Task{}, err
+	}
+	uid, ok := davUID(chi.URLParam(r, "name"), r.URL.RawPath != "")
+	if !ok {
+		return Task{}, ErrNotFound
+	}
+	return davLookup(r.Context(), repo, callerScope(r.Context()), p.ID, uid)
+}
+
+// davPreconditions checks If-Match and If-None-Match against the
+// resource's ETag, empty when it does not exist, and answers 412 if they
+// fail.
+func davPreconditions(w http.ResponseWriter, r *http.Request, etag string) bool {
+	matches := func(header string) bool {
+		for _, part := range strings.Split(header, ",") {
+			part = strings.TrimPrefix(strings.TrimSpace(part), "W/")
+			if part == "*" && etag != "" || part == etag && etag != "" {
+				return true
+			}
+		}
+		return false
+	}
+	if h := r.Header.Get("If-Match"); h != "" && !matches(h) {
+		writeJSON(w, http.StatusPreconditionFailed, errResponse{Error: "precondition_failed"})
+		return false
+	}
+	if h := r.Header.Get("If-None-Match"); h != "" && matches(h) {
+		writeJSON(w, http.StatusPreconditionFailed, errResponse{Error: "precondition_failed"})
+		return false
+	}
+	return true
+}
+
+// davWellKnown points clients at the principal (RFC 6764).
+func davWellKnown(w http.ResponseWriter, r *http.Request) {
+	http.Redirect(w, r, davPrincipal, http.StatusMovedPermanently)
+}
+
+func davOptions(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("DAV", "1, 3, calendar-access")
+	w.Header().Set("Allow", "OPTIONS, GET, PUT, DELETE, PROPFIND, REPORT")
+	w.WriteHeader(http.StatusOK)
+}
+
+func propfindPrincipal(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	want, ok := propfindNames(w, r)
+	if !ok {
+		return
+	}
+	writeMultistatus(w, []davResponse{principalResource(r.Context()).response(want)})
+}
+
+// propfindHome lists the calendar home and, at depth 1, every project.
+func propfindHome(repo Repository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		want, ok := propfindNames(w, r)
+		if !ok {
+			return
+		}
+		out := []davResponse{homeResource().response(want)}
+		if davDepth(r) > 0 {
+			ctx := r.Context()
+			s := callerScope(ctx)
+			projects, err := repo.ListProjects(ctx, s)
+			if err != nil {
+				writeJSON(w, http.StatusInternalServerError, errResponse{Error: "unexpected_error"})
+				return
+			}
+			for _, p := range projects {
+				res, err := calendarResource(ctx, repo, s, p)
+				if err != nil {
+					writeJSON(w, http.StatusInternalServerError, errResponse{Error: "unexpected_error"})
+					return
+				}
+				out = append(out, res.response(want))
+			}
+		}
+		writeMultistatus(w, out)
+	}
+}
+
+// propfindCalendar describes a project's calendar and, at depth 1, its
+// tasks.
+func propfindCalendar(repo Repository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		ctx := r.Context()
+		s := callerScope(ctx)
+		p, err := davProject(r, repo)
+		if errors.Is(err, ErrNotFound) {
+			writeJSON(w, http.StatusNotFound, errResponse{Error: "not_found"})
+			return
+		}
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, errResponse{Error: "unexpected_error"})
+			return
+		}
+		want, ok := propfindNames(w, r)
+		if !ok {
+			return
+		}
+		res, err := calendarResource(ctx, repo, s, p)
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, errResponse{Error: "unexpected_error"})
+			return
+		}
+		out := []davResponse{res.response(want)}
+		if davDepth(r) > 0 {
+			err = repo.Stream(ctx, s, ListQuery{ProjectID: &p.ID}, func(t Task) error {
+				out = append(out, objectResource(t, false).response(want))
+				return nil
+			})
+			if err != nil {
+				writeJSON(w, http.StatusInternalServerError, errResponse{Error: "unexpected_error"})
+				return
+			}
+		}
+		writeMultistatus(w, out)
+	}
+}
+
+func propfindObject(repo Repository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		t, err := davObjectTask(r, repo)
+		if errors.Is(err, ErrNotFound) {
+			writeJSON(w, http.StatusNotFound, errResponse{Error: "not_found"})
+			return
+		}
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, errResponse{Error: "unexpected_error"})
+			return
+		}
+		want, ok := propfindNames(w, r)
+		if !ok {
+			return
+		}
+		writeMultistatus(w, []davResponse{objectResource(t, false).response(want)})
+	}
+}
+
+// calendarReport answers calendar-query and calendar-multiget. Without a
+// prop list it returns the ETag and data of each task.
+func calendarReport(repo Repository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		ctx := r.Context()
+		s := callerScope(ctx)
+		p, err := davProject(r, repo)
+		if errors.Is(err, ErrNotFound) {
+			writeJSON(w, http.StatusNotFound, errResponse{Error: "not_found"})
+			return
+		}
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, errResponse{Error: "unexpected_error"})
+			return
+		}
+		var req davReportRequest
+		if err := readDAVBody(r, &req); err != nil {
+			writeJSON(w, http.StatusBadRequest, errResponse{Error: "invalid_body"})
+			return
+		}
+		want := req.Prop.list()
+		if want == nil {
+			want = []xml.Name{davName("getetag"), calDAVName("calendar-data")}
+		}
+
+		out := []davResponse{}
+		switch req.XMLName {
+		case calDAVName("calendar-query"):
+			match, done := calendarQueryFilter(req.Filter)
+			if !match {
+				break
+			}
+			err := repo.Stream(ctx, s, ListQuery{ProjectID: &p.ID, Done: done}, func(t Task) error {
+				out = append(out, objectResource(t, true).response(want))
+				return nil
+			})
+			if err != nil {
+				writeJSON(w, http.StatusInternalServerError, errResponse{Error: "unexpected_error"})
+				return
+			}
+		case calDAVName("calendar-multiget"):
+			for _, href := range req.Hrefs {
+				t, err := davHrefTask(ctx, repo, s, p.ID, href)
+				if errors.Is(err, ErrNotFound) {
+					out = append(out, davResponse{Href: href, Status: davStatus(http.StatusNotFound)})
+					continue
+				}
+				if err != nil {
+					writeJSON(w, http.StatusInternalServerError, errResponse{Error: "unexpected_error"})
+					return
+				}
+				out = append(out, objectResource(t, true).response(want))
+			}
+		default:
+			davError(w, http.StatusForbidden, davName("supported-report"))
+			return
+		}
+		writeMultistatus(w, out)
+	}
+}
+
+// calendarQueryFilter reads a calendar-query filter: whether it can match
+// to-dos at all, and the done state a COMPLETED prop-filter asks for.
+func calendarQueryFilter(f *davCompFilter) (bool, *bool) {
+	if f == nil {
+		return true, nil
+	}
+	if f.Name != "VCALENDAR" {
+		return false, nil
+	}
+	if len(f.Comps) == 0 {
+		return true, nil
+	}
+	for _, c := range f.Comps {
+		if c.Name != "VTODO" {
+			continue
+		}
+		var done *bool
+		for _, p := range c.Props {
+			if p.Name == "COMPLETED" {
+				d := p.IsNotDefined == nil
+				done = &d
+			}
+		}
+		return true, done
+	}
+	return false, nil
+}
+
+// davHrefTask resolves a multiget href, which must name a resource of the
+// project's calendar.
+func davHrefTask(ctx context.Context, repo Repository, s Scope, projectID int64, href string) (Task, error) {
+	u, err := url.Parse(href)
+	if err != nil {
+		return Task{}, ErrNotFound
+	}
+	name, ok := strings.CutPrefix(u.EscapedPath(), davCalendarHref(projectID))
+	if !ok || strings.Contains(name, "/") {
+		return Task{}, ErrNotFound
+	}
+	uid, ok := davUID(name, true)
+	if !ok {
+		return Task{}, ErrNotFound
+	}
+	return davLookup(ctx, repo, s, projectID, uid)
+}
+
+func getCalendarObject(repo Repository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		t, err := davObjectTask(r, repo)
+		if errors.Is(err, ErrNotFound) {
+			writeJSON(w, http.StatusNotFound, errResponse{Error: "not_found"})
+			return
+		}
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, errResponse{Error: "unexpected_error"})
+			return
+		}
+		data, etag := davObject(t)
+		w.Header().Set("Content-Type", davObjectType)
+		w.Header().Set("ETag", etag)
+		_, _ = io.WriteString(w, data)
+	}
+}
+
+// putCalendarObject creates or replaces the task of a resource from a
+// single VTODO, like an ICS import with on_conflict=overwrite. The stored
+// task keeps only what tasks can represent, so no ETag is returned and
+// clients fetch the resource again.
+func putCalendarObject(repo Repository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		ctx := r.Context()
+		s := callerScope(ctx)
+		p, err := davProject(r, repo)
+		if err == nil {
+			err = requireRole(ctx, repo, p.ID, RoleEditor)
+		}
+		switch {
+		case errors.Is(err, ErrNotFound):
+			writeJSON(w, http.StatusNotFound, errResponse{Error: "not_found"})
+			return
+		case errors.Is(err, errForbidden):
+			writeJSON(w, http.StatusForbidden, errResponse{Error: "forbidden"})
+			return
+		case err != nil:
+			writeJSON(w, http.StatusInternalServerError, errResponse{Error: "unexpected_error"})
+			return
+		}
+		uid, ok := davUID(chi.URLParam(r, "name"), r.URL.RawPath != "")
+		if !ok {
+			writeValidation(w, []fieldError{{Field: "name", Message: "resource names must end in .ics"}})
+			return
+		}
+
+		comps, err := parseICS(http.MaxBytesReader(w, r.Body, maxDAVBody))
+		var sizeErr *http.MaxBytesError
+		switch {
+		case errors.As(err, &sizeErr):
+			writeJSON(w, http.StatusRequestEntityTooLarge, errResponse{Error: "too_large"})
+			return
+		case err != nil:
+			writeJSON(w, http.StatusBadRequest, errResponse{Error: "invalid_body"})
+			return
+		case len(comps) != 1 || comps[0].kind != "VTODO":
+			davError(w, http.StatusForbidden, calDAVName("supported-calendar-component"))
+			return
+		}
+		if got, _ := comps[0].get("UID"); icalUnescaper.Replace(got.value) != uid {
+			writeValidation(w, []fieldError{{Field: "UID", Message: "UID must match the resource name"}})
+			return
+		}
+		records, rErrs, err := icalRecords(comps)
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, errResponse{Error: "unexpected_error"})
+			return
+		}
+		if len(rErrs) > 0 {
+			var fErrs []fieldError
+			for _, e := range rErrs {
+				fErrs = append(fErrs, fieldError{Field: e.Field, Message: e.Message})
+			}
+			writeValidation(w, fErrs)
+			return
+		}
+
+		existing, err := davLookup(ctx, repo, s, p.ID, uid)
+		found := err == nil
+		if err != nil && !errors.Is(err, ErrNotFound) {
+			writeJSON(w, http.StatusInternalServerError, errResponse{Error: "unexpected_error"})
+			return
+		}
+		etag := ""
+		if found {
+			_, etag = davObject(existing)
+		}
+		if !davPreconditions(w, r, etag) {
+			return
+		}
+
+		rec := records[0]
+		set := func(key string, v any) { rec[key], _ = json.Marshal(v) }
+		strategy := ImportSkip
+		if found {
+			set("id", existing.ID)
+			delete(rec, "ical_uid")
+			strategy = ImportOverwrite
+		} else {
+			// the resource keeps its name even if it looks like one of ours
+			delete(rec, "id")
+			set("ical_uid", uid)
+			set("project_id", p.ID)
+		}
+		row, fErrs, err := parseImportRecord(r, repo, rec, strategy, callerID(ctx))
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, errResponse{Error: "unexpected_error"})
+			return
+		}
+		if len(fErrs) > 0 {
+			writeValidation(w, fErrs)
+			return
+		}
+		out, err := repo.Import(ctx, s, []ImportRow{row}, strategy, false)
+		switch {
+		case errors.Is(err, ErrNotFound), errors.Is(err, ErrTitleRequired), errors.Is(err, ErrConflict):
+			writeJSON(w, http.StatusConflict, errResponse{Error: "conflict"})
+			return
+		case err != nil:
+			writeJSON(w, http.StatusInternalServerError, errResponse{Error: "unexpected_error"})
+			return
+		}
+		switch out[0].Action {
+		case "created":
+			w.WriteHeader(http.StatusCreated)
+		case "updated":
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			// the UID belongs to a task in another project
+			writeJSON(w, http.StatusConflict, errResponse{Error: "conflict"})
+		}
+	}
+}
+
+// deleteCalendarObject deletes the task of a resource, with its subtasks.
+func deleteCalendarObject(repo Repository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		ctx := r.Context()
+		t, err := davObjectTask(r, repo)
+		if errors.Is(err, ErrNotFound) {
+			writeJSON(w, http.StatusNotFound, errResponse{Error: "not_found"})
+			return
+		}
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, errResponse{Error: "unexpected_error"})
+			return
+		}
+		if _, etag := davObject(t); !davPreconditions(w, r, etag) {
+			return
+		}
+		err = checkTaskWritable(ctx, repo, t.ID)
+		if err == nil {
+			err = repo.Delete(ctx, callerScope(ctx), t.ID)
+		}
+		switch {
+		case errors.Is(err, errForbidden):
+			writeJSON(w, http.StatusForbidden, errResponse{Error: "forbidden"})
+			return
+		case errors.Is(err, ErrNotFound):
+			writeJSON(w, http.StatusNotFound, errResponse{Error: "not_found"})
+			return
+		case err != nil:
+			writeJSON(w, http.StatusInternalServerError, errResponse{Error: "unexpected_error"})
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,231 @@
+package tasks
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func doDAV(t *testing.T, r http.Handler, token, method, path, body string, header map[string]string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer "+token)
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	return rec
+}
+
+// testMultistatus decodes the parts of a 207 response the tests look at.
+type testMultistatus struct {
+	Responses []struct {
+		Href     string `xml:"DAV: href"`
+		Status   string `xml:"DAV: status"`
+		Propstat []struct {
+			Status string `xml:"DAV: status"`
+			Prop   struct {
+				Props []struct {
+					XMLName xml.Name
+					Inner   string `xml:",innerxml"`
+					Text    string `xml:",chardata"`
+				} `xml:",any"`
+			} `xml:"DAV: prop"`
+		} `xml:"DAV: propstat"`
+	} `xml:"DAV: response"`
+}
+
+func parseMultistatus(t *testing.T, rec *httptest.ResponseRecorder) testMultistatus {
+	t.Helper()
+	if rec.Code != http.StatusMultiStatus {
+		t.Fatalf("expected 207, got %d, body=%s", rec.Code, rec.Body.String())
+	}
+	var ms testMultistatus
+	if err := xml.Unmarshal(rec.Body.Bytes(), &ms); err != nil {
+		t.Fatalf("failed to parse XML: %v, body=%s", err, rec.Body.String())
+	}
+	return ms
+}
+
+// prop returns a property found on the response for href: its text, or
+// its XML if it has child elements.
+func (ms testMultistatus) prop(href, local string) (string, bool) {
+	for _, resp := range ms.Responses {
+		if resp.Href != href {
+			continue
+		}
+		for _, ps := range resp.Propstat {
+			if !strings.Contains(ps.Status, " 200 ") {
+				continue
+			}
+			for _, p := range ps.Prop.Props {
+				if p.XMLName.Local == local {
+					if strings.Contains(p.Inner, "<") {
+						return p.Inner, true
+					}
+					return p.Text, true
+				}
+			}
+		}
+	}
+	return "", false
+}
+
+func (ms testMultistatus) hrefs() []string {
+	var out []string
+	for _, resp := range ms.Responses {
+		out = append(out, resp.Href)
+	}
+	return out
+}
+
+const testVTODO = "BEGIN:VCALENDAR\r\nVERSION:2.0\r\nPRODID:-//Example//Reminders//EN\r\n" +
+	"BEGIN:VTODO\r\nUID:%s\r\nSUMMARY:%s\r\nSTATUS:%s\r\nEND:VTODO\r\nEND:VCALENDAR\r\n"
+
+func TestCalDAV(t *testing.T) {
+	forEachRepo(t, func(t *testing.T, repo Repository) {
+		r := newAuthServer(repo)
+		alice := createTestUser(t, r, "alice", false)
+		bob := createTestUser(t, r, "bob", false)
+		project := createdID(t, r, alice, "/projects", `{"name":"Home & garden"}`)
+		doAs(t, r, alice, http.MethodPost, fmt.Sprintf("/projects/%d/members", project), fmt.Sprintf(`{"user_id":%d,"role":"viewer"}`, testUserID(t, r, bob)))
+		createdID(t, r, alice, "/tasks", fmt.Sprintf(`{"title":"mow","project_id":%d,"due_at":"2030-05-01T08:00:00Z"}`, project))
+		createdID(t, r, alice, "/tasks", `{"title":"no project"}`)
+		calendar := fmt.Sprintf("/caldav/projects/%d/", project)
+		mow := calendar + "task-1@tasks-api.ics"
+
+		if rec := doDAV(t, r, alice, http.MethodGet, "/.well-known/caldav", "", nil); rec.Code != http.StatusMovedPermanently || rec.Header().Get("Location") != "/caldav/" {
+			t.Fatalf("well-known: expected a redirect to /caldav/, got %d %q", rec.Code, rec.Header().Get("Location"))
+		}
+		if rec := doDAV(t, r, alice, http.MethodOptions, calendar, "", nil); !strings.Contains(rec.Header().Get("DAV"), "calendar-access") {
+			t.Fatalf("options: expected calendar-access, got %d %q", rec.Code, rec.Header().Get("DAV"))
+		}
+
+		// discovery: principal, home, calendars
+		ms := parseMultistatus(t, doDAV(t, r, alice, "PROPFIND", "/caldav/",
+			`<propfind xmlns="DAV:" xmlns:C="urn:ietf:params:xml:ns:caldav"><prop><current-user-principal/><C:calendar-home-set/><getetag/></prop></propfind>`,
+			map[string]string{"Depth": "0"}))
+		if home, ok := ms.prop("/caldav/", "calendar-home-set"); !ok || !strings.Contains(home, "/caldav/projects/") {
+			t.Fatalf("principal: expected the calendar home, got %+v", ms)
+		}
+		if len(ms.Responses[0].Propstat) != 2 || !strings.Contains(ms.Responses[0].Propstat[1].Status, "404") {
+			t.Fatalf("principal: expected getetag as 404, got %+v", ms)
+		}
+		ms = parseMultistatus(t, doDAV(t, r, alice, "PROPFIND", "/caldav/projects/", "", map[string]string{"Depth": "1"}))
+		if name, ok := ms.prop(calendar, "displayname"); !ok || name != "Home & garden" {
+			t.Fatalf("home: expected the project's calendar, got %+v", ms)
+		}
+		ctag, _ := ms.prop(calendar, "getctag")
+		if privs, _ := ms.prop(calendar, "current-user-privilege-set"); !strings.Contains(privs, "write-content") {
+			t.Fatalf("home: expected alice to have write access, got %q", privs)
+		}
+		ms = parseMultistatus(t, doDAV(t, r, alice, "PROPFIND", calendar, "", map[string]string{"Depth": "1"}))
+		if got := ms.hrefs(); len(got) != 2 || got[1] != mow {
+			t.Fatalf("calendar: expected the project's task, got %v", got)
+		}
+		etag, _ := ms.prop(mow, "getetag")
+
+		// calendar-query and GET return the same object and ETag
+		query := `<C:calendar-query xmlns:D="DAV:" xmlns:C="urn:ietf:params:xml:ns:caldav"><D:prop><D:getetag/><C:calendar-data/></D:prop>` +
+			`<C:filter><C:comp-filter name="VCALENDAR"><C:comp-filter name="VTODO"><C:prop-filter name="COMPLETED"><C:is-not-defined/></C:prop-filter></C:comp-filter></C:comp-filter></C:filter></C:calendar-query>`
+		ms = parseMultistatus(t, doDAV(t, r, alice, "REPORT", calendar, query, map[string]string{"Depth": "1"}))
+		data, _ := ms.prop(mow, "calendar-data")
+		if len(ms.Responses) != 1 || !strings.Contains(data, "SUMMARY:mow") || !strings.Contains(data, "DUE:20300501T080000Z") {
+			t.Fatalf("query: unexpected result %+v", ms)
+		}
+		rec := doDAV(t, r, alice, http.MethodGet, mow, "", nil)
+		if rec.Code != http.StatusOK || rec.Header().Get("ETag") != etag || rec.Body.String() != data {
+			t.Fatalf("get: expected the reported object, got %d %q %q", rec.Code, rec.Header().Get("ETag"), rec.Body.String())
+		}
+
+		// ticking the task off in the client
+		done := strings.Replace(rec.Body.String(), "STATUS:NEEDS-ACTION", "STATUS:COMPLETED", 1)
+		if rec := doDAV(t, r, alice, http.MethodPut, mow, done, map[string]string{"If-Match": `"stale"`}); rec.Code != http.StatusPreconditionFailed {
+			t.Fatalf("put with a stale ETag: expected 412, got %d", rec.Code)
+		}
+		if rec := doDAV(t, r, alice, http.MethodPut, mow, done, map[string]string{"If-Match": etag}); rec.Code != http.StatusNoContent {
+			t.Fatalf("put: expected 204, got %d, body=%s", rec.Code, rec.Body.String())
+		}
+		var got Task
+		if err := json.Unmarshal(doAs(t, r, alice, http.MethodGet, "/tasks/1", "").Body.Bytes(), &got); err != nil {
+			t.Fatalf("failed to parse JSON: %v", err)
+		}
+		if !got.Done || got.DueAt == nil || got.ProjectID == nil || *got.ProjectID != project {
+			t.Fatalf("put: unexpected task %+v", got)
+		}
+		if rec := doDAV(t, r, alice, http.MethodGet, mow, "", nil); rec.Header().Get("ETag") == etag {
+			t.Fatalf("put: expected the ETag to change")
+		}
+		ms = parseMultistatus(t, doDAV(t, r, alice, "REPORT", calendar, query, nil))
+		if len(ms.Responses) != 0 {
+			t.Fatalf("query: expected no open to-dos, got %+v", ms)
+		}
+
+		// creating a to-do in the client
+		milk := calendar + "A1B2%2FC3.ics"
+		body := fmt.Sprintf(testVTODO, "A1B2/C3", "buy milk", "NEEDS-ACTION")
+		if rec := doDAV(t, r, alice, http.MethodPut, milk, body, map[string]string{"If-None-Match": "*"}); rec.Code != http.StatusCreated {
+			t.Fatalf("create: expected 201, got %d, body=%s", rec.Code, rec.Body.String())
+		}
+		if rec := doDAV(t, r, alice, http.MethodPut, milk, body, map[string]string{"If-None-Match": "*"}); rec.Code != http.StatusPreconditionFailed {
+			t.Fatalf("create again: expected 412, got %d", rec.Code)
+		}
+		multiget := `<C:calendar-multiget xmlns:D="DAV:" xmlns:C="urn:ietf:params:xml:ns:caldav"><D:prop><D:getetag/></D:prop>` +
+			`<D:href>` + milk + `</D:href><D:href>` + calendar + `gone.ics</D:href></C:calendar-multiget>`
+		ms = parseMultistatus(t, doDAV(t, r, alice, "REPORT", calendar, multiget, nil))
+		if len(ms.Responses) != 2 || ms.Responses[0].Href != milk || !strings.Contains(ms.Responses[1].Status, "404") {
+			t.Fatalf("multiget: unexpected result %+v", ms)
+		}
+		ms = parseMultistatus(t, doDAV(t, r, alice, "PROPFIND", "/caldav/projects/", "", map[string]string{"Depth": "1"}))
+		if newCtag, _ := ms.prop(calendar, "getctag"); newCtag == ctag {
+			t.Fatalf("expected the ctag to change")
+		}
+
+		for _, tt := range []struct {
+			name, token, method, path, body string
+			wantCode                        int
+		}{
+			{"event", alice, http.MethodPut, calendar + "e.ics", "BEGIN:VCALENDAR\r\nBEGIN:VEVENT\r\nUID:e\r\nSUMMARY:x\r\nEND:VEVENT\r\nEND:VCALENDAR\r\n", http.StatusForbidden},
+			{"uid mismatch", alice, http.MethodPut, calendar + "x.ics", fmt.Sprintf(testVTODO, "y", "x", "NEEDS-ACTION"), http.StatusUnprocessableEntity},
+			{"no title", alice, http.MethodPut, calendar + "x.ics", fmt.Sprintf(testVTODO, "x", "", "NEEDS-ACTION"), http.StatusUnprocessableEntity},
+			{"viewer put", bob, http.MethodPut, calendar + "b.ics", fmt.Sprintf(testVTODO, "b", "x", "NEEDS-ACTION"), http.StatusForbidden},
+			{"viewer delete", bob, http.MethodDelete, milk, "", http.StatusForbidden},
+			{"unknown report", alice, "REPORT", calendar, `<sync-collection xmlns="DAV:"/>`, http.StatusForbidden},
+			{"bad xml", alice, "PROPFIND", calendar, `<propfind`, http.StatusBadRequest},
+			{"no project", alice, http.MethodGet, calendar + "task-2@tasks-api.ics", "", http.StatusNotFound},
+		} {
+			if rec := doDAV(t, r, tt.token, tt.method, tt.path, tt.body, nil); rec.Code != tt.wantCode {
+				t.Fatalf("%s: expected %d, got %d, body=%s", tt.name, tt.wantCode, rec.Code, rec.Body.String())
+			}
+		}
+
+		// deleting in the client
+		if rec := doDAV(t, r, alice, http.MethodDelete, milk, "", nil); rec.Code != http.StatusNoContent {
+			t.Fatalf("delete: expected 204, got %d", rec.Code)
+		}
+		if rec := doDAV(t, r, alice, http.MethodGet, milk, "", nil); rec.Code != http.StatusNotFound {
+			t.Fatalf("delete: expected the resource to be gone, got %d", rec.Code)
+		}
+		if got := listTitlesAs(t, r, alice); len(got) != 2 {
+			t.Fatalf("delete: expected 2 tasks left, got %v", got)
+		}
+	})
+}
+
+func listTitlesAs(t *testing.T, r http.Handler, token string) []string {
+	t.Helper()
+	var list []Task
+	if err := json.Unmarshal(doAs(t, r, token, http.MethodGet, "/tasks", "").Body.Bytes(), &list); err != nil {
+		t.Fatalf("failed to parse JSON: %v", err)
+	}
+	var out []string
+	for _, task := range list {
+		out = append(out, task.Title)
+	}
+	return out
+}
@@ -0,0 +1,296 @@
+package tasks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Types of TaskEvent.
+const (
+	EventCreated = "created"
+	EventUpdated = "updated"
+	EventDeleted = "deleted"
+)
+
+// TaskEvent is a change made through a Repository returned by WithEvents,
+// or recorded in an Outbox. ID numbers it in the event log.
+type TaskEvent struct {
+	ID          int64
+	Type        string
+	Task        Task // after the change; a deleted task as it was
+	WorkspaceID int64
+	At          time.Time
+}
+
+// Broker hands task events to the subscribers in this process. Publishing
+// never blocks: a subscriber that falls more than its buffer behind is
+// dropped and its channel closed, so it can catch up from the event log
+// and resubscribe.
+type Broker struct {
+	mu     sync.Mutex
+	subs   map[chan TaskEvent]struct{}
+	done   chan struct{}
+	closed bool
+}
+
+func NewBroker() *Broker {
+	return &Broker{subs: make(map[chan TaskEvent]struct{}), done: make(chan struct{})}
+}
+
+// Subscribe returns a channel of the events published from now on and a
+// function that ends the subscription. After Close the channel is closed
+// right away.
+func (b *Broker) Subscribe(buffer int) (<-chan TaskEvent, func()) {
+	ch := make(chan TaskEvent, buffer)
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		close(ch)
+		return ch, func() {}
+	}
+	b.subs[ch] = struct{}{}
+	b.mu.Unlock()
+	return ch, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if _, ok := b.subs[ch]; ok {
+			delete(b.subs, ch)
+			close(ch)
+		}
+	}
+}
+
+// Close ends every subscription, so streams can finish before the server
+// shuts down.
+func (b *Broker) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return
+	}
+	b.closed = true
+	close(b.done)
+	for ch := range b.subs {
+		delete(b.subs, ch)
+		close(ch)
+	}
+}
+
+// Done is closed by Close.
+func (b *Broker) Done() <-chan struct{} { return b.done }
+
+func (b *Broker) Publish(e TaskEvent) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for ch := range b.subs {
+		select {
+		case ch <- e:
+		default:
+			delete(b.subs, ch)
+			close(ch)
+		}
+	}
+}
+
+// WithEvents returns repo recording an event in its event log, queueing
+// it for the webhooks subscribed to it and publishing it to b, for every
+// task it creates, changes or deletes.
+// Deleting a task also reports its subtasks. A change whose events cannot
+// be logged is kept, but reported as failed; a repository with an Outbox
+// avoids that by relaying its events with a Relay and WithBroker instead.
+func WithEvents(repo Repository, b *Broker) Repository {
+	return &eventRepo{brokerRepo: brokerRepo{Repository: repo, broker: b}}
+}
+
+// WithBroker returns repo with b as the broker the handlers of live events
+// follow, for a repository whose events reach b some other way, such as
+// through a Relay.
+func WithBroker(repo Repository, b *Broker) Repository {
+	return &brokerRepo{Repository: repo, broker: b}
+}
+
+type brokerRepo struct {
+	Repository
+	broker *Broker
+}
+
+// Broker lets the handlers of live events find the broker behind a
+// Repository.
+func (r *brokerRepo) Broker() *Broker { return r.broker }
+
+type eventRepo struct {
+	brokerRepo
+}
+
+func (r *eventRepo) publish(ctx context.Context, s Scope, typ string, ts ...Task) error {
+	now := time.Now().UTC()
+	events := make([]TaskEvent, len(ts))
+	for i, t := range ts {
+		events[i] = TaskEvent{Type: typ, Task: t, WorkspaceID: s.workspace(), At: now}
+	}
+	// the change is made already, so logging it must not be cut short
+	ctx = context.WithoutCancel(ctx)
+	logged, err := r.Repository.AppendEvents(ctx, events)
+	if err != nil {
+		return fmt.Errorf("log task events: %w", err)
+	}
+	if err := WebhookSink(r.Repository).Publish(ctx, logged); err != nil {
+		return err
+	}
+	return BrokerSink(r.broker).Publish(ctx, logged)
+}
+
+// brokerOf is the broker repo publishes to, or nil if it does not.
+func brokerOf(repo Repository) *Broker {
+	if src, ok := repo.(interface{ Broker() *Broker }); ok {
+		return src.Broker()
+	}
+	return nil
+}
+
+func (r *eventRepo) Create(ctx context.Context, s Scope, in TaskInput) (Task, error) {
+	t, err := r.Repository.Create(ctx, s, in)
+	if err != nil {
+		return t, err
+	}
+	return t, r.publish(ctx, s, EventCreated, t)
+}
+
+func (r *eventRepo) CreateTree(ctx context.Context, s Scope, root TaskTree) ([]Task, error) {
+	ts, err := r.Repository.CreateTree(ctx, s, root)
+	if err != nil {
+		return ts, err
+	}
+	return ts, r.publish(ctx, s, EventCreated, ts...)
+}
+
+func (r *eventRepo) Update(ctx context.Context, s Scope, id int64, p TaskPatch) (Task, error) {
+	t, err := r.Repository.Update(ctx, s, id, p)
+	if err != nil {
+		return t, err
+	}
+	return t, r.publish(ctx, s, EventUpdated, t)
+}
+
+func (r *eventRepo) Assign(ctx context.Context, s Scope, taskID, userID int64) (Task, error) {
+	t, err := r.Repository.Assign(ctx, s, taskID, userID)
+	if err != nil {
+		return t, err
+	}
+	return t, r.publish(ctx, s, EventUpdated, t)
+}
+
+func (r *eventRepo) Unassign(ctx context.Context, s Scope, taskID, userID int64) (Task, error) {
+	t, err := r.Repository.Unassign(ctx, s, taskID, userID)
+	if err != nil {
+		return t, err
+	}
+	return t, r.publish(ctx, s, EventUpdated, t)
+}
+
+// Delete reads the task and its subtasks first, so the events can carry
+// them.
+func (r *eventRepo) Delete(ctx context.Context, s Scope, id int64) error {
+	gone, err := r.subtree(ctx, s, id)
+	if err != nil {
+		return err
+	}
+	if err := r.Repository.Delete(ctx, s, id); err != nil {
+		return err
+	}
+	return r.publish(ctx, s, EventDeleted, gone...)
+}
+
+// subtree reads the task id and its subtasks, parents first.
+func (r *eventRepo) subtree(ctx context.Context, s Scope, id int64) ([]Task, error) {
+	t, err := r.Repository.Get(ctx, s, id)
+	if err != nil {
+		return nil, err
+	}
+	out := []Task{t}
+	for parents := []int64{id}; len(parents) > 0; {
+		subs, err := r.Repository.List(ctx, s, ListQuery{ParentIDs: parents})
+		if err != nil {
+			return nil, err
+		}
+		parents = parents[:0]
+		for _, sub := range subs {
+			out = append(out, sub)
+			parents = append(parents, sub.ID)
+		}
+	}
+	return out, nil
+}
+
+func (r *eventRepo) MergeUpdate(ctx context.Context, s Scope, id int64, p TaskPatch, changedAt time.Time) (Task, []FieldClock, error) {
+	t, stale, err := r.Repository.MergeUpdate(ctx, s, id, p, changedAt)
+	if err != nil || len(stale) == len(patchFields(p)) {
+		return t, stale, err
+	}
+	return t, stale, r.publish(ctx, s, EventUpdated, t)
+}
+
+// MergeDelete reads the task and its subtasks first, like Delete; a task
+// that is gone already, or is kept, is not reported.
+func (r *eventRepo) MergeDelete(ctx context.Context, s Scope, id int64, changedAt time.Time) ([]FieldClock, error) {
+	gone, err := r.subtree(ctx, s, id)
+	if errors.Is(err, ErrNotFound) {
+		return r.Repository.MergeDelete(ctx, s, id, changedAt)
+	}
+	if err != nil {
+		return nil, err
+	}
+	newer, err := r.Repository.MergeDelete(ctx, s, id, changedAt)
+	if err != nil || len(newer) > 0 {
+		return newer, err
+	}
+	return nil, r.publish(ctx, s, EventDeleted, gone...)
+}
+
+// Import reads back the tasks a committed import created or updated.
+func (r *eventRepo) Import(ctx context.Context, s Scope, rows []ImportRow, strategy ImportStrategy, dryRun bool) ([]ImportOutcome, error) {
+	out, err := r.Repository.Import(ctx, s, rows, strategy, dryRun)
+	if err != nil || dryRun {
+		return out, err
+	}
+	for _, o := range out {
+		if o.Action != "created" && o.Action != "updated" {
+			continue
+		}
+		t, err := r.Repository.Get(ctx, s, o.ID)
+		if err != nil {
+			continue
+		}
+		typ := EventUpdated
+		if o.Action == "created" {
+			typ = EventCreated
+		}
+		if err := r.publish(ctx, s, typ, t); err != nil {
+			return out, err
+		}
+	}
+	return out, nil
+}
+
+// eventVisible reports whether s may see the task of e, by the rules of
+// Scope: the same workspace and, for a restricted scope, ownership,
+// assignment or membership of the task's project. It does not read the
+// task again, so it also works for deleted tasks.
+func eventVisible(ctx context.Context, repo Repository, s Scope, e TaskEvent) (bool, error) {
+	switch {
+	case e.WorkspaceID != s.workspace():
+		return false, nil
+	case !s.restricted() || involves(e.Task, s.UserID):
+		return true, nil
+	case e.Task.ProjectID == nil:
+		return false, nil
+	}
+	_, err := repo.ProjectRole(ctx, s, *e.Task.ProjectID)
+	if errors.Is(err, ErrNotFound) {
+		return false, nil
+	}
+	return err == nil, err
+}
@@ -0,0 +1,879 @@
+package tasks
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// EventSourcedRepo is a Repository that keeps every task as a stream of
+// events in SQLite. The current state of a task is the fold of its stream,
+// starting from the latest snapshot. Each change projects the new state
+// into the task tables of SQLiteRepo in the same transaction, so those
+// tables are a read model: Get, List, Stream, Stats and sync read them
+// through the embedded SQLiteRepo, and Rebuild can recreate them from the
+// streams at any time.
+//
+// ApplyMigrations adopts the tasks of a database written by SQLiteRepo as
+// streams of one created event each. Once adopted, tasks must only be
+// changed through EventSourcedRepo.
+type EventSourcedRepo struct {
+	*SQLiteRepo
+	// SnapshotEvery is how many events a stream grows by between
+	// snapshots of its state; zero turns snapshots off.
+	SnapshotEvery int
+}
+
+// defaultSnapshotEvery is SnapshotEvery of NewEventSourcedRepo.
+const defaultSnapshotEvery = 50
+
+// NewEventSourcedRepo opens the database dsn with transactions that take
+// the write lock when they begin, so that commands on a stream wait for
+// each other rather than fail on reads that went stale.
+func NewEventSourcedRepo(dsn string) (*EventSourcedRepo, error) {
+	sep := "?"
+	if strings.Contains(dsn, "?") {
+		sep = "&"
+	}
+	r, err := NewSQLiteRepo(dsn + sep + "_txlock=immediate")
+	if err != nil {
+		return nil, err
+	}
+	return &EventSourcedRepo{SQLiteRepo: r, SnapshotEvery: defaultSnapshotEvery}, nil
+}
+
+// errStreamRace reports that a stream moved on while a command appended to
+// it.
+var errStreamRace = errors.New("task stream changed concurrently")
+
+// streamRetries is how many times a command runs before it gives up on a
+// race for a stream or the database.
+const streamRetries = 3
+
+// retry runs op, a command in a transaction of its own, again while it
+// loses a race for a stream or the database.
+func retry[T any](op func() (T, error)) (T, error) {
+	for attempt := 1; ; attempt++ {
+		v, err := op()
+		if attempt == streamRetries || !(errors.Is(err, errStreamRace) || isBusy(err)) {
+			return v, err
+		}
+	}
+}
+
+// isBusy reports whether err is SQLite's SQLITE_BUSY, which a transaction
+// gets when it cannot take the lock or its reads went stale.
+func isBusy(err error) bool {
+	var se *sqlite.Error
+	return errors.As(err, &se) && se.Code()&0xff == sqlite3.SQLITE_BUSY
+}
+
+// Types of the events in a task stream.
+const (
+	streamCreated    = "created"
+	streamPatched    = "patched"
+	streamAssigned   = "assigned"
+	streamUnassigned = "unassigned"
+	streamDeleted    = "deleted"
+)
+
+// streamEvent is an event of a task stream. Type and At are columns of
+// task_stream_events; the rest is its data.
+type streamEvent struct {
+	Type string    `json:"-"`
+	At   time.Time `json:"-"`
+
+	Task   *Task                `json:"task,omitempty"`   // created
+	Clocks map[string]time.Time `json:"clocks,omitempty"` // created, when adopted
+
+	Patch     *streamPatch `json:"patch,omitempty"`      // patched
+	ChangedAt *time.Time   `json:"changed_at,omitempty"` // patched, if not At
+
+	UserID int64 `json:"user_id,omitempty"` // assigned, unassigned
+}
+
+// streamPatch is TaskPatch as it is stored in a patched event.
+type streamPatch struct {
+	Title      *string          `json:"title,omitempty"`
+	Done       *bool            `json:"done,omitempty"`
+	Tags       *[]string        `json:"tags,omitempty"`
+	Checklist  *[]ChecklistItem `json:"checklist,omitempty"`
+	DueAt      *time.Time       `json:"due_at,omitempty"`
+	ClearDueAt bool             `json:"clear_due_at,omitempty"`
+	Priority   *int             `json:"priority,omitempty"`
+	Assignee   *string          `json:"assignee,omitempty"`
+	AssigneeID int64            `json:"assignee_id,omitempty"`
+}
+
+// taskState is the state of a task stream, as stored in its snapshots.
+type taskState struct {
+	Task    Task                 `json:"task"`
+	Clocks  map[string]time.Time `json:"clocks,omitempty"` // by syncFields
+	Deleted bool                 `json:"deleted,omitempty"`
+}
+
+// apply folds e into the state.
+func (st *taskState) apply(e streamEvent) {
+	switch e.Type {
+	case streamCreated:
+		st.Task = cloneTask(*e.Task)
+		st.Clocks = maps.Clone(e.Clocks)
+	case streamPatched:
+		p := TaskPatch(*e.Patch)
+		st.Task = patched(st.Task, p, e.At)
+		at := e.At
+		if e.ChangedAt != nil {
+			at = *e.ChangedAt
+		}
+		for _, f := range patchFields(p) {
+			if st.Clocks == nil {
+				st.Clocks = make(map[string]time.Time)
+			}
+			st.Clocks[f] = at
+		}
+	case streamAssigned:
+		st.Task.AssigneeIDs = sortedIDs(append(slices.Clone(st.Task.AssigneeIDs), e.UserID))
+	case streamUnassigned:
+		st.Task.AssigneeIDs = slices.DeleteFunc(slices.Clone(st.Task.AssigneeIDs), func(id int64) bool { return id == e.UserID })
+		if len(st.Task.AssigneeIDs) == 0 {
+			st.Task.AssigneeIDs = nil
+		}
+	case streamDeleted:
+		st.Deleted = true
+	}
+}
+
+// taskStream is a task stream as loaded in a transaction.
+type taskStream struct {
+	id          int64
+	workspaceID int64
+	version     int64
+	state       taskState
+}
+
+// loadStream reads the stream of the task id: its latest snapshot and
+// the events after it.
+func loadStream(ctx context.Context, db *sql.Tx, id int64) (*taskStream, error) {
+	st := &taskStream{id: id}
+	err := db.QueryRowContext(ctx, `SELECT workspace_id FROM task_streams WHERE id = ?`, id).Scan(&st.workspaceID)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	var state string
+	err = db.QueryRowContext(ctx, `SELECT version, state FROM task_snapshots WHERE task_id = ?`, id).Scan(&st.version, &state)
+	switch {
+	case err == nil:
+		if err := json.Unmarshal([]byte(state), &st.state); err != nil {
+			return nil, err
+		}
+	case err != sql.ErrNoRows:
+		return nil, err
+	}
+	err = eachRow(ctx, db, `
+		SELECT version, type, data, at FROM task_stream_events
+		WHERE task_id = ? AND version > ?
+		ORDER BY version ASC
+	`, []any{id, st.version}, func(rows *sql.Rows) error {
+		var (
+			e        streamEvent
+			data, at string
+		)
+		if err := rows.Scan(&st.version, &e.Type, &data, &at); err != nil {
+			return err
+		}
+		if err := json.Unmarshal([]byte(data), &e); err != nil {
+			return err
+		}
+		if e.At, err = time.Parse(time.RFC3339Nano, at); err != nil {
+			return err
+		}
+		st.state.apply(e)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return st, nil
+}
+
+// startStream starts the stream of a new task in the scope's workspace
+// with the created event for t, giving t its id unless it has one.
+func (r *EventSourcedRepo) startStream(ctx context.Context, tx *sql.Tx, s Scope, t Task, clocks map[string]time.Time, now time.Time) (Task, error) {
+	var id any
+	if t.ID != 0 {
+		id = t.ID
+	}
+	res, err := tx.ExecContext(ctx, `INSERT INTO task_streams (id, workspace_id) VALUES (?, ?)`, id, s.workspace())
+	if err != nil {
+		return Task{}, err
+	}
+	if t.ID, err = res.LastInsertId(); err != nil {
+		return Task{}, err
+	}
+	st := &taskStream{id: t.ID, workspaceID: s.workspace()}
+	if err := r.appendStream(ctx, tx, st, streamEvent{Type: streamCreated, At: now, Task: &t, Clocks: clocks}); err != nil {
+		return Task{}, err
+	}
+	return t, nil
+}
+
+// appendStream appends events to st, snapshots its state when it grows
+// past a multiple of SnapshotEvery and projects it into the read model.
+// It reports errStreamRace if the stream moved on since st was loaded.
+func (r *EventSourcedRepo) appendStream(ctx context.Context, tx *sql.Tx, st *taskStream, events ...streamEvent) error {
+	from := st.version
+	for _, e := range events {
+		data, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		st.state.apply(e)
+		st.version++
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO task_stream_events (task_id, version, type, data, at) VALUES (?, ?, ?, ?, ?)
+		`, st.id, st.version, e.Type, string(data), e.At.UTC().Format(time.RFC3339Nano)); err != nil {
+			if isUniqueViolation(err) {
+				return errStreamRace
+			}
+			return err
+		}
+	}
+	res, err := tx.ExecContext(ctx, `UPDATE task_streams SET version = ? WHERE id = ? AND version = ?`, st.version, st.id, from)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return errStreamRace
+	}
+	if every := int64(r.SnapshotEvery); every > 0 && st.version/every > from/every {
+		state, err := json.Marshal(st.state)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO task_snapshots (task_id, version, state) VALUES (?, ?, ?)
+			ON CONFLICT (task_id) DO UPDATE SET version = excluded.version, state = excluded.state
+		`, st.id, st.version, string(state)); err != nil {
+			return err
+		}
+	}
+	return projectTask(ctx, tx, st)
+}
+
+// projectTask writes the state of st into the task tables: the tasks row
+// and its tags, checklist, field values and assignees. Field values are
+// kept only while the task's project defines them.
+func projectTask(ctx context.Context, tx *sql.Tx, st *taskStream) error {
+	if st.state.Deleted {
+		// subtasks have deleted events of their own
+		_, err := tx.ExecContext(ctx, `DELETE FROM tasks WHERE id = ?`, st.id)
+		return err
+	}
+	t := st.state.Task
+	// an upsert, as REPLACE would cascade to the subtasks
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO tasks (id, workspace_id, title, done, project_id, parent_id, due_at, priority, assignee, owner_id, created_at, completed_at, ical_uid)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET
+			title = excluded.title, done = excluded.done, project_id = excluded.project_id,
+			parent_id = excluded.parent_id, due_at = excluded.due_at, priority = excluded.priority,
+			assignee = excluded.assignee, owner_id = excluded.owner_id, created_at = excluded.created_at,
+			completed_at = excluded.completed_at, ical_uid = excluded.ical_uid
+	`, st.id, st.workspaceID, t.Title, t.Done, t.ProjectID, t.ParentID, formatTime(t.DueAt), t.Priority, nullString(t.Assignee),
+		t.OwnerID, t.CreatedAt.UTC().Format(time.RFC3339Nano), formatTime(t.CompletedAt), nullString(t.ICalUID)); err != nil {
+		return err
+	}
+	for _, table := range []string{"task_tags", "checklist_items", "task_field_values", "task_assignees"} {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM `+table+` WHERE task_id = ?`, st.id); err != nil {
+			return err
+		}
+	}
+	for _, tag := range t.Tags {
+		if _, err := tx.ExecContext(ctx, `INSERT INTO task_tags (task_id, tag) VALUES (?, ?)`, st.id, tag); err != nil {
+			return err
+		}
+	}
+	for i, it := range t.Checklist {
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO checklist_items (task_id, position, text, done)
+			VALUES (?, ?, ?, ?)
+		`, st.id, i, it.Text, it.Done); err != nil {
+			return err
+		}
+	}
+	if t.ProjectID != nil {
+		// the state keeps values as they were set; they follow the
+		// project's current definitions like SetProjectFields converts them
+		defs, err := queryFieldDefs(ctx, tx, *t.ProjectID)
+		if err != nil {
+			return err
+		}
+		for name, v := range t.Fields {
+			def, ok := findField(defs, name)
+			if ok {
+				v, ok = convertFieldValue(def, v)
+			}
+			if !ok {
+				continue
+			}
+			if _, err := tx.ExecContext(ctx, `
+				INSERT INTO task_field_values (task_id, project_id, name, value) VALUES (?, ?, ?, ?)
+			`, st.id, *t.ProjectID, name, toSQLFieldValue(v)); err != nil {
+				return err
+			}
+		}
+	}
+	for _, uid := range t.AssigneeIDs {
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO task_assignees (task_id, user_id) VALUES (?, ?)
+		`, st.id, uid); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Rebuild recreates the task tables from the task streams.
+func (r *EventSourcedRepo) Rebuild(ctx context.Context) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM tasks`); err != nil {
+		return err
+	}
+	var ids []int64
+	err = eachRow(ctx, tx, `SELECT id FROM task_streams ORDER BY id ASC`, nil, func(rows *sql.Rows) error {
+		var id int64
+		err := rows.Scan(&id)
+		ids = append(ids, id)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	// subtasks start after their parent, so id order projects parents first
+	for _, id := range ids {
+		st, err := loadStream(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+		if st.state.Deleted {
+			continue
+		}
+		if err := projectTask(ctx, tx, st); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// ApplyMigrations brings the schema up to date and starts a stream for
+// each task that has none yet.
+func (r *EventSourcedRepo) ApplyMigrations(ctx context.Context) error {
+	if err := r.SQLiteRepo.ApplyMigrations(ctx); err != nil {
+		return err
+	}
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	type orphan struct{ id, workspaceID int64 }
+	var orphans []orphan
+	err = eachRow(ctx, tx, `
+		SELECT t.id, t.workspace_id FROM tasks t
+		WHERE NOT EXISTS (SELECT 1 FROM task_streams s WHERE s.id = t.id)
+		ORDER BY t.id ASC
+	`, nil, func(rows *sql.Rows) error {
+		var o orphan
+		err := rows.Scan(&o.id, &o.workspaceID)
+		orphans = append(orphans, o)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	now := time.Now().UTC()
+	for _, o := range orphans {
+		s := Scope{WorkspaceID: o.workspaceID}
+		t, err := queryTask(ctx, tx, s, o.id)
+		if err != nil {
+			return err
+		}
+		clocks, err := fieldClocks(ctx, tx, o.id)
+		if err != nil {
+			return err
+		}
+		if _, err := r.startStream(ctx, tx, s, t, clocks, now); err != nil {
+			return err
+		}
+	}
+	// new streams must not reuse the id of a task deleted before adoption;
+	// sqlite_sequence has no key to upsert on, so make sure the row exists
+	// before raising it
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO sqlite_sequence (name, seq)
+		SELECT 'task_streams', 0 WHERE NOT EXISTS (SELECT 1 FROM sqlite_sequence WHERE name = 'task_streams')
+	`); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE sqlite_sequence SET seq = MAX(seq, COALESCE((SELECT seq FROM sqlite_sequence WHERE name = 'tasks'), 0))
+		WHERE name = 'task_streams'
+	`); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Create implements Repository.Create by starting a task stream.
+func (r *EventSourcedRepo) Create(ctx context.Context, s Scope, in TaskInput) (Task, error) {
+	return retry(func() (Task, error) { return r.create(ctx, s, in) })
+}
+
+func (r *EventSourcedRepo) create(ctx context.Context, s Scope, in TaskInput) (Task, error) {
+	if strings.TrimSpace(in.Title) == "" {
+		return Task{}, ErrTitleRequired
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return Task{}, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	now := time.Now().UTC()
+	t, err := r.insert(ctx, tx, s, in, now)
+	if err != nil {
+		return Task{}, err
+	}
+	if err := writeOutbox(ctx, tx, s, EventCreated, now, t); err != nil {
+		return Task{}, err
+	}
+	if err := r.commit(tx); err != nil {
+		return Task{}, err
+	}
+	return t, nil
+}
+
+// insert starts the stream of a task created from in.
+func (r *EventSourcedRepo) insert(ctx context.Context, tx *sql.Tx, s Scope, in TaskInput, now time.Time) (Task, error) {
+	if err := checkTaskRefs(ctx, tx, s, in); err != nil {
+		return Task{}, err
+	}
+	return r.startStream(ctx, tx, s, inputTask(0, in, now), nil, now)
+}
+
+// CreateTree implements Repository.CreateTree in a single transaction.
+func (r *EventSourcedRepo) CreateTree(ctx context.Context, s Scope, root TaskTree) ([]Task, error) {
+	return retry(func() ([]Task, error) { return r.createTree(ctx, s, root) })
+}
+
+func (r *EventSourcedRepo) createTree(ctx context.Context, s Scope, root TaskTree) ([]Task, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	now := time.Now().UTC()
+	var out []Task
+	var create func(n TaskTree, parent *int64) error
+	create = func(n TaskTree, parent *int64) error {
+		if strings.TrimSpace(n.Title) == "" {
+			return ErrTitleRequired
+		}
+		in := n.TaskInput
+		if parent != nil {
+			in.ParentID = parent
+		}
+		t, err := r.insert(ctx, tx, s, in, now)
+		if err != nil {
+			return err
+		}
+		out = append(out, t)
+		for _, c := range n.Subtasks {
+			if err := create(c, &t.ID); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := create(root, nil); err != nil {
+		return nil, err
+	}
+	if err := writeOutbox(ctx, tx, s, EventCreated, now, out...); err != nil {
+		return nil, err
+	}
+	if err := r.commit(tx); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// target loads the stream of the task id in scope, or reports
+// ErrNotFound.
+func target(ctx context.Context, tx *sql.Tx, s Scope, id int64) (*taskStream, error) {
+	where := taskWhere(s, id)
+	if err := tx.QueryRowContext(ctx, `SELECT t.id FROM tasks t WHERE `+where.sql, where.args...).Scan(new(int64)); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return loadStream(ctx, tx, id)
+}
+
+// patchEvent is the patched event for p at now, with the attributes it
+// sets changed at changedAt.
+func patchEvent(p TaskPatch, now time.Time, changedAt *time.Time) streamEvent {
+	sp := streamPatch(p)
+	return streamEvent{Type: streamPatched, At: now, Patch: &sp, ChangedAt: changedAt}
+}
+
+// Update implements Repository.Update by appending a patched event.
+func (r *EventSourcedRepo) Update(ctx context.Context, s Scope, id int64, p TaskPatch) (Task, error) {
+	return retry(func() (Task, error) { return r.update(ctx, s, id, p) })
+}
+
+func (r *EventSourcedRepo) update(ctx context.Context, s Scope, id int64, p TaskPatch) (Task, error) {
+	if p.Title != nil && strings.TrimSpace(*p.Title) == "" {
+		return Task{}, ErrTitleRequired
+	}
+	now := time.Now().UTC()
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return Task{}, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	st, err := target(ctx, tx, s, id)
+	if err != nil {
+		return Task{}, err
+	}
+	if err := r.appendStream(ctx, tx, st, patchEvent(p, now, nil)); err != nil {
+		return Task{}, err
+	}
+	// as the workspace sees it, even if the change hid it from the caller
+	t, err := queryTask(ctx, tx, Scope{WorkspaceID: s.WorkspaceID}, id)
+	if err != nil {
+		return Task{}, err
+	}
+	if err := writeOutbox(ctx, tx, s, EventUpdated, now, t); err != nil {
+		return Task{}, err
+	}
+	if err := r.commit(tx); err != nil {
+		return Task{}, err
+	}
+	return t, nil
+}
+
+// Delete implements Repository.Delete by appending a deleted event to the
+// streams of the task and its subtasks.
+func (r *EventSourcedRepo) Delete(ctx context.Context, s Scope, id int64) error {
+	_, err := retry(func() (struct{}, error) { return struct{}{}, r.delete(ctx, s, id) })
+	return err
+}
+
+func (r *EventSourcedRepo) delete(ctx context.Context, s Scope, id int64) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if _, err := target(ctx, tx, s, id); err != nil {
+		return err
+	}
+	if err := r.remove(ctx, tx, s, id); err != nil {
+		return err
+	}
+	return r.commit(tx)
+}
+
+// remove ends the streams of the task id and its subtasks and writes
+// their events to the outbox.
+func (r *EventSourcedRepo) remove(ctx context.Context, tx *sql.Tx, s Scope, id int64) error {
+	gone, err := querySubtree(ctx, tx, id)
+	if err != nil {
+		return err
+	}
+	now := time.Now().UTC()
+	for _, t := range gone {
+		st, err := loadStream(ctx, tx, t.ID)
+		if err != nil {
+			return err
+		}
+		if err := r.appendStream(ctx, tx, st, streamEvent{Type: streamDeleted, At: now}); err != nil {
+			return err
+		}
+	}
+	return writeOutbox(ctx, tx, s, EventDeleted, now, gone...)
+}
+
+// Assign implements Repository.Assign
+func (r *EventSourcedRepo) Assign(ctx context.Context, s Scope, taskID, userID int64) (Task, error) {
+	return retry(func() (Task, error) { return r.assign(ctx, s, taskID, userID, true) })
+}
+
+// Unassign implements Repository.Unassign
+func (r *EventSourcedRepo) Unassign(ctx context.Context, s Scope, taskID, userID int64) (Task, error) {
+	return retry(func() (Task, error) { return r.assign(ctx, s, taskID, userID, false) })
+}
+
+// assign appends an assigned or unassigned event unless the user already
+// is or is not assigned to the task.
+func (r *EventSourcedRepo) assign(ctx context.Context, s Scope, taskID, userID int64, assigned bool) (Task, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return Task{}, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	st, err := target(ctx, tx, s, taskID)
+	if err != nil {
+		return Task{}, err
+	}
+	if err := tx.QueryRowContext(ctx, `SELECT id FROM users WHERE id = ? AND workspace_id = ?`, userID, s.workspace()).Scan(new(int64)); err != nil {
+		if err == sql.ErrNoRows {
+			return Task{}, ErrNotFound
+		}
+		return Task{}, err
+	}
+	now := time.Now().UTC()
+	if slices.Contains(st.state.Task.AssigneeIDs, userID) != assigned {
+		typ := streamUnassigned
+		if assigned {
+			typ = streamAssigned
+		}
+		if err := r.appendStream(ctx, tx, st, streamEvent{Type: typ, At: now, UserID: userID}); err != nil {
+			return Task{}, err
+		}
+	}
+	// as the workspace sees it, even if the change hid it from the caller
+	t, err := queryTask(ctx, tx, Scope{WorkspaceID: s.WorkspaceID}, taskID)
+	if err != nil {
+		return Task{}, err
+	}
+	if err := writeOutbox(ctx, tx, s, EventUpdated, now, t); err != nil {
+		return Task{}, err
+	}
+	if err := r.commit(tx); err != nil {
+		return Task{}, err
+	}
+	return t, nil
+}
+
+// Import implements Repository.Import in a single transaction; a dry run
+// rolls it back.
+func (r *EventSourcedRepo) Import(ctx context.Context, s Scope, rows []ImportRow, strategy ImportStrategy, dryRun bool) ([]ImportOutcome, error) {
+	return retry(func() ([]ImportOutcome, error) { return r.importRows(ctx, s, rows, strategy, dryRun) })
+}
+
+func (r *EventSourcedRepo) importRows(ctx context.Context, s Scope, rows []ImportRow, strategy ImportStrategy, dryRun bool) ([]ImportOutcome, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	now := time.Now().UTC()
+	out := make([]ImportOutcome, len(rows))
+	for i, row := range rows {
+		id, found, err := importConflict(ctx, tx, s, row)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case found && strategy == ImportSkip:
+			out[i] = ImportOutcome{Action: "skipped", ID: id}
+			continue
+		case found && strategy == ImportOverwrite:
+			st, err := loadStream(ctx, tx, id)
+			if err != nil {
+				return nil, err
+			}
+			if err := r.appendStream(ctx, tx, st, patchEvent(row.Patch, now, nil)); err != nil {
+				return nil, err
+			}
+			out[i] = ImportOutcome{Action: "updated", ID: id}
+			continue
+		case found:
+			// a duplicate cannot share the calendar UID
+			row.Input.ICalUID = ""
+		}
+
+		if row.Input.Title == "" {
+			return nil, ErrTitleRequired
+		}
+		if p := row.ParentRow; p != nil {
+			if *p < 0 || *p >= i {
+				return nil, ErrNotFound
+			}
+			parent := out[*p].ID
+			row.Input.ParentID = &parent
+		}
+		t, err := r.insert(ctx, tx, s, row.Input, now)
+		if isUniqueViolation(err) {
+			// the UID belongs to a task the scope cannot see
+			return nil, ErrConflict
+		}
+		if err != nil {
+			return nil, err
+		}
+		if row.Done {
+			st, err := loadStream(ctx, tx, t.ID)
+			if err != nil {
+				return nil, err
+			}
+			if err := r.appendStream(ctx, tx, st, patchEvent(TaskPatch{Done: &row.Done}, now, nil)); err != nil {
+				return nil, err
+			}
+		}
+		out[i] = ImportOutcome{Action: "created", ID: t.ID}
+	}
+
+	if dryRun {
+		for i := range out {
+			if out[i].Action == "created" {
+				out[i].ID = 0
+			}
+		}
+		return out, nil
+	}
+	for _, o := range out {
+		typ := EventUpdated
+		switch o.Action {
+		case "created":
+			typ = EventCreated
+		case "updated":
+		default:
+			continue
+		}
+		t, err := queryTask(ctx, tx, Scope{WorkspaceID: s.WorkspaceID}, o.ID)
+		if err != nil {
+			return nil, err
+		}
+		if err := writeOutbox(ctx, tx, s, typ, now, t); err != nil {
+			return nil, err
+		}
+	}
+	if err := r.commit(tx); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// MergeUpdate implements Repository.MergeUpdate against the field clocks
+// of the task stream.
+func (r *EventSourcedRepo) MergeUpdate(ctx context.Context, s Scope, id int64, p TaskPatch, changedAt time.Time) (Task, []FieldClock, error) {
+	var stale []FieldClock
+	t, err := retry(func() (t Task, err error) {
+		t, stale, err = r.mergeUpdate(ctx, s, id, p, changedAt)
+		return t, err
+	})
+	return t, stale, err
+}
+
+func (r *EventSourcedRepo) mergeUpdate(ctx context.Context, s Scope, id int64, p TaskPatch, changedAt time.Time) (Task, []FieldClock, error) {
+	if p.Title != nil && strings.TrimSpace(*p.Title) == "" {
+		return Task{}, nil, ErrTitleRequired
+	}
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return Task{}, nil, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	st, err := mergeStream(ctx, tx, s, id)
+	if err != nil {
+		return Task{}, nil, err
+	}
+	stale := clocksAfter(st.state.Clocks, patchFields(p), changedAt)
+	p = withoutFields(p, stale)
+	if len(patchFields(p)) == 0 {
+		t, err := queryTask(ctx, tx, s, id)
+		return t, stale, err
+	}
+
+	now := time.Now().UTC()
+	changedAt = changedAt.UTC()
+	if err := r.appendStream(ctx, tx, st, patchEvent(p, now, &changedAt)); err != nil {
+		return Task{}, nil, err
+	}
+	// as the workspace sees it, even if the change hid it from the caller
+	t, err := queryTask(ctx, tx, Scope{WorkspaceID: s.WorkspaceID}, id)
+	if err != nil {
+		return Task{}, nil, err
+	}
+	if err := writeOutbox(ctx, tx, s, EventUpdated, now, t); err != nil {
+		return Task{}, nil, err
+	}
+	if err := r.commit(tx); err != nil {
+		return Task{}, nil, err
+	}
+	return t, stale, nil
+}
+
+// MergeDelete implements Repository.MergeDelete against the field clocks
+// of the task stream.
+func (r *EventSourcedRepo) MergeDelete(ctx context.Context, s Scope, id int64, changedAt time.Time) ([]FieldClock, error) {
+	return retry(func() ([]FieldClock, error) { return r.mergeDelete(ctx, s, id, changedAt) })
+}
+
+func (r *EventSourcedRepo) mergeDelete(ctx context.Context, s Scope, id int64, changedAt time.Time) ([]FieldClock, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	st, err := mergeStream(ctx, tx, s, id)
+	switch {
+	case err == ErrDeleted:
+		return nil, nil
+	case err != nil:
+		return nil, err
+	}
+	if newer := clocksAfter(st.state.Clocks, syncFields, changedAt); len(newer) > 0 {
+		return newer, nil
+	}
+	if err := r.remove(ctx, tx, s, id); err != nil {
+		return nil, err
+	}
+	return nil, r.commit(tx)
+}
+
+// mergeStream loads the stream of the task id in scope. It reports
+// ErrDeleted if the stream of the scope's workspace was deleted and
+// ErrNotFound if the scope cannot see the task otherwise.
+func mergeStream(ctx context.Context, tx *sql.Tx, s Scope, id int64) (*taskStream, error) {
+	st, err := target(ctx, tx, s, id)
+	if err != ErrNotFound {
+		return st, err
+	}
+	if st, err := loadStream(ctx, tx, id); err == nil && st.workspaceID == s.workspace() && st.state.Deleted {
+		return nil, ErrDeleted
+	} else if err != nil && err != ErrNotFound {
+		return nil, err
+	}
+	return nil, ErrNotFound
+}
@@ -0,0 +1,246 @@
+package tasks
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"sync"
+	"testing"
+)
+
+func newTempEventSourced(t *testing.T) *EventSourcedRepo {
+	t.Helper()
+	dir := t.TempDir()
+	dsn, err := SQLiteFileDSN(filepath.Join(dir, "test.db"))
+	if err != nil {
+		t.Fatalf("dsn error: %v", err)
+	}
+	repo, err := NewEventSourcedRepo(dsn)
+	if err != nil {
+		t.Fatalf("open error: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = repo.Close()
+		_ = os.RemoveAll(dir)
+	})
+	if err := repo.ApplyMigrations(context.Background()); err != nil {
+		t.Fatalf("migrate error: %v", err)
+	}
+	return repo
+}
+
+// forEachRepo runs fn as a subtest against a fresh repository of each
+// backend.
+func forEachRepo(t *testing.T, fn func(t *testing.T, repo Repository)) {
+	t.Helper()
+	for name, newRepo := range map[string]func(t *testing.T) Repository{
+		"memory":       func(*testing.T) Repository { return NewInMemoryRepo() },
+		"sqlite":       func(t *testing.T) Repository { return newTempDB(t) },
+		"eventsourced": func(t *testing.T) Repository { return newTempEventSourced(t) },
+	} {
+		t.Run(name, func(t *testing.T) {
+			fn(t, newRepo(t))
+		})
+	}
+}
+
+func TestEventSourcedRepo_Rebuild(t *testing.T) {
+	repo := newTempEventSourced(t)
+	repo.SnapshotEvery = 3
+	ctx := context.Background()
+
+	u, err := repo.CreateUser(ctx, Scope{}, "ann", false, "hash-ann")
+	if err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	p, err := repo.CreateProject(ctx, Scope{}, "p", []FieldDef{{Name: "size", Type: FieldNumber}})
+	if err != nil {
+		t.Fatalf("create project: %v", err)
+	}
+	tree, err := repo.CreateTree(ctx, Scope{}, TaskTree{
+		TaskInput: TaskInput{Title: "root", ProjectID: &p.ID, Fields: map[string]any{"size": 3.0}, Tags: []string{"b", "a"}},
+		Subtasks:  []TaskTree{{TaskInput: TaskInput{Title: "child"}}},
+	})
+	if err != nil {
+		t.Fatalf("create tree: %v", err)
+	}
+	root := tree[0].ID
+	for i, title := range []string{"one", "two", "three", "four"} {
+		done := i%2 == 0
+		if _, err := repo.Update(ctx, Scope{}, root, TaskPatch{Title: &title, Done: &done}); err != nil {
+			t.Fatalf("update: %v", err)
+		}
+	}
+	if _, err := repo.Assign(ctx, Scope{}, root, u.ID); err != nil {
+		t.Fatalf("assign: %v", err)
+	}
+	gone, err := repo.Create(ctx, Scope{}, TaskInput{Title: "gone"})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if err := repo.Delete(ctx, Scope{}, gone.ID); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+
+	var version int64
+	if err := repo.db.QueryRow(`SELECT version FROM task_snapshots WHERE task_id = ?`, root).Scan(&version); err != nil {
+		t.Fatalf("snapshot: %v", err)
+	}
+	if version != 6 { // created, four patches and the assignment
+		t.Fatalf("snapshot version = %d, want 6", version)
+	}
+
+	before, err := repo.List(ctx, Scope{}, ListQuery{})
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	if err := repo.Rebuild(ctx); err != nil {
+		t.Fatalf("rebuild: %v", err)
+	}
+	after, err := repo.List(ctx, Scope{}, ListQuery{})
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	if !reflect.DeepEqual(before, after) {
+		t.Fatalf("rebuilt read model differs:\n got %+v\nwant %+v", after, before)
+	}
+	if len(after) != 2 || after[0].Title != "four" || after[0].Fields["size"] != 3.0 || !slices.Equal(after[0].AssigneeIDs, []int64{u.ID}) {
+		t.Fatalf("unexpected tasks: %+v", after)
+	}
+}
+
+func TestEventSourcedRepo_AdoptsSQLiteTasks(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	dsn, err := SQLiteFileDSN(filepath.Join(dir, "test.db"))
+	if err != nil {
+		t.Fatalf("dsn error: %v", err)
+	}
+
+	plain, err := NewSQLiteRepo(dsn)
+	if err != nil {
+		t.Fatalf("open error: %v", err)
+	}
+	if err := plain.ApplyMigrations(ctx); err != nil {
+		t.Fatalf("migrate error: %v", err)
+	}
+	kept, err := plain.Create(ctx, Scope{}, TaskInput{Title: "kept", Tags: []string{"x"}})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	deleted, err := plain.Create(ctx, Scope{}, TaskInput{Title: "deleted"})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if err := plain.Delete(ctx, Scope{}, deleted.ID); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	_ = plain.Close()
+
+	repo, err := NewEventSourcedRepo(dsn)
+	if err != nil {
+		t.Fatalf("open error: %v", err)
+	}
+	defer func() { _ = repo.Close() }()
+	if err := repo.ApplyMigrations(ctx); err != nil {
+		t.Fatalf("migrate error: %v", err)
+	}
+	if err := repo.Rebuild(ctx); err != nil {
+		t.Fatalf("rebuild: %v", err)
+	}
+	got, err := repo.Get(ctx, Scope{}, kept.ID)
+	if err != nil || got.Title != "kept" || !slices.Equal(got.Tags, []string{"x"}) {
+		t.Fatalf("adopted task = %+v, %v", got, err)
+	}
+	fresh, err := repo.Create(ctx, Scope{}, TaskInput{Title: "fresh"})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if fresh.ID <= deleted.ID {
+		t.Fatalf("new task reused id %d", fresh.ID)
+	}
+}
+
+func TestEventSourcedRepo_ConcurrentUpdates(t *testing.T) {
+	repo := newTempEventSourced(t)
+	ctx := context.Background()
+	task, err := repo.Create(ctx, Scope{}, TaskInput{Title: "x"})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+
+	const writers, updates = 8, 10
+	var wg sync.WaitGroup
+	errs := make(chan error, writers*updates)
+	for i := range writers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range updates {
+				title := fmt.Sprint(i, "-", j)
+				if _, err := repo.Update(ctx, Scope{}, task.ID, TaskPatch{Title: &title}); err != nil {
+					errs <- err
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatalf("update: %v", err)
+	}
+	var version int64
+	if err := repo.db.QueryRow(`SELECT version FROM task_streams WHERE id = ?`, task.ID).Scan(&version); err != nil {
+		t.Fatalf("version: %v", err)
+	}
+	if version != 1+writers*updates {
+		t.Fatalf("stream version = %d, want %d", version, 1+writers*updates)
+	}
+}
+
+func TestEventSourcedRepo_NoReusedIDs(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	dsn, err := SQLiteFileDSN(filepath.Join(dir, "test.db"))
+	if err != nil {
+		t.Fatalf("dsn error: %v", err)
+	}
+	plain, err := NewSQLiteRepo(dsn)
+	if err != nil {
+		t.Fatalf("open error: %v", err)
+	}
+	if err := plain.ApplyMigrations(ctx); err != nil {
+		t.Fatalf("migrate error: %v", err)
+	}
+	gone, err := plain.Create(ctx, Scope{}, TaskInput{Title: "gone"})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if err := plain.Delete(ctx, Scope{}, gone.ID); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	// no stream was ever started, so there is no sequence to raise
+	if _, err := plain.db.Exec(`DELETE FROM sqlite_sequence WHERE name = 'task_streams'`); err != nil {
+		t.Fatalf("reset sequence: %v", err)
+	}
+	_ = plain.Close()
+
+	repo, err := NewEventSourcedRepo(dsn)
+	if err != nil {
+		t.Fatalf("open error: %v", err)
+	}
+	defer func() { _ = repo.Close() }()
+	if err := repo.ApplyMigrations(ctx); err != nil {
+		t.Fatalf("migrate error: %v", err)
+	}
+	fresh, err := repo.Create(ctx, Scope{}, TaskInput{Title: "fresh"})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if fresh.ID <= gone.ID {
+		t.Fatalf("new task reused id %d", fresh.ID)
+	}
+}
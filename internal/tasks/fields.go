@@ -0,0 +1,337 @@
+package tasks
+
+import (
+	"cmp"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type FieldType string
+
+const (
+	FieldText   FieldType = "text"
+	FieldNumber FieldType = "number"
+	FieldDate   FieldType = "date"
+	FieldEnum   FieldType = "enum"
+	FieldBool   FieldType = "bool"
+)
+
+const (
+	maxFieldsPerProject = 50
+	maxFieldTextLen     = 1000
+	fieldDateLayout     = "2006-01-02"
+)
+
+var fieldNameRe = regexp.MustCompile(`^[a-z][a-z0-9_]{0,62}$`)
+
+// FieldDef describes one custom field available on a project's tasks.
+type FieldDef struct {
+	Name     string    `json:"name"`
+	Type     FieldType `json:"type"`
+	Options  []string  `json:"options,omitempty"`
+	Required bool      `json:"required,omitempty"`
+}
+
+// FieldFilter compares a custom field against Value, which has already been
+// converted to the field's Go representation (see normalizeFieldValue).
+type FieldFilter struct {
+	Name  string
+	Op    string
+	Value any
+}
+
+var filterOps = map[string]string{
+	"eq":  "=",
+	"ne":  "<>",
+	"gt":  ">",
+	"gte": ">=",
+	"lt":  "<",
+	"lte": "<=",
+}
+
+func (t FieldType) valid() bool {
+	switch t {
+	case FieldText, FieldNumber, FieldDate, FieldEnum, FieldBool:
+		return true
+	}
+	return false
+}
+
+// ordered reports whether range operators make sense for the type.
+func (t FieldType) ordered() bool {
+	return t == FieldNumber || t == FieldDate
+}
+
+func findField(defs []FieldDef, name string) (FieldDef, bool) {
+	for _, d := range defs {
+		if d.Name == name {
+			return d, true
+		}
+	}
+	return FieldDef{}, false
+}
+
+func validateFieldDefs(defs []FieldDef) []fieldError {
+	var errs []fieldError
+
+	if len(defs) > maxFieldsPerProject {
+		errs = append(errs, fieldError{
+			Field:   "fields",
+			Message: fmt.Sprintf("at most %d custom fields are allowed", maxFieldsPerProject),
+		})
+	}
+
+	seen := make(map[string]struct{}, len(defs))
+	for i, d := range defs {
+		key := fmt.Sprintf("fields[%d]", i)
+		if !fieldNameRe.MatchString(d.Name) {
+			errs = append(errs, fieldError{
+				Field:   key + ".name",
+				Message: "name must start with a lowercase letter and contain only a-z, 0-9 and _",
+			})
+		} else if _, dup := seen[d.Name]; dup {
+			errs = append(errs, fieldError{Field: key + ".name", Message: "duplicate field name " + d.Name})
+		}
+		seen[d.Name] = struct{}{}
+
+		if !d.Type.valid() {
+			errs = append(errs, fieldError{
+				Field:   key + ".type",
+				Message: "type must be one of text, number, date, enum, bool",
+			})
+			continue
+		}
+		if d.Type == FieldEnum {
+			if len(d.Options) == 0 {
+				errs = append(errs, fieldError{Field: key + ".options", Message: "enum fields need at least one option"})
+			}
+			for _, o := range d.Options {
+				if strings.TrimSpace(o) == "" {
+					errs = append(errs, fieldError{Field: key + ".options", Message: "options must not be empty"})
+					break
+				}
+			}
+		} else if len(d.Options) > 0 {
+			errs = append(errs, fieldError{Field: key + ".options", Message: "options are only allowed on enum fields"})
+		}
+	}
+	return errs
+}
+
+// validateFieldValues checks values against defs and returns them in their
+// canonical Go representation. Errors are keyed as "fields.<name>".
+func validateFieldValues(defs []FieldDef, values map[string]any) (map[string]any, []fieldError) {
+	var errs []fieldError
+	out := make(map[string]any, len(values))
+
+	for name, raw := range values {
+		def, ok := findField(defs, name)
+		if !ok {
+			errs = append(errs, fieldError{Field: "fields." + name, Message: "unknown field " + name})
+			continue
+		}
+		if raw == nil {
+			continue
+		}
+		v, err := normalizeFieldValue(def, raw)
+		if err != nil {
+			errs = append(errs, fieldError{Field: "fields." + name, Message: err.Error()})
+			continue
+		}
+		out[name] = v
+	}
+
+	for _, d := range defs {
+		if _, ok := out[d.Name]; d.Required && !ok {
+			errs = append(errs, fieldError{Field: "fields." + d.Name, Message: d.Name + " is required"})
+		}
+	}
+
+	sortFieldErrors(errs)
+	if len(out) == 0 {
+		out = nil
+	}
+	return out, errs
+}
+
+// normalizeFieldValue converts a decoded JSON value to the canonical
+// representation for def: string for text/date/enum, float64 for number
+// and bool for bool.
+func normalizeFieldValue(def FieldDef, raw any) (any, error) {
+	switch def.Type {
+	case FieldText:
+		s, ok := raw.(string)
+		if !ok {
+			return nil, fmt.Errorf("%s must be a string", def.Name)
+		}
+		if len(s) > maxFieldTextLen {
+			return nil, fmt.Errorf("%s must be at most %d characters", def.Name, maxFieldTextLen)
+		}
+		return s, nil
+	case FieldNumber:
+		n, ok := raw.(float64)
+		if !ok {
+			return nil, fmt.Errorf("%s must be a number", def.Name)
+		}
+		return n, nil
+	case FieldDate:
+		s, ok := raw.(string)
+		if !ok {
+			return nil, fmt.Errorf("%s must be a date (YYYY-MM-DD)", def.Name)
+		}
+		if _, err := time.Parse(fieldDateLayout, s); err != nil {
+			return nil, fmt.Errorf("%s must be a date (YYYY-MM-DD)", def.Name)
+		}
+		return s, nil
+	case FieldEnum:
+		s, ok := raw.(string)
+		if !ok || !slices.Contains(def.Options, s) {
+			return nil, fmt.Errorf("%s must be one of %s", def.Name, strings.Join(def.Options, ", "))
+		}
+		return s, nil
+	case FieldBool:
+		b, ok := raw.(bool)
+		if !ok {
+			return nil, fmt.Errorf("%s must be a boolean", def.Name)
+		}
+		return b, nil
+	}
+	return nil, fmt.Errorf("%s has unsupported type %s", def.Name, def.Type)
+}
+
+// parseFieldValue converts a query-string value for def.
+func parseFieldValue(def FieldDef, s string) (any, error) {
+	switch def.Type {
+	case FieldNumber:
+		n, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s must be a number", def.Name)
+		}
+		return n, nil
+	case FieldBool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return nil, fmt.Errorf("%s must be a boolean", def.Name)
+		}
+		return b, nil
+	default:
+		return normalizeFieldValue(def, s)
+	}
+}
+
+// convertFieldValue carries a canonical value over to def when a field's
+// definition changes: it reports false if v is no valid value of def
+// anymore, e.g. text that is no number or an option that was removed.
+func convertFieldValue(def FieldDef, v any) (any, bool) {
+	var s string
+	switch v := v.(type) {
+	case string:
+		s = v
+	case float64:
+		s = strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		s = strconv.FormatBool(v)
+	default:
+		return nil, false
+	}
+	out, err := parseFieldValue(def, s)
+	return out, err == nil
+}
+
+// compareFieldValues orders two canonical values of the same field type.
+// nil sorts before everything, matching SQLite's NULL ordering.
+func compareFieldValues(a, b any) int {
+	switch {
+	case a == nil && b == nil:
+		return 0
+	case a == nil:
+		return -1
+	case b == nil:
+		return 1
+	}
+	switch av := a.(type) {
+	case float64:
+		bv, _ := b.(float64)
+		return cmp.Compare(av, bv)
+	case bool:
+		bv, _ := b.(bool)
+		return cmp.Compare(boolInt(av), boolInt(bv))
+	case string:
+		bv, _ := b.(string)
+		return strings.Compare(av, bv)
+	}
+	return 0
+}
+
+// boolInt maps false to 0 and true to 1, the order of stored bools.
+func boolInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// matches reports whether a task's value for the filtered field satisfies f.
+// A missing value only matches "ne".
+func (f FieldFilter) matches(v any) bool {
+	if v == nil {
+		return f.Op == "ne"
+	}
+	c := compareFieldValues(v, f.Value)
+	switch f.Op {
+	case "eq":
+		return c == 0
+	case "ne":
+		return c != 0
+	case "gt":
+		return c > 0
+	case "gte":
+		return c >= 0
+	case "lt":
+		return c < 0
+	case "lte":
+		return c <= 0
+	}
+	return false
+}
+
+// toSQLFieldValue maps a canonical value to what is stored in
+// task_field_values.value.
+func toSQLFieldValue(v any) any {
+	if b, ok := v.(bool); ok {
+		if b {
+			return int64(1)
+		}
+		return int64(0)
+	}
+	return v
+}
+
+// fromSQLFieldValue is the inverse of toSQLFieldValue.
+func fromSQLFieldValue(t FieldType, raw any) any {
+	switch t {
+	case FieldNumber:
+		switch n := raw.(type) {
+		case float64:
+			return n
+		case int64:
+			return float64(n)
+		}
+	case FieldBool:
+		if n, ok := raw.(int64); ok {
+			return n != 0
+		}
+	default:
+		switch s := raw.(type) {
+		case string:
+			return s
+		case []byte:
+			return string(s)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,211 @@
+package tasks
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestValidateFieldDefs(t *testing.T) {
+	cases := []struct {
+		name  string
+		defs  []FieldDef
+		field string
+	}{
+		{"bad name", []FieldDef{{Name: "Story Points", Type: FieldNumber}}, "fields[0].name"},
+		{"duplicate", []FieldDef{{Name: "a", Type: FieldText}, {Name: "a", Type: FieldText}}, "fields[1].name"},
+		{"bad type", []FieldDef{{Name: "a", Type: "money"}}, "fields[0].type"},
+		{"enum without options", []FieldDef{{Name: "a", Type: FieldEnum}}, "fields[0].options"},
+		{"options on text", []FieldDef{{Name: "a", Type: FieldText, Options: []string{"x"}}}, "fields[0].options"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			errs := validateFieldDefs(tc.defs)
+			if len(errs) != 1 || errs[0].Field != tc.field {
+				t.Fatalf("expected one error on %s, got %+v", tc.field, errs)
+			}
+		})
+	}
+
+	ok := []FieldDef{
+		{Name: "customer", Type: FieldText},
+		{Name: "severity", Type: FieldEnum, Options: []string{"low", "high"}, Required: true},
+	}
+	if errs := validateFieldDefs(ok); len(errs) != 0 {
+		t.Fatalf("expected valid defs, got %+v", errs)
+	}
+}
+
+func TestValidateFieldValues(t *testing.T) {
+	defs := []FieldDef{
+		{Name: "customer", Type: FieldText},
+		{Name: "points", Type: FieldNumber},
+		{Name: "due", Type: FieldDate},
+		{Name: "severity", Type: FieldEnum, Options: []string{"low", "high"}, Required: true},
+		{Name: "billable", Type: FieldBool},
+	}
+
+	got, errs := validateFieldValues(defs, map[string]any{
+		"customer": "acme",
+		"points":   float64(3),
+		"due":      "2025-01-31",
+		"severity": "high",
+		"billable": true,
+	})
+	if len(errs) != 0 {
+		t.Fatalf("unexpected errors: %+v", errs)
+	}
+	if got["points"] != float64(3) || got["billable"] != true {
+		t.Fatalf("unexpected values: %+v", got)
+	}
+
+	_, errs = validateFieldValues(defs, map[string]any{
+		"points":   "three",
+		"due":      "31/01/2025",
+		"billable": "yes",
+		"color":    "red",
+	})
+	want := []string{"fields.billable", "fields.color", "fields.due", "fields.points", "fields.severity"}
+	if len(errs) != len(want) {
+		t.Fatalf("expected %d errors, got %+v", len(want), errs)
+	}
+	for i, f := range want {
+		if errs[i].Field != f {
+			t.Errorf("error %d: expected field %s, got %+v", i, f, errs[i])
+		}
+	}
+}
+
+// Every repository must filter and order custom fields identically.
+func TestCustomFieldQueries(t *testing.T) {
+	forEachRepo(t, func(t *testing.T, repo Repository) {
+		ctx := context.Background()
+		p, err := repo.CreateProject(ctx, Scope{}, "support", []FieldDef{
+			{Name: "points", Type: FieldNumber},
+			{Name: "severity", Type: FieldEnum, Options: []string{"low", "high"}},
+			{Name: "billable", Type: FieldBool},
+		})
+		if err != nil {
+			t.Fatalf("create project: %v", err)
+		}
+		seed := []TaskInput{
+			{Title: "a", ProjectID: &p.ID, Fields: map[string]any{"points": 5.0, "severity": "high", "billable": true}},
+			{Title: "b", ProjectID: &p.ID, Fields: map[string]any{"points": 1.5, "severity": "low"}},
+			{Title: "c", ProjectID: &p.ID, Fields: map[string]any{"severity": "high", "billable": false}},
+			{Title: "d"},
+		}
+		for _, in := range seed {
+			if _, err := repo.Create(ctx, Scope{}, in); err != nil {
+				t.Fatalf("create %s: %v", in.Title, err)
+			}
+		}
+
+		check := func(q ListQuery, want ...string) {
+			t.Helper()
+			list, err := repo.List(ctx, Scope{}, q)
+			if err != nil {
+				t.Fatalf("list: %v", err)
+			}
+			var got []string
+			for _, tk := range list {
+				got = append(got, tk.Title)
+			}
+			if len(got) != len(want) {
+				t.Fatalf("expected %v, got %v", want, got)
+			}
+			for i := range want {
+				if got[i] != want[i] {
+					t.Fatalf("expected %v, got %v", want, got)
+				}
+			}
+		}
+
+		check(ListQuery{ProjectID: &p.ID, Fields: []FieldFilter{{Name: "severity", Op: "eq", Value: "high"}}}, "a", "c")
+		check(ListQuery{ProjectID: &p.ID, Fields: []FieldFilter{{Name: "points", Op: "gte", Value: 1.5}}}, "a", "b")
+		check(ListQuery{ProjectID: &p.ID, Fields: []FieldFilter{{Name: "billable", Op: "ne", Value: true}}}, "b", "c")
+		check(ListQuery{ProjectID: &p.ID, Sort: []SortKey{{Field: "points", Desc: true}}}, "a", "b", "c")
+		check(ListQuery{ProjectID: &p.ID, Sort: []SortKey{{Field: "points"}}}, "c", "b", "a")
+		check(ListQuery{Sort: []SortKey{{Column: "title", Desc: true}}}, "d", "c", "b", "a")
+
+		list, err := repo.List(ctx, Scope{}, ListQuery{ProjectID: &p.ID})
+		if err != nil {
+			t.Fatalf("list: %v", err)
+		}
+		if v := list[0].Fields["billable"]; v != true {
+			t.Fatalf("expected billable=true to round-trip, got %#v", v)
+		}
+
+		// dropping a definition drops its values
+		if _, err := repo.SetProjectFields(ctx, Scope{}, p.ID, []FieldDef{{Name: "points", Type: FieldNumber}}); err != nil {
+			t.Fatalf("set fields: %v", err)
+		}
+		list, err = repo.List(ctx, Scope{}, ListQuery{ProjectID: &p.ID})
+		if err != nil {
+			t.Fatalf("list: %v", err)
+		}
+		if _, ok := list[0].Fields["severity"]; ok || list[0].Fields["points"] != 5.0 {
+			t.Fatalf("unexpected fields after redefinition: %+v", list[0].Fields)
+		}
+	})
+}
+
+func TestSetProjectFields_Convert(t *testing.T) {
+	forEachRepo(t, func(t *testing.T, repo Repository) {
+		ctx := context.Background()
+		p, err := repo.CreateProject(ctx, Scope{}, "support", []FieldDef{
+			{Name: "points", Type: FieldNumber},
+			{Name: "severity", Type: FieldEnum, Options: []string{"low", "high"}},
+			{Name: "estimate", Type: FieldText},
+			{Name: "billable", Type: FieldBool},
+		})
+		if err != nil {
+			t.Fatalf("create project: %v", err)
+		}
+		var ids []int64
+		for _, fields := range []map[string]any{
+			{"points": 5.0, "severity": "high", "estimate": "12", "billable": true},
+			{"points": 1.5, "severity": "low", "estimate": "soon"},
+		} {
+			task, err := repo.Create(ctx, Scope{}, TaskInput{Title: "t", ProjectID: &p.ID, Fields: fields})
+			if err != nil {
+				t.Fatalf("create: %v", err)
+			}
+			ids = append(ids, task.ID)
+		}
+
+		if _, err := repo.SetProjectFields(ctx, Scope{}, p.ID, []FieldDef{
+			{Name: "points", Type: FieldText},
+			{Name: "severity", Type: FieldEnum, Options: []string{"high", "urgent"}},
+			{Name: "estimate", Type: FieldNumber},
+			{Name: "billable", Type: FieldText},
+		}); err != nil {
+			t.Fatalf("set fields: %v", err)
+		}
+		want := []map[string]any{
+			{"points": "5", "severity": "high", "estimate": 12.0, "billable": "true"},
+			{"points": "1.5"},
+		}
+		check := func(when string) {
+			t.Helper()
+			for i, id := range ids {
+				task, err := repo.Get(ctx, Scope{}, id)
+				if err != nil {
+					t.Fatalf("get: %v", err)
+				}
+				if !reflect.DeepEqual(task.Fields, want[i]) {
+					t.Fatalf("%s: expected fields %#v, got %#v", when, want[i], task.Fields)
+				}
+			}
+		}
+		check("after the change")
+
+		// later updates keep the converted values
+		for _, id := range ids {
+			done := true
+			if _, err := repo.Update(ctx, Scope{}, id, TaskPatch{Done: &done}); err != nil {
+				t.Fatalf("update: %v", err)
+			}
+		}
+		check("after an update")
+	})
+}
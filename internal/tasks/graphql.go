@@ -0,0 +1,913 @@
+package tasks
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/graph-gophers/graphql-go"
+)
+
+// graphqlSchema mirrors the REST resources. Lists of tasks are cursor
+// connections in id order; mutations validate like their REST
+// counterparts and report failures with the REST error code in the
+// error's extensions.
+const graphqlSchema = `
+schema {
+	query: Query
+	mutation: Mutation
+}
+
+scalar Time
+scalar JSON
+
+type Query {
+	task(id: ID!): Task
+	tasks(first: Int, after: String, projectId: ID, done: Boolean, tag: String): TaskConnection!
+	project(id: ID!): Project
+	projects: [Project!]!
+	tags: [Tag!]!
+}
+
+type Mutation {
+	createTask(input: CreateTaskInput!): Task!
+	updateTask(id: ID!, input: UpdateTaskInput!): Task!
+	createProject(input: CreateProjectInput!): Project!
+}
+
+type Task {
+	id: ID!
+	title: String!
+	done: Boolean!
+	priority: Int!
+	tags: [String!]!
+	checklist: [ChecklistItem!]!
+	fields: JSON
+	assignee: String
+	dueAt: Time
+	createdAt: Time!
+	completedAt: Time
+	project: Project
+	parent: Task
+	subtasks: [Task!]!
+}
+
+type ChecklistItem {
+	text: String!
+	done: Boolean!
+}
+
+type Project {
+	id: ID!
+	name: String!
+	fields: [FieldDef!]!
+	createdAt: Time!
+	tasks(first: Int, after: String, done: Boolean): TaskConnection!
+}
+
+type FieldDef {
+	name: String!
+	type: String!
+	options: [String!]!
+	required: Boolean!
+}
+
+type Tag {
+	name: String!
+	taskCount: Int!
+}
+
+type TaskConnection {
+	edges: [TaskEdge!]!
+	nodes: [Task!]!
+	pageInfo: PageInfo!
+}
+
+type TaskEdge {
+	cursor: String!
+	node: Task!
+}
+
+type PageInfo {
+	hasNextPage: Boolean!
+	endCursor: String
+}
+
+input ChecklistItemInput {
+	text: String!
+	done: Boolean
+}
+
+input CreateTaskInput {
+	title: String!
+	projectId: ID
+	parentId: ID
+	tags: [String!]
+	checklist: [ChecklistItemInput!]
+	fields: JSON
+	dueAt: Time
+	priority: Int
+	assignee: String
+}
+
+input UpdateTaskInput {
+	title: String
+	done: Boolean
+	tags: [String!]
+	checklist: [ChecklistItemInput!]
+	dueAt: Time
+	priority: Int
+	assignee: String
+}
+
+input CreateProjectInput {
+	name: String!
+}
+`
+
+const (
+	// graphqlPageSize is the page size of a connection without first.
+	graphqlPageSize = 100
+	// graphqlMaxDepth bounds how deeply parents and subtasks may nest in
+	// one query.
+	graphqlMaxDepth = 10
+	maxGraphQLBytes = 1 << 20
+)
+
+type graphqlRequest struct {
+	Query         string         `json:"query"`
+	OperationName string         `json:"operationName"`
+	Variables     map[string]any `json:"variables"`
+}
+
+// serveGraphQL executes POST /graphql requests. Every request gets its
+// own loaders, so batching and caching never cross callers.
+func serveGraphQL(repo Repository) http.HandlerFunc {
+	schema := graphql.MustParseSchema(graphqlSchema, &graphqlResolver{repo: repo}, graphql.MaxDepth(graphqlMaxDepth))
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		var req graphqlRequest
+		err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxGraphQLBytes)).Decode(&req)
+		var sizeErr *http.MaxBytesError
+		if errors.As(err, &sizeErr) {
+			writeJSON(w, http.StatusRequestEntityTooLarge, errResponse{Error: "too_large"})
+			return
+		}
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, errResponse{Error: "invalid_json"})
+			return
+		}
+		if strings.TrimSpace(req.Query) == "" {
+			writeValidation(w, []fieldError{{Field: "query", Message: "query is required"}})
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), graphqlLoadersKey{}, newGraphqlLoaders(repo, callerScope(r.Context())))
+		writeJSON(w, http.StatusOK, schema.Exec(ctx, req.Query, req.OperationName, req.Variables))
+	}
+}
+
+// graphqlError is a resolver error whose extensions carry the code, and
+// for validation errors the details, a REST response would have.
+type graphqlError struct {
+	code    string
+	details []fieldError
+}
+
+func (e *graphqlError) Error() string {
+	return strings.ReplaceAll(e.code, "_", " ")
+}
+
+func (e *graphqlError) Extensions() map[string]any {
+	ext := map[string]any{"code": e.code}
+	if len(e.details) > 0 {
+		ext["details"] = e.details
+	}
+	return ext
+}
+
+func graphqlValidation(errs []fieldError) error {
+	sortFieldErrors(errs)
+	return &graphqlError{code: "validation_error", details: errs}
+}
+
+// graphqlErr maps a repository error onto a graphqlError; unexpected
+// errors are not passed on to the client.
+func graphqlErr(err error) error {
+	switch {
+	case errors.Is(err, ErrNotFound):
+		return &graphqlError{code: "not_found"}
+	case errors.Is(err, errForbidden):
+		return &graphqlError{code: "forbidden"}
+	case errors.Is(err, ErrTitleRequired):
+		return graphqlValidation([]fieldError{{Field: "title", Message: "title is required"}})
+	default:
+		return &graphqlError{code: "unexpected_error"}
+	}
+}
+
+// graphqlJSON is the JSON scalar, used for custom field values.
+type graphqlJSON struct {
+	Value any
+}
+
+func (graphqlJSON) ImplementsGraphQLType(name string) bool { return name == "JSON" }
+
+func (j *graphqlJSON) UnmarshalGraphQL(input any) error {
+	j.Value = input
+	return nil
+}
+
+func (j graphqlJSON) MarshalJSON() ([]byte, error) {
+	return json.Marshal(j.Value)
+}
+
+// parseGraphqlID reads a record id; a malformed one is reported on field.
+func parseGraphqlID(field string, id graphql.ID) (int64, []fieldError) {
+	n, err := strconv.ParseInt(string(id), 10, 64)
+	if err != nil || n <= 0 {
+		return 0, []fieldError{{Field: field, Message: field + " must be a positive integer"}}
+	}
+	return n, nil
+}
+
+// Cursors are opaque to clients; they hold the id of the task an edge
+// points at, and a page continues after it.
+func encodeCursor(id int64) string {
+	return base64.RawURLEncoding.EncodeToString([]byte("task:" + strconv.FormatInt(id, 10)))
+}
+
+func decodeCursor(s string) (int64, bool) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return 0, false
+	}
+	rest, ok := strings.CutPrefix(string(b), "task:")
+	if !ok {
+		return 0, false
+	}
+	id, err := strconv.ParseInt(rest, 10, 64)
+	return id, err == nil && id > 0
+}
+
+// pageArgs are the arguments of a task connection.
+type pageArgs struct {
+	First *int32
+	After *string
+}
+
+// parse returns the page size and the id to continue after.
+func (a pageArgs) parse() (int, int64, []fieldError) {
+	var errs []fieldError
+	first := graphqlPageSize
+	if a.First != nil {
+		if *a.First < 0 || *a.First > maxPageSize {
+			errs = append(errs, fieldError{Field: "first", Message: fmt.Sprintf("first must be from 0 to %d", maxPageSize)})
+		}
+		first = int(*a.First)
+	}
+	var after int64
+	if a.After != nil {
+		var ok bool
+		if after, ok = decodeCursor(*a.After); !ok {
+			errs = append(errs, fieldError{Field: "after", Message: "after must be a cursor from an earlier page"})
+		}
+	}
+	return first, after, errs
+}
+
+// batchLoader loads values by key with one call to fetch for many keys.
+// Resolvers prime the keys of every task or project they return, and the
+// first load of any key fetches all keys primed so far, so the fields of a
+// page of results cost one repository call each instead of one per row.
+// Results, including keys fetch did not find, are cached for the request.
+type batchLoader[K comparable, V any] struct {
+	fetch func(ctx context.Context, keys []K) (map[K]V, error)
+
+	mu      sync.Mutex
+	pending []K
+	queued  map[K]bool
+	loaded  map[K]V
+	fetched map[K]bool
+}
+
+func newBatchLoader[K comparable, V any](fetch func(context.Context, []K) (map[K]V, error)) *batchLoader[K, V] {
+	return &batchLoader[K, V]{fetch: fetch, queued: make(map[K]bool), loaded: make(map[K]V), fetched: make(map[K]bool)}
+}
+
+// prime queues k for the next fetch.
+func (l *batchLoader[K, V]) prime(k K) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !l.fetched[k] && !l.queued[k] {
+		l.queued[k] = true
+		l.pending = append(l.pending, k)
+	}
+}
+
+// load returns the value of k and whether fetch found it.
+func (l *batchLoader[K, V]) load(ctx context.Context, k K) (V, bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !l.fetched[k] {
+		keys := l.pending
+		if !l.queued[k] {
+			keys = append(keys, k)
+		}
+		vs, err := l.fetch(ctx, keys)
+		if err != nil {
+			var zero V
+			return zero, false, err
+		}
+		for _, key := range keys {
+			l.fetched[key] = true
+			delete(l.queued, key)
+			if v, ok := vs[key]; ok {
+				l.loaded[key] = v
+			}
+		}
+		l.pending = nil
+	}
+	v, ok := l.loaded[k]
+	return v, ok, nil
+}
+
+type graphqlLoadersKey struct{}
+
+// graphqlLoaders batch the lookups behind a task's project, parent and
+// subtasks and a project's tasks.
+type graphqlLoaders struct {
+	repo     Repository
+	scope    Scope
+	projects *batchLoader[int64, Project]
+	tasks    *batchLoader[int64, Task]
+	subtasks *batchLoader[int64, []Task]
+
+	mu           sync.Mutex
+	projectIDs   []int64 // every project returned so far
+	projectTasks map[projectTasksKey]*batchLoader[int64, []Task]
+}
+
+// projectTasksKey tells apart Project.tasks selections with different
+// arguments; each gets its own loader.
+type projectTasksKey struct {
+	done    string
+	afterID int64
+}
+
+func newGraphqlLoaders(repo Repository, s Scope) *graphqlLoaders {
+	l := &graphqlLoaders{repo: repo, scope: s, projectTasks: make(map[projectTasksKey]*batchLoader[int64, []Task])}
+	// projects are few; one call loads every visible one
+	l.projects = newBatchLoader(func(ctx context.Context, _ []int64) (map[int64]Project, error) {
+		ps, err := repo.ListProjects(ctx, s)
+		if err != nil {
+			return nil, err
+		}
+		out := make(map[int64]Project, len(ps))
+		for _, p := range ps {
+			out[p.ID] = p
+		}
+		return out, nil
+	})
+	l.tasks = newBatchLoader(func(ctx context.Context, ids []int64) (map[int64]Task, error) {
+		ts, err := repo.List(ctx, s, ListQuery{IDs: ids})
+		if err != nil {
+			return nil, err
+		}
+		out := make(map[int64]Task, len(ts))
+		for _, t := range ts {
+			out[t.ID] = t
+		}
+		return out, nil
+	})
+	l.subtasks = newBatchLoader(func(ctx context.Context, ids []int64) (map[int64][]Task, error) {
+		ts, err := repo.List(ctx, s, ListQuery{ParentIDs: ids})
+		if err != nil {
+			return nil, err
+		}
+		out := make(map[int64][]Task)
+		for _, t := range ts {
+			out[*t.ParentID] = append(out[*t.ParentID], t)
+		}
+		return out, nil
+	})
+	return l
+}
+
+func loadersFrom(ctx context.Context) *graphqlLoaders {
+	return ctx.Value(graphqlLoadersKey{}).(*graphqlLoaders)
+}
+
+// projectTasksLoader returns the loader of Project.tasks with done and
+// after, primed with every project returned so far. It loads whole
+// projects' tasks; connections are cut from them.
+func (l *graphqlLoaders) projectTasksLoader(done *bool, afterID int64) *batchLoader[int64, []Task] {
+	key := projectTasksKey{afterID: afterID}
+	if done != nil {
+		key.done = strconv.FormatBool(*done)
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if bl, ok := l.projectTasks[key]; ok {
+		return bl
+	}
+	bl := newBatchLoader(func(ctx context.Context, ids []int64) (map[int64][]Task, error) {
+		ts, err := l.repo.List(ctx, l.scope, ListQuery{ProjectIDs: ids, Done: done, AfterID: afterID})
+		if err != nil {
+			return nil, err
+		}
+		out := make(map[int64][]Task)
+		for _, t := range ts {
+			out[*t.ProjectID] = append(out[*t.ProjectID], t)
+		}
+		return out, nil
+	})
+	for _, id := range l.projectIDs {
+		bl.prime(id)
+	}
+	l.projectTasks[key] = bl
+	return bl
+}
+
+func (l *graphqlLoaders) newTask(t Task) *taskResolver {
+	if t.ProjectID != nil {
+		l.projects.prime(*t.ProjectID)
+	}
+	if t.ParentID != nil {
+		l.tasks.prime(*t.ParentID)
+	}
+	l.subtasks.prime(t.ID)
+	return &taskResolver{t: t}
+}
+
+func (l *graphqlLoaders) newTasks(ts []Task) []*taskResolver {
+	out := make([]*taskResolver, len(ts))
+	for i, t := range ts {
+		out[i] = l.newTask(t)
+	}
+	return out
+}
+
+func (l *graphqlLoaders) newProject(p Project) *projectResolver {
+	l.mu.Lock()
+	l.projectIDs = append(l.projectIDs, p.ID)
+	bls := make([]*batchLoader[int64, []Task], 0, len(l.projectTasks))
+	for _, bl := range l.projectTasks {
+		bls = append(bls, bl)
+	}
+	l.mu.Unlock()
+	for _, bl := range bls {
+		bl.prime(p.ID)
+	}
+	return &projectResolver{p: p}
+}
+
+// newConnection builds a page from up to first+1 tasks; the extra one
+// only tells that there is a next page.
+func (l *graphqlLoaders) newConnection(ts []Task, first int) *taskConnection {
+	c := &taskConnection{hasNext: len(ts) > first}
+	c.nodes = l.newTasks(ts[:min(first, len(ts))])
+	return c
+}
+
+// graphqlResolver resolves the fields of Query and Mutation.
+type graphqlResolver struct {
+	repo Repository
+}
+
+func (r *graphqlResolver) Task(ctx context.Context, args struct{ ID graphql.ID }) (*taskResolver, error) {
+	id, vErrs := parseGraphqlID("id", args.ID)
+	if len(vErrs) > 0 {
+		return nil, graphqlValidation(vErrs)
+	}
+	l := loadersFrom(ctx)
+	t, ok, err := l.tasks.load(ctx, id)
+	if err != nil {
+		return nil, graphqlErr(err)
+	}
+	if !ok {
+		return nil, nil
+	}
+	return l.newTask(t), nil
+}
+
+func (r *graphqlResolver) Tasks(ctx context.Context, args struct {
+	pageArgs
+	ProjectID *graphql.ID
+	Done      *bool
+	Tag       *string
+}) (*taskConnection, error) {
+	first, after, vErrs := args.parse()
+	q := ListQuery{Done: args.Done, AfterID: after, Limit: first + 1}
+	if args.ProjectID != nil {
+		id, errs := parseGraphqlID("projectId", *args.ProjectID)
+		q.ProjectID, vErrs = &id, append(vErrs, errs...)
+	}
+	if args.Tag != nil {
+		q.Tag = strings.ToLower(strings.TrimSpace(*args.Tag))
+	}
+	if len(vErrs) > 0 {
+		return nil, graphqlValidation(vErrs)
+	}
+	l := loadersFrom(ctx)
+	ts, err := r.repo.List(ctx, l.scope, q)
+	if err != nil {
+		return nil, graphqlErr(err)
+	}
+	return l.newConnection(ts, first), nil
+}
+
+func (r *graphqlResolver) Project(ctx context.Context, args struct{ ID graphql.ID }) (*projectResolver, error) {
+	id, vErrs := parseGraphqlID("id", args.ID)
+	if len(vErrs) > 0 {
+		return nil, graphqlValidation(vErrs)
+	}
+	l := loadersFrom(ctx)
+	p, ok, err := l.projects.load(ctx, id)
+	if err != nil {
+		return nil, graphqlErr(err)
+	}
+	if !ok {
+		return nil, nil
+	}
+	return l.newProject(p), nil
+}
+
+func (r *graphqlResolver) Projects(ctx context.Context) ([]*projectResolver, error) {
+	l := loadersFrom(ctx)
+	ps, err := r.repo.ListProjects(ctx, l.scope)
+	if err != nil {
+		return nil, graphqlErr(err)
+	}
+	out := make([]*projectResolver, len(ps))
+	for i, p := range ps {
+		out[i] = l.newProject(p)
+	}
+	return out, nil
+}
+
+// Tags counts the tasks of every tag in use, in one pass over the tags.
+func (r *graphqlResolver) Tags(ctx context.Context) ([]*tagResolver, error) {
+	counts := make(map[string]int32)
+	err := r.repo.Stream(ctx, loadersFrom(ctx).scope, ListQuery{Select: []string{"tags"}}, func(t Task) error {
+		for _, tag := range t.Tags {
+			counts[tag]++
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, graphqlErr(err)
+	}
+	out := make([]*tagResolver, 0, len(counts))
+	for name, n := range counts {
+		out = append(out, &tagResolver{name: name, count: n})
+	}
+	slices.SortFunc(out, func(a, b *tagResolver) int { return strings.Compare(a.name, b.name) })
+	return out, nil
+}
+
+type checklistInput struct {
+	Text string
+	Done *bool
+}
+
+func checklistFromInput(in *[]checklistInput) *[]ChecklistItem {
+	if in == nil {
+		return nil
+	}
+	items := make([]ChecklistItem, len(*in))
+	for i, it := range *in {
+		items[i] = ChecklistItem{Text: it.Text, Done: it.Done != nil && *it.Done}
+	}
+	return &items
+}
+
+type createTaskInput struct {
+	Title     string
+	ProjectID *graphql.ID
+	ParentID  *graphql.ID
+	Tags      *[]string
+	Checklist *[]checklistInput
+	Fields    *graphqlJSON
+	DueAt     *graphql.Time
+	Priority  *int32
+	Assignee  *string
+}
+
+// CreateTask creates a task like POST /tasks.
+func (r *graphqlResolver) CreateTask(ctx context.Context, args struct{ Input createTaskInput }) (*taskResolver, error) {
+	a := args.Input
+	in := TaskInput{Title: a.Title, OwnerID: callerID(ctx)}
+	var vErrs []fieldError
+	if a.ProjectID != nil {
+		id, errs := parseGraphqlID("project_id", *a.ProjectID)
+		in.ProjectID, vErrs = &id, append(vErrs, errs...)
+	}
+	if a.ParentID != nil {
+		id, errs := parseGraphqlID("parent_id", *a.ParentID)
+		in.ParentID, vErrs = &id, append(vErrs, errs...)
+	}
+	if a.Tags != nil {
+		in.Tags = *a.Tags
+	}
+	if items := checklistFromInput(a.Checklist); items != nil {
+		in.Checklist = *items
+	}
+	if a.Fields != nil && a.Fields.Value != nil {
+		fields, ok := a.Fields.Value.(map[string]any)
+		if !ok {
+			vErrs = append(vErrs, fieldError{Field: "fields", Message: "fields must be an object"})
+		}
+		in.Fields = fields
+	}
+	if a.DueAt != nil {
+		in.DueAt = &a.DueAt.Time
+	}
+	if a.Priority != nil {
+		in.Priority = int(*a.Priority)
+	}
+	if a.Assignee != nil {
+		in.Assignee = *a.Assignee
+	}
+	if len(vErrs) > 0 {
+		return nil, graphqlValidation(vErrs)
+	}
+
+	vErrs, err := checkTaskInput(ctx, r.repo, "", &in)
+	if err != nil {
+		return nil, graphqlErr(err)
+	}
+	if len(vErrs) > 0 {
+		return nil, graphqlValidation(vErrs)
+	}
+	l := loadersFrom(ctx)
+	t, err := r.repo.Create(ctx, l.scope, in)
+	if err != nil {
+		return nil, graphqlErr(err)
+	}
+	return l.newTask(t), nil
+}
+
+type updateTaskInput struct {
+	Title     *string
+	Done      *bool
+	Tags      *[]string
+	Checklist *[]checklistInput
+	DueAt     graphql.NullTime
+	Priority  *int32
+	Assignee  *string
+}
+
+// UpdateTask applies a partial update like PATCH /tasks/{id}; dueAt: null
+// clears the due date.
+func (r *graphqlResolver) UpdateTask(ctx context.Context, args struct {
+	ID    graphql.ID
+	Input updateTaskInput
+}) (*taskResolver, error) {
+	id, vErrs := parseGraphqlID("id", args.ID)
+	a := args.Input
+	p := TaskPatch{
+		Title:     a.Title,
+		Done:      a.Done,
+		Tags:      a.Tags,
+		Checklist: checklistFromInput(a.Checklist),
+		Assignee:  a.Assignee,
+	}
+	if a.DueAt.Value != nil {
+		p.DueAt = &a.DueAt.Value.Time
+	}
+	p.ClearDueAt = a.DueAt.Set && a.DueAt.Value == nil
+	if a.Priority != nil {
+		n := int(*a.Priority)
+		p.Priority = &n
+	}
+	pErrs, err := checkTaskPatch(ctx, r.repo, &p)
+	if err != nil {
+		return nil, graphqlErr(err)
+	}
+	if vErrs = append(vErrs, pErrs...); len(vErrs) > 0 {
+		return nil, graphqlValidation(vErrs)
+	}
+
+	if err := checkTaskWritable(ctx, r.repo, id); err != nil {
+		return nil, graphqlErr(err)
+	}
+	l := loadersFrom(ctx)
+	t, err := r.repo.Update(ctx, l.scope, id, p)
+	if err != nil {
+		return nil, graphqlErr(err)
+	}
+	return l.newTask(t), nil
+}
+
+// CreateProject creates a project without custom fields; they are set with
+// PUT /projects/{id}/fields.
+func (r *graphqlResolver) CreateProject(ctx context.Context, args struct{ Input struct{ Name string } }) (*projectResolver, error) {
+	if vErrs := validateProjectName(args.Input.Name); len(vErrs) > 0 {
+		return nil, graphqlValidation(vErrs)
+	}
+	l := loadersFrom(ctx)
+	p, err := r.repo.CreateProject(ctx, l.scope, args.Input.Name, nil)
+	if err != nil {
+		return nil, graphqlErr(err)
+	}
+	return l.newProject(p), nil
+}
+
+type taskResolver struct {
+	t Task
+}
+
+func (r *taskResolver) ID() graphql.ID  { return graphql.ID(strconv.FormatInt(r.t.ID, 10)) }
+func (r *taskResolver) Title() string   { return r.t.Title }
+func (r *taskResolver) Done() bool      { return r.t.Done }
+func (r *taskResolver) Priority() int32 { return int32(r.t.Priority) }
+
+func (r *taskResolver) Tags() []string {
+	if r.t.Tags == nil {
+		return []string{}
+	}
+	return r.t.Tags
+}
+
+func (r *taskResolver) Checklist() []*checklistResolver {
+	out := make([]*checklistResolver, len(r.t.Checklist))
+	for i, it := range r.t.Checklist {
+		out[i] = &checklistResolver{it}
+	}
+	return out
+}
+
+func (r *taskResolver) Fields() *graphqlJSON {
+	if len(r.t.Fields) == 0 {
+		return nil
+	}
+	return &graphqlJSON{r.t.Fields}
+}
+
+func (r *taskResolver) Assignee() *string {
+	if r.t.Assignee == "" {
+		return nil
+	}
+	return &r.t.Assignee
+}
+
+func (r *taskResolver) DueAt() *graphql.Time       { return graphqlTime(r.t.DueAt) }
+func (r *taskResolver) CreatedAt() graphql.Time    { return graphql.Time{Time: r.t.CreatedAt} }
+func (r *taskResolver) CompletedAt() *graphql.Time { return graphqlTime(r.t.CompletedAt) }
+
+func graphqlTime(t *time.Time) *graphql.Time {
+	if t == nil {
+		return nil
+	}
+	return &graphql.Time{Time: *t}
+}
+
+func (r *taskResolver) Project(ctx context.Context) (*projectResolver, error) {
+	if r.t.ProjectID == nil {
+		return nil, nil
+	}
+	l := loadersFrom(ctx)
+	p, ok, err := l.projects.load(ctx, *r.t.ProjectID)
+	if err != nil {
+		return nil, graphqlErr(err)
+	}
+	if !ok {
+		// an assignee may see a task of a project they are no member of
+		return nil, nil
+	}
+	return l.newProject(p), nil
+}
+
+func (r *taskResolver) Parent(ctx context.Context) (*taskResolver, error) {
+	if r.t.ParentID == nil {
+		return nil, nil
+	}
+	l := loadersFrom(ctx)
+	t, ok, err := l.tasks.load(ctx, *r.t.ParentID)
+	if err != nil {
+		return nil, graphqlErr(err)
+	}
+	if !ok {
+		return nil, nil
+	}
+	return l.newTask(t), nil
+}
+
+func (r *taskResolver) Subtasks(ctx context.Context) ([]*taskResolver, error) {
+	l := loadersFrom(ctx)
+	ts, _, err := l.subtasks.load(ctx, r.t.ID)
+	if err != nil {
+		return nil, graphqlErr(err)
+	}
+	return l.newTasks(ts), nil
+}
+
+type checklistResolver struct {
+	it ChecklistItem
+}
+
+func (r *checklistResolver) Text() string { return r.it.Text }
+func (r *checklistResolver) Done() bool   { return r.it.Done }
+
+type projectResolver struct {
+	p Project
+}
+
+func (r *projectResolver) ID() graphql.ID          { return graphql.ID(strconv.FormatInt(r.p.ID, 10)) }
+func (r *projectResolver) Name() string            { return r.p.Name }
+func (r *projectResolver) CreatedAt() graphql.Time { return graphql.Time{Time: r.p.CreatedAt} }
+
+func (r *projectResolver) Fields() []*fieldDefResolver {
+	out := make([]*fieldDefResolver, len(r.p.Fields))
+	for i, def := range r.p.Fields {
+		out[i] = &fieldDefResolver{def}
+	}
+	return out
+}
+
+func (r *projectResolver) Tasks(ctx context.Context, args struct {
+	pageArgs
+	Done *bool
+}) (*taskConnection, error) {
+	first, after, vErrs := args.parse()
+	if len(vErrs) > 0 {
+		return nil, graphqlValidation(vErrs)
+	}
+	l := loadersFrom(ctx)
+	ts, _, err := l.projectTasksLoader(args.Done, after).load(ctx, r.p.ID)
+	if err != nil {
+		return nil, graphqlErr(err)
+	}
+	return l.newConnection(ts[:min(first+1, len(ts))], first), nil
+}
+
+type fieldDefResolver struct {
+	def FieldDef
+}
+
+func (r *fieldDefResolver) Name() string   { return r.def.Name }
+func (r *fieldDefResolver) Type() string   { return string(r.def.Type) }
+func (r *fieldDefResolver) Required() bool { return r.def.Required }
+func (r *fieldDefResolver) Options() []string {
+	if r.def.Options == nil {
+		return []string{}
+	}
+	return r.def.Options
+}
+
+type tagResolver struct {
+	name  string
+	count int32
+}
+
+func (r *tagResolver) Name() string     { return r.name }
+func (r *tagResolver) TaskCount() int32 { return r.count }
+
+type taskConnection struct {
+	nodes   []*taskResolver
+	hasNext bool
+}
+
+func (c *taskConnection) Nodes() []*taskResolver { return c.nodes }
+
+func (c *taskConnection) Edges() []*taskEdge {
+	out := make([]*taskEdge, len(c.nodes))
+	for i, n := range c.nodes {
+		out[i] = &taskEdge{n}
+	}
+	return out
+}
+
+func (c *taskConnection) PageInfo() *pageInfo {
+	pi := &pageInfo{hasNext: c.hasNext}
+	if len(c.nodes) > 0 {
+		end := encodeCursor(c.nodes[len(c.nodes)-1].t.ID)
+		pi.endCursor = &end
+	}
+	return pi
+}
+
+type taskEdge struct {
+	node *taskResolver
+}
+
+func (e *taskEdge) Cursor() string      { return encodeCursor(e.node.t.ID) }
+func (e *taskEdge) Node() *taskResolver { return e.node }
+
+type pageInfo struct {
+	hasNext   bool
+	endCursor *string
+}
+
+func (p *pageInfo) HasNextPage() bool  { return p.hasNext }
+func (p *pageInfo) EndCursor() *string { return p.endCursor }
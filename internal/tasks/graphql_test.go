@@ -0,0 +1,289 @@
+package tasks
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync/atomic"
+	"testing"
+)
+
+type graphqlResult struct {
+	Data   json.RawMessage `json:"data"`
+	Errors []struct {
+		Message    string `json:"message"`
+		Extensions struct {
+			Code    string       `json:"code"`
+			Details []fieldError `json:"details"`
+		} `json:"extensions"`
+	} `json:"errors"`
+}
+
+// doGraphQL runs query with vars as token, or without a token if it is
+// empty, and decodes the data into out.
+func doGraphQL(t *testing.T, r http.Handler, token, query string, vars map[string]any, out any) graphqlResult {
+	t.Helper()
+	body, _ := json.Marshal(map[string]any{"query": query, "variables": vars})
+	var rec *httptest.ResponseRecorder
+	if token == "" {
+		rec = doJSON(t, r, http.MethodPost, "/graphql", string(body))
+	} else {
+		rec = doAs(t, r, token, http.MethodPost, "/graphql", string(body))
+	}
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d, body=%s", rec.Code, rec.Body.String())
+	}
+	var res graphqlResult
+	if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+		t.Fatalf("failed to parse JSON: %v", err)
+	}
+	if out != nil && len(res.Data) > 0 && string(res.Data) != "null" {
+		if err := json.Unmarshal(res.Data, out); err != nil {
+			t.Fatalf("failed to parse data: %v, body=%s", err, rec.Body.String())
+		}
+	}
+	return res
+}
+
+// countingRepo counts the calls GraphQL resolvers make to look up tasks
+// and projects.
+type countingRepo struct {
+	Repository
+	lists, projects atomic.Int32
+}
+
+func (c *countingRepo) List(ctx context.Context, s Scope, q ListQuery) ([]Task, error) {
+	c.lists.Add(1)
+	return c.Repository.List(ctx, s, q)
+}
+
+func (c *countingRepo) ListProjects(ctx context.Context, s Scope) ([]Project, error) {
+	c.projects.Add(1)
+	return c.Repository.ListProjects(ctx, s)
+}
+
+type testTaskNode struct {
+	Title   string `json:"title"`
+	Project *struct {
+		Name string `json:"name"`
+	} `json:"project"`
+	Parent *struct {
+		Title string `json:"title"`
+	} `json:"parent"`
+	Subtasks []struct {
+		Title string `json:"title"`
+	} `json:"subtasks"`
+}
+
+type testConnection struct {
+	Edges []struct {
+		Cursor string       `json:"cursor"`
+		Node   testTaskNode `json:"node"`
+	} `json:"edges"`
+	Nodes    []testTaskNode `json:"nodes"`
+	PageInfo struct {
+		HasNextPage bool    `json:"hasNextPage"`
+		EndCursor   *string `json:"endCursor"`
+	} `json:"pageInfo"`
+}
+
+const testTasksQuery = `query($first: Int, $after: String) {
+	tasks(first: $first, after: $after) {
+		edges { cursor node { title project { name } parent { title } subtasks { title } } }
+		pageInfo { hasNextPage endCursor }
+	}
+}`
+
+func TestGraphQL_QueryBatching(t *testing.T) {
+	forEachRepo(t, func(t *testing.T, base Repository) {
+		repo := &countingRepo{Repository: base}
+		r := newTestServer(repo)
+		doJSON(t, r, http.MethodPost, "/projects", `{"name":"Home"}`)
+		doJSON(t, r, http.MethodPost, "/projects", `{"name":"Work"}`)
+		doJSON(t, r, http.MethodPost, "/tasks", `{"title":"clean","project_id":1}`)
+		doJSON(t, r, http.MethodPost, "/tasks", `{"title":"kitchen","project_id":1,"parent_id":1}`)
+		doJSON(t, r, http.MethodPost, "/tasks", `{"title":"report","project_id":2,"tags":["q3"]}`)
+		doJSON(t, r, http.MethodPost, "/tasks", `{"title":"call mom","tags":["q3","family"]}`)
+		doJSON(t, r, http.MethodPost, "/tasks", `{"title":"bathroom","project_id":1,"parent_id":1}`)
+
+		repo.lists.Store(0)
+		repo.projects.Store(0)
+		var data struct{ Tasks testConnection }
+		if res := doGraphQL(t, r, "", testTasksQuery, nil, &data); len(res.Errors) > 0 {
+			t.Fatalf("unexpected errors %+v", res.Errors)
+		}
+		// one call for the page, one for its parents and one for its
+		// subtasks, however many tasks there are
+		if n, p := repo.lists.Load(), repo.projects.Load(); n != 3 || p != 1 {
+			t.Fatalf("expected 3 List and 1 ListProjects calls, got %d and %d", n, p)
+		}
+		if len(data.Tasks.Edges) != 5 || data.Tasks.PageInfo.HasNextPage {
+			t.Fatalf("unexpected connection %+v", data.Tasks)
+		}
+		clean, kitchen, mom := data.Tasks.Edges[0].Node, data.Tasks.Edges[1].Node, data.Tasks.Edges[3].Node
+		if clean.Project.Name != "Home" || clean.Parent != nil || len(clean.Subtasks) != 2 || clean.Subtasks[1].Title != "bathroom" {
+			t.Fatalf("unexpected task %+v", clean)
+		}
+		if kitchen.Parent == nil || kitchen.Parent.Title != "clean" || len(kitchen.Subtasks) != 0 {
+			t.Fatalf("unexpected task %+v", kitchen)
+		}
+		if mom.Project != nil {
+			t.Fatalf("unexpected task %+v", mom)
+		}
+
+		// paging by cursor
+		var titles []string
+		var after any
+		for range 3 {
+			var page struct{ Tasks testConnection }
+			doGraphQL(t, r, "", testTasksQuery, map[string]any{"first": 2, "after": after}, &page)
+			for _, e := range page.Tasks.Edges {
+				titles = append(titles, e.Node.Title)
+			}
+			if more := len(titles) < 5; page.Tasks.PageInfo.HasNextPage != more {
+				t.Fatalf("after %v: expected hasNextPage %v", titles, more)
+			}
+			after = *page.Tasks.PageInfo.EndCursor
+		}
+		if !slices.Equal(titles, []string{"clean", "kitchen", "report", "call mom", "bathroom"}) {
+			t.Fatalf("unexpected pages %v", titles)
+		}
+
+		repo.lists.Store(0)
+		var projects struct {
+			Projects []struct {
+				Name  string
+				Tasks testConnection
+			}
+		}
+		doGraphQL(t, r, "", `{ projects { name tasks(first: 2) { nodes { title } pageInfo { hasNextPage } } } }`, nil, &projects)
+		if n := repo.lists.Load(); n != 1 {
+			t.Fatalf("expected the tasks of both projects in 1 List call, got %d", n)
+		}
+		home, work := projects.Projects[0], projects.Projects[1]
+		if len(home.Tasks.Nodes) != 2 || !home.Tasks.PageInfo.HasNextPage || len(work.Tasks.Nodes) != 1 || work.Tasks.Nodes[0].Title != "report" {
+			t.Fatalf("unexpected projects %+v", projects)
+		}
+
+		var tags struct {
+			Tags []struct {
+				Name      string
+				TaskCount int
+			}
+		}
+		doGraphQL(t, r, "", `{ tags { name taskCount } }`, nil, &tags)
+		if len(tags.Tags) != 2 || tags.Tags[0].Name != "family" || tags.Tags[1].TaskCount != 2 {
+			t.Fatalf("unexpected tags %+v", tags)
+		}
+
+		res := doGraphQL(t, r, "", `{ tasks(after: "nope") { nodes { title } } }`, nil, nil)
+		if len(res.Errors) != 1 || res.Errors[0].Extensions.Code != "validation_error" {
+			t.Fatalf("expected a validation error, got %+v", res)
+		}
+	})
+}
+
+func TestGraphQL_Mutations(t *testing.T) {
+	r := newTestServer(NewInMemoryRepo())
+
+	var created struct {
+		CreateProject struct{ ID string }
+	}
+	doGraphQL(t, r, "", `mutation { createProject(input: {name: "Home"}) { id } }`, nil, &created)
+	if created.CreateProject.ID != "1" {
+		t.Fatalf("unexpected project %+v", created)
+	}
+
+	const create = `mutation($in: CreateTaskInput!) {
+		createTask(input: $in) { id title tags dueAt project { name } checklist { text done } }
+	}`
+	var task struct {
+		CreateTask struct {
+			ID        string
+			Title     string
+			Tags      []string
+			DueAt     *string
+			Project   struct{ Name string }
+			Checklist []ChecklistItem
+		}
+	}
+	in := map[string]any{
+		"title": "water plants", "projectId": "1", "tags": []string{" Garden "},
+		"dueAt": "2030-01-02T15:04:05Z", "checklist": []map[string]any{{"text": "ficus", "done": true}},
+	}
+	if res := doGraphQL(t, r, "", create, map[string]any{"in": in}, &task); len(res.Errors) > 0 {
+		t.Fatalf("unexpected errors %+v", res.Errors)
+	}
+	got := task.CreateTask
+	if got.Title != "water plants" || !slices.Equal(got.Tags, []string{"garden"}) || got.DueAt == nil ||
+		got.Project.Name != "Home" || len(got.Checklist) != 1 || !got.Checklist[0].Done {
+		t.Fatalf("unexpected task %+v", got)
+	}
+
+	res := doGraphQL(t, r, "", create, map[string]any{"in": map[string]any{"title": " ", "projectId": "9", "priority": 7}}, nil)
+	if len(res.Errors) != 1 || res.Errors[0].Extensions.Code != "validation_error" || len(res.Errors[0].Extensions.Details) != 3 {
+		t.Fatalf("expected 3 validation errors, got %+v", res)
+	}
+
+	var updated struct {
+		UpdateTask struct {
+			Done        bool
+			DueAt       *string
+			CompletedAt *string
+		}
+	}
+	res = doGraphQL(t, r, "", `mutation { updateTask(id: "1", input: {done: true, dueAt: null}) { done dueAt completedAt } }`, nil, &updated)
+	if len(res.Errors) > 0 || !updated.UpdateTask.Done || updated.UpdateTask.DueAt != nil || updated.UpdateTask.CompletedAt == nil {
+		t.Fatalf("unexpected update %+v %+v", updated, res.Errors)
+	}
+	res = doGraphQL(t, r, "", `mutation { updateTask(id: "2", input: {done: true}) { id } }`, nil, nil)
+	if len(res.Errors) != 1 || res.Errors[0].Extensions.Code != "not_found" {
+		t.Fatalf("expected not_found, got %+v", res)
+	}
+
+	for body, want := range map[string]int{
+		`not json`:      http.StatusBadRequest,
+		`{"query":" "}`: http.StatusUnprocessableEntity,
+	} {
+		if rec := doJSON(t, r, http.MethodPost, "/graphql", body); rec.Code != want {
+			t.Fatalf("%s: expected %d, got %d", body, want, rec.Code)
+		}
+	}
+}
+
+func TestGraphQL_Scope(t *testing.T) {
+	repo := NewInMemoryRepo()
+	r := newAuthServer(repo)
+	if rec := doJSON(t, r, http.MethodPost, "/graphql", `{"query":"{ projects { id } }"}`); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 without a token, got %d", rec.Code)
+	}
+
+	victim := createTestWorkspace(t, r, "acme", "acme-admin")
+	intruder := createTestWorkspace(t, r, "globex", "globex-admin")
+	project := createdID(t, r, victim, "/projects", `{"name":"secret"}`)
+	task := createdID(t, r, victim, "/tasks", fmt.Sprintf(`{"title":"plans","project_id":%d}`, project))
+
+	var data struct {
+		Task     *struct{ Title string }
+		Project  *struct{ Name string }
+		Tasks    testConnection
+		Projects []struct{ Name string }
+	}
+	query := fmt.Sprintf(`{ task(id: "%d") { title } project(id: "%d") { name } tasks { nodes { title } } projects { name } }`, task, project)
+	doGraphQL(t, r, intruder, query, nil, &data)
+	if data.Task != nil || data.Project != nil || len(data.Tasks.Nodes) != 0 || len(data.Projects) != 0 {
+		t.Fatalf("intruder sees %+v", data)
+	}
+	doGraphQL(t, r, victim, query, nil, &data)
+	if data.Task == nil || data.Project == nil || len(data.Tasks.Nodes) != 1 || len(data.Projects) != 1 {
+		t.Fatalf("victim sees %+v", data)
+	}
+
+	res := doGraphQL(t, r, intruder, fmt.Sprintf(`mutation { updateTask(id: "%d", input: {title: "pwned"}) { id } }`, task), nil, nil)
+	if len(res.Errors) != 1 || res.Errors[0].Extensions.Code != "not_found" {
+		t.Fatalf("expected not_found, got %+v", res)
+	}
+}
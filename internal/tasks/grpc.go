@@ -0,0 +1,326 @@
+package tasks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/s1natex/tasks-api-GO/internal/tasksv1"
+)
+
+// watchBuffer is how many events a WatchTasks stream may fall behind
+// before it is ended.
+const watchBuffer = 256
+
+// GRPCService implements tasksv1.TasksServiceServer on a Repository, with
+// the validation and permissions of the REST routes. Field names in
+// validation errors are the REST ones.
+type GRPCService struct {
+	tasksv1.UnimplementedTasksServiceServer
+	repo   Repository
+	broker *Broker
+}
+
+// NewGRPCService serves repo; WatchTasks follows the events of broker, so
+// the changes to repo should reach it (see WithEvents and Relay).
+func NewGRPCService(repo Repository, broker *Broker) *GRPCService {
+	return &GRPCService{repo: repo, broker: broker}
+}
+
+// grpcErr maps a repository error onto a status, like the REST handlers
+// map it onto a status code.
+func grpcErr(err error) error {
+	switch {
+	case errors.Is(err, ErrNotFound):
+		return status.Error(codes.NotFound, "not_found")
+	case errors.Is(err, errForbidden):
+		return status.Error(codes.PermissionDenied, "forbidden")
+	case errors.Is(err, ErrTitleRequired):
+		return grpcValidation([]fieldError{{Field: "title", Message: "title is required"}})
+	case errors.Is(err, context.Canceled):
+		return status.Error(codes.Canceled, err.Error())
+	default:
+		return status.Error(codes.Internal, "unexpected_error")
+	}
+}
+
+// grpcValidation reports errs as INVALID_ARGUMENT with a BadRequest detail.
+func grpcValidation(errs []fieldError) error {
+	sortFieldErrors(errs)
+	br := &errdetails.BadRequest{}
+	for _, e := range errs {
+		br.FieldViolations = append(br.FieldViolations, &errdetails.BadRequest_FieldViolation{Field: e.Field, Description: e.Message})
+	}
+	st, err := status.New(codes.InvalidArgument, "validation_error").WithDetails(br)
+	if err != nil {
+		return status.Error(codes.InvalidArgument, "validation_error")
+	}
+	return st.Err()
+}
+
+func taskToProto(t Task) (*tasksv1.Task, error) {
+	pt := &tasksv1.Task{
+		Id:          t.ID,
+		Title:       t.Title,
+		Done:        t.Done,
+		ProjectId:   t.ProjectID,
+		ParentId:    t.ParentID,
+		Tags:        t.Tags,
+		Priority:    int32(t.Priority),
+		Assignee:    t.Assignee,
+		AssigneeIds: t.AssigneeIDs,
+		OwnerId:     t.OwnerID,
+		CreatedAt:   timestamppb.New(t.CreatedAt),
+	}
+	for _, it := range t.Checklist {
+		pt.Checklist = append(pt.Checklist, &tasksv1.ChecklistItem{Text: it.Text, Done: it.Done})
+	}
+	if len(t.Fields) > 0 {
+		fields, err := structpb.NewStruct(t.Fields)
+		if err != nil {
+			return nil, err
+		}
+		pt.Fields = fields
+	}
+	if t.DueAt != nil {
+		pt.DueAt = timestamppb.New(*t.DueAt)
+	}
+	if t.CompletedAt != nil {
+		pt.CompletedAt = timestamppb.New(*t.CompletedAt)
+	}
+	return pt, nil
+}
+
+func checklistFromProto(items []*tasksv1.ChecklistItem) []ChecklistItem {
+	out := make([]ChecklistItem, len(items))
+	for i, it := range items {
+		out[i] = ChecklistItem{Text: it.GetText(), Done: it.GetDone()}
+	}
+	return out
+}
+
+func (g *GRPCService) reply(t Task) (*tasksv1.Task, error) {
+	pt, err := taskToProto(t)
+	if err != nil {
+		return nil, grpcErr(err)
+	}
+	return pt, nil
+}
+
+func (g *GRPCService) CreateTask(ctx context.Context, req *tasksv1.CreateTaskRequest) (*tasksv1.Task, error) {
+	pt := req.GetTask()
+	in := TaskInput{
+		Title:       pt.GetTitle(),
+		ProjectID:   pt.ProjectId,
+		ParentID:    pt.ParentId,
+		Tags:        pt.GetTags(),
+		Checklist:   checklistFromProto(pt.GetChecklist()),
+		Fields:      pt.GetFields().AsMap(),
+		Priority:    int(pt.GetPriority()),
+		Assignee:    pt.GetAssignee(),
+		AssigneeIDs: pt.GetAssigneeIds(),
+		OwnerID:     callerID(ctx),
+	}
+	if pt.GetDueAt() != nil {
+		due := pt.GetDueAt().AsTime()
+		in.DueAt = &due
+	}
+	if len(in.Fields) == 0 {
+		in.Fields = nil
+	}
+	vErrs, err := checkTaskInput(ctx, g.repo, "", &in)
+	if err != nil {
+		return nil, grpcErr(err)
+	}
+	if len(vErrs) > 0 {
+		return nil, grpcValidation(vErrs)
+	}
+	t, err := g.repo.Create(ctx, callerScope(ctx), in)
+	if err != nil {
+		return nil, grpcErr(err)
+	}
+	return g.reply(t)
+}
+
+func (g *GRPCService) GetTask(ctx context.Context, req *tasksv1.GetTaskRequest) (*tasksv1.Task, error) {
+	t, err := g.repo.Get(ctx, callerScope(ctx), req.GetId())
+	if err != nil {
+		return nil, grpcErr(err)
+	}
+	return g.reply(t)
+}
+
+// ListTasks pages with the cursors of the GraphQL connections.
+func (g *GRPCService) ListTasks(ctx context.Context, req *tasksv1.ListTasksRequest) (*tasksv1.ListTasksResponse, error) {
+	var vErrs []fieldError
+	size := int(req.GetPageSize())
+	switch {
+	case size == 0:
+		size = graphqlPageSize
+	case size < 0 || size > maxPageSize:
+		vErrs = append(vErrs, fieldError{Field: "page_size", Message: fmt.Sprintf("page_size must be from 0 to %d", maxPageSize)})
+	}
+	q := ListQuery{ProjectID: req.ProjectId, Done: req.Done, Tag: strings.ToLower(strings.TrimSpace(req.GetTag())), Limit: size + 1}
+	if tok := req.GetPageToken(); tok != "" {
+		var ok bool
+		if q.AfterID, ok = decodeCursor(tok); !ok {
+			vErrs = append(vErrs, fieldError{Field: "page_token", Message: "page_token must come from an earlier page"})
+		}
+	}
+	if len(vErrs) > 0 {
+		return nil, grpcValidation(vErrs)
+	}
+
+	ts, err := g.repo.List(ctx, callerScope(ctx), q)
+	if err != nil {
+		return nil, grpcErr(err)
+	}
+	resp := &tasksv1.ListTasksResponse{}
+	if len(ts) > size {
+		ts = ts[:size]
+		resp.NextPageToken = encodeCursor(ts[size-1].ID)
+	}
+	for _, t := range ts {
+		pt, err := taskToProto(t)
+		if err != nil {
+			return nil, grpcErr(err)
+		}
+		resp.Tasks = append(resp.Tasks, pt)
+	}
+	return resp, nil
+}
+
+// updatePaths are the update_mask paths UpdateTask accepts.
+var updatePaths = []string{"title", "done", "tags", "checklist", "due_at", "priority", "assignee"}
+
+func (g *GRPCService) UpdateTask(ctx context.Context, req *tasksv1.UpdateTaskRequest) (*tasksv1.Task, error) {
+	pt := req.GetTask()
+	paths := req.GetUpdateMask().GetPaths()
+	if len(paths) == 0 {
+		return nil, grpcValidation([]fieldError{{Field: "update_mask", Message: "update_mask must name the fields to change"}})
+	}
+	var p TaskPatch
+	for _, path := range paths {
+		switch path {
+		case "title":
+			p.Title = &pt.Title
+		case "done":
+			p.Done = &pt.Done
+		case "tags":
+			tags := slices.Clone(pt.GetTags())
+			p.Tags = &tags
+		case "checklist":
+			items := checklistFromProto(pt.GetChecklist())
+			p.Checklist = &items
+		case "due_at":
+			if pt.GetDueAt() == nil {
+				p.ClearDueAt = true
+			} else {
+				due := pt.GetDueAt().AsTime()
+				p.DueAt = &due
+			}
+		case "priority":
+			n := int(pt.GetPriority())
+			p.Priority = &n
+		case "assignee":
+			p.Assignee = &pt.Assignee
+		default:
+			return nil, grpcValidation([]fieldError{{
+				Field:   "update_mask",
+				Message: fmt.Sprintf("update_mask paths must be among %s", strings.Join(updatePaths, ", ")),
+			}})
+		}
+	}
+	vErrs, err := checkTaskPatch(ctx, g.repo, &p)
+	if err != nil {
+		return nil, grpcErr(err)
+	}
+	if len(vErrs) > 0 {
+		return nil, grpcValidation(vErrs)
+	}
+
+	id := pt.GetId()
+	if err := checkTaskWritable(ctx, g.repo, id); err != nil {
+		return nil, grpcErr(err)
+	}
+	t, err := g.repo.Update(ctx, callerScope(ctx), id, p)
+	if err != nil {
+		return nil, grpcErr(err)
+	}
+	return g.reply(t)
+}
+
+// DeleteTask needs the same access to the task as UpdateTask.
+func (g *GRPCService) DeleteTask(ctx context.Context, req *tasksv1.DeleteTaskRequest) (*emptypb.Empty, error) {
+	if err := checkTaskWritable(ctx, g.repo, req.GetId()); err != nil {
+		return nil, grpcErr(err)
+	}
+	if err := g.repo.Delete(ctx, callerScope(ctx), req.GetId()); err != nil {
+		return nil, grpcErr(err)
+	}
+	return &emptypb.Empty{}, nil
+}
+
+var eventTypes = map[string]tasksv1.TaskEvent_Type{
+	EventCreated: tasksv1.TaskEvent_TYPE_CREATED,
+	EventUpdated: tasksv1.TaskEvent_TYPE_UPDATED,
+	EventDeleted: tasksv1.TaskEvent_TYPE_DELETED,
+}
+
+// WatchTasks sends the events of visible tasks matching the filters until
+// the client goes away or falls behind.
+func (g *GRPCService) WatchTasks(req *tasksv1.WatchTasksRequest, stream tasksv1.TasksService_WatchTasksServer) error {
+	ctx := stream.Context()
+	s := callerScope(ctx)
+	tag := strings.ToLower(strings.TrimSpace(req.GetTag()))
+	events, cancel := g.broker.Subscribe(watchBuffer)
+	defer cancel()
+	// Send the headers now, so the client knows it is watching.
+	if err := stream.SendHeader(metadata.MD{}); err != nil {
+		return err
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case e, ok := <-events:
+			if !ok {
+				select {
+				case <-g.broker.Done():
+					return status.Error(codes.Unavailable, "server shutting down")
+				default:
+					return status.Error(codes.ResourceExhausted, "watcher fell behind")
+				}
+			}
+			if req.ProjectId != nil && (e.Task.ProjectID == nil || *e.Task.ProjectID != *req.ProjectId) {
+				continue
+			}
+			if tag != "" && !slices.Contains(e.Task.Tags, tag) {
+				continue
+			}
+			if ok, err := eventVisible(ctx, g.repo, s, e); err != nil {
+				return grpcErr(err)
+			} else if !ok {
+				continue
+			}
+			pt, err := taskToProto(e.Task)
+			if err != nil {
+				return grpcErr(err)
+			}
+			if err := stream.Send(&tasksv1.TaskEvent{Type: eventTypes[e.Type], Task: pt, Time: timestamppb.New(e.At)}); err != nil {
+				return err
+			}
+		}
+	}
+}
@@ -0,0 +1,182 @@
+package tasks
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+
+	"github.com/s1natex/tasks-api-GO/internal/middleware"
+	"github.com/s1natex/tasks-api-GO/internal/tasksv1"
+)
+
+// newGRPCClient serves repo over an in-memory connection with the bearer
+// authentication of newAuthServer.
+func newGRPCClient(t *testing.T, repo Repository, broker *Broker) tasksv1.TasksServiceClient {
+	t.Helper()
+	authUnary, authStream := middleware.GRPCAuthInterceptors(middleware.AuthConfig{
+		Mode:        middleware.AuthBearer,
+		BearerToken: testRootToken,
+		Lookup:      LookupPrincipal(repo),
+	})
+	srv := grpc.NewServer(grpc.UnaryInterceptor(authUnary), grpc.StreamInterceptor(authStream))
+	tasksv1.RegisterTasksServiceServer(srv, NewGRPCService(repo, broker))
+	lis := bufconn.Listen(1 << 20)
+	go func() { _ = srv.Serve(lis) }()
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	return tasksv1.NewTasksServiceClient(conn)
+}
+
+func asUser(token string) context.Context {
+	return metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer "+token)
+}
+
+func TestGRPC_TaskLifecycle(t *testing.T) {
+	forEachRepo(t, func(t *testing.T, repo Repository) {
+		c := newGRPCClient(t, repo, NewBroker())
+		ctx := asUser(testRootToken)
+
+		if _, err := c.GetTask(context.Background(), &tasksv1.GetTaskRequest{Id: 1}); status.Code(err) != codes.Unauthenticated {
+			t.Fatalf("expected UNAUTHENTICATED without credentials, got %v", err)
+		}
+
+		var ids []int64
+		for _, title := range []string{"one", "two", "three"} {
+			task, err := c.CreateTask(ctx, &tasksv1.CreateTaskRequest{Task: &tasksv1.Task{Title: title, Tags: []string{" Work "}}})
+			if err != nil {
+				t.Fatalf("create %s: %v", title, err)
+			}
+			if len(task.Tags) != 1 || task.Tags[0] != "work" {
+				t.Fatalf("expected normalized tags, got %v", task.Tags)
+			}
+			ids = append(ids, task.Id)
+		}
+
+		_, err := c.CreateTask(ctx, &tasksv1.CreateTaskRequest{Task: &tasksv1.Task{Title: " ", Priority: 9}})
+		if status.Code(err) != codes.InvalidArgument {
+			t.Fatalf("expected INVALID_ARGUMENT, got %v", err)
+		}
+		var fields []string
+		for _, d := range status.Convert(err).Details() {
+			if br, ok := d.(*errdetails.BadRequest); ok {
+				for _, v := range br.FieldViolations {
+					fields = append(fields, v.Field)
+				}
+			}
+		}
+		if len(fields) != 2 || fields[0] != "priority" || fields[1] != "title" {
+			t.Fatalf("expected violations of priority and title, got %v", fields)
+		}
+
+		var listed []int64
+		token := ""
+		for pages := 0; ; pages++ {
+			if pages > 3 {
+				t.Fatalf("too many pages")
+			}
+			resp, err := c.ListTasks(ctx, &tasksv1.ListTasksRequest{PageSize: 2, PageToken: token})
+			if err != nil {
+				t.Fatalf("list: %v", err)
+			}
+			for _, task := range resp.Tasks {
+				listed = append(listed, task.Id)
+			}
+			if token = resp.NextPageToken; token == "" {
+				break
+			}
+		}
+		if len(listed) != 3 || listed[0] != ids[0] || listed[2] != ids[2] {
+			t.Fatalf("expected %v over the pages, got %v", ids, listed)
+		}
+		if _, err := c.ListTasks(ctx, &tasksv1.ListTasksRequest{PageToken: "bogus"}); status.Code(err) != codes.InvalidArgument {
+			t.Fatalf("expected INVALID_ARGUMENT for a bad token, got %v", err)
+		}
+
+		updated, err := c.UpdateTask(ctx, &tasksv1.UpdateTaskRequest{
+			Task:       &tasksv1.Task{Id: ids[0], Title: "ignored", Done: true},
+			UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"done"}},
+		})
+		if err != nil {
+			t.Fatalf("update: %v", err)
+		}
+		if !updated.Done || updated.Title != "one" || updated.CompletedAt == nil {
+			t.Fatalf("expected only done to change, got %+v", updated)
+		}
+		_, err = c.UpdateTask(ctx, &tasksv1.UpdateTaskRequest{
+			Task:       &tasksv1.Task{Id: ids[0]},
+			UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"owner_id"}},
+		})
+		if status.Code(err) != codes.InvalidArgument {
+			t.Fatalf("expected INVALID_ARGUMENT for an unknown path, got %v", err)
+		}
+
+		if _, err := c.DeleteTask(ctx, &tasksv1.DeleteTaskRequest{Id: ids[1]}); err != nil {
+			t.Fatalf("delete: %v", err)
+		}
+		if _, err := c.GetTask(ctx, &tasksv1.GetTaskRequest{Id: ids[1]}); status.Code(err) != codes.NotFound {
+			t.Fatalf("expected NOT_FOUND after delete, got %v", err)
+		}
+	})
+}
+
+func TestGRPC_WatchTasks(t *testing.T) {
+	broker := NewBroker()
+	repo := WithEvents(NewInMemoryRepo(), broker)
+	r := newAuthServer(repo)
+	c := newGRPCClient(t, repo, broker)
+	acme := createTestWorkspace(t, r, "acme", "acme-admin")
+	globex := createTestWorkspace(t, r, "globex", "globex-admin")
+
+	ctx, cancel := context.WithTimeout(asUser(acme), 5*time.Second)
+	defer cancel()
+	stream, err := c.WatchTasks(ctx, &tasksv1.WatchTasksRequest{Tag: "ops"})
+	if err != nil {
+		t.Fatalf("watch: %v", err)
+	}
+	// The header arrives once the server has subscribed.
+	if _, err := stream.Header(); err != nil {
+		t.Fatalf("header: %v", err)
+	}
+
+	if _, err := c.CreateTask(asUser(globex), &tasksv1.CreateTaskRequest{Task: &tasksv1.Task{Title: "theirs", Tags: []string{"ops"}}}); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if _, err := c.CreateTask(asUser(acme), &tasksv1.CreateTaskRequest{Task: &tasksv1.Task{Title: "untagged"}}); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	mine, err := c.CreateTask(asUser(acme), &tasksv1.CreateTaskRequest{Task: &tasksv1.Task{Title: "ours", Tags: []string{"ops"}}})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if _, err := c.DeleteTask(asUser(acme), &tasksv1.DeleteTaskRequest{Id: mine.Id}); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+
+	for _, want := range []tasksv1.TaskEvent_Type{tasksv1.TaskEvent_TYPE_CREATED, tasksv1.TaskEvent_TYPE_DELETED} {
+		e, err := stream.Recv()
+		if err != nil {
+			t.Fatalf("recv: %v", err)
+		}
+		if e.Type != want || e.Task.Id != mine.Id {
+			t.Fatalf("expected %v of task %d, got %v of %q", want, mine.Id, e.Type, e.Task.Title)
+		}
+	}
+}
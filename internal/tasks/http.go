@@ -1,18 +1,71 @@
 package tasks
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 )
 
 type createTaskRequest struct {
-	Title string `json:"title"`
+	Title       string          `json:"title"`
+	ProjectID   *int64          `json:"project_id"`
+	ParentID    *int64          `json:"parent_id"`
+	Tags        []string        `json:"tags"`
+	Checklist   []ChecklistItem `json:"checklist"`
+	Fields      map[string]any  `json:"fields"`
+	DueAt       *time.Time      `json:"due_at"`
+	Priority    int             `json:"priority"`
+	Assignee    string          `json:"assignee"`
+	AssigneeIDs []int64         `json:"assignee_ids"`
 }
 
+type updateTaskRequest struct {
+	Title     *string             `json:"title"`
+	Done      *bool               `json:"done"`
+	Tags      *[]string           `json:"tags"`
+	Checklist *[]ChecklistItem    `json:"checklist"`
+	DueAt     nullable[time.Time] `json:"due_at"`
+	Priority  *int                `json:"priority"`
+	Assignee  *string             `json:"assignee"`
+}
+
+// nullable tells an absent JSON member apart from an explicit null.
+type nullable[T any] struct {
+	Set   bool
+	Value *T
+}
+
+func (n *nullable[T]) UnmarshalJSON(b []byte) error {
+	n.Set = true
+	if string(b) == "null" {
+		return nil
+	}
+	var v T
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	n.Value = &v
+	return nil
+}
+
+const (
+	maxTitleLen         = 200
+	maxPageSize         = 500
+	maxTags             = 20
+	maxTagLen           = 50
+	maxChecklistItems   = 100
+	maxChecklistTextLen = 200
+)
+
 type fieldError struct {
 	Field   string `json:"field"`
 	Message string `json:"message"`
@@ -25,12 +78,75 @@ type errResponse struct {
 
 func RegisterRoutes(r chi.Router, repo Repository) {
 	r.Post("/tasks", createTask(repo))
+	r.Post("/tasks/quick", quickAddTask(repo, time.Now))
 	r.Get("/tasks", listTasks(repo))
+	r.Get("/tasks/events", taskEvents(repo))
+	r.Get("/tasks/{id}", getTask(repo))
+	r.Patch("/tasks/{id}", updateTask(repo))
+	r.Post("/tasks/{id}/assignees", assignTask(repo))
+	r.Delete("/tasks/{id}/assignees/{user_id}", unassignTask(repo))
+	r.Get("/stats", getStats(repo, time.Now))
+	r.Get("/export", exportTasks(repo))
+	r.Post("/import", importTasks(repo))
+	r.Post("/import/trello", importForeign(repo, parseTrello))
+	r.Post("/import/todoist", importForeign(repo, parseTodoist))
+	r.Get("/sync", pullChanges(repo))
+	r.Post("/sync", pushChanges(repo))
+	r.Post("/graphql", serveGraphQL(repo))
+	r.Get("/ws", serveWebSocket(repo))
+
+	r.Post("/projects", createProject(repo))
+	r.Get("/projects", listProjects(repo))
+	r.Get("/projects/{id}", getProject(repo))
+	r.Put("/projects/{id}/fields", setProjectFields(repo))
+	r.Post("/projects/{id}/members", addProjectMember(repo))
+	r.Get("/projects/{id}/members", listProjectMembers(repo))
+
+	r.Post("/views", createView(repo))
+	r.Get("/views", listViews(repo))
+	r.Get("/views/{id}", getView(repo))
+	r.Delete("/views/{id}", deleteView(repo))
+	r.Get("/views/{id}/tasks", listViewTasks(repo))
+
+	r.Post("/webhooks", createWebhook(repo))
+	r.Get("/webhooks", listWebhooks(repo))
+	r.Get("/webhooks/{id}", getWebhook(repo))
+	r.Patch("/webhooks/{id}", updateWebhook(repo))
+	r.Delete("/webhooks/{id}", deleteWebhook(repo))
+	r.Get("/webhooks/{id}/deliveries", listWebhookDeliveries(repo))
+	r.Post("/webhooks/{id}/deliveries/{delivery_id}/redeliver", redeliverWebhook(repo))
+
+	r.Post("/templates", createTemplate(repo))
+	r.Get("/templates", listTemplates(repo))
+	r.Get("/templates/{id}", getTemplate(repo))
+	r.Delete("/templates/{id}", deleteTemplate(repo))
+	r.Post("/templates/{id}/instantiate", instantiateTemplate(repo))
+
+	r.Post("/users", createUser(repo))
+	r.Get("/users", listUsers(repo))
+	r.Get("/me", getMe(repo))
+	r.Get("/me/tasks", listMyTasks(repo))
+	r.Post("/me/ical-token", rotateFeedToken(repo))
+	r.Delete("/me/ical-token", revokeFeedToken(repo))
+	r.Get("/ical/{file}", calendarFeed(repo, time.Now))
+
+	r.Get("/.well-known/caldav", davWellKnown)
+	r.Method("PROPFIND", "/.well-known/caldav", http.HandlerFunc(davWellKnown))
+	r.Options("/caldav/*", davOptions)
+	r.Method("PROPFIND", "/caldav/", http.HandlerFunc(propfindPrincipal))
+	r.Method("PROPFIND", "/caldav/projects/", propfindHome(repo))
+	r.Method("PROPFIND", "/caldav/projects/{project}/", propfindCalendar(repo))
+	r.Method("REPORT", "/caldav/projects/{project}/", calendarReport(repo))
+	r.Method("PROPFIND", "/caldav/projects/{project}/{name}", propfindObject(repo))
+	r.Get("/caldav/projects/{project}/{name}", getCalendarObject(repo))
+	r.Put("/caldav/projects/{project}/{name}", putCalendarObject(repo))
+	r.Delete("/caldav/projects/{project}/{name}", deleteCalendarObject(repo))
+
+	r.Post("/workspaces", createWorkspace(repo))
+	r.Get("/workspaces", listWorkspaces(repo))
 }
 
 func createTask(repo Repository) http.HandlerFunc {
-	const maxTitleLen = 200
-
 	return func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
 
@@ -40,7 +156,29 @@ func createTask(repo Repository) http.HandlerFunc {
 			return
 		}
 
-		if vErrs := validateCreateTask(req.Title, maxTitleLen); len(vErrs) > 0 {
+		in := TaskInput{
+			Title:       req.Title,
+			ProjectID:   req.ProjectID,
+			ParentID:    req.ParentID,
+			Tags:        req.Tags,
+			Checklist:   req.Checklist,
+			Fields:      req.Fields,
+			DueAt:       req.DueAt,
+			Priority:    req.Priority,
+			Assignee:    req.Assignee,
+			AssigneeIDs: req.AssigneeIDs,
+			OwnerID:     callerID(r.Context()),
+		}
+		vErrs, err := checkTaskInput(r.Context(), repo, "", &in)
+		if errors.Is(err, errForbidden) {
+			writeJSON(w, http.StatusForbidden, errResponse{Error: "forbidden"})
+			return
+		}
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, errResponse{Error: "unexpected_error"})
+			return
+		}
+		if len(vErrs) > 0 {
 			writeJSON(w, http.StatusUnprocessableEntity, errResponse{
 				Error:   "validation_error",
 				Details: vErrs,
@@ -48,7 +186,7 @@ func createTask(repo Repository) http.HandlerFunc {
 			return
 		}
 
-		t, err := repo.Create(req.Title)
+		t, err := repo.Create(r.Context(), callerScope(r.Context()), in)
 		if err != nil {
 			if err == ErrTitleRequired {
 				writeJSON(w, http.StatusUnprocessableEntity, errResponse{
@@ -67,19 +205,492 @@ func createTask(repo Repository) http.HandlerFunc {
 	}
 }
 
+func getTask(repo Repository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		id, ok := pathID(r, "id")
+		if !ok {
+			writeJSON(w, http.StatusNotFound, errResponse{Error: "not_found"})
+			return
+		}
+		proj, vErrs := parseProjection(r.URL.Query())
+		if len(vErrs) > 0 {
+			writeValidation(w, vErrs)
+			return
+		}
+		s := callerScope(r.Context())
+		t, err := repo.Get(r.Context(), s, id)
+		if errors.Is(err, ErrNotFound) {
+			writeJSON(w, http.StatusNotFound, errResponse{Error: "not_found"})
+			return
+		}
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, errResponse{Error: "unexpected_error"})
+			return
+		}
+		out, err := proj.render(r.Context(), repo, s, []Task{t})
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, errResponse{Error: "unexpected_error"})
+			return
+		}
+		writeJSON(w, http.StatusOK, out[0])
+	}
+}
+
+// checkTaskInput validates in and normalizes its tags and custom field
+// values in place. Error fields are prefixed with prefix so nested inputs,
+// such as template subtasks, can be told apart.
+func checkTaskInput(ctx context.Context, repo Repository, prefix string, in *TaskInput) ([]fieldError, error) {
+	errs := validateCreateTask(in.Title, maxTitleLen)
+
+	tags, tErrs := normalizeTags(in.Tags)
+	in.Tags = tags
+	errs = append(errs, tErrs...)
+	errs = append(errs, validateChecklist(in.Checklist)...)
+	errs = append(errs, validatePriority(in.Priority)...)
+	// the user the handle names is assigned, which is what access and
+	// GET /me/tasks go by
+	uid, aErrs, err := checkAssignee(ctx, repo, in.Assignee)
+	if err != nil {
+		return nil, err
+	}
+	errs = append(errs, aErrs...)
+	if uid != 0 && !slices.Contains(in.AssigneeIDs, uid) {
+		in.AssigneeIDs = append(in.AssigneeIDs, uid)
+	}
+
+	fields, fErrs, err := validateTaskFields(ctx, repo, in.ProjectID, in.Fields)
+	if err != nil {
+		return nil, err
+	}
+	in.Fields = fields
+	errs = append(errs, fErrs...)
+
+	if in.ParentID != nil {
+		_, err := repo.Get(ctx, callerScope(ctx), *in.ParentID)
+		if errors.Is(err, ErrNotFound) {
+			errs = append(errs, fieldError{Field: "parent_id", Message: "parent task not found"})
+		} else if err != nil {
+			return nil, err
+		}
+	}
+	for i, id := range in.AssigneeIDs {
+		_, err := repo.GetUser(ctx, callerScope(ctx), id)
+		if errors.Is(err, ErrNotFound) {
+			errs = append(errs, fieldError{Field: fmt.Sprintf("assignee_ids[%d]", i), Message: "user not found"})
+		} else if err != nil {
+			return nil, err
+		}
+	}
+
+	for i := range errs {
+		errs[i].Field = prefix + errs[i].Field
+	}
+	return errs, nil
+}
+
+func validatePriority(p int) []fieldError {
+	if p < 0 || p > maxPriority {
+		return []fieldError{{Field: "priority", Message: fmt.Sprintf("priority must be between 0 and %d", maxPriority)}}
+	}
+	return nil
+}
+
+// checkAssignee resolves an assignee handle to the user of the caller's
+// workspace it names, reporting a handle that names none.
+func checkAssignee(ctx context.Context, repo Repository, a string) (int64, []fieldError, error) {
+	if a == "" {
+		return 0, nil, nil
+	}
+	if !handleRe.MatchString(a) {
+		return 0, []fieldError{{Field: "assignee", Message: "assignee must be a handle of letters, digits, '.', '_' or '-'"}}, nil
+	}
+	users, err := repo.ListUsers(ctx, callerScope(ctx))
+	if err != nil {
+		return 0, nil, err
+	}
+	i := slices.IndexFunc(users, func(u User) bool { return u.Name == a })
+	if i < 0 {
+		return 0, []fieldError{{Field: "assignee", Message: "assignee must be the name of a user of the workspace"}}, nil
+	}
+	return users[i].ID, nil, nil
+}
+
+// updateTask applies a partial update. Members left out of the body are
+// unchanged; "due_at": null clears the due date.
+func updateTask(repo Repository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		id, ok := pathID(r, "id")
+		if !ok {
+			writeJSON(w, http.StatusNotFound, errResponse{Error: "not_found"})
+			return
+		}
+		var req updateTaskRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeJSON(w, http.StatusBadRequest, errResponse{Error: "invalid_json"})
+			return
+		}
+
+		p := TaskPatch{
+			Title:     req.Title,
+			Done:      req.Done,
+			Tags:      req.Tags,
+			Checklist: req.Checklist,
+			DueAt:     req.DueAt.Value,
+			Priority:  req.Priority,
+			Assignee:  req.Assignee,
+		}
+		p.ClearDueAt = req.DueAt.Set && req.DueAt.Value == nil
+		vErrs, err := checkTaskPatch(r.Context(), repo, &p)
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, errResponse{Error: "unexpected_error"})
+			return
+		}
+		if len(vErrs) > 0 {
+			writeValidation(w, vErrs)
+			return
+		}
+
+		if !writeTaskWritable(w, r, repo, id) {
+			return
+		}
+
+		t, err := repo.Update(r.Context(), callerScope(r.Context()), id, p)
+		if errors.Is(err, ErrNotFound) {
+			writeJSON(w, http.StatusNotFound, errResponse{Error: "not_found"})
+			return
+		}
+		if errors.Is(err, ErrTitleRequired) {
+			writeValidation(w, []fieldError{{Field: "title", Message: "title is required"}})
+			return
+		}
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, errResponse{Error: "unexpected_error"})
+			return
+		}
+		writeJSON(w, http.StatusOK, t)
+	}
+}
+
+// checkTaskPatch validates the members p sets, normalizes its tags in
+// place and resolves its assignee to AssigneeID.
+func checkTaskPatch(ctx context.Context, repo Repository, p *TaskPatch) ([]fieldError, error) {
+	var errs []fieldError
+	if p.Title != nil {
+		errs = append(errs, validateCreateTask(*p.Title, maxTitleLen)...)
+	}
+	if p.Tags != nil {
+		tags, tErrs := normalizeTags(*p.Tags)
+		p.Tags = &tags
+		errs = append(errs, tErrs...)
+	}
+	if p.Checklist != nil {
+		errs = append(errs, validateChecklist(*p.Checklist)...)
+	}
+	if p.Priority != nil {
+		errs = append(errs, validatePriority(*p.Priority)...)
+	}
+	if p.Assignee != nil {
+		uid, aErrs, err := checkAssignee(ctx, repo, *p.Assignee)
+		if err != nil {
+			return nil, err
+		}
+		errs = append(errs, aErrs...)
+		p.AssigneeID = uid
+	}
+	return errs, nil
+}
+
+// checkTaskWritable reports ErrNotFound if the caller cannot see the task
+// and errForbidden if they may only read its project.
+func checkTaskWritable(ctx context.Context, repo Repository, id int64) error {
+	t, err := repo.Get(ctx, callerScope(ctx), id)
+	if err != nil || t.ProjectID == nil {
+		return err
+	}
+	err = requireRole(ctx, repo, *t.ProjectID, RoleEditor)
+	if errors.Is(err, ErrNotFound) {
+		// owners and assignees keep access without a role on the project
+		return nil
+	}
+	return err
+}
+
+// validateTaskFields resolves the task's project and checks custom field
+// values against its definitions.
+func validateTaskFields(ctx context.Context, repo Repository, projectID *int64, values map[string]any) (map[string]any, []fieldError, error) {
+	if projectID == nil {
+		if len(values) > 0 {
+			return nil, []fieldError{{Field: "fields", Message: "custom fields require project_id"}}, nil
+		}
+		return nil, nil, nil
+	}
+	p, err := repo.GetProject(ctx, callerScope(ctx), *projectID)
+	if errors.Is(err, ErrNotFound) {
+		return nil, []fieldError{{Field: "project_id", Message: "project not found"}}, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := requireRole(ctx, repo, p.ID, RoleEditor); err != nil {
+		return nil, nil, err
+	}
+	out, errs := validateFieldValues(p.Fields, values)
+	return out, errs, nil
+}
+
+// normalizeTags trims and lowercases tags and drops duplicates.
+func normalizeTags(tags []string) ([]string, []fieldError) {
+	var errs []fieldError
+	if len(tags) > maxTags {
+		errs = append(errs, fieldError{Field: "tags", Message: fmt.Sprintf("at most %d tags are allowed", maxTags)})
+	}
+	var out []string
+	for _, t := range tags {
+		t = strings.ToLower(strings.TrimSpace(t))
+		switch {
+		case t == "":
+			errs = append(errs, fieldError{Field: "tags", Message: "tags must not be empty"})
+		case len(t) > maxTagLen:
+			errs = append(errs, fieldError{Field: "tags", Message: fmt.Sprintf("tags must be at most %d characters", maxTagLen)})
+		case strings.ContainsAny(t, " \t\n,"):
+			errs = append(errs, fieldError{Field: "tags", Message: "tags must not contain spaces or commas"})
+		case !slices.Contains(out, t):
+			out = append(out, t)
+		}
+	}
+	return out, errs
+}
+
+func validateChecklist(items []ChecklistItem) []fieldError {
+	var errs []fieldError
+	if len(items) > maxChecklistItems {
+		errs = append(errs, fieldError{Field: "checklist", Message: fmt.Sprintf("at most %d checklist items are allowed", maxChecklistItems)})
+	}
+	for i, it := range items {
+		key := fmt.Sprintf("checklist[%d].text", i)
+		if strings.TrimSpace(it.Text) == "" {
+			errs = append(errs, fieldError{Field: key, Message: "text is required"})
+		} else if len(it.Text) > maxChecklistTextLen {
+			errs = append(errs, fieldError{Field: key, Message: fmt.Sprintf("text must be at most %d characters", maxChecklistTextLen)})
+		}
+	}
+	return errs
+}
+
 func listTasks(repo Repository) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
 
-		tasks, err := repo.List()
+		q, vErrs, err := parseListQuery(r, repo, r.URL.Query())
 		if err != nil {
 			writeJSON(w, http.StatusInternalServerError, errResponse{Error: "unexpected_error"})
 			return
 		}
-		writeJSON(w, http.StatusOK, tasks)
+		proj, pErrs := parseProjection(r.URL.Query())
+		if vErrs = append(vErrs, pErrs...); len(vErrs) > 0 {
+			writeJSON(w, http.StatusUnprocessableEntity, errResponse{
+				Error:   "validation_error",
+				Details: vErrs,
+			})
+			return
+		}
+		writeTasks(w, r, repo, q, proj)
 	}
 }
 
+// writeTasks answers a task listing with the tasks matching q, in the
+// representation the client accepts: todo.txt or NDJSON streamed from the
+// repository, or a JSON array, both of the latter shaped by proj.
+func writeTasks(w http.ResponseWriter, r *http.Request, repo Repository, q ListQuery, proj projection) {
+	q.Select = proj.selection()
+
+	s := callerScope(r.Context())
+	if accepts(r, todoTxtType) {
+		// todo.txt has a fixed set of attributes
+		q.Select = nil
+		enc, err := newTodoTxtEncoder(r.Context(), repo, s, w)
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, errResponse{Error: "unexpected_error"})
+			return
+		}
+		streamTasks(w, r, repo, s, q, todoTxtType, enc)
+		return
+	}
+	if accepts(r, ndjsonType) {
+		render, err := proj.renderer(r.Context(), repo, s)
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, errResponse{Error: "unexpected_error"})
+			return
+		}
+		streamTasks(w, r, repo, s, q, ndjsonType, newNDJSONEncoder(w, render))
+		return
+	}
+	tasks, err := repo.List(r.Context(), s, q)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, errResponse{Error: "unexpected_error"})
+		return
+	}
+	out, err := proj.render(r.Context(), repo, s, tasks)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, errResponse{Error: "unexpected_error"})
+		return
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+// parseListQuery turns GET /tasks query parameters into a ListQuery:
+//
+//	project_id=1&parent_id=7&tag=home&done=false
+//	fields.severity=high            (equality)
+//	fields.points[gte]=3            (eq, ne, gt, gte, lt, lte)
+//	sort=-fields.points,title       (leading "-" sorts descending)
+//
+// Custom field filters and sorts need project_id so values can be typed
+// against that project's definitions.
+func parseListQuery(r *http.Request, repo Repository, params url.Values) (ListQuery, []fieldError, error) {
+	var (
+		q    ListQuery
+		errs []fieldError
+		defs []FieldDef
+	)
+
+	if s := params.Get("project_id"); s != "" {
+		id, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			errs = append(errs, fieldError{Field: "project_id", Message: "project_id must be an integer"})
+		} else {
+			q.ProjectID = &id
+			p, err := repo.GetProject(r.Context(), callerScope(r.Context()), id)
+			switch {
+			case errors.Is(err, ErrNotFound):
+				errs = append(errs, fieldError{Field: "project_id", Message: "project not found"})
+			case err != nil:
+				return ListQuery{}, nil, err
+			default:
+				defs = p.Fields
+			}
+		}
+	}
+	if s := params.Get("parent_id"); s != "" {
+		id, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			errs = append(errs, fieldError{Field: "parent_id", Message: "parent_id must be an integer"})
+		} else {
+			q.ParentID = &id
+		}
+	}
+	if s := params.Get("assignee_id"); s != "" {
+		id, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			errs = append(errs, fieldError{Field: "assignee_id", Message: "assignee_id must be an integer"})
+		} else {
+			q.AssigneeID = &id
+		}
+	}
+	if s := params.Get("tag"); s != "" {
+		q.Tag = strings.ToLower(strings.TrimSpace(s))
+	}
+	if s := params.Get("done"); s != "" {
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			errs = append(errs, fieldError{Field: "done", Message: "done must be true or false"})
+		} else {
+			q.Done = &b
+		}
+	}
+
+	for key, vals := range params {
+		name, ok := strings.CutPrefix(key, "fields.")
+		if !ok {
+			continue
+		}
+		op := "eq"
+		if i := strings.IndexByte(name, '['); i >= 0 && strings.HasSuffix(name, "]") {
+			name, op = name[:i], name[i+1:len(name)-1]
+		}
+		if _, ok := filterOps[op]; !ok {
+			errs = append(errs, fieldError{Field: key, Message: "operator must be one of eq, ne, gt, gte, lt, lte"})
+			continue
+		}
+		def, fErr := customFieldFor(q, defs, key, name)
+		if fErr != nil {
+			errs = append(errs, *fErr)
+			continue
+		}
+		if op != "eq" && op != "ne" && !def.Type.ordered() {
+			errs = append(errs, fieldError{Field: key, Message: fmt.Sprintf("%s fields only support eq and ne", def.Type)})
+			continue
+		}
+		for _, s := range vals {
+			v, err := parseFieldValue(def, s)
+			if err != nil {
+				errs = append(errs, fieldError{Field: key, Message: err.Error()})
+				continue
+			}
+			q.Fields = append(q.Fields, FieldFilter{Name: name, Op: op, Value: v})
+		}
+	}
+
+	if s := params.Get("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 || n > maxPageSize {
+			errs = append(errs, fieldError{Field: "limit", Message: fmt.Sprintf("limit must be an integer from 1 to %d", maxPageSize)})
+		} else {
+			q.Limit = n
+		}
+	}
+	if s := params.Get("offset"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 {
+			errs = append(errs, fieldError{Field: "offset", Message: "offset must be a non-negative integer"})
+		} else {
+			q.Offset = n
+		}
+	}
+
+	if s := params.Get("sort"); s != "" {
+		for _, part := range strings.Split(s, ",") {
+			k := SortKey{}
+			if rest, ok := strings.CutPrefix(part, "-"); ok {
+				k.Desc, part = true, rest
+			}
+			switch {
+			case part == "id", part == "title", part == "created_at", part == "due_at", part == "priority":
+				k.Column = part
+			case strings.HasPrefix(part, "fields."):
+				name := strings.TrimPrefix(part, "fields.")
+				if _, fErr := customFieldFor(q, defs, "sort", name); fErr != nil {
+					errs = append(errs, *fErr)
+					continue
+				}
+				k.Field = name
+			default:
+				errs = append(errs, fieldError{Field: "sort", Message: "cannot sort by " + part})
+				continue
+			}
+			q.Sort = append(q.Sort, k)
+		}
+	}
+
+	sortFieldErrors(errs)
+	return q, errs, nil
+}
+
+func customFieldFor(q ListQuery, defs []FieldDef, key, name string) (FieldDef, *fieldError) {
+	if q.ProjectID == nil {
+		return FieldDef{}, &fieldError{Field: key, Message: "custom fields require project_id"}
+	}
+	def, ok := findField(defs, name)
+	if !ok {
+		return FieldDef{}, &fieldError{Field: key, Message: "unknown field " + name}
+	}
+	return def, nil
+}
+
 func validateCreateTask(title string, maxLen int) []fieldError {
 	var errs []fieldError
 
@@ -104,3 +715,21 @@ func writeJSON(w http.ResponseWriter, status int, v any) {
 	w.WriteHeader(status)
 	_ = json.NewEncoder(w).Encode(v)
 }
+
+func writeValidation(w http.ResponseWriter, errs []fieldError) {
+	writeJSON(w, http.StatusUnprocessableEntity, errResponse{
+		Error:   "validation_error",
+		Details: errs,
+	})
+}
+
+// sortFieldErrors orders errors by field so responses built from map
+// iteration are deterministic.
+func sortFieldErrors(errs []fieldError) {
+	slices.SortStableFunc(errs, func(a, b fieldError) int { return strings.Compare(a.Field, b.Field) })
+}
+
+func pathID(r *http.Request, key string) (int64, bool) {
+	id, err := strconv.ParseInt(chi.URLParam(r, key), 10, 64)
+	return id, err == nil && id > 0
+}
@@ -2,8 +2,10 @@ package tasks
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"strings"
@@ -144,7 +146,7 @@ func TestPostTasks_InvalidJSON(t *testing.T) {
 func TestGetTasks_HappyPath(t *testing.T) {
 	repo := NewInMemoryRepo()
 
-	seed, err := repo.Create("seeded task")
+	seed, err := repo.Create(context.Background(), Scope{}, TaskInput{Title: "seeded task"})
 	if err != nil {
 		t.Fatalf("unexpected error seeding repo: %v", err)
 	}
@@ -173,10 +175,11 @@ func TestGetTasks_HappyPath(t *testing.T) {
 	}
 }
 
-type fakeRepoListError struct{}
+type fakeRepoListError struct{ Repository }
 
-func (f fakeRepoListError) Create(title string) (Task, error) { return Task{}, nil }
-func (f fakeRepoListError) List() ([]Task, error)             { return nil, errors.New("boom") }
+func (f fakeRepoListError) List(context.Context, Scope, ListQuery) ([]Task, error) {
+	return nil, errors.New("boom")
+}
 
 func TestGetTasks_RepoError(t *testing.T) {
 	r := newTestServer(fakeRepoListError{})
@@ -197,3 +200,156 @@ func TestGetTasks_RepoError(t *testing.T) {
 		t.Errorf("expected error 'unexpected_error', got %q", resp.Error)
 	}
 }
+
+func doJSON(t *testing.T, r http.Handler, method, path, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestCustomFields_CreateAndValidate(t *testing.T) {
+	r := newTestServer(NewInMemoryRepo())
+
+	rec := doJSON(t, r, http.MethodPost, "/projects", `{"name":"support","fields":[
+		{"name":"customer","type":"text"},
+		{"name":"severity","type":"enum","options":["low","high"],"required":true},
+		{"name":"points","type":"number"}
+	]}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d, body=%s", rec.Code, rec.Body.String())
+	}
+	var p Project
+	if err := json.Unmarshal(rec.Body.Bytes(), &p); err != nil {
+		t.Fatalf("failed to parse JSON: %v", err)
+	}
+
+	rec = doJSON(t, r, http.MethodPost, "/tasks", fmt.Sprintf(`{"title":"t","project_id":%d,"fields":{"points":"many"}}`, p.ID))
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("expected 422, got %d, body=%s", rec.Code, rec.Body.String())
+	}
+	var resp errResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to parse error JSON: %v", err)
+	}
+	fields := map[string]bool{}
+	for _, d := range resp.Details {
+		fields[d.Field] = true
+	}
+	if !fields["fields.points"] || !fields["fields.severity"] {
+		t.Fatalf("expected errors keyed by field name, got %+v", resp.Details)
+	}
+
+	rec = doJSON(t, r, http.MethodPost, "/tasks", fmt.Sprintf(`{"title":"t","project_id":%d,"fields":{"severity":"high","points":3}}`, p.ID))
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d, body=%s", rec.Code, rec.Body.String())
+	}
+	var got Task
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatalf("failed to parse JSON: %v", err)
+	}
+	if got.Fields["severity"] != "high" || got.Fields["points"] != 3.0 {
+		t.Fatalf("unexpected fields: %+v", got.Fields)
+	}
+
+	rec = doJSON(t, r, http.MethodPost, "/tasks", `{"title":"t","fields":{"severity":"high"}}`)
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("expected 422 for fields without project, got %d", rec.Code)
+	}
+
+	// a new type converts the stored values, removed options drop theirs
+	rec = doJSON(t, r, http.MethodPut, fmt.Sprintf("/projects/%d/fields", p.ID),
+		`{"fields":[{"name":"points","type":"text"},{"name":"severity","type":"enum","options":["urgent"]}]}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200 on type change, got %d, body=%s", rec.Code, rec.Body.String())
+	}
+	rec = doJSON(t, r, http.MethodGet, fmt.Sprintf("/tasks/%d", got.ID), "")
+	got = Task{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatalf("failed to parse JSON: %v", err)
+	}
+	if len(got.Fields) != 1 || got.Fields["points"] != "3" {
+		t.Fatalf("expected points converted to text and severity dropped, got %+v", got.Fields)
+	}
+}
+
+func TestGetTasks_FilterAndSortByCustomField(t *testing.T) {
+	repo := NewInMemoryRepo()
+	ctx := context.Background()
+	p, err := repo.CreateProject(ctx, Scope{}, "p", []FieldDef{{Name: "points", Type: FieldNumber}})
+	if err != nil {
+		t.Fatalf("create project: %v", err)
+	}
+	for i, pts := range []float64{2, 8, 5} {
+		if _, err := repo.Create(ctx, Scope{}, TaskInput{Title: fmt.Sprint("t", i), ProjectID: &p.ID, Fields: map[string]any{"points": pts}}); err != nil {
+			t.Fatalf("seed: %v", err)
+		}
+	}
+	r := newTestServer(repo)
+
+	rec := doJSON(t, r, http.MethodGet, fmt.Sprintf("/tasks?project_id=%d&fields.points[gt]=3&sort=-fields.points", p.ID), "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d, body=%s", rec.Code, rec.Body.String())
+	}
+	var list []Task
+	if err := json.Unmarshal(rec.Body.Bytes(), &list); err != nil {
+		t.Fatalf("failed to parse JSON: %v", err)
+	}
+	if len(list) != 2 || list[0].Title != "t1" || list[1].Title != "t2" {
+		t.Fatalf("unexpected result: %+v", list)
+	}
+
+	for _, path := range []string{
+		"/tasks?fields.points=3",
+		fmt.Sprintf("/tasks?project_id=%d&fields.color=red", p.ID),
+		fmt.Sprintf("/tasks?project_id=%d&fields.points=lots", p.ID),
+		fmt.Sprintf("/tasks?project_id=%d&sort=fields.nope", p.ID),
+	} {
+		rec := doJSON(t, r, http.MethodGet, path, "")
+		if rec.Code != http.StatusUnprocessableEntity {
+			t.Errorf("%s: expected 422, got %d", path, rec.Code)
+		}
+	}
+}
+
+func TestPostTasks_TagsChecklistAndParent(t *testing.T) {
+	r := newTestServer(NewInMemoryRepo())
+
+	rec := doJSON(t, r, http.MethodPost, "/tasks", `{"title":"parent","tags":[" Home ","home","errands"],"checklist":[{"text":"milk"}]}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d, body=%s", rec.Code, rec.Body.String())
+	}
+	var parent Task
+	if err := json.Unmarshal(rec.Body.Bytes(), &parent); err != nil {
+		t.Fatalf("failed to parse JSON: %v", err)
+	}
+	if len(parent.Tags) != 2 || parent.Tags[0] != "errands" || parent.Tags[1] != "home" {
+		t.Fatalf("expected normalized tags, got %v", parent.Tags)
+	}
+
+	rec = doJSON(t, r, http.MethodPost, "/tasks", fmt.Sprintf(`{"title":"child","parent_id":%d}`, parent.ID))
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d, body=%s", rec.Code, rec.Body.String())
+	}
+
+	rec = doJSON(t, r, http.MethodGet, fmt.Sprintf("/tasks?parent_id=%d", parent.ID), "")
+	var subs []Task
+	if err := json.Unmarshal(rec.Body.Bytes(), &subs); err != nil {
+		t.Fatalf("failed to parse JSON: %v", err)
+	}
+	if len(subs) != 1 || subs[0].Title != "child" {
+		t.Fatalf("unexpected subtasks: %+v", subs)
+	}
+
+	rec = doJSON(t, r, http.MethodPost, "/tasks", `{"title":"orphan","parent_id":999,"checklist":[{"text":""}]}`)
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("expected 422, got %d, body=%s", rec.Code, rec.Body.String())
+	}
+
+	rec = doJSON(t, r, http.MethodGet, "/tasks/999", "")
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("expected 404, got %d", rec.Code)
+	}
+}
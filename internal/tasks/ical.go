@@ -0,0 +1,528 @@
+package tasks
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// A minimal RFC 5545 reader and writer: enough to publish tasks as VTODO
+// components and to import VTODO and VEVENT entries from other apps.
+
+const (
+	icalType   = "text/calendar"
+	icalProdID = "-//tasks-api//tasks//EN"
+	// icalLineLen is the longest content line in octets, before folding.
+	icalLineLen = 75
+	maxUIDLen   = 255
+)
+
+// icalOwnUID matches the UID given to tasks that were not imported, so a
+// file exported by this API maps back onto the same tasks.
+var icalOwnUID = regexp.MustCompile(`^task-([0-9]+)@tasks-api$`)
+
+func icalUID(t Task) string {
+	if t.ICalUID != "" {
+		return t.ICalUID
+	}
+	return fmt.Sprintf("task-%d@tasks-api", t.ID)
+}
+
+// icalPriority maps 1 (most urgent) to 4 onto the 1-9 scale, where 1 is
+// the highest and 0 undefined.
+func icalPriority(p int) int {
+	if p == 0 {
+		return 0
+	}
+	return 2*p - 1
+}
+
+// taskPriority is the inverse of icalPriority: 1-2 high, 3-4 and 5
+// medium, 6-9 low, matching how calendar apps group the scale.
+func taskPriority(p int) int {
+	switch {
+	case p <= 0:
+		return 0
+	case p <= 2:
+		return 1
+	case p <= 4:
+		return 2
+	case p == 5:
+		return 3
+	default:
+		return maxPriority
+	}
+}
+
+var (
+	icalEscaper   = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`)
+	icalUnescaper = strings.NewReplacer(`\\`, `\`, `\;`, ";", `\,`, ",", `\n`, "\n", `\N`, "\n")
+)
+
+// icsEncoder writes tasks as the VTODO components of one VCALENDAR.
+type icsEncoder struct {
+	w       *bufio.Writer
+	now     time.Time // DTSTAMP of every component; zero uses CREATED
+	dueOnly bool      // skip tasks without a due date, for calendar feeds
+	started bool
+}
+
+func newICSEncoder(w io.Writer, now time.Time, dueOnly bool) *icsEncoder {
+	return &icsEncoder{w: bufio.NewWriter(w), now: now.UTC(), dueOnly: dueOnly}
+}
+
+// line writes one content line, folded after icalLineLen octets without
+// splitting a UTF-8 sequence.
+func (e *icsEncoder) line(name, value string) {
+	s := name + ":" + value
+	for first := true; ; first = false {
+		n := icalLineLen
+		if !first {
+			n-- // the leading space of a continuation counts
+			e.w.WriteByte(' ')
+		}
+		if len(s) <= n {
+			e.w.WriteString(s + "\r\n")
+			return
+		}
+		for n > 0 && s[n]&0xC0 == 0x80 {
+			n--
+		}
+		e.w.WriteString(s[:n] + "\r\n")
+		s = s[n:]
+	}
+}
+
+func (e *icsEncoder) start() {
+	if e.started {
+		return
+	}
+	e.started = true
+	e.line("BEGIN", "VCALENDAR")
+	e.line("VERSION", "2.0")
+	e.line("PRODID", icalProdID)
+	e.line("CALSCALE", "GREGORIAN")
+	e.line("X-WR-CALNAME", "Tasks")
+}
+
+func (e *icsEncoder) encode(t Task) error {
+	if e.dueOnly && t.DueAt == nil {
+		return nil
+	}
+	e.start()
+	stamp := func(ts time.Time) string { return ts.UTC().Format("20060102T150405Z") }
+	e.line("BEGIN", "VTODO")
+	e.line("UID", icalEscaper.Replace(icalUID(t)))
+	if e.now.IsZero() {
+		e.line("DTSTAMP", stamp(t.CreatedAt))
+	} else {
+		e.line("DTSTAMP", stamp(e.now))
+	}
+	e.line("CREATED", stamp(t.CreatedAt))
+	e.line("SUMMARY", icalEscaper.Replace(t.Title))
+	if t.Done {
+		e.line("STATUS", "COMPLETED")
+	} else {
+		e.line("STATUS", "NEEDS-ACTION")
+	}
+	if t.CompletedAt != nil {
+		e.line("COMPLETED", stamp(*t.CompletedAt))
+	}
+	if t.DueAt != nil {
+		e.line("DUE", stamp(*t.DueAt))
+	}
+	if t.Priority != 0 {
+		e.line("PRIORITY", strconv.Itoa(icalPriority(t.Priority)))
+	}
+	if len(t.Tags) > 0 {
+		tags := make([]string, len(t.Tags))
+		for i, tag := range t.Tags {
+			tags[i] = icalEscaper.Replace(tag)
+		}
+		e.line("CATEGORIES", strings.Join(tags, ","))
+	}
+	e.line("END", "VTODO")
+	return e.w.Flush()
+}
+
+func (e *icsEncoder) end() error {
+	e.start()
+	e.line("END", "VCALENDAR")
+	return e.w.Flush()
+}
+
+// fail reports false: a calendar has no way to carry an error.
+func (e *icsEncoder) fail() bool { return false }
+
+// icalProp is one content line: NAME;PARAM=value:VALUE. Names and
+// parameter names are upper-cased; the value is left escaped.
+type icalProp struct {
+	name   string
+	params map[string]string
+	value  string
+}
+
+type icalComponent struct {
+	kind  string // VTODO or VEVENT
+	props []icalProp
+}
+
+func (c icalComponent) get(name string) (icalProp, bool) {
+	for _, p := range c.props {
+		if p.name == name {
+			return p, true
+		}
+	}
+	return icalProp{}, false
+}
+
+// parseICalLine splits a content line, honouring quoted parameter values.
+func parseICalLine(line string) (icalProp, error) {
+	var (
+		p       = icalProp{params: make(map[string]string)}
+		i       int
+		quoted  bool
+		nameEnd = -1
+	)
+	for i = 0; i < len(line); i++ {
+		c := line[i]
+		if c == '"' {
+			quoted = !quoted
+		}
+		if quoted {
+			continue
+		}
+		if c == ';' && nameEnd < 0 {
+			nameEnd = i
+		}
+		if c == ':' {
+			break
+		}
+	}
+	if i == len(line) {
+		return icalProp{}, fmt.Errorf("line %q has no value", line)
+	}
+	if nameEnd < 0 {
+		nameEnd = i
+	}
+	p.name = strings.ToUpper(line[:nameEnd])
+	p.value = line[i+1:]
+	if p.name == "" {
+		return icalProp{}, fmt.Errorf("line %q has no name", line)
+	}
+	if nameEnd < i {
+		for _, param := range splitICalParams(line[nameEnd+1 : i]) {
+			k, v, _ := strings.Cut(param, "=")
+			p.params[strings.ToUpper(k)] = strings.Trim(v, `"`)
+		}
+	}
+	return p, nil
+}
+
+func splitICalParams(s string) []string {
+	var (
+		out    []string
+		quoted bool
+		start  int
+	)
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '"':
+			quoted = !quoted
+		case ';':
+			if !quoted {
+				out = append(out, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(out, s[start:])
+}
+
+// parseICS reads the VTODO and VEVENT components of a calendar file.
+// Nested components such as VALARM are skipped, and so are the
+// properties of other components.
+func parseICS(body io.Reader) ([]icalComponent, error) {
+	sc := bufio.NewScanner(body)
+	sc.Buffer(nil, maxImportBytes)
+
+	// unfold: a line starting with a space or tab continues the previous one
+	var lines []string
+	for sc.Scan() {
+		l := strings.TrimRight(sc.Text(), "\r")
+		if len(lines) == 0 {
+			l = strings.TrimPrefix(l, "\ufeff")
+		}
+		switch {
+		case l == "":
+		case (l[0] == ' ' || l[0] == '\t') && len(lines) > 0:
+			lines[len(lines)-1] += l[1:]
+		default:
+			lines = append(lines, l)
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	if len(lines) == 0 || !strings.EqualFold(lines[0], "BEGIN:VCALENDAR") {
+		return nil, errors.New("not an iCalendar file")
+	}
+
+	var (
+		out   []icalComponent
+		stack []string
+		cur   *icalComponent
+	)
+	for _, l := range lines {
+		p, err := parseICalLine(l)
+		if err != nil {
+			return nil, err
+		}
+		switch p.name {
+		case "BEGIN":
+			kind := strings.ToUpper(p.value)
+			stack = append(stack, kind)
+			if len(stack) == 2 && (kind == "VTODO" || kind == "VEVENT") {
+				out = append(out, icalComponent{kind: kind})
+				cur = &out[len(out)-1]
+			}
+		case "END":
+			kind := strings.ToUpper(p.value)
+			if len(stack) == 0 || stack[len(stack)-1] != kind {
+				return nil, fmt.Errorf("END:%s does not close a component", p.value)
+			}
+			stack = stack[:len(stack)-1]
+			if len(stack) < 2 {
+				cur = nil
+			}
+		default:
+			if cur != nil && len(stack) == 2 {
+				cur.props = append(cur.props, p)
+			}
+		}
+	}
+	if len(stack) != 0 {
+		return nil, errors.New("the calendar is not closed")
+	}
+	return out, nil
+}
+
+// parseICalTime reads a DATE or DATE-TIME value. Dates are midnight UTC;
+// local times use their TZID, or UTC when the zone is unknown or the time
+// is floating.
+func parseICalTime(p icalProp) (time.Time, error) {
+	v := p.value
+	if p.params["VALUE"] == "DATE" || len(v) == 8 {
+		return time.Parse("20060102", v)
+	}
+	if strings.HasSuffix(v, "Z") {
+		return time.Parse("20060102T150405Z", v)
+	}
+	loc := time.UTC
+	if tz := p.params["TZID"]; tz != "" {
+		if l, err := time.LoadLocation(strings.TrimPrefix(tz, "/")); err == nil {
+			loc = l
+		}
+	}
+	t, err := time.ParseInLocation("20060102T150405", v, loc)
+	return t.UTC(), err
+}
+
+// splitICalList splits a comma-separated value such as CATEGORIES and
+// unescapes each item.
+func splitICalList(v string) []string {
+	var (
+		out   []string
+		start int
+	)
+	for i := 0; i < len(v); i++ {
+		switch v[i] {
+		case '\\':
+			i++
+		case ',':
+			out = append(out, icalUnescaper.Replace(v[start:i]))
+			start = i + 1
+		}
+	}
+	return append(out, icalUnescaper.Replace(v[start:]))
+}
+
+// readICSRecords converts each VTODO and VEVENT into an import record.
+// Every record sets title, done, due_at, priority and tags, so an
+// overwrite makes the task match the calendar entry. The UID becomes the
+// task's ical_uid, or its id when the file was exported by this API.
+// Events are due when they start; categories become tags, with spaces
+// replaced by dashes.
+func readICSRecords(body io.Reader) ([]importRecord, []rowError, error) {
+	comps, err := parseICS(body)
+	if err != nil {
+		return nil, nil, err
+	}
+	return icalRecords(comps)
+}
+
+func icalRecords(comps []icalComponent) ([]importRecord, []rowError, error) {
+	var (
+		out  []importRecord
+		errs []rowError
+	)
+	for i, c := range comps {
+		row := i + 1
+		v := map[string]any{"done": false, "due_at": nil, "priority": 0}
+
+		if p, ok := c.get("SUMMARY"); ok {
+			v["title"] = strings.TrimSpace(icalUnescaper.Replace(p.value))
+		}
+		if p, ok := c.get("UID"); ok && p.value != "" {
+			uid := icalUnescaper.Replace(p.value)
+			if m := icalOwnUID.FindStringSubmatch(uid); m != nil {
+				id, _ := strconv.ParseInt(m[1], 10, 64)
+				v["id"] = id
+			} else {
+				v["ical_uid"] = uid
+			}
+		}
+		if c.kind == "VTODO" {
+			status, _ := c.get("STATUS")
+			_, completed := c.get("COMPLETED")
+			v["done"] = strings.EqualFold(status.value, "COMPLETED") || completed
+		}
+		due := "DUE"
+		if c.kind == "VEVENT" {
+			due = "DTSTART"
+		}
+		if p, ok := c.get(due); ok {
+			t, err := parseICalTime(p)
+			if err != nil {
+				errs = append(errs, rowError{Row: row, Field: "due_at", Message: due + " must be an iCalendar date or date-time"})
+			} else {
+				v["due_at"] = t
+			}
+		}
+		if p, ok := c.get("PRIORITY"); ok {
+			n, err := strconv.Atoi(strings.TrimSpace(p.value))
+			if err != nil || n < 0 || n > 9 {
+				errs = append(errs, rowError{Row: row, Field: "priority", Message: "PRIORITY must be an integer from 0 to 9"})
+			} else {
+				v["priority"] = taskPriority(n)
+			}
+		}
+		tags := []string{}
+		for _, p := range c.props {
+			if p.name != "CATEGORIES" {
+				continue
+			}
+			for _, cat := range splitICalList(p.value) {
+				if tag := strings.Join(strings.Fields(cat), "-"); tag != "" {
+					tags = append(tags, tag)
+				}
+			}
+		}
+		v["tags"] = tags
+
+		rec, err := newImportRecord(v)
+		if err != nil {
+			return nil, nil, err
+		}
+		out = append(out, rec)
+	}
+	return out, errs, nil
+}
+
+type feedURL struct {
+	URL string `json:"url"`
+}
+
+// rotateFeedToken issues a new secret calendar feed URL for the caller,
+// replacing the previous one. The URL is only shown once. The shared
+// secret and disabled authentication have no account to attach it to.
+func rotateFeedToken(repo Repository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		ctx := r.Context()
+		if callerID(ctx) == nil {
+			writeJSON(w, http.StatusNotFound, errResponse{Error: "not_found"})
+			return
+		}
+		token, err := newToken()
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, errResponse{Error: "unexpected_error"})
+			return
+		}
+		err = repo.SetFeedToken(ctx, callerScope(ctx), hashToken(token))
+		if errors.Is(err, ErrNotFound) {
+			writeJSON(w, http.StatusNotFound, errResponse{Error: "not_found"})
+			return
+		}
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, errResponse{Error: "unexpected_error"})
+			return
+		}
+		scheme := "http"
+		if r.TLS != nil {
+			scheme = "https"
+		}
+		writeJSON(w, http.StatusCreated, feedURL{URL: scheme + "://" + r.Host + "/ical/" + token + ".ics"})
+	}
+}
+
+// revokeFeedToken turns the caller's calendar feed URL off.
+func revokeFeedToken(repo Repository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		ctx := r.Context()
+		if callerID(ctx) == nil {
+			writeJSON(w, http.StatusNotFound, errResponse{Error: "not_found"})
+			return
+		}
+		err := repo.SetFeedToken(ctx, callerScope(ctx), "")
+		if errors.Is(err, ErrNotFound) {
+			writeJSON(w, http.StatusNotFound, errResponse{Error: "not_found"})
+			return
+		}
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, errResponse{Error: "unexpected_error"})
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// calendarFeed serves the tasks with a due date that the feed token's user
+// can see, as VTODO components. The token in the URL is the only
+// credential, since calendar apps cannot send headers.
+func calendarFeed(repo Repository, now func() time.Time) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		token, ok := strings.CutSuffix(chi.URLParam(r, "file"), ".ics")
+		if !ok || token == "" {
+			writeJSON(w, http.StatusNotFound, errResponse{Error: "not_found"})
+			return
+		}
+		u, err := repo.UserByFeedTokenHash(r.Context(), hashToken(token))
+		if errors.Is(err, ErrNotFound) {
+			writeJSON(w, http.StatusNotFound, errResponse{Error: "not_found"})
+			return
+		}
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, errResponse{Error: "unexpected_error"})
+			return
+		}
+
+		s := Scope{WorkspaceID: u.WorkspaceID, UserID: u.ID, Admin: u.Admin}
+		q := ListQuery{Sort: []SortKey{{Column: "due_at"}, {Column: "id"}}}
+		w.Header().Set("Cache-Control", "private, no-cache")
+		streamTasks(w, r, repo, s, q, icalType+"; charset=utf-8", newICSEncoder(w, now(), true))
+	}
+}
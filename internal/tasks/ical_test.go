@@ -0,0 +1,210 @@
+package tasks
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// feedToken rotates the calendar feed of token's user and returns the
+// token part of the new URL.
+func feedToken(t *testing.T, r http.Handler, token string) string {
+	t.Helper()
+	rec := doAs(t, r, token, http.MethodPost, "/me/ical-token", "")
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("rotate feed token: expected 201, got %d, body=%s", rec.Code, rec.Body.String())
+	}
+	var v feedURL
+	if err := json.Unmarshal(rec.Body.Bytes(), &v); err != nil {
+		t.Fatalf("failed to parse JSON: %v", err)
+	}
+	_, file, ok := strings.Cut(v.URL, "/ical/")
+	if !ok || !strings.HasSuffix(file, ".ics") {
+		t.Fatalf("unexpected feed URL %q", v.URL)
+	}
+	return strings.TrimSuffix(file, ".ics")
+}
+
+func getFeed(r http.Handler, token string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/ical/"+token+".ics", nil))
+	return rec
+}
+
+func TestCalendarFeed(t *testing.T) {
+	forEachRepo(t, func(t *testing.T, repo Repository) {
+		r := newAuthServer(repo)
+		alice := createTestUser(t, r, "alice", false)
+		doAs(t, r, alice, http.MethodPost, "/tasks", `{"title":"file taxes; all of them","due_at":"2030-04-15T09:00:00Z","priority":2,"tags":["home","money"]}`)
+		doAs(t, r, alice, http.MethodPost, "/tasks", `{"title":"someday"}`)
+		doAs(t, r, alice, http.MethodPost, "/tasks", `{"title":"renew passport","due_at":"2030-01-10T00:00:00Z"}`)
+		doAs(t, r, alice, http.MethodPatch, "/tasks/3", `{"done":true}`)
+
+		if rec := doAs(t, r, testRootToken, http.MethodPost, "/me/ical-token", ""); rec.Code != http.StatusNotFound {
+			t.Fatalf("shared secret: expected 404, got %d", rec.Code)
+		}
+		if rec := getFeed(r, "tsk_unknown"); rec.Code != http.StatusNotFound {
+			t.Fatalf("unknown token: expected 404, got %d", rec.Code)
+		}
+
+		token := feedToken(t, r, alice)
+		rec := getFeed(r, token)
+		if rec.Code != http.StatusOK || !strings.HasPrefix(rec.Header().Get("Content-Type"), icalType) {
+			t.Fatalf("expected a calendar, got %d %q", rec.Code, rec.Header().Get("Content-Type"))
+		}
+		body := rec.Body.String()
+		if !strings.HasPrefix(body, "BEGIN:VCALENDAR\r\nVERSION:2.0\r\n") || !strings.HasSuffix(body, "END:VCALENDAR\r\n") {
+			t.Fatalf("unexpected calendar %q", body)
+		}
+		for _, want := range []string{
+			"UID:task-3@tasks-api\r\n", "STATUS:COMPLETED\r\n", "DUE:20300110T000000Z\r\n",
+			"UID:task-1@tasks-api\r\n", "SUMMARY:file taxes\\; all of them\r\n", "STATUS:NEEDS-ACTION\r\n",
+			"DUE:20300415T090000Z\r\n", "PRIORITY:3\r\n", "CATEGORIES:home,money\r\n",
+		} {
+			if !strings.Contains(body, want) {
+				t.Fatalf("expected %q in %s", want, body)
+			}
+		}
+		if strings.Count(body, "BEGIN:VTODO") != 2 || strings.Contains(body, "someday") {
+			t.Fatalf("expected only the tasks with due dates, got %s", body)
+		}
+		if strings.Index(body, "task-3@") > strings.Index(body, "task-1@") {
+			t.Fatalf("expected the earliest due date first, got %s", body)
+		}
+
+		// rotating replaces the URL, revoking turns it off
+		rotated := feedToken(t, r, alice)
+		if getFeed(r, token).Code != http.StatusNotFound || getFeed(r, rotated).Code != http.StatusOK {
+			t.Fatalf("expected only the rotated feed URL to work")
+		}
+		if rec := doAs(t, r, alice, http.MethodDelete, "/me/ical-token", ""); rec.Code != http.StatusNoContent {
+			t.Fatalf("revoke: expected 204, got %d", rec.Code)
+		}
+		if getFeed(r, rotated).Code != http.StatusNotFound {
+			t.Fatalf("expected the revoked feed URL to stop working")
+		}
+	})
+}
+
+const testICS = "BEGIN:VCALENDAR\r\n" +
+	"VERSION:2.0\r\n" +
+	"PRODID:-//Example//Planner//EN\r\n" +
+	"BEGIN:VTODO\r\n" +
+	"UID:42@planner.example\r\n" +
+	"SUMMARY:Buy milk\\, eggs and a very long list of other things that needs fo\r\n" +
+	" lding\r\n" +
+	"DUE;VALUE=DATE:20300102\r\n" +
+	"PRIORITY:2\r\n" +
+	"CATEGORIES:Errands,Deep Focus\r\n" +
+	"STATUS:COMPLETED\r\n" +
+	"BEGIN:VALARM\r\n" +
+	"ACTION:DISPLAY\r\n" +
+	"SUMMARY:ignored\r\n" +
+	"END:VALARM\r\n" +
+	"END:VTODO\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"UID:event-7@planner.example\r\n" +
+	"SUMMARY:Dentist\r\n" +
+	"DTSTART;TZID=\"UTC\":20300103T143000\r\n" +
+	"END:VEVENT\r\n" +
+	"END:VCALENDAR\r\n"
+
+func TestImport_ICS(t *testing.T) {
+	forEachRepo(t, func(t *testing.T, repo Repository) {
+		r := newTestServer(repo)
+
+		code, rep := doImport(t, r, "", "text/calendar", testICS)
+		if code != http.StatusOK || rep.Created != 2 {
+			t.Fatalf("ics import: unexpected report %d %+v", code, rep)
+		}
+		var list []Task
+		if err := json.Unmarshal(doJSON(t, r, http.MethodGet, "/tasks", "").Body.Bytes(), &list); err != nil {
+			t.Fatalf("failed to parse JSON: %v", err)
+		}
+		if len(list) != 2 {
+			t.Fatalf("expected 2 tasks, got %+v", list)
+		}
+		todo, event := list[0], list[1]
+		wantDue := time.Date(2030, 1, 2, 0, 0, 0, 0, time.UTC)
+		if todo.Title != "Buy milk, eggs and a very long list of other things that needs folding" || !todo.Done ||
+			todo.DueAt == nil || !todo.DueAt.Equal(wantDue) || todo.Priority != 1 ||
+			!slices.Equal(todo.Tags, []string{"deep-focus", "errands"}) || todo.ICalUID != "42@planner.example" {
+			t.Fatalf("unexpected todo %+v", todo)
+		}
+		wantStart := time.Date(2030, 1, 3, 14, 30, 0, 0, time.UTC)
+		if event.Title != "Dentist" || event.Done || event.DueAt == nil || !event.DueAt.Equal(wantStart) {
+			t.Fatalf("unexpected event %+v", event)
+		}
+
+		// the same entries again are recognized by UID
+		code, rep = doImport(t, r, "", "text/calendar", testICS)
+		if code != http.StatusOK || rep.Skipped != 2 || rep.Rows[0].ID != todo.ID {
+			t.Fatalf("reimport: unexpected report %d %+v", code, rep)
+		}
+		changed := strings.Replace(testICS, "SUMMARY:Dentist", "SUMMARY:Dentist (moved)", 1)
+		code, rep = doImport(t, r, "?on_conflict=overwrite", "text/calendar", changed)
+		if code != http.StatusOK || rep.Updated != 2 || len(listTitles(t, r)) != 2 || listTitles(t, r)[1] != "Dentist (moved)" {
+			t.Fatalf("overwrite: unexpected report %d %+v", code, rep)
+		}
+
+		// an export maps back onto the same tasks
+		doJSON(t, r, http.MethodPost, "/tasks", `{"title":"local"}`)
+		rec := doJSON(t, r, http.MethodGet, "/export?format=ics", "")
+		if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != icalType {
+			t.Fatalf("expected a calendar export, got %d %q", rec.Code, rec.Header().Get("Content-Type"))
+		}
+		code, rep = doImport(t, r, "?format=ics", "text/plain", rec.Body.String())
+		if code != http.StatusOK || rep.Skipped != 3 || rep.Created != 0 {
+			t.Fatalf("export round trip: unexpected report %d %+v", code, rep)
+		}
+		code, rep = doImport(t, r, "?on_conflict=duplicate", "text/calendar", testICS)
+		if code != http.StatusOK || rep.Created != 2 || len(listTitles(t, r)) != 5 {
+			t.Fatalf("duplicate: unexpected report %d %+v", code, rep)
+		}
+
+		for _, tt := range []struct{ name, body string }{
+			{"not a calendar", "hello\r\n"},
+			{"unclosed", "BEGIN:VCALENDAR\r\nBEGIN:VTODO\r\n"},
+			{"mismatched", "BEGIN:VCALENDAR\r\nBEGIN:VTODO\r\nEND:VEVENT\r\nEND:VCALENDAR\r\n"},
+		} {
+			if code, _ := doImport(t, r, "", "text/calendar", tt.body); code != http.StatusBadRequest {
+				t.Fatalf("%s: expected 400, got %d", tt.name, code)
+			}
+		}
+		bad := "BEGIN:VCALENDAR\r\nBEGIN:VTODO\r\nSUMMARY:x\r\nPRIORITY:high\r\nDUE:tomorrow\r\nEND:VTODO\r\nEND:VCALENDAR\r\n"
+		if code, rep := doImport(t, r, "", "text/calendar", bad); code != http.StatusUnprocessableEntity || len(rep.Errors) != 2 {
+			t.Fatalf("invalid entry: unexpected report %d %+v", code, rep)
+		}
+	})
+}
+
+func TestICSEncoder_Folding(t *testing.T) {
+	title := strings.Repeat("ünïcödé, ", 20)
+	var buf bytes.Buffer
+	enc := newICSEncoder(&buf, time.Now(), false)
+	if err := enc.encode(Task{ID: 1, Title: title}); err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	if err := enc.end(); err != nil {
+		t.Fatalf("end: %v", err)
+	}
+	for _, line := range strings.Split(strings.TrimSuffix(buf.String(), "\r\n"), "\r\n") {
+		if len(line) > icalLineLen {
+			t.Fatalf("line longer than %d octets: %q", icalLineLen, line)
+		}
+	}
+
+	comps, err := parseICS(&buf)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	summary, _ := comps[0].get("SUMMARY")
+	if got := icalUnescaper.Replace(summary.value); got != title {
+		t.Fatalf("expected the title back, got %q", got)
+	}
+}
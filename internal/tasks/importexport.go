@@ -0,0 +1,697 @@
+package tasks
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const maxImportBytes = 10 << 20
+
+// csvColumns are the columns GET /export writes and POST /import reads by
+// default. Tags are separated by spaces.
+var csvColumns = []string{
+	"id", "title", "done", "project_id", "parent_id", "tags", "due_at",
+	"priority", "assignee", "owner_id", "created_at", "completed_at",
+}
+
+// exportOnly are attributes an export carries that import ignores, so an
+// exported file can be imported as it is.
+var exportOnly = []string{"owner_id", "created_at", "completed_at"}
+
+// importOnly are attributes import reads that tasks do not have. parent_row
+// is the row number of an earlier row whose new task becomes the parent.
+var importOnly = []string{"parent_row"}
+
+// exportFormats maps the format parameter to a media type.
+var exportFormats = map[string]string{
+	"json":     "application/json",
+	"csv":      "text/csv",
+	"ndjson":   ndjsonType,
+	"ics":      icalType,
+	"todotxt":  todoTxtType,
+	"markdown": markdownType,
+}
+
+// requestFormat picks the format from the format parameter, or else from
+// the media type in header, defaulting to JSON.
+func requestFormat(r *http.Request, header string) (string, bool) {
+	if f := r.URL.Query().Get("format"); f != "" {
+		_, ok := exportFormats[f]
+		return f, ok
+	}
+	for _, part := range strings.Split(r.Header.Get(header), ",") {
+		for f, t := range exportFormats {
+			if matchMediaType(part, t) {
+				return f, true
+			}
+		}
+	}
+	return "json", true
+}
+
+// exportTasks streams the tasks GET /tasks would list as a JSON array, CSV,
+// NDJSON, iCalendar, todo.txt or Markdown file.
+func exportTasks(repo Repository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		format, ok := requestFormat(r, "Accept")
+		if !ok {
+			writeValidation(w, []fieldError{{Field: "format", Message: "format must be json, csv, ndjson, ics, todotxt or markdown"}})
+			return
+		}
+		q, vErrs, err := parseListQuery(r, repo, r.URL.Query())
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, errResponse{Error: "unexpected_error"})
+			return
+		}
+		if len(vErrs) > 0 {
+			writeValidation(w, vErrs)
+			return
+		}
+
+		var enc taskEncoder
+		switch format {
+		case "csv":
+			enc = &csvEncoder{w: csv.NewWriter(w)}
+		case "ndjson":
+			enc = newNDJSONEncoder(w, func(t Task) (any, error) { return t, nil })
+		case "ics":
+			enc = newICSEncoder(w, time.Now(), false)
+		case "todotxt":
+			if enc, err = newTodoTxtEncoder(r.Context(), repo, callerScope(r.Context()), w); err != nil {
+				writeJSON(w, http.StatusInternalServerError, errResponse{Error: "unexpected_error"})
+				return
+			}
+		case "markdown":
+			if enc, err = newMarkdownEncoder(r.Context(), repo, callerScope(r.Context()), w); err != nil {
+				writeJSON(w, http.StatusInternalServerError, errResponse{Error: "unexpected_error"})
+				return
+			}
+		default:
+			enc = &jsonArrayEncoder{w: w, enc: json.NewEncoder(w)}
+		}
+		filename := "tasks." + format
+		switch format {
+		case "todotxt":
+			filename = "todo.txt"
+		case "markdown":
+			filename = "tasks.md"
+		}
+		w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+		streamTasks(w, r, repo, callerScope(r.Context()), q, exportFormats[format], enc)
+	}
+}
+
+// jsonArrayEncoder writes the tasks as one JSON array, a task per line.
+type jsonArrayEncoder struct {
+	w   io.Writer
+	enc *json.Encoder
+	n   int
+}
+
+func (e *jsonArrayEncoder) encode(t Task) error {
+	sep := ","
+	if e.n == 0 {
+		sep = "["
+	}
+	e.n++
+	if _, err := io.WriteString(e.w, sep); err != nil {
+		return err
+	}
+	return e.enc.Encode(t)
+}
+
+func (e *jsonArrayEncoder) end() error {
+	if e.n == 0 {
+		_, err := io.WriteString(e.w, "[]\n")
+		return err
+	}
+	_, err := io.WriteString(e.w, "]\n")
+	return err
+}
+
+func (e *jsonArrayEncoder) fail() bool { return false }
+
+// csvEncoder writes csvColumns, with a header row.
+type csvEncoder struct {
+	w      *csv.Writer
+	header bool
+}
+
+func (e *csvEncoder) writeHeader() error {
+	if e.header {
+		return nil
+	}
+	e.header = true
+	return e.w.Write(csvColumns)
+}
+
+func (e *csvEncoder) encode(t Task) error {
+	if err := e.writeHeader(); err != nil {
+		return err
+	}
+	optID := func(id *int64) string {
+		if id == nil {
+			return ""
+		}
+		return strconv.FormatInt(*id, 10)
+	}
+	optTime := func(ts *time.Time) string {
+		if ts == nil {
+			return ""
+		}
+		return ts.UTC().Format(time.RFC3339)
+	}
+	err := e.w.Write([]string{
+		strconv.FormatInt(t.ID, 10),
+		t.Title,
+		strconv.FormatBool(t.Done),
+		optID(t.ProjectID),
+		optID(t.ParentID),
+		strings.Join(t.Tags, " "),
+		optTime(t.DueAt),
+		strconv.Itoa(t.Priority),
+		t.Assignee,
+		optID(t.OwnerID),
+		optTime(&t.CreatedAt),
+		optTime(t.CompletedAt),
+	})
+	if err != nil {
+		return err
+	}
+	e.w.Flush()
+	return e.w.Error()
+}
+
+func (e *csvEncoder) end() error {
+	if err := e.writeHeader(); err != nil {
+		return err
+	}
+	e.w.Flush()
+	return e.w.Error()
+}
+
+func (e *csvEncoder) fail() bool { return false }
+
+// importRecord holds one decoded row. Rows are decoded from a map so the
+// attributes a row leaves out can be told from zero values.
+type importRecord map[string]json.RawMessage
+
+// newImportRecord encodes the attributes in v as a record.
+func newImportRecord(v map[string]any) (importRecord, error) {
+	rec := make(importRecord, len(v))
+	for k, val := range v {
+		raw, err := json.Marshal(val)
+		if err != nil {
+			return nil, err
+		}
+		rec[k] = raw
+	}
+	return rec, nil
+}
+
+// rowError is a validation problem of one import row; rows are numbered
+// from 1 in input order, not counting a CSV header.
+type rowError struct {
+	Row     int    `json:"row"`
+	Source  string `json:"source,omitempty"`
+	Field   string `json:"field,omitempty"`
+	Message string `json:"message"`
+}
+
+type importRowResult struct {
+	Row    int    `json:"row"`
+	Source string `json:"source,omitempty"`
+	ImportOutcome
+}
+
+type importReport struct {
+	Error    string            `json:"error,omitempty"`
+	DryRun   bool              `json:"dry_run"`
+	Strategy ImportStrategy    `json:"strategy"`
+	Created  int               `json:"created"`
+	Updated  int               `json:"updated"`
+	Skipped  int               `json:"skipped"`
+	Rows     []importRowResult `json:"rows"`
+	Errors   []rowError        `json:"errors,omitempty"`
+	// set by the Trello and Todoist imports
+	Projects []importProject `json:"projects,omitempty"`
+	Unmapped []unmappedItem  `json:"unmapped,omitempty"`
+}
+
+// importTasks creates tasks from a JSON array, CSV, NDJSON, iCalendar,
+// todo.txt or Markdown body. Rows with the id or ical_uid of a task the
+// caller can see conflict with it and are resolved by on_conflict (skip,
+// overwrite or duplicate). Every row is validated first; any problem
+// rejects the whole import, and dry_run=true only reports what would
+// happen. The import runs in one transaction.
+func importTasks(repo Repository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		params := r.URL.Query()
+		var vErrs []fieldError
+		format, ok := requestFormat(r, "Content-Type")
+		if !ok {
+			vErrs = append(vErrs, fieldError{Field: "format", Message: "format must be json, csv, ndjson, ics, todotxt or markdown"})
+		}
+		strategy, dryRun, pErrs := parseImportParams(params)
+		vErrs = append(vErrs, pErrs...)
+		var columns map[string]string
+		if format == "csv" {
+			var err error
+			if columns, err = parseColumnMap(params.Get("map")); err != nil {
+				vErrs = append(vErrs, fieldError{Field: "map", Message: err.Error()})
+			}
+		}
+		if len(vErrs) > 0 {
+			writeValidation(w, vErrs)
+			return
+		}
+
+		body := http.MaxBytesReader(w, r.Body, maxImportBytes)
+		var (
+			records []importRecord
+			rErrs   []rowError
+			err     error
+		)
+		switch format {
+		case "csv":
+			records, rErrs, err = readCSVRecords(body, columns)
+		case "ndjson":
+			records, rErrs, err = readNDJSONRecords(body)
+		case "ics":
+			records, rErrs, err = readICSRecords(body)
+		case "todotxt", "markdown":
+			var projects []Project
+			if projects, err = repo.ListProjects(r.Context(), callerScope(r.Context())); err != nil {
+				writeJSON(w, http.StatusInternalServerError, errResponse{Error: "unexpected_error"})
+				return
+			}
+			if format == "todotxt" {
+				records, rErrs, err = readTodoTxtRecords(body, projects)
+			} else {
+				records, rErrs, err = readMarkdownRecords(body, projects)
+			}
+		default:
+			records, rErrs, err = readJSONRecords(body)
+		}
+		var (
+			headerErr *csvHeaderError
+			sizeErr   *http.MaxBytesError
+		)
+		switch {
+		case errors.As(err, &headerErr):
+			writeValidation(w, []fieldError{{Field: "header", Message: headerErr.msg}})
+			return
+		case errors.As(err, &sizeErr):
+			writeJSON(w, http.StatusRequestEntityTooLarge, errResponse{Error: "too_large"})
+			return
+		case err != nil && format == "json":
+			writeJSON(w, http.StatusBadRequest, errResponse{Error: "invalid_json"})
+			return
+		case err != nil:
+			writeJSON(w, http.StatusBadRequest, errResponse{Error: "invalid_body"})
+			return
+		}
+
+		report := importReport{DryRun: dryRun, Strategy: strategy}
+		runImport(w, r, repo, report, records, rErrs, strategy, nil)
+	}
+}
+
+// parseImportParams reads the on_conflict and dry_run parameters.
+func parseImportParams(params url.Values) (ImportStrategy, bool, []fieldError) {
+	var errs []fieldError
+	strategy := ImportStrategy(params.Get("on_conflict"))
+	switch strategy {
+	case "":
+		strategy = ImportSkip
+	case ImportSkip, ImportOverwrite, ImportDuplicate:
+	default:
+		errs = append(errs, fieldError{Field: "on_conflict", Message: "on_conflict must be skip, overwrite or duplicate"})
+	}
+	dryRun := false
+	if s := params.Get("dry_run"); s != "" {
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			errs = append(errs, fieldError{Field: "dry_run", Message: "dry_run must be true or false"})
+		}
+		dryRun = b
+	}
+	return strategy, dryRun, errs
+}
+
+// runImport validates records and imports them, then writes report with
+// the outcome. rErrs are problems the reader found already. sources, if
+// not nil, names where each record came from in a foreign export.
+func runImport(w http.ResponseWriter, r *http.Request, repo Repository, report importReport, records []importRecord, rErrs []rowError, strategy ImportStrategy, sources []string) {
+	ctx := r.Context()
+	owner := callerID(ctx)
+	source := func(row int) string {
+		if sources == nil {
+			return ""
+		}
+		return sources[row-1]
+	}
+	rows := make([]ImportRow, 0, len(records))
+	rowNums := make([]int, 0, len(records))
+	for i, rec := range records {
+		if rec == nil {
+			// a line that did not parse, already reported
+			continue
+		}
+		row, fErrs, err := parseImportRecord(r, repo, rec, strategy, owner)
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, errResponse{Error: "unexpected_error"})
+			return
+		}
+		if p := row.ParentRow; p != nil && *p >= 1 {
+			// parent_row counts input rows, Repository.Import indexes rows
+			idx, ok := slices.BinarySearch(rowNums, *p)
+			switch {
+			case *p > i:
+				fErrs = append(fErrs, fieldError{Field: "parent_row", Message: "parent_row must name an earlier row"})
+			case ok:
+				row.ParentRow = &idx
+			default:
+				// the parent row is invalid and reported already
+				row.ParentRow = nil
+			}
+		}
+		for _, e := range fErrs {
+			rErrs = append(rErrs, rowError{Row: i + 1, Source: source(i + 1), Field: e.Field, Message: e.Message})
+		}
+		if len(fErrs) == 0 {
+			rows = append(rows, row)
+			rowNums = append(rowNums, i+1)
+		}
+	}
+	slices.SortStableFunc(rErrs, func(a, b rowError) int { return a.Row - b.Row })
+
+	report.Rows, report.Errors = []importRowResult{}, rErrs
+	if len(rErrs) > 0 && !report.DryRun {
+		report.Error = "validation_error"
+		writeJSON(w, http.StatusUnprocessableEntity, report)
+		return
+	}
+	out, err := repo.Import(ctx, callerScope(ctx), rows, strategy, report.DryRun || len(rErrs) > 0)
+	switch {
+	case errors.Is(err, ErrNotFound), errors.Is(err, ErrTitleRequired), errors.Is(err, ErrConflict):
+		// a project, parent or user went away after validation, or a
+		// calendar UID belongs to a task the caller cannot see
+		writeJSON(w, http.StatusConflict, errResponse{Error: "conflict"})
+		return
+	case err != nil:
+		writeJSON(w, http.StatusInternalServerError, errResponse{Error: "unexpected_error"})
+		return
+	}
+	for i, o := range out {
+		report.Rows = append(report.Rows, importRowResult{Row: rowNums[i], Source: source(rowNums[i]), ImportOutcome: o})
+		switch o.Action {
+		case "created":
+			report.Created++
+		case "updated":
+			report.Updated++
+		case "skipped":
+			report.Skipped++
+		}
+	}
+	writeJSON(w, http.StatusOK, report)
+}
+
+// parseImportRecord validates one record like POST /tasks validates its
+// body. Patch only carries the attributes the record has, so overwriting
+// leaves the others alone; project, parent, custom fields and assignee
+// ids are only used for new tasks.
+func parseImportRecord(r *http.Request, repo Repository, rec importRecord, strategy ImportStrategy, owner *int64) (ImportRow, []fieldError, error) {
+	var (
+		row  ImportRow
+		errs []fieldError
+	)
+	decode := func(key string, dst any, msg string) bool {
+		raw, ok := rec[key]
+		if !ok {
+			return false
+		}
+		if err := json.Unmarshal(raw, dst); err != nil {
+			errs = append(errs, fieldError{Field: key, Message: msg})
+			return false
+		}
+		return true
+	}
+
+	var keys []string
+	for key := range rec {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	for _, key := range keys {
+		if !slices.Contains(taskAttributes, key) && !slices.Contains(importOnly, key) {
+			errs = append(errs, fieldError{Field: key, Message: "unknown attribute " + key})
+		}
+	}
+
+	in := TaskInput{OwnerID: owner}
+	decode("id", &row.ID, "id must be an integer")
+	decode("title", &in.Title, "title must be a string")
+	decode("done", &row.Done, "done must be true or false")
+	decode("project_id", &in.ProjectID, "project_id must be an integer")
+	decode("parent_id", &in.ParentID, "parent_id must be an integer")
+	if decode("parent_row", &row.ParentRow, "parent_row must be an integer") && row.ParentRow != nil {
+		if *row.ParentRow < 1 {
+			errs = append(errs, fieldError{Field: "parent_row", Message: "parent_row must be a row number"})
+		}
+		if in.ParentID != nil {
+			errs = append(errs, fieldError{Field: "parent_row", Message: "set parent_id or parent_row, not both"})
+		}
+	}
+	decode("tags", &in.Tags, "tags must be an array of strings")
+	decode("checklist", &in.Checklist, "checklist must be an array of items")
+	decode("fields", &in.Fields, "fields must be an object")
+	decode("due_at", &in.DueAt, "due_at must be an RFC 3339 timestamp")
+	decode("priority", &in.Priority, "priority must be an integer")
+	decode("assignee", &in.Assignee, "assignee must be a string")
+	decode("assignee_ids", &in.AssigneeIDs, "assignee_ids must be an array of integers")
+	if decode("ical_uid", &in.ICalUID, "ical_uid must be a string") && len(in.ICalUID) > maxUIDLen {
+		errs = append(errs, fieldError{Field: "ical_uid", Message: fmt.Sprintf("ical_uid must be at most %d characters", maxUIDLen)})
+	}
+
+	ctx := r.Context()
+	iErrs, err := checkTaskInput(ctx, repo, "", &in)
+	if errors.Is(err, errForbidden) {
+		iErrs, err = []fieldError{{Field: "project_id", Message: "you may not add tasks to this project"}}, nil
+	}
+	if err != nil {
+		return ImportRow{}, nil, err
+	}
+	errs = append(errs, iErrs...)
+
+	if row.ID != nil && strategy == ImportOverwrite {
+		err := checkTaskWritable(ctx, repo, *row.ID)
+		switch {
+		case errors.Is(err, errForbidden):
+			errs = append(errs, fieldError{Field: "id", Message: "you may not change this task"})
+		case err != nil && !errors.Is(err, ErrNotFound):
+			return ImportRow{}, nil, err
+		}
+	}
+	if len(errs) > 0 {
+		return ImportRow{}, errs, nil
+	}
+
+	row.Input = in
+	if _, ok := rec["title"]; ok {
+		row.Patch.Title = &in.Title
+	}
+	if _, ok := rec["done"]; ok {
+		row.Patch.Done = &row.Done
+	}
+	if _, ok := rec["tags"]; ok {
+		row.Patch.Tags = &in.Tags
+	}
+	if _, ok := rec["checklist"]; ok {
+		row.Patch.Checklist = &in.Checklist
+	}
+	if _, ok := rec["due_at"]; ok {
+		row.Patch.DueAt, row.Patch.ClearDueAt = in.DueAt, in.DueAt == nil
+	}
+	if _, ok := rec["priority"]; ok {
+		row.Patch.Priority = &in.Priority
+	}
+	if _, ok := rec["assignee"]; ok {
+		row.Patch.Assignee = &in.Assignee
+	}
+	return row, nil, nil
+}
+
+// readJSONRecords reads a JSON array of objects.
+func readJSONRecords(body io.Reader) ([]importRecord, []rowError, error) {
+	var out []importRecord
+	if err := json.NewDecoder(body).Decode(&out); err != nil {
+		return nil, nil, err
+	}
+	var errs []rowError
+	for i, rec := range out {
+		if rec == nil {
+			errs = append(errs, rowError{Row: i + 1, Message: "row must be a JSON object"})
+		}
+	}
+	return out, errs, nil
+}
+
+// readNDJSONRecords reads one JSON object per line; blank lines are
+// skipped. A line that does not parse is reported and left nil.
+func readNDJSONRecords(body io.Reader) ([]importRecord, []rowError, error) {
+	var (
+		out  []importRecord
+		errs []rowError
+	)
+	sc := bufio.NewScanner(body)
+	sc.Buffer(nil, maxImportBytes)
+	for sc.Scan() {
+		line := bytes.TrimSpace(sc.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var rec importRecord
+		if err := json.Unmarshal(line, &rec); err != nil || rec == nil {
+			errs = append(errs, rowError{Row: len(out) + 1, Message: "row must be a JSON object"})
+			rec = nil
+		}
+		out = append(out, rec)
+	}
+	return out, errs, sc.Err()
+}
+
+// csvHeaderError reports a CSV header that cannot be mapped to attributes.
+type csvHeaderError struct{ msg string }
+
+func (e *csvHeaderError) Error() string { return e.msg }
+
+// parseColumnMap reads the map parameter, "Source column:attribute" pairs
+// separated by commas, into a lookup from lower-cased column name.
+func parseColumnMap(s string) (map[string]string, error) {
+	out := make(map[string]string)
+	if s == "" {
+		return out, nil
+	}
+	for _, pair := range strings.Split(s, ",") {
+		from, to, ok := strings.Cut(pair, ":")
+		from, to = strings.ToLower(strings.TrimSpace(from)), strings.TrimSpace(to)
+		if !ok || from == "" {
+			return nil, fmt.Errorf("map must be a list of column:attribute pairs")
+		}
+		if !slices.Contains(csvColumns, to) {
+			return nil, fmt.Errorf("cannot map %s to %s; attributes are %s", from, to, strings.Join(csvColumns, ", "))
+		}
+		out[from] = to
+	}
+	return out, nil
+}
+
+// readCSVRecords reads a CSV file whose header names attributes, directly
+// or through columns (see parseColumnMap). Cells are converted to the
+// JSON values of their attributes; an empty cell is null.
+func readCSVRecords(body io.Reader, columns map[string]string) ([]importRecord, []rowError, error) {
+	cr := csv.NewReader(body)
+	cr.FieldsPerRecord = 0
+	header, err := cr.Read()
+	if err == io.EOF {
+		return nil, nil, &csvHeaderError{msg: "the file is empty"}
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	attrs := make([]string, len(header))
+	for i, h := range header {
+		name := strings.ToLower(strings.TrimSpace(strings.TrimPrefix(h, "\ufeff")))
+		attr, ok := columns[name]
+		if !ok {
+			attr = name
+		}
+		if !slices.Contains(csvColumns, attr) {
+			return nil, nil, &csvHeaderError{msg: fmt.Sprintf("unknown column %q; map it with map=%s:<attribute>", h, h)}
+		}
+		if slices.Contains(attrs, attr) {
+			return nil, nil, &csvHeaderError{msg: fmt.Sprintf("more than one column maps to %s", attr)}
+		}
+		attrs[i] = attr
+	}
+
+	var (
+		out  []importRecord
+		errs []rowError
+	)
+	for {
+		cells, err := cr.Read()
+		if err == io.EOF {
+			return out, errs, nil
+		}
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			errs = append(errs, rowError{Row: len(out) + 1, Message: err.Error()})
+			out = append(out, nil)
+			continue
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+
+		rec := make(importRecord, len(cells))
+		for i, cell := range cells {
+			attr := attrs[i]
+			if slices.Contains(exportOnly, attr) {
+				continue
+			}
+			v, err := csvValue(attr, strings.TrimSpace(cell))
+			if err != nil {
+				errs = append(errs, rowError{Row: len(out) + 1, Field: attr, Message: err.Error()})
+				continue
+			}
+			rec[attr] = v
+		}
+		out = append(out, rec)
+	}
+}
+
+// csvValue converts a CSV cell to the JSON value of attr.
+func csvValue(attr, cell string) (json.RawMessage, error) {
+	var v any
+	switch {
+	case cell == "" && attr == "tags":
+		v = []string{}
+	case cell == "":
+		v = nil
+	case attr == "id", attr == "project_id", attr == "parent_id", attr == "parent_row", attr == "priority":
+		n, err := strconv.ParseInt(cell, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s must be an integer", attr)
+		}
+		v = n
+	case attr == "done":
+		b, err := strconv.ParseBool(cell)
+		if err != nil {
+			return nil, fmt.Errorf("done must be true or false")
+		}
+		v = b
+	case attr == "tags":
+		v = strings.Fields(cell)
+	default:
+		v = cell
+	}
+	return json.Marshal(v)
+}
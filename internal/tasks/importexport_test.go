@@ -0,0 +1,224 @@
+package tasks
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func doImport(t *testing.T, r http.Handler, query, contentType, body string) (int, importReport) {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/import"+query, strings.NewReader(body))
+	req.Header.Set("Content-Type", contentType)
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	var rep importReport
+	if rec.Code == http.StatusOK || rec.Code == http.StatusUnprocessableEntity {
+		if err := json.Unmarshal(rec.Body.Bytes(), &rep); err != nil {
+			t.Fatalf("failed to parse JSON: %v, body=%s", err, rec.Body.String())
+		}
+	}
+	return rec.Code, rep
+}
+
+func listTitles(t *testing.T, r http.Handler) []string {
+	t.Helper()
+	var list []Task
+	if err := json.Unmarshal(doJSON(t, r, http.MethodGet, "/tasks", "").Body.Bytes(), &list); err != nil {
+		t.Fatalf("failed to parse JSON: %v", err)
+	}
+	var out []string
+	for _, task := range list {
+		out = append(out, task.Title)
+	}
+	return out
+}
+
+func TestExport(t *testing.T) {
+	forEachRepo(t, func(t *testing.T, repo Repository) {
+		r := newTestServer(repo)
+		doJSON(t, r, http.MethodPost, "/tasks", `{"title":"paint, then dry","tags":["diy","home"],"priority":2}`)
+		doJSON(t, r, http.MethodPost, "/tasks", `{"title":"call mom"}`)
+		doJSON(t, r, http.MethodPatch, "/tasks/2", `{"done":true}`)
+
+		rec := doJSON(t, r, http.MethodGet, "/export?format=csv", "")
+		if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "text/csv" {
+			t.Fatalf("expected a CSV file, got %d %q", rec.Code, rec.Header().Get("Content-Type"))
+		}
+		rows, err := csv.NewReader(rec.Body).ReadAll()
+		if err != nil {
+			t.Fatalf("failed to parse CSV: %v", err)
+		}
+		if len(rows) != 3 || !slices.Equal(rows[0], csvColumns) {
+			t.Fatalf("expected a header and 2 rows, got %q", rows)
+		}
+		if rows[1][1] != "paint, then dry" || rows[1][5] != "diy home" || rows[2][2] != "true" || rows[2][11] == "" {
+			t.Fatalf("unexpected rows %q", rows)
+		}
+
+		for _, tt := range []struct{ query, accept, wantType string }{
+			{"", "", "application/json"},
+			{"?done=true", "application/x-ndjson", ndjsonType},
+			{"?tag=none", "", "application/json"},
+		} {
+			req := httptest.NewRequest(http.MethodGet, "/export"+tt.query, nil)
+			req.Header.Set("Accept", tt.accept)
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, req)
+			if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != tt.wantType {
+				t.Fatalf("export%s: expected %s, got %d %q", tt.query, tt.wantType, rec.Code, rec.Header().Get("Content-Type"))
+			}
+			if tt.wantType == ndjsonType {
+				if n := strings.Count(rec.Body.String(), "\n"); n != 1 {
+					t.Fatalf("export%s: expected 1 line, got %q", tt.query, rec.Body.String())
+				}
+				continue
+			}
+			var list []Task
+			if err := json.Unmarshal(rec.Body.Bytes(), &list); err != nil {
+				t.Fatalf("export%s: failed to parse JSON: %v", tt.query, err)
+			}
+		}
+
+		if rec := doJSON(t, r, http.MethodGet, "/export?format=xml", ""); rec.Code != http.StatusUnprocessableEntity {
+			t.Fatalf("expected 422 for an unknown format, got %d", rec.Code)
+		}
+	})
+}
+
+func TestImport(t *testing.T) {
+	forEachRepo(t, func(t *testing.T, repo Repository) {
+		r := newTestServer(repo)
+		doJSON(t, r, http.MethodPost, "/tasks", `{"title":"existing","tags":["keep"]}`)
+
+		// a dry run reports every problem by row and changes nothing
+		code, rep := doImport(t, r, "?dry_run=true", "application/json",
+			`[{"title":"ok"},{"title":"","priority":9},{"title":"x","color":"red"},{"id":1,"title":"dup"}]`)
+		if code != http.StatusOK || !rep.DryRun || rep.Created != 1 || rep.Skipped != 1 {
+			t.Fatalf("dry run: unexpected report %d %+v", code, rep)
+		}
+		var rowsWithErrors []int
+		for _, e := range rep.Errors {
+			rowsWithErrors = append(rowsWithErrors, e.Row)
+		}
+		if !slices.Equal(rowsWithErrors, []int{2, 2, 3}) {
+			t.Fatalf("dry run: expected errors on rows 2, 2 and 3, got %+v", rep.Errors)
+		}
+		if rep.Rows[0].Row != 1 || rep.Rows[0].ID != 0 || rep.Rows[1].Row != 4 || rep.Rows[1].ID != 1 {
+			t.Fatalf("dry run: unexpected rows %+v", rep.Rows)
+		}
+
+		// any invalid row rejects the whole import
+		code, rep = doImport(t, r, "", "application/x-ndjson", "{\"title\":\"ok\"}\n\nnot json\n")
+		if code != http.StatusUnprocessableEntity || len(rep.Errors) != 1 || rep.Errors[0].Row != 2 {
+			t.Fatalf("invalid import: unexpected report %d %+v", code, rep)
+		}
+		if got := listTitles(t, r); !slices.Equal(got, []string{"existing"}) {
+			t.Fatalf("invalid import changed tasks: %v", got)
+		}
+
+		// CSV with header mapping; the existing task is skipped
+		csvBody := "ID,Name,Finished,Tags\n1,renamed,true,\n,bake,true,home kitchen\n"
+		code, rep = doImport(t, r, "?map=ID:id,Name:title,Finished:done", "text/csv", csvBody)
+		if code != http.StatusOK || rep.Created != 1 || rep.Skipped != 1 {
+			t.Fatalf("csv import: unexpected report %d %+v", code, rep)
+		}
+		var baked Task
+		if err := json.Unmarshal(doJSON(t, r, http.MethodGet, "/tasks/2", "").Body.Bytes(), &baked); err != nil {
+			t.Fatalf("failed to parse JSON: %v", err)
+		}
+		if baked.Title != "bake" || !baked.Done || baked.CompletedAt == nil || !slices.Equal(baked.Tags, []string{"home", "kitchen"}) {
+			t.Fatalf("csv import: unexpected task %+v", baked)
+		}
+
+		// overwrite only changes the attributes the row has
+		code, rep = doImport(t, r, "?on_conflict=overwrite", "application/x-ndjson", `{"id":1,"title":"renamed","done":true}`)
+		if code != http.StatusOK || rep.Updated != 1 || rep.Rows[0].ID != 1 {
+			t.Fatalf("overwrite: unexpected report %d %+v", code, rep)
+		}
+		var first Task
+		if err := json.Unmarshal(doJSON(t, r, http.MethodGet, "/tasks/1", "").Body.Bytes(), &first); err != nil {
+			t.Fatalf("failed to parse JSON: %v", err)
+		}
+		if first.Title != "renamed" || !first.Done || !slices.Equal(first.Tags, []string{"keep"}) {
+			t.Fatalf("overwrite: unexpected task %+v", first)
+		}
+
+		// an export imports as it is; duplicate copies every task
+		exported := doJSON(t, r, http.MethodGet, "/export?format=csv", "").Body.String()
+		code, rep = doImport(t, r, "?on_conflict=duplicate&format=csv", "text/plain", exported)
+		if code != http.StatusOK || rep.Created != 2 {
+			t.Fatalf("duplicate: unexpected report %d %+v", code, rep)
+		}
+		if got := listTitles(t, r); !slices.Equal(got, []string{"renamed", "bake", "renamed", "bake"}) {
+			t.Fatalf("duplicate: unexpected tasks %v", got)
+		}
+
+		for _, tt := range []struct {
+			name, query, contentType, body string
+			wantCode                       int
+		}{
+			{"unknown column", "", "text/csv", "title,color\nx,red\n", http.StatusUnprocessableEntity},
+			{"bad map", "?map=Name:name", "text/csv", "Name\nx\n", http.StatusUnprocessableEntity},
+			{"bad strategy", "?on_conflict=merge", "application/json", `[]`, http.StatusUnprocessableEntity},
+			{"invalid json", "", "application/json", `{`, http.StatusBadRequest},
+		} {
+			if code, _ := doImport(t, r, tt.query, tt.contentType, tt.body); code != tt.wantCode {
+				t.Fatalf("%s: expected %d, got %d", tt.name, tt.wantCode, code)
+			}
+		}
+	})
+}
+
+func TestImport_ParentRow(t *testing.T) {
+	forEachRepo(t, func(t *testing.T, repo Repository) {
+		r := newTestServer(repo)
+
+		bad := `[{"title":"a"},{"title":"b","parent_row":2},{"title":"c","parent_row":1,"parent_id":1}]`
+		if code, rep := doImport(t, r, "", "application/json", bad); code != http.StatusUnprocessableEntity || len(rep.Errors) != 3 {
+			t.Fatalf("invalid parent_row: unexpected report %d %+v", code, rep)
+		}
+
+		doJSON(t, r, http.MethodPost, "/tasks", `{"title":"existing"}`)
+		body := `[{"id":1,"title":"existing"},{"title":"child","parent_row":1},{"title":"grandchild","parent_row":2}]`
+		code, rep := doImport(t, r, "", "application/json", body)
+		if code != http.StatusOK || rep.Skipped != 1 || rep.Created != 2 {
+			t.Fatalf("import: unexpected report %d %+v", code, rep)
+		}
+		var list []Task
+		if err := json.Unmarshal(doJSON(t, r, http.MethodGet, "/tasks", "").Body.Bytes(), &list); err != nil {
+			t.Fatalf("failed to parse JSON: %v", err)
+		}
+		if len(list) != 3 || list[1].ParentID == nil || *list[1].ParentID != 1 || list[2].ParentID == nil || *list[2].ParentID != list[1].ID {
+			t.Fatalf("expected a chain of subtasks, got %+v", list)
+		}
+	})
+}
+
+func TestImport_HiddenUIDConflict(t *testing.T) {
+	forEachRepo(t, func(t *testing.T, repo Repository) {
+		r := newAuthServer(repo)
+		alice := createTestUser(t, r, "alice", false)
+		bob := createTestUser(t, r, "bob", false)
+
+		importAs := func(token string) int {
+			req := httptest.NewRequest(http.MethodPost, "/import", strings.NewReader(testICS))
+			req.Header.Set("Content-Type", "text/calendar")
+			req.Header.Set("Authorization", "Bearer "+token)
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, req)
+			return rec.Code
+		}
+		if code := importAs(alice); code != http.StatusOK {
+			t.Fatalf("alice: expected 200, got %d", code)
+		}
+		// bob cannot see alice's task, so its UID is not his to reuse
+		if code := importAs(bob); code != http.StatusConflict {
+			t.Fatalf("bob: expected 409, got %d", code)
+		}
+	})
+}
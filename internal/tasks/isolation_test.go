@@ -0,0 +1,222 @@
+package tasks
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// createTestWorkspace provisions a workspace with the shared secret and
+// returns its admin's token.
+func createTestWorkspace(t *testing.T, r http.Handler, name, admin string) string {
+	t.Helper()
+	rec := doAs(t, r, testRootToken, http.MethodPost, "/workspaces", fmt.Sprintf(`{"name":%q,"admin":%q}`, name, admin))
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("create workspace %s: expected 201, got %d, body=%s", name, rec.Code, rec.Body.String())
+	}
+	var ws createdWorkspace
+	if err := json.Unmarshal(rec.Body.Bytes(), &ws); err != nil {
+		t.Fatalf("failed to parse JSON: %v", err)
+	}
+	return ws.Admin.Token
+}
+
+// createdID posts body as token and returns the id of the created record.
+func createdID(t *testing.T, r http.Handler, token, path, body string) int64 {
+	t.Helper()
+	rec := doAs(t, r, token, http.MethodPost, path, body)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("POST %s: expected 201, got %d, body=%s", path, rec.Code, rec.Body.String())
+	}
+	var v struct {
+		ID int64 `json:"id"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &v); err != nil {
+		t.Fatalf("failed to parse JSON: %v", err)
+	}
+	return v.ID
+}
+
+// TestWorkspaceIsolation signs in as the admin of one workspace and tries
+// every endpoint against the records of another. Records of other
+// workspaces must look like they do not exist.
+func TestWorkspaceIsolation(t *testing.T) {
+	forEachRepo(t, func(t *testing.T, repo Repository) {
+		r := newAuthServer(repo)
+		victim := createTestWorkspace(t, r, "acme", "acme-admin")
+		intruder := createTestWorkspace(t, r, "globex", "globex-admin")
+
+		project := createdID(t, r, victim, "/projects", `{"name":"secret","fields":[{"name":"points","type":"number"}]}`)
+		task := createdID(t, r, victim, "/tasks", fmt.Sprintf(`{"title":"plans","project_id":%d,"fields":{"points":3}}`, project))
+		tpl := createdID(t, r, victim, "/templates", `{"name":"t","task":{"title":"x"}}`)
+		view := createdID(t, r, victim, "/views", fmt.Sprintf(`{"name":"v","query":"project_id=%d","project_id":%d}`, project, project))
+		hook := createdID(t, r, victim, "/webhooks", `{"url":"https://acme.example/hook"}`)
+		createTestUserAs(t, r, victim, "acme-dev")
+		victimID := testUserID(t, r, victim)
+		intruderFeed := feedToken(t, r, intruder)
+
+		tests := []struct {
+			route    string // chi pattern, checked against the router below
+			path     string
+			body     string
+			wantCode int
+			wantLen  int // items in a JSON array response, -1 to skip
+		}{
+			{"POST /tasks", "/tasks", fmt.Sprintf(`{"title":"x","project_id":%d}`, project), http.StatusUnprocessableEntity, -1},
+			{"POST /tasks", "/tasks", fmt.Sprintf(`{"title":"x","parent_id":%d}`, task), http.StatusUnprocessableEntity, -1},
+			{"POST /tasks", "/tasks", fmt.Sprintf(`{"title":"x","assignee_ids":[%d]}`, victimID), http.StatusUnprocessableEntity, -1},
+			{"GET /tasks", "/tasks", "", http.StatusOK, 0},
+			{"GET /tasks", fmt.Sprintf("/tasks?project_id=%d", project), "", http.StatusUnprocessableEntity, -1},
+			// a valid request streams until the client leaves; TestTaskEvents_Scope covers isolation
+			{"GET /tasks/events", "/tasks/events?type=renamed", "", http.StatusUnprocessableEntity, -1},
+			{"POST /tasks/quick", "/tasks/quick", `{"text":"mine tomorrow"}`, http.StatusCreated, -1},
+			{"GET /tasks/{id}", fmt.Sprintf("/tasks/%d", task), "", http.StatusNotFound, -1},
+			{"PATCH /tasks/{id}", fmt.Sprintf("/tasks/%d", task), `{"done":true}`, http.StatusNotFound, -1},
+			{"POST /tasks/{id}/assignees", fmt.Sprintf("/tasks/%d/assignees", task), fmt.Sprintf(`{"user_id":%d}`, victimID), http.StatusNotFound, -1},
+			{"DELETE /tasks/{id}/assignees/{user_id}", fmt.Sprintf("/tasks/%d/assignees/%d", task, victimID), "", http.StatusNotFound, -1},
+			{"POST /projects", "/projects", `{"name":"mine"}`, http.StatusCreated, -1},
+			{"GET /projects", "/projects", "", http.StatusOK, 1},
+			{"GET /projects/{id}", fmt.Sprintf("/projects/%d", project), "", http.StatusNotFound, -1},
+			{"PUT /projects/{id}/fields", fmt.Sprintf("/projects/%d/fields", project), `{"fields":[]}`, http.StatusNotFound, -1},
+			{"POST /projects/{id}/members", fmt.Sprintf("/projects/%d/members", project), `{"user_id":1,"role":"owner"}`, http.StatusNotFound, -1},
+			{"GET /projects/{id}/members", fmt.Sprintf("/projects/%d/members", project), "", http.StatusNotFound, -1},
+			{"POST /views", "/views", fmt.Sprintf(`{"name":"v","query":"project_id=%d"}`, project), http.StatusUnprocessableEntity, -1},
+			{"POST /views", "/views", fmt.Sprintf(`{"name":"v","project_id":%d}`, project), http.StatusUnprocessableEntity, -1},
+			{"GET /views", "/views", "", http.StatusOK, 0},
+			{"GET /views/{id}", fmt.Sprintf("/views/%d", view), "", http.StatusNotFound, -1},
+			{"DELETE /views/{id}", fmt.Sprintf("/views/%d", view), "", http.StatusNotFound, -1},
+			{"GET /views/{id}/tasks", fmt.Sprintf("/views/%d/tasks", view), "", http.StatusNotFound, -1},
+			{"POST /webhooks", "/webhooks", `{"url":"https://globex.example/hook"}`, http.StatusCreated, -1},
+			{"GET /webhooks", "/webhooks", "", http.StatusOK, 1},
+			{"GET /webhooks/{id}", fmt.Sprintf("/webhooks/%d", hook), "", http.StatusNotFound, -1},
+			{"PATCH /webhooks/{id}", fmt.Sprintf("/webhooks/%d", hook), `{"active":false}`, http.StatusNotFound, -1},
+			{"GET /webhooks/{id}/deliveries", fmt.Sprintf("/webhooks/%d/deliveries", hook), "", http.StatusNotFound, -1},
+			{"POST /webhooks/{id}/deliveries/{delivery_id}/redeliver", fmt.Sprintf("/webhooks/%d/deliveries/1/redeliver", hook), "", http.StatusNotFound, -1},
+			{"DELETE /webhooks/{id}", fmt.Sprintf("/webhooks/%d", hook), "", http.StatusNotFound, -1},
+			{"POST /templates", "/templates", fmt.Sprintf(`{"name":"t","task":{"title":"x","project_id":%d}}`, project), http.StatusUnprocessableEntity, -1},
+			{"GET /templates", "/templates", "", http.StatusOK, 0},
+			{"GET /templates/{id}", fmt.Sprintf("/templates/%d", tpl), "", http.StatusNotFound, -1},
+			{"DELETE /templates/{id}", fmt.Sprintf("/templates/%d", tpl), "", http.StatusNotFound, -1},
+			{"POST /templates/{id}/instantiate", fmt.Sprintf("/templates/%d/instantiate", tpl), `{}`, http.StatusNotFound, -1},
+			{"POST /users", "/users", `{"name":"globex-dev"}`, http.StatusCreated, -1},
+			{"GET /users", "/users", "", http.StatusOK, 2},
+			{"GET /me", "/me", "", http.StatusOK, -1},
+			{"GET /me/tasks", "/me/tasks", "", http.StatusOK, 1},
+			{"GET /ical/{file}", "/ical/" + intruderFeed + ".ics", "", http.StatusOK, -1},
+			{"POST /me/ical-token", "/me/ical-token", "", http.StatusCreated, -1},
+			{"DELETE /me/ical-token", "/me/ical-token", "", http.StatusNoContent, -1},
+			{"GET /stats", fmt.Sprintf("/stats?project_id=%d", project), "", http.StatusUnprocessableEntity, -1},
+			{"GET /export", "/export", "", http.StatusOK, 1},
+			{"POST /import", "/import", fmt.Sprintf(`[{"title":"x","project_id":%d}]`, project), http.StatusUnprocessableEntity, -1},
+			{"POST /import", "/import?on_conflict=overwrite", fmt.Sprintf(`[{"id":%d,"title":"pwned","done":true}]`, task), http.StatusOK, -1},
+			{"POST /import/trello", "/import/trello?dry_run=true", `{"name":"secret","cards":[{"id":"c1","name":"x"}]}`, http.StatusOK, -1},
+			{"POST /import/todoist", "/import/todoist?dry_run=true", `{"projects":[{"id":"p1","name":"secret"}],"items":[{"id":"i1","content":"x","project_id":"p1"}]}`, http.StatusOK, -1},
+			{"POST /graphql", "/graphql", fmt.Sprintf(`{"query":"mutation { updateTask(id: \"%d\", input: {done: true}) { id } }"}`, task), http.StatusOK, -1},
+			// the handshake is refused without Upgrade; TestWebSocket_Auth covers isolation
+			{"GET /ws", "/ws", "", http.StatusUpgradeRequired, -1},
+			// TestSync_Scope covers the changes a pull returns
+			{"GET /sync", "/sync", "", http.StatusOK, -1},
+			{"POST /sync", "/sync", fmt.Sprintf(`{"changes":[{"client_id":"c1","fields":{"title":"x","project_id":%d}}]}`, project), http.StatusUnprocessableEntity, -1},
+			{"POST /sync", "/sync", fmt.Sprintf(`{"changes":[{"id":%d,"fields":{"done":true},"changed_at":"2030-01-01T00:00:00Z"},{"id":%d,"deleted":true,"changed_at":"2030-01-01T00:00:00Z"}]}`, task, task), http.StatusOK, -1},
+			{"GET /.well-known/caldav", "/.well-known/caldav", "", http.StatusMovedPermanently, -1},
+			{"PROPFIND /.well-known/caldav", "/.well-known/caldav", "", http.StatusMovedPermanently, -1},
+			{"OPTIONS /caldav/*", fmt.Sprintf("/caldav/projects/%d/", project), "", http.StatusOK, -1},
+			{"PROPFIND /caldav/", "/caldav/", "", http.StatusMultiStatus, -1},
+			{"PROPFIND /caldav/projects/", "/caldav/projects/", "", http.StatusMultiStatus, -1},
+			{"PROPFIND /caldav/projects/{project}/", fmt.Sprintf("/caldav/projects/%d/", project), "", http.StatusNotFound, -1},
+			{"REPORT /caldav/projects/{project}/", fmt.Sprintf("/caldav/projects/%d/", project), `<calendar-query xmlns="urn:ietf:params:xml:ns:caldav"/>`, http.StatusNotFound, -1},
+			{"PROPFIND /caldav/projects/{project}/{name}", fmt.Sprintf("/caldav/projects/%d/task-%d@tasks-api.ics", project, task), "", http.StatusNotFound, -1},
+			{"GET /caldav/projects/{project}/{name}", fmt.Sprintf("/caldav/projects/%d/task-%d@tasks-api.ics", project, task), "", http.StatusNotFound, -1},
+			{"PUT /caldav/projects/{project}/{name}", fmt.Sprintf("/caldav/projects/%d/task-%d@tasks-api.ics", project, task), fmt.Sprintf(testVTODO, fmt.Sprintf("task-%d@tasks-api", task), "pwned", "COMPLETED"), http.StatusNotFound, -1},
+			{"DELETE /caldav/projects/{project}/{name}", fmt.Sprintf("/caldav/projects/%d/task-%d@tasks-api.ics", project, task), "", http.StatusNotFound, -1},
+			{"POST /workspaces", "/workspaces", `{"name":"x","admin":"x-admin"}`, http.StatusForbidden, -1},
+			{"GET /workspaces", "/workspaces", "", http.StatusForbidden, -1},
+		}
+
+		covered := map[string]bool{}
+		for _, tt := range tests {
+			covered[tt.route] = true
+			method, _, _ := strings.Cut(tt.route, " ")
+			rec := doAs(t, r, intruder, method, tt.path, tt.body)
+			if rec.Code != tt.wantCode {
+				t.Fatalf("%s %s: expected %d, got %d, body=%s", method, tt.path, tt.wantCode, rec.Code, rec.Body.String())
+			}
+			if tt.wantLen >= 0 {
+				var list []json.RawMessage
+				if err := json.Unmarshal(rec.Body.Bytes(), &list); err != nil {
+					t.Fatalf("%s %s: failed to parse JSON: %v", method, tt.path, err)
+				}
+				if len(list) != tt.wantLen {
+					t.Fatalf("%s %s: expected %d items, got %s", method, tt.path, tt.wantLen, rec.Body.String())
+				}
+			}
+		}
+
+		// every route must have a case above
+		err := chi.Walk(r, func(method, route string, _ http.Handler, _ ...func(http.Handler) http.Handler) error {
+			if !covered[method+" "+route] {
+				t.Errorf("no isolation case for %s %s", method, route)
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("walk: %v", err)
+		}
+
+		// the victim's records are untouched and the intruder's are not visible
+		rec := doAs(t, r, victim, http.MethodGet, fmt.Sprintf("/tasks/%d", task), "")
+		var got Task
+		if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+			t.Fatalf("failed to parse JSON: %v", err)
+		}
+		if got.Done || got.Fields["points"] != 3.0 {
+			t.Fatalf("victim task was modified: %+v", got)
+		}
+		if rec := doAs(t, r, victim, http.MethodGet, fmt.Sprintf("/templates/%d", tpl), ""); rec.Code != http.StatusOK {
+			t.Fatalf("victim template is gone: %d", rec.Code)
+		}
+		if rec := doAs(t, r, victim, http.MethodGet, fmt.Sprintf("/webhooks/%d", hook), ""); rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"active":true`) {
+			t.Fatalf("victim webhook was modified: %d %s", rec.Code, rec.Body.String())
+		}
+		for path, want := range map[string]int{"/tasks": 1, "/projects": 1, "/templates": 1, "/users": 2} {
+			var list []json.RawMessage
+			rec := doAs(t, r, victim, http.MethodGet, path, "")
+			if err := json.Unmarshal(rec.Body.Bytes(), &list); err != nil || len(list) != want {
+				t.Fatalf("victim %s: expected %d items, got %s", path, want, rec.Body.String())
+			}
+		}
+		rec = doAs(t, r, testRootToken, http.MethodGet, "/workspaces", "")
+		var wss []Workspace
+		if err := json.Unmarshal(rec.Body.Bytes(), &wss); err != nil {
+			t.Fatalf("failed to parse JSON: %v", err)
+		}
+		if names := []string{wss[0].Name, wss[1].Name, wss[2].Name}; !slices.Equal(names, []string{"default", "acme", "globex"}) {
+			t.Fatalf("unexpected workspaces: %+v", wss)
+		}
+		var defaults []Task
+		rec = doAs(t, r, testRootToken, http.MethodGet, "/tasks", "")
+		if err := json.Unmarshal(rec.Body.Bytes(), &defaults); err != nil || len(defaults) != 0 {
+			t.Fatalf("default workspace must not see other workspaces: %s", rec.Body.String())
+		}
+
+		// user names are unique per workspace, so another one's do not show
+		createTestUserAs(t, r, intruder, "acme-dev")
+		createTestWorkspace(t, r, "initech", "acme-admin")
+		if rec := doAs(t, r, intruder, http.MethodPost, "/users", `{"name":"acme-dev"}`); rec.Code != http.StatusConflict {
+			t.Fatalf("expected 409 for a name taken in the same workspace, got %d", rec.Code)
+		}
+	})
+}
+
+func createTestUserAs(t *testing.T, r http.Handler, token, name string) {
+	t.Helper()
+	rec := doAs(t, r, token, http.MethodPost, "/users", fmt.Sprintf(`{"name":%q}`, name))
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("create user %s: expected 201, got %d, body=%s", name, rec.Code, rec.Body.String())
+	}
+}
@@ -0,0 +1,181 @@
+package tasks
+
+import (
+	"bufio"
+	"cmp"
+	"context"
+	"fmt"
+	"io"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// markdownType is a GitHub-flavored Markdown checklist, with a heading per
+// project after the tasks that have none:
+//
+//	## Home
+//
+//	- [ ] file taxes
+//	  - [x] find receipts
+//
+// Subtasks are nested under their parent when the parent is listed too.
+const markdownType = "text/markdown"
+
+var (
+	markdownHeading = regexp.MustCompile(`^ {0,3}#{1,6}(?:[ \t]+(.*?))?(?:[ \t]+#+)?[ \t]*$`)
+	markdownItem    = regexp.MustCompile(`^([ \t]*)(?:[-*+]|[0-9]{1,9}[.)])[ \t]+\[([ xX])\](?:[ \t]+(.*?))?[ \t]*$`)
+	markdownEscaped = regexp.MustCompile("\\\\([!-/:-@[-`{-~])")
+	markdownEscaper = strings.NewReplacer(
+		`\`, `\\`, "`", "\\`", `*`, `\*`, `_`, `\_`, `[`, `\[`, `]`, `\]`,
+		`<`, `\<`, `>`, `\>`, `~`, `\~`, `#`, `\#`,
+	)
+)
+
+// markdownUnescape undoes backslash escapes of ASCII punctuation.
+func markdownUnescape(s string) string {
+	return markdownEscaped.ReplaceAllString(s, "$1")
+}
+
+// markdownEncoder collects the tasks and writes the checklist at the end,
+// when every parent is known.
+type markdownEncoder struct {
+	w        io.Writer
+	projects map[int64]string
+	tasks    []Task
+}
+
+// newMarkdownEncoder loads the projects visible in s, which head their
+// tasks.
+func newMarkdownEncoder(ctx context.Context, repo Repository, s Scope, w io.Writer) (*markdownEncoder, error) {
+	ps, err := repo.ListProjects(ctx, s)
+	if err != nil {
+		return nil, err
+	}
+	projects := make(map[int64]string, len(ps))
+	for _, p := range ps {
+		projects[p.ID] = p.Name
+	}
+	return &markdownEncoder{w: w, projects: projects}, nil
+}
+
+func (e *markdownEncoder) encode(t Task) error {
+	e.tasks = append(e.tasks, t)
+	return nil
+}
+
+func (e *markdownEncoder) end() error {
+	listed := make(map[int64]bool, len(e.tasks))
+	for _, t := range e.tasks {
+		listed[t.ID] = true
+	}
+	var (
+		groups   []int64 // projects in order of appearance, 0 for none
+		roots    = make(map[int64][]Task)
+		children = make(map[int64][]Task)
+	)
+	for _, t := range e.tasks {
+		if t.ParentID != nil && listed[*t.ParentID] {
+			children[*t.ParentID] = append(children[*t.ParentID], t)
+			continue
+		}
+		var project int64
+		if t.ProjectID != nil {
+			project = *t.ProjectID
+		}
+		if _, ok := roots[project]; !ok {
+			groups = append(groups, project)
+		}
+		roots[project] = append(roots[project], t)
+	}
+	// tasks without a project come first, without a heading
+	slices.SortStableFunc(groups, func(a, b int64) int {
+		return cmp.Compare(min(a, 1), min(b, 1))
+	})
+
+	bw := bufio.NewWriter(e.w)
+	var write func(t Task, depth int)
+	write = func(t Task, depth int) {
+		box := " "
+		if t.Done {
+			box = "x"
+		}
+		fmt.Fprintf(bw, "%s- [%s] %s\n", strings.Repeat("  ", depth), box, markdownEscaper.Replace(t.Title))
+		for _, c := range children[t.ID] {
+			write(c, depth+1)
+		}
+	}
+	for i, project := range groups {
+		if i > 0 {
+			bw.WriteString("\n")
+		}
+		if project != 0 {
+			name, ok := e.projects[project]
+			if !ok {
+				name = fmt.Sprintf("Project %d", project)
+			}
+			fmt.Fprintf(bw, "## %s\n\n", markdownEscaper.Replace(name))
+		}
+		for _, t := range roots[project] {
+			write(t, 0)
+		}
+	}
+	return bw.Flush()
+}
+
+func (e *markdownEncoder) fail() bool { return false }
+
+// readMarkdownRecords parses the task list items of a Markdown document
+// into import records, one per item, keeping their done state. Items are
+// nested by indentation, and a heading naming one of projects puts the
+// items after it into that project; other headings end the project's
+// section. Everything else in the document is ignored.
+func readMarkdownRecords(body io.Reader, projects []Project) ([]importRecord, []rowError, error) {
+	type open struct{ indent, row int }
+	var (
+		out     []importRecord
+		project *int64
+		stack   []open // the items new items may be nested under
+	)
+	sc := bufio.NewScanner(body)
+	sc.Buffer(nil, maxImportBytes)
+	for sc.Scan() {
+		line := sc.Text()
+		if m := markdownHeading.FindStringSubmatch(line); m != nil {
+			name := strings.TrimSpace(markdownUnescape(m[1]))
+			project, stack = nil, nil
+			if i := slices.IndexFunc(projects, func(p Project) bool { return strings.EqualFold(p.Name, name) }); i >= 0 {
+				project = &projects[i].ID
+			}
+			continue
+		}
+		m := markdownItem.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		indent := len(strings.ReplaceAll(m[1], "\t", "    "))
+		for len(stack) > 0 && stack[len(stack)-1].indent >= indent {
+			stack = stack[:len(stack)-1]
+		}
+		v := map[string]any{
+			"title": markdownUnescape(m[3]),
+			"done":  m[2] != " ",
+		}
+		if project != nil {
+			v["project_id"] = *project
+		}
+		if len(stack) > 0 {
+			v["parent_row"] = stack[len(stack)-1].row
+		}
+		rec, err := newImportRecord(v)
+		if err != nil {
+			return nil, nil, err
+		}
+		out = append(out, rec)
+		stack = append(stack, open{indent: indent, row: len(out)})
+	}
+	if err := sc.Err(); err != nil {
+		return nil, nil, err
+	}
+	return out, nil, nil
+}
@@ -0,0 +1,103 @@
+package tasks
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+func TestMarkdown_RoundTrip(t *testing.T) {
+	for name, newRepo := range map[string]func() Repository{
+		"memory": func() Repository { return NewInMemoryRepo() },
+		"sqlite": func() Repository { return newTempDB(t) },
+	} {
+		t.Run(name, func(t *testing.T) {
+			r := newTestServer(newRepo())
+			doJSON(t, r, http.MethodPost, "/projects", `{"name":"Home"}`)
+			doJSON(t, r, http.MethodPost, "/tasks", `{"title":"call mom"}`)
+			doJSON(t, r, http.MethodPost, "/tasks", `{"title":"file taxes","project_id":1}`)
+			doJSON(t, r, http.MethodPost, "/tasks", `{"title":"find receipts","project_id":1,"parent_id":2}`)
+			doJSON(t, r, http.MethodPost, "/tasks", `{"title":"scan *all* [pages] #2","project_id":1,"parent_id":3}`)
+			doJSON(t, r, http.MethodPost, "/tasks", `{"title":"water plants"}`)
+			doJSON(t, r, http.MethodPatch, "/tasks/3", `{"done":true}`)
+
+			rec := doJSON(t, r, http.MethodGet, "/export?format=markdown", "")
+			if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != markdownType {
+				t.Fatalf("expected Markdown, got %d %q", rec.Code, rec.Header().Get("Content-Type"))
+			}
+			want := "- [ ] call mom\n" +
+				"- [ ] water plants\n" +
+				"\n" +
+				"## Home\n" +
+				"\n" +
+				"- [ ] file taxes\n" +
+				"  - [x] find receipts\n" +
+				"    - [ ] scan \\*all\\* \\[pages\\] \\#2\n"
+			body := rec.Body.String()
+			if body != want {
+				t.Fatalf("unexpected checklist:\n%s\nwant:\n%s", body, want)
+			}
+
+			other := newTestServer(newRepo())
+			doJSON(t, other, http.MethodPost, "/projects", `{"name":"Home"}`)
+			code, rep := doImport(t, other, "", markdownType, body)
+			if code != http.StatusOK || rep.Created != 5 {
+				t.Fatalf("import: unexpected report %d %+v", code, rep)
+			}
+			if got := doJSON(t, other, http.MethodGet, "/export?format=markdown", "").Body.String(); got != want {
+				t.Fatalf("round trip changed the checklist:\n%s", got)
+			}
+		})
+	}
+}
+
+func TestMarkdown_Import(t *testing.T) {
+	r := newTestServer(NewInMemoryRepo())
+	doJSON(t, r, http.MethodPost, "/projects", `{"name":"Release 1.2"}`)
+
+	doc := "# Release 1.2\n" +
+		"\n" +
+		"Some prose, and a [link](https://example.com).\n" +
+		"\n" +
+		"* [X] cut the branch\n" +
+		"\t1. [ ] write notes\n" +
+		"\t- plain bullet\n" +
+		"\t\t- [ ] ask QA\n" +
+		"- [ ] tag it\n" +
+		"\n" +
+		"## Retro\n" +
+		"\n" +
+		"+ [ ] book a room\n"
+	code, rep := doImport(t, r, "?format=markdown", "text/plain", doc)
+	if code != http.StatusOK || rep.Created != 5 {
+		t.Fatalf("import: unexpected report %d %+v", code, rep)
+	}
+	var list []Task
+	if err := json.Unmarshal(doJSON(t, r, http.MethodGet, "/tasks", "").Body.Bytes(), &list); err != nil {
+		t.Fatalf("failed to parse JSON: %v", err)
+	}
+	if len(list) != 5 {
+		t.Fatalf("expected 5 tasks, got %+v", list)
+	}
+	branch, notes, qa, tag, room := list[0], list[1], list[2], list[3], list[4]
+	if branch.Title != "cut the branch" || !branch.Done || branch.ParentID != nil || branch.ProjectID == nil {
+		t.Fatalf("unexpected task %+v", branch)
+	}
+	if notes.Done || notes.ParentID == nil || *notes.ParentID != branch.ID {
+		t.Fatalf("expected notes under the branch, got %+v", notes)
+	}
+	if qa.Title != "ask QA" || qa.ParentID == nil || *qa.ParentID != notes.ID {
+		t.Fatalf("expected QA under the notes, got %+v", qa)
+	}
+	if tag.ParentID != nil || tag.ProjectID == nil {
+		t.Fatalf("unexpected task %+v", tag)
+	}
+	// the Retro heading names no project
+	if room.Title != "book a room" || room.ProjectID != nil {
+		t.Fatalf("unexpected task %+v", room)
+	}
+
+	if code, rep := doImport(t, r, "?format=markdown", "text/plain", "- [ ] \n"); code != http.StatusUnprocessableEntity || len(rep.Errors) != 1 {
+		t.Fatalf("empty item: unexpected report %d %+v", code, rep)
+	}
+}
@@ -0,0 +1,105 @@
+package tasks
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+// testUserID returns the id of the user behind token.
+func testUserID(t *testing.T, r http.Handler, token string) int64 {
+	t.Helper()
+	rec := doAs(t, r, token, http.MethodGet, "/me", "")
+	var u User
+	if err := json.Unmarshal(rec.Body.Bytes(), &u); err != nil {
+		t.Fatalf("failed to parse JSON: %v", err)
+	}
+	return u.ID
+}
+
+func TestProjectRoles(t *testing.T) {
+	forEachRepo(t, func(t *testing.T, repo Repository) {
+		r := newAuthServer(repo)
+		owner := createTestUser(t, r, "olivia", false)
+		editor := createTestUser(t, r, "ed", false)
+		viewer := createTestUser(t, r, "vic", false)
+		outsider := createTestUser(t, r, "otto", false)
+		admin := createTestUser(t, r, "ops", true)
+		latecomer := createTestUser(t, r, "late", false)
+
+		project := createdID(t, r, owner, "/projects", `{"name":"shared"}`)
+		task := createdID(t, r, owner, "/tasks", fmt.Sprintf(`{"title":"plan","project_id":%d}`, project))
+		members := fmt.Sprintf("/projects/%d/members", project)
+		for token, role := range map[string]Role{editor: RoleEditor, viewer: RoleViewer} {
+			body := fmt.Sprintf(`{"user_id":%d,"role":%q}`, testUserID(t, r, token), role)
+			if rec := doAs(t, r, owner, http.MethodPost, members, body); rec.Code != http.StatusCreated {
+				t.Fatalf("invite %s: expected 201, got %d, body=%s", role, rec.Code, rec.Body.String())
+			}
+		}
+
+		projectPath := fmt.Sprintf("/projects/%d", project)
+		taskPath := fmt.Sprintf("/tasks/%d", task)
+		newTask := fmt.Sprintf(`{"title":"x","project_id":%d}`, project)
+		invite := func(id int64, role string) string {
+			return fmt.Sprintf(`{"user_id":%d,"role":%q}`, id, role)
+		}
+		lateID := testUserID(t, r, latecomer)
+
+		tests := []struct {
+			name     string
+			token    string
+			method   string
+			path     string
+			body     string
+			wantCode int
+			wantLen  int
+		}{
+			{"owner lists projects", owner, http.MethodGet, "/projects", "", http.StatusOK, 1},
+			{"viewer lists projects", viewer, http.MethodGet, "/projects", "", http.StatusOK, 1},
+			{"outsider lists projects", outsider, http.MethodGet, "/projects", "", http.StatusOK, 0},
+			{"admin lists projects", admin, http.MethodGet, "/projects", "", http.StatusOK, 1},
+			{"viewer gets project", viewer, http.MethodGet, projectPath, "", http.StatusOK, -1},
+			{"outsider cannot get project", outsider, http.MethodGet, projectPath, "", http.StatusNotFound, -1},
+			{"viewer lists tasks", viewer, http.MethodGet, "/tasks", "", http.StatusOK, 1},
+			{"outsider lists tasks", outsider, http.MethodGet, "/tasks", "", http.StatusOK, 0},
+			{"viewer gets task", viewer, http.MethodGet, taskPath, "", http.StatusOK, -1},
+			{"outsider cannot get task", outsider, http.MethodGet, taskPath, "", http.StatusNotFound, -1},
+			{"viewer lists members", viewer, http.MethodGet, members, "", http.StatusOK, 3},
+			{"outsider cannot list members", outsider, http.MethodGet, members, "", http.StatusNotFound, -1},
+			{"viewer cannot create task", viewer, http.MethodPost, "/tasks", newTask, http.StatusForbidden, -1},
+			{"viewer cannot update task", viewer, http.MethodPatch, taskPath, `{"done":true}`, http.StatusForbidden, -1},
+			{"viewer cannot set fields", viewer, http.MethodPut, projectPath + "/fields", `{"fields":[]}`, http.StatusForbidden, -1},
+			{"viewer cannot invite", viewer, http.MethodPost, members, invite(lateID, "viewer"), http.StatusForbidden, -1},
+			{"outsider cannot create task", outsider, http.MethodPost, "/tasks", newTask, http.StatusUnprocessableEntity, -1},
+			{"outsider cannot invite", outsider, http.MethodPost, members, invite(lateID, "viewer"), http.StatusNotFound, -1},
+			{"editor creates task", editor, http.MethodPost, "/tasks", newTask, http.StatusCreated, -1},
+			{"editor updates task", editor, http.MethodPatch, taskPath, `{"priority":2}`, http.StatusOK, -1},
+			{"editor cannot set fields", editor, http.MethodPut, projectPath + "/fields", `{"fields":[]}`, http.StatusForbidden, -1},
+			{"editor cannot invite", editor, http.MethodPost, members, invite(lateID, "viewer"), http.StatusForbidden, -1},
+			{"owner sets fields", owner, http.MethodPut, projectPath + "/fields", `{"fields":[]}`, http.StatusOK, -1},
+			{"owner rejects bad role", owner, http.MethodPost, members, invite(lateID, "boss"), http.StatusUnprocessableEntity, -1},
+			{"owner rejects unknown user", owner, http.MethodPost, members, invite(999, "viewer"), http.StatusUnprocessableEntity, -1},
+			{"owner invites", owner, http.MethodPost, members, invite(lateID, "editor"), http.StatusCreated, -1},
+			{"owner cannot invite twice", owner, http.MethodPost, members, invite(lateID, "viewer"), http.StatusConflict, -1},
+			{"admin acts as owner", admin, http.MethodPut, projectPath + "/fields", `{"fields":[]}`, http.StatusOK, -1},
+			{"latecomer creates task", latecomer, http.MethodPost, "/tasks", newTask, http.StatusCreated, -1},
+			{"viewer sees every project task", viewer, http.MethodGet, "/tasks", "", http.StatusOK, 3},
+		}
+		for _, tt := range tests {
+			rec := doAs(t, r, tt.token, tt.method, tt.path, tt.body)
+			if rec.Code != tt.wantCode {
+				t.Fatalf("%s: expected %d, got %d, body=%s", tt.name, tt.wantCode, rec.Code, rec.Body.String())
+			}
+			if tt.wantLen >= 0 {
+				var list []json.RawMessage
+				if err := json.Unmarshal(rec.Body.Bytes(), &list); err != nil {
+					t.Fatalf("%s: failed to parse JSON: %v", tt.name, err)
+				}
+				if len(list) != tt.wantLen {
+					t.Fatalf("%s: expected %d items, got %s", tt.name, tt.wantLen, rec.Body.String())
+				}
+			}
+		}
+	})
+}
@@ -1,10 +1,326 @@
 package tasks
 
-import "time"
+import (
+	"encoding/json"
+	"time"
+)
 
 type Task struct {
+	workspaceID int64 // used by InMemoryRepo
+
+	ID          int64           `json:"id"`
+	Title       string          `json:"title"`
+	Done        bool            `json:"done"`
+	ProjectID   *int64          `json:"project_id,omitempty"`
+	ParentID    *int64          `json:"parent_id,omitempty"`
+	Tags        []string        `json:"tags,omitempty"`
+	Checklist   []ChecklistItem `json:"checklist,omitempty"`
+	Fields      map[string]any  `json:"fields,omitempty"`
+	DueAt       *time.Time      `json:"due_at,omitempty"`
+	Priority    int             `json:"priority,omitempty"`
+	Assignee    string          `json:"assignee,omitempty"`
+	AssigneeIDs []int64         `json:"assignee_ids,omitempty"`
+	OwnerID     *int64          `json:"owner_id,omitempty"`
+	CreatedAt   time.Time       `json:"created_at"`
+	CompletedAt *time.Time      `json:"completed_at,omitempty"`
+	ICalUID     string          `json:"ical_uid,omitempty"` // UID of the calendar entry it was imported from
+}
+
+type ChecklistItem struct {
+	Text string `json:"text"`
+	Done bool   `json:"done"`
+}
+
+// TaskInput carries the caller-supplied attributes of a new task.
+// Fields must already be validated against the project's definitions
+// and Tags normalized (see normalizeTags).
+type TaskInput struct {
+	Title       string
+	ProjectID   *int64
+	ParentID    *int64
+	Tags        []string
+	Checklist   []ChecklistItem
+	Fields      map[string]any
+	DueAt       *time.Time
+	Priority    int
+	Assignee    string
+	AssigneeIDs []int64
+	OwnerID     *int64
+	ICalUID     string
+}
+
+// TaskPatch lists the attributes to change on an existing task; nil
+// members are left alone. ClearDueAt removes the due date.
+type TaskPatch struct {
+	Title      *string
+	Done       *bool
+	Tags       *[]string
+	Checklist  *[]ChecklistItem
+	DueAt      *time.Time
+	ClearDueAt bool
+	Priority   *int
+	Assignee   *string
+	// AssigneeID is the user Assignee names, who is assigned along with
+	// it (see checkTaskPatch).
+	AssigneeID int64
+}
+
+// FieldClock is when a task attribute, named as in JSON, was last
+// changed.
+type FieldClock struct {
+	Field     string
+	ChangedAt time.Time
+}
+
+// DefaultWorkspaceID is the workspace of the shared secret and of
+// unauthenticated deployments. It always exists.
+const DefaultWorkspaceID int64 = 1
+
+// Scope describes who a repository call acts for and limits what it can
+// see: records of one workspace and, for a user who is not an admin, only
+// the projects they are a member of and the tasks they own or that belong
+// to those projects. A zero WorkspaceID means DefaultWorkspaceID, so the
+// zero Scope sees everything in the default workspace.
+type Scope struct {
+	WorkspaceID int64
+	UserID      int64
+	Admin       bool
+}
+
+func (s Scope) workspace() int64 {
+	if s.WorkspaceID == 0 {
+		return DefaultWorkspaceID
+	}
+	return s.WorkspaceID
+}
+
+// restricted reports whether s is limited to the user's own records.
+func (s Scope) restricted() bool {
+	return s.UserID != 0 && !s.Admin
+}
+
+// Role is a user's access level on a project. Each role can do everything
+// the previous one can.
+type Role string
+
+const (
+	RoleViewer Role = "viewer" // read the project and its tasks
+	RoleEditor Role = "editor" // create and update tasks in it
+	RoleOwner  Role = "owner"  // change its fields and invite members
+)
+
+var roleRank = map[Role]int{RoleViewer: 1, RoleEditor: 2, RoleOwner: 3}
+
+func (r Role) valid() bool { return roleRank[r] > 0 }
+
+// atLeast reports whether r grants everything min does.
+func (r Role) atLeast(min Role) bool { return roleRank[r] >= roleRank[min] }
+
+type Member struct {
+	UserID    int64     `json:"user_id"`
+	Name      string    `json:"name"`
+	Role      Role      `json:"role"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type Workspace struct {
+	ID        int64     `json:"id"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type User struct {
+	ID          int64     `json:"id"`
+	WorkspaceID int64     `json:"workspace_id"`
+	Name        string    `json:"name"`
+	Admin       bool      `json:"admin"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// TaskTree is a task together with subtasks that are created under it.
+// A subtask's ParentID is assigned by the repository.
+type TaskTree struct {
+	TaskInput
+	Subtasks []TaskTree
+}
+
+// ImportStrategy resolves an import row whose ID names a task in scope.
+type ImportStrategy string
+
+const (
+	ImportSkip      ImportStrategy = "skip"      // keep the existing task
+	ImportOverwrite ImportStrategy = "overwrite" // apply the row's attributes to it
+	ImportDuplicate ImportStrategy = "duplicate" // create a new task anyway
+)
+
+// ImportRow is one task of an import. New tasks are created from Input and
+// Done; Patch holds the attributes the row sets, which ImportOverwrite
+// applies to the existing task. A row conflicts with a task by ID or, if
+// none matches, by Input.ICalUID. ParentRow is the index in rows of an
+// earlier row whose task becomes the parent of a new task, in place of
+// Input.ParentID.
+type ImportRow struct {
+	ID        *int64
+	Input     TaskInput
+	Done      bool
+	Patch     TaskPatch
+	ParentRow *int
+}
+
+// ImportOutcome is what Repository.Import did with one row.
+type ImportOutcome struct {
+	Action string `json:"action"` // created, updated or skipped
+	ID     int64  `json:"id,omitempty"`
+}
+
+type Project struct {
+	workspaceID int64 // used by InMemoryRepo
+
+	ID        int64      `json:"id"`
+	Name      string     `json:"name"`
+	Fields    []FieldDef `json:"fields"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// ListQuery narrows and orders the result of Repository.List.
+// The zero value lists every task ordered by id.
+type ListQuery struct {
+	ProjectID      *int64
+	ParentID       *int64
+	Done           *bool
+	Tag            string
+	ICalUID        string  // imported from the calendar entry with this UID
+	AssigneeID     *int64  // assigned to this user
+	InvolvedUserID *int64  // owned by or assigned to this user
+	IDs            []int64 // any of these tasks, when not nil
+	ProjectIDs     []int64 // in any of these projects, when not nil
+	ParentIDs      []int64 // subtasks of any of these tasks, when not nil
+	AfterID        int64   // ids above this one, for paging by cursor
+	Fields         []FieldFilter
+	Sort           []SortKey
+	Limit          int // at most this many tasks; 0 means all
+	Offset         int
+	Select         []string // JSON names of the attributes to load; nil means all
+}
+
+// View is a saved GET /tasks query. Query holds the URL query string; it
+// is parsed again on every use, so it may stop being valid when the
+// project's fields change. A view with a ProjectID is shared with the
+// project's members, otherwise only its owner sees it.
+type View struct {
+	workspaceID int64 // used by InMemoryRepo
+
 	ID        int64     `json:"id"`
-	Title     string    `json:"title"`
-	Done      bool      `json:"done"`
+	Name      string    `json:"name"`
+	Query     string    `json:"query"`
+	ProjectID *int64    `json:"project_id,omitempty"`
+	OwnerID   *int64    `json:"owner_id,omitempty"`
 	CreatedAt time.Time `json:"created_at"`
 }
+
+// StatsQuery selects the tasks Repository.Stats summarizes. From and To
+// are UTC dates (midnight) bounding the daily series and the cycle times,
+// both inclusive. Now decides which open tasks are overdue.
+type StatsQuery struct {
+	ProjectID *int64
+	From, To  time.Time
+	Now       time.Time
+}
+
+type Stats struct {
+	ByStatus  StatusCounts `json:"by_status"`
+	Daily     []DayStats   `json:"daily"`
+	CycleTime CycleTime    `json:"cycle_time"`
+}
+
+// StatusCounts covers every task in scope regardless of the date range.
+type StatusCounts struct {
+	Open    int `json:"open"`
+	Done    int `json:"done"`
+	Overdue int `json:"overdue"` // open with a due date before now
+}
+
+type DayStats struct {
+	Date      string `json:"date"` // YYYY-MM-DD, UTC
+	Created   int    `json:"created"`
+	Completed int    `json:"completed"`
+}
+
+// CycleTime summarizes the seconds from creation to completion of the tasks
+// completed in the range, using nearest-rank percentiles. The percentiles
+// are omitted when Count is zero.
+type CycleTime struct {
+	Count int    `json:"count"`
+	P50   *int64 `json:"p50_seconds,omitempty"`
+	P90   *int64 `json:"p90_seconds,omitempty"`
+	P95   *int64 `json:"p95_seconds,omitempty"`
+}
+
+// SortKey orders by a core column (id, title, created_at, due_at,
+// priority) or, when Field is set, by the named custom field.
+type SortKey struct {
+	Column string
+	Field  string
+	Desc   bool
+}
+
+// Webhook subscribes an HTTP endpoint to the task events of its workspace.
+// Secret signs the deliveries and is only shown when the webhook is
+// created. The delivery worker turns Active off after Failures, the
+// failed attempts in a row, reach its limit.
+type Webhook struct {
+	workspaceID int64 // used by InMemoryRepo
+
+	ID        int64     `json:"id"`
+	URL       string    `json:"url"`
+	Events    []string  `json:"events"`
+	Secret    string    `json:"-"`
+	Active    bool      `json:"active"`
+	Failures  int       `json:"failures"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// States of a WebhookDelivery.
+const (
+	DeliveryPending   = "pending"
+	DeliverySucceeded = "succeeded"
+	DeliveryFailed    = "failed" // gave up retrying
+)
+
+// WebhookDelivery is one event sent, or to be sent, to a webhook, with the
+// outcome of its latest attempt.
+type WebhookDelivery struct {
+	ID             int64           `json:"id"`
+	WebhookID      int64           `json:"webhook_id"`
+	EventID        int64           `json:"event_id"`
+	Event          string          `json:"event"`
+	Payload        json.RawMessage `json:"payload"`
+	Status         string          `json:"status"`
+	Attempts       int             `json:"attempts"`
+	NextAttemptAt  *time.Time      `json:"next_attempt_at,omitempty"`
+	LastAttemptAt  *time.Time      `json:"last_attempt_at,omitempty"`
+	ResponseStatus int             `json:"response_status,omitempty"`
+	LastError      string          `json:"last_error,omitempty"`
+	RedeliveryOf   *int64          `json:"redelivery_of,omitempty"`
+	CreatedAt      time.Time       `json:"created_at"`
+}
+
+// DueDelivery is a pending delivery with the endpoint to send it to.
+type DueDelivery struct {
+	WebhookDelivery
+	URL    string
+	Secret string
+}
+
+// WebhookAttempt is the outcome of one POST of a delivery. Error is empty
+// on success.
+type WebhookAttempt struct {
+	At         time.Time
+	StatusCode int // 0 without a response
+	Error      string
+	// Retry is when to try a failed delivery again; nil gives up.
+	Retry *time.Time
+	// DisableAfter turns the webhook off once this many attempts in a
+	// row have failed.
+	DisableAfter int
+}
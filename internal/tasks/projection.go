@@ -0,0 +1,150 @@
+package tasks
+
+import (
+	"context"
+	"encoding/json"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// taskAttributes are the JSON names of Task, the values ?fields= accepts.
+var taskAttributes = []string{
+	"id", "title", "done", "project_id", "parent_id", "tags", "checklist", "fields",
+	"due_at", "priority", "assignee", "assignee_ids", "owner_id", "created_at", "completed_at",
+	"ical_uid",
+}
+
+// taskIncludes are the related resources ?include= can embed.
+var taskIncludes = []string{"tags", "project"}
+
+// projection is a sparse fieldset and the resources to embed in task
+// responses. The zero value renders tasks unchanged.
+type projection struct {
+	fields  []string
+	include []string
+}
+
+// parseProjection reads the comma-separated fields and include parameters:
+//
+//	fields=id,title,done      (only these attributes; id is always kept)
+//	include=project,tags      (embed the project, always list tags)
+func parseProjection(params url.Values) (projection, []fieldError) {
+	var (
+		p    projection
+		errs []fieldError
+	)
+	for _, param := range []struct {
+		name    string
+		allowed []string
+		dst     *[]string
+	}{{"fields", taskAttributes, &p.fields}, {"include", taskIncludes, &p.include}} {
+		s := params.Get(param.name)
+		if s == "" {
+			continue
+		}
+		for _, name := range strings.Split(s, ",") {
+			name = strings.TrimSpace(name)
+			if !slices.Contains(param.allowed, name) {
+				errs = append(errs, fieldError{Field: param.name, Message: "unknown " + param.name + " name " + name})
+				continue
+			}
+			if !slices.Contains(*param.dst, name) {
+				*param.dst = append(*param.dst, name)
+			}
+		}
+	}
+	return p, errs
+}
+
+// selection returns the attributes the repository must load, for
+// ListQuery.Select: the requested fields plus what the includes need.
+func (p projection) selection() []string {
+	if p.fields == nil {
+		return nil
+	}
+	sel := slices.Clone(p.fields)
+	if slices.Contains(p.include, "tags") {
+		sel = append(sel, "tags")
+	}
+	if slices.Contains(p.include, "project") {
+		sel = append(sel, "project_id")
+	}
+	return sel
+}
+
+// render projects tasks for a response. Without fields or include the
+// tasks are returned as they are.
+func (p projection) render(ctx context.Context, repo Repository, s Scope, tasks []Task) ([]any, error) {
+	one, err := p.renderer(ctx, repo, s)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]any, 0, len(tasks))
+	for _, t := range tasks {
+		v, err := one(t)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, v)
+	}
+	return out, nil
+}
+
+// renderer returns a function projecting one task at a time, for responses
+// that are streamed. Projects to embed are loaded once, up front.
+func (p projection) renderer(ctx context.Context, repo Repository, s Scope) (func(Task) (any, error), error) {
+	if p.fields == nil && p.include == nil {
+		return func(t Task) (any, error) { return t, nil }, nil
+	}
+
+	var projects map[int64]Project
+	if slices.Contains(p.include, "project") {
+		ps, err := repo.ListProjects(ctx, s)
+		if err != nil {
+			return nil, err
+		}
+		projects = make(map[int64]Project, len(ps))
+		for _, pr := range ps {
+			projects[pr.ID] = pr
+		}
+	}
+	return func(t Task) (any, error) { return p.renderOne(t, projects) }, nil
+}
+
+func (p projection) renderOne(t Task, projects map[int64]Project) (map[string]any, error) {
+	b, err := json.Marshal(t)
+	if err != nil {
+		return nil, err
+	}
+	var all map[string]json.RawMessage
+	if err := json.Unmarshal(b, &all); err != nil {
+		return nil, err
+	}
+
+	m := make(map[string]any, len(all))
+	for name, v := range all {
+		if p.fields == nil || name == "id" || slices.Contains(p.fields, name) {
+			m[name] = v
+		}
+	}
+	for _, inc := range p.include {
+		switch inc {
+		case "tags":
+			m["tags"] = t.Tags
+			if t.Tags == nil {
+				m["tags"] = []string{}
+			}
+		case "project":
+			// a project the caller cannot see, e.g. of a task they are
+			// only assigned to, is not embedded
+			if t.ProjectID == nil {
+				continue
+			}
+			if pr, ok := projects[*t.ProjectID]; ok {
+				m["project"] = pr
+			}
+		}
+	}
+	return m, nil
+}
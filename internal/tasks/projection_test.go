@@ -0,0 +1,104 @@
+package tasks
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"testing"
+)
+
+func TestSparseFieldsAndInclude(t *testing.T) {
+	forEachRepo(t, func(t *testing.T, repo Repository) {
+		r := newTestServer(repo)
+		rec := doJSON(t, r, http.MethodPost, "/projects", `{"name":"home"}`)
+		if rec.Code != http.StatusCreated {
+			t.Fatalf("create project: expected 201, got %d, body=%s", rec.Code, rec.Body.String())
+		}
+		var p Project
+		if err := json.Unmarshal(rec.Body.Bytes(), &p); err != nil {
+			t.Fatalf("failed to parse JSON: %v", err)
+		}
+		for _, body := range []string{
+			fmt.Sprintf(`{"title":"paint","project_id":%d,"tags":["diy"],"priority":2}`, p.ID),
+			`{"title":"call mom"}`,
+		} {
+			if rec := doJSON(t, r, http.MethodPost, "/tasks", body); rec.Code != http.StatusCreated {
+				t.Fatalf("create task: expected 201, got %d, body=%s", rec.Code, rec.Body.String())
+			}
+		}
+
+		tests := []struct {
+			name     string
+			path     string
+			wantCode int
+			wantKeys [][]string // sorted keys of each returned task
+		}{
+			{"fields", "/tasks?fields=title,done", http.StatusOK, [][]string{{"done", "id", "title"}, {"done", "id", "title"}}},
+			{"fields on one task", "/tasks/1?fields=priority", http.StatusOK, [][]string{{"id", "priority"}}},
+			{"include tags", "/tasks?fields=title&include=tags", http.StatusOK, [][]string{{"id", "tags", "title"}, {"id", "tags", "title"}}},
+			{"include project", "/tasks?fields=id&include=project", http.StatusOK, [][]string{{"id", "project"}, {"id"}}},
+			{"no projection", "/tasks?limit=1", http.StatusOK, [][]string{{"created_at", "done", "id", "priority", "project_id", "tags", "title"}}},
+			{"unknown field", "/tasks?fields=title,secret", http.StatusUnprocessableEntity, nil},
+			{"unknown include", "/tasks/1?include=owner", http.StatusUnprocessableEntity, nil},
+		}
+		for _, tt := range tests {
+			rec := doJSON(t, r, http.MethodGet, tt.path, "")
+			if rec.Code != tt.wantCode {
+				t.Fatalf("%s: expected %d, got %d, body=%s", tt.name, tt.wantCode, rec.Code, rec.Body.String())
+			}
+			if tt.wantKeys == nil {
+				continue
+			}
+			var got []map[string]json.RawMessage
+			if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+				var one map[string]json.RawMessage
+				if err := json.Unmarshal(rec.Body.Bytes(), &one); err != nil {
+					t.Fatalf("%s: failed to parse JSON: %v", tt.name, err)
+				}
+				got = append(got, one)
+			}
+			var keys [][]string
+			for _, m := range got {
+				var k []string
+				for name := range m {
+					k = append(k, name)
+				}
+				slices.Sort(k)
+				keys = append(keys, k)
+			}
+			if !slices.EqualFunc(keys, tt.wantKeys, slices.Equal) {
+				t.Fatalf("%s: expected keys %v, got %v", tt.name, tt.wantKeys, keys)
+			}
+		}
+
+		rec = doJSON(t, r, http.MethodGet, "/tasks/2?include=tags,project", "")
+		var plain map[string]json.RawMessage
+		if err := json.Unmarshal(rec.Body.Bytes(), &plain); err != nil {
+			t.Fatalf("failed to parse JSON: %v", err)
+		}
+		if string(plain["tags"]) != "[]" || plain["project"] != nil {
+			t.Fatalf("expected empty tags and no project, got %s", rec.Body.String())
+		}
+	})
+}
+
+func TestSQLiteRepo_ListSelect(t *testing.T) {
+	repo := newTempDB(t)
+	ctx := context.Background()
+	if _, err := repo.Create(ctx, Scope{}, TaskInput{Title: "paint", Tags: []string{"diy"}}); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+
+	got, err := repo.List(ctx, Scope{}, ListQuery{Select: []string{"title"}})
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	if len(got) != 1 || got[0].ID == 0 || got[0].Title != "paint" {
+		t.Fatalf("expected id and title, got %+v", got)
+	}
+	if !got[0].CreatedAt.IsZero() || got[0].Tags != nil {
+		t.Fatalf("expected unselected attributes to stay unloaded, got %+v", got[0])
+	}
+}
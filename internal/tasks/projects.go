@@ -0,0 +1,250 @@
+package tasks
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+type projectRequest struct {
+	Name   string     `json:"name"`
+	Fields []FieldDef `json:"fields"`
+}
+
+type projectFieldsRequest struct {
+	Fields []FieldDef `json:"fields"`
+}
+
+type addMemberRequest struct {
+	UserID int64 `json:"user_id"`
+	Role   Role  `json:"role"`
+}
+
+// errForbidden is returned by requireRole when the caller can see a
+// project but their role on it is too low.
+var errForbidden = errors.New("forbidden")
+
+// requireRole reports ErrNotFound if the caller cannot see the project and
+// errForbidden if their role on it is below min.
+func requireRole(ctx context.Context, repo Repository, projectID int64, min Role) error {
+	role, err := repo.ProjectRole(ctx, callerScope(ctx), projectID)
+	if err != nil {
+		return err
+	}
+	if !role.atLeast(min) {
+		return errForbidden
+	}
+	return nil
+}
+
+// maxProjectNameLen is the longest project name, in bytes.
+const maxProjectNameLen = 100
+
+func validateProjectName(name string) []fieldError {
+	if strings.TrimSpace(name) == "" {
+		return []fieldError{{Field: "name", Message: "name is required"}}
+	}
+	if len(name) > maxProjectNameLen {
+		return []fieldError{{Field: "name", Message: fmt.Sprintf("name must be at most %d characters", maxProjectNameLen)}}
+	}
+	return nil
+}
+
+func createProject(repo Repository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		var req projectRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeJSON(w, http.StatusBadRequest, errResponse{Error: "invalid_json"})
+			return
+		}
+
+		vErrs := validateProjectName(req.Name)
+		vErrs = append(vErrs, validateFieldDefs(req.Fields)...)
+		if len(vErrs) > 0 {
+			writeValidation(w, vErrs)
+			return
+		}
+
+		p, err := repo.CreateProject(r.Context(), callerScope(r.Context()), req.Name, req.Fields)
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, errResponse{Error: "unexpected_error"})
+			return
+		}
+		writeJSON(w, http.StatusCreated, p)
+	}
+}
+
+func listProjects(repo Repository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		ps, err := repo.ListProjects(r.Context(), callerScope(r.Context()))
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, errResponse{Error: "unexpected_error"})
+			return
+		}
+		writeJSON(w, http.StatusOK, ps)
+	}
+}
+
+func getProject(repo Repository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		id, ok := pathID(r, "id")
+		if !ok {
+			writeJSON(w, http.StatusNotFound, errResponse{Error: "not_found"})
+			return
+		}
+		p, err := repo.GetProject(r.Context(), callerScope(r.Context()), id)
+		if errors.Is(err, ErrNotFound) {
+			writeJSON(w, http.StatusNotFound, errResponse{Error: "not_found"})
+			return
+		}
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, errResponse{Error: "unexpected_error"})
+			return
+		}
+		writeJSON(w, http.StatusOK, p)
+	}
+}
+
+// setProjectFields replaces a project's custom field definitions. Fields
+// may be added, removed (dropping their stored values) or have their
+// type, options and required flag changed; stored values are converted
+// to a new type or option list, or dropped where they do not fit.
+func setProjectFields(repo Repository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		id, ok := pathID(r, "id")
+		if !ok {
+			writeJSON(w, http.StatusNotFound, errResponse{Error: "not_found"})
+			return
+		}
+		var req projectFieldsRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeJSON(w, http.StatusBadRequest, errResponse{Error: "invalid_json"})
+			return
+		}
+
+		err := requireRole(r.Context(), repo, id, RoleOwner)
+		if errors.Is(err, ErrNotFound) {
+			writeJSON(w, http.StatusNotFound, errResponse{Error: "not_found"})
+			return
+		}
+		if errors.Is(err, errForbidden) {
+			writeJSON(w, http.StatusForbidden, errResponse{Error: "forbidden"})
+			return
+		}
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, errResponse{Error: "unexpected_error"})
+			return
+		}
+		if vErrs := validateFieldDefs(req.Fields); len(vErrs) > 0 {
+			writeValidation(w, vErrs)
+			return
+		}
+
+		p, err := repo.SetProjectFields(r.Context(), callerScope(r.Context()), id, req.Fields)
+		if errors.Is(err, ErrNotFound) {
+			writeJSON(w, http.StatusNotFound, errResponse{Error: "not_found"})
+			return
+		}
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, errResponse{Error: "unexpected_error"})
+			return
+		}
+		writeJSON(w, http.StatusOK, p)
+	}
+}
+
+// addProjectMember shares a project with another user of the workspace.
+// Only the project's owners may invite.
+func addProjectMember(repo Repository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		id, ok := pathID(r, "id")
+		if !ok {
+			writeJSON(w, http.StatusNotFound, errResponse{Error: "not_found"})
+			return
+		}
+		var req addMemberRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeJSON(w, http.StatusBadRequest, errResponse{Error: "invalid_json"})
+			return
+		}
+
+		err := requireRole(r.Context(), repo, id, RoleOwner)
+		if errors.Is(err, ErrNotFound) {
+			writeJSON(w, http.StatusNotFound, errResponse{Error: "not_found"})
+			return
+		}
+		if errors.Is(err, errForbidden) {
+			writeJSON(w, http.StatusForbidden, errResponse{Error: "forbidden"})
+			return
+		}
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, errResponse{Error: "unexpected_error"})
+			return
+		}
+
+		var vErrs []fieldError
+		if !req.Role.valid() {
+			vErrs = append(vErrs, fieldError{Field: "role", Message: "role must be one of viewer, editor, owner"})
+		}
+		if _, err := repo.GetUser(r.Context(), callerScope(r.Context()), req.UserID); errors.Is(err, ErrNotFound) {
+			vErrs = append(vErrs, fieldError{Field: "user_id", Message: "user not found"})
+		} else if err != nil {
+			writeJSON(w, http.StatusInternalServerError, errResponse{Error: "unexpected_error"})
+			return
+		}
+		if len(vErrs) > 0 {
+			writeValidation(w, vErrs)
+			return
+		}
+
+		m, err := repo.AddProjectMember(r.Context(), callerScope(r.Context()), id, req.UserID, req.Role)
+		if errors.Is(err, ErrConflict) {
+			writeJSON(w, http.StatusConflict, errResponse{Error: "conflict"})
+			return
+		}
+		if errors.Is(err, ErrNotFound) {
+			writeJSON(w, http.StatusNotFound, errResponse{Error: "not_found"})
+			return
+		}
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, errResponse{Error: "unexpected_error"})
+			return
+		}
+		writeJSON(w, http.StatusCreated, m)
+	}
+}
+
+func listProjectMembers(repo Repository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		id, ok := pathID(r, "id")
+		if !ok {
+			writeJSON(w, http.StatusNotFound, errResponse{Error: "not_found"})
+			return
+		}
+		ms, err := repo.ListProjectMembers(r.Context(), callerScope(r.Context()), id)
+		if errors.Is(err, ErrNotFound) {
+			writeJSON(w, http.StatusNotFound, errResponse{Error: "not_found"})
+			return
+		}
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, errResponse{Error: "unexpected_error"})
+			return
+		}
+		writeJSON(w, http.StatusOK, ms)
+	}
+}
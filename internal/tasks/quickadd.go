@@ -0,0 +1,431 @@
+package tasks
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// QuickAdd is the result of parsing a quick-add line such as
+// "Pay rent tomorrow 9am #home !p1 @alice".
+type QuickAdd struct {
+	Title    string     `json:"title"`
+	DueAt    *time.Time `json:"due_at,omitempty"`
+	Tags     []string   `json:"tags,omitempty"`
+	Priority int        `json:"priority,omitempty"`
+	Assignee string     `json:"assignee,omitempty"`
+}
+
+// maxPriority is the lowest-urgency priority; 1 is the most urgent and 0
+// means none.
+const maxPriority = 4
+
+type quickAddRequest struct {
+	Text     string `json:"text"`
+	Timezone string `json:"timezone"`
+}
+
+var (
+	priorityRe = regexp.MustCompile(`^!p?([1-4])$`)
+	isoDateRe  = regexp.MustCompile(`^(\d{4})-(\d{2})-(\d{2})$`)
+	clockRe    = regexp.MustCompile(`^(\d{1,2})(?::(\d{2}))?(am|pm)?$`)
+	ordinalRe  = regexp.MustCompile(`^(\d{1,2})(?:st|nd|rd|th)?,?$`)
+	yearRe     = regexp.MustCompile(`^\d{4}$`)
+	handleRe   = regexp.MustCompile(`^[A-Za-z0-9._-]+$`)
+)
+
+var months = map[string]time.Month{
+	"jan": time.January, "january": time.January,
+	"feb": time.February, "february": time.February,
+	"mar": time.March, "march": time.March,
+	"apr": time.April, "april": time.April,
+	"may": time.May,
+	"jun": time.June, "june": time.June,
+	"jul": time.July, "july": time.July,
+	"aug": time.August, "august": time.August,
+	"sep": time.September, "sept": time.September, "september": time.September,
+	"oct": time.October, "october": time.October,
+	"nov": time.November, "november": time.November,
+	"dec": time.December, "december": time.December,
+}
+
+var weekdays = map[string]time.Weekday{
+	"sunday": time.Sunday, "monday": time.Monday, "tuesday": time.Tuesday,
+	"wednesday": time.Wednesday, "thursday": time.Thursday, "friday": time.Friday,
+	"saturday": time.Saturday,
+}
+
+// connectors are swallowed when they introduce a date or time ("due
+// friday", "at 9am") and kept as title words otherwise.
+var connectors = map[string]bool{"on": true, "at": true, "by": true, "due": true}
+
+// quickState accumulates what the parser has recognized so far.
+type quickState struct {
+	now     time.Time
+	date    *time.Time // midnight of the due day in now's location
+	clock   *[2]int    // hour, minute
+	instant *time.Time // "in 2 hours" style expressions set both at once
+}
+
+// parseQuickAdd parses line relative to now, whose location decides how
+// calendar expressions are interpreted. A due date without a time of day
+// is due at the end of that day; a time without a date means its next
+// occurrence.
+func parseQuickAdd(line string, now time.Time) (QuickAdd, []fieldError) {
+	var (
+		out   QuickAdd
+		errs  []fieldError
+		title []string
+		st    = quickState{now: now}
+	)
+
+	toks := strings.Fields(line)
+	for i := 0; i < len(toks); i++ {
+		tok := toks[i]
+		switch {
+		case len(tok) > 1 && tok[0] == '#':
+			out.Tags = append(out.Tags, tok[1:])
+			continue
+		case priorityRe.MatchString(strings.ToLower(tok)):
+			p, _ := strconv.Atoi(priorityRe.FindStringSubmatch(strings.ToLower(tok))[1])
+			out.Priority = p
+			continue
+		case len(tok) > 1 && tok[0] == '@':
+			if out.Assignee != "" {
+				errs = append(errs, fieldError{Field: "text", Message: "only one @assignee is allowed"})
+				continue
+			}
+			if !handleRe.MatchString(tok[1:]) {
+				errs = append(errs, fieldError{Field: "text", Message: "invalid assignee " + tok})
+				continue
+			}
+			out.Assignee = tok[1:]
+			continue
+		}
+
+		start := i
+		if connectors[strings.ToLower(tok)] && i+1 < len(toks) {
+			start = i + 1
+		}
+		if n := st.consume(toks[start:]); n > 0 {
+			i = start + n - 1
+			continue
+		}
+		title = append(title, tok)
+	}
+
+	out.Title = strings.Join(title, " ")
+	if due, ok := st.due(); ok {
+		out.DueAt = &due
+	}
+	return out, errs
+}
+
+// consume tries to read one date or time expression from the start of
+// toks and returns how many tokens it used. Once a date (or time) is set,
+// further date (or time) expressions are left for the title.
+func (st *quickState) consume(toks []string) int {
+	low := make([]string, len(toks))
+	for i, t := range toks {
+		low[i] = strings.TrimSuffix(strings.ToLower(t), ",")
+	}
+	word := low[0]
+	today := time.Date(st.now.Year(), st.now.Month(), st.now.Day(), 0, 0, 0, 0, st.now.Location())
+
+	setDate := func(d time.Time, n int) int {
+		if st.date != nil || st.instant != nil {
+			return 0
+		}
+		st.date = &d
+		return n
+	}
+	setClock := func(h, m, n int) int {
+		if st.clock != nil || st.instant != nil {
+			return 0
+		}
+		st.clock = &[2]int{h, m}
+		return n
+	}
+
+	switch word {
+	case "today":
+		return setDate(today, 1)
+	case "tonight":
+		if n := setDate(today, 1); n > 0 {
+			if st.clock == nil {
+				st.clock = &[2]int{20, 0}
+			}
+			return n
+		}
+		return 0
+	case "tomorrow", "tmr", "tmrw":
+		return setDate(today.AddDate(0, 0, 1), 1)
+	case "noon":
+		return setClock(12, 0, 1)
+	case "midnight":
+		return setClock(0, 0, 1)
+	case "next":
+		if len(low) < 2 {
+			return 0
+		}
+		switch low[1] {
+		case "week":
+			return setDate(nextWeekday(today, time.Monday), 2)
+		case "month":
+			return setDate(time.Date(today.Year(), today.Month()+1, 1, 0, 0, 0, 0, today.Location()), 2)
+		}
+		if wd, ok := weekdays[low[1]]; ok {
+			return setDate(nextWeekday(today, wd), 2)
+		}
+		return 0
+	case "in":
+		if len(low) < 3 {
+			return 0
+		}
+		n, err := strconv.Atoi(low[1])
+		if err != nil || n <= 0 || n > 1000 {
+			return 0
+		}
+		switch strings.TrimSuffix(low[2], "s") {
+		case "day":
+			return setDate(today.AddDate(0, 0, n), 3)
+		case "week":
+			return setDate(today.AddDate(0, 0, 7*n), 3)
+		case "month":
+			return setDate(today.AddDate(0, n, 0), 3)
+		case "hour", "hr":
+			return st.setInstant(st.now.Add(time.Duration(n)*time.Hour), 3)
+		case "minute", "min":
+			return st.setInstant(st.now.Add(time.Duration(n)*time.Minute), 3)
+		}
+		return 0
+	}
+
+	if wd, ok := weekdays[word]; ok {
+		return setDate(nextWeekday(today, wd), 1)
+	}
+	if m := isoDateRe.FindStringSubmatch(word); m != nil {
+		y, _ := strconv.Atoi(m[1])
+		mo, _ := strconv.Atoi(m[2])
+		d, _ := strconv.Atoi(m[3])
+		t := time.Date(y, time.Month(mo), d, 0, 0, 0, 0, today.Location())
+		if t.Month() != time.Month(mo) || t.Day() != d {
+			return 0
+		}
+		return setDate(t, 1)
+	}
+	if n, d, ok := parseMonthDay(low, today); ok {
+		return setDate(d, n)
+	}
+	if m := clockRe.FindStringSubmatch(word); m != nil {
+		suffix := m[3]
+		n := 1
+		if suffix == "" && m[2] == "" && len(low) > 1 && (low[1] == "am" || low[1] == "pm") {
+			// "9 am"
+			suffix, n = low[1], 2
+		}
+		if suffix == "" && m[2] == "" {
+			// a bare number is not a time
+			return 0
+		}
+		h, _ := strconv.Atoi(m[1])
+		mi, _ := strconv.Atoi(m[2])
+		if mi > 59 {
+			return 0
+		}
+		switch suffix {
+		case "am", "pm":
+			if h < 1 || h > 12 {
+				return 0
+			}
+			h %= 12
+			if suffix == "pm" {
+				h += 12
+			}
+		default:
+			if h > 23 {
+				return 0
+			}
+		}
+		return setClock(h, mi, n)
+	}
+	return 0
+}
+
+func (st *quickState) setInstant(t time.Time, n int) int {
+	if st.date != nil || st.clock != nil || st.instant != nil {
+		return 0
+	}
+	t = t.Truncate(time.Minute)
+	st.instant = &t
+	return n
+}
+
+func (st *quickState) due() (time.Time, bool) {
+	switch {
+	case st.instant != nil:
+		return *st.instant, true
+	case st.date != nil && st.clock != nil:
+		d := *st.date
+		return time.Date(d.Year(), d.Month(), d.Day(), st.clock[0], st.clock[1], 0, 0, d.Location()), true
+	case st.date != nil:
+		d := *st.date
+		return time.Date(d.Year(), d.Month(), d.Day(), 23, 59, 0, 0, d.Location()), true
+	case st.clock != nil:
+		n := st.now
+		t := time.Date(n.Year(), n.Month(), n.Day(), st.clock[0], st.clock[1], 0, 0, n.Location())
+		if !t.After(n) {
+			t = t.AddDate(0, 0, 1)
+		}
+		return t, true
+	}
+	return time.Time{}, false
+}
+
+// parseMonthDay reads "mar 5", "march 5th, 2026" or "5 mar" and rolls
+// dates without a year that already passed into next year.
+func parseMonthDay(low []string, today time.Time) (int, time.Time, bool) {
+	var (
+		mo  time.Month
+		day int
+		ok  bool
+	)
+	if len(low) < 2 {
+		return 0, time.Time{}, false
+	}
+	if m, isMonth := months[low[0]]; isMonth {
+		if d := ordinalRe.FindStringSubmatch(low[1]); d != nil {
+			mo, ok = m, true
+			day, _ = strconv.Atoi(d[1])
+		}
+	} else if d := ordinalRe.FindStringSubmatch(low[0]); d != nil {
+		if m, isMonth := months[low[1]]; isMonth {
+			mo, ok = m, true
+			day, _ = strconv.Atoi(d[1])
+		}
+	}
+	if !ok {
+		return 0, time.Time{}, false
+	}
+
+	n, year := 2, today.Year()
+	explicitYear := len(low) > 2 && yearRe.MatchString(low[2])
+	if explicitYear {
+		year, _ = strconv.Atoi(low[2])
+		n = 3
+	}
+	t := time.Date(year, mo, day, 0, 0, 0, 0, today.Location())
+	if t.Month() != mo || t.Day() != day {
+		return 0, time.Time{}, false
+	}
+	if !explicitYear && t.Before(today) {
+		t = t.AddDate(1, 0, 0)
+	}
+	return n, t, true
+}
+
+// nextWeekday returns the first wd strictly after day.
+func nextWeekday(day time.Time, wd time.Weekday) time.Time {
+	diff := (int(wd) - int(day.Weekday()) + 7) % 7
+	if diff == 0 {
+		diff = 7
+	}
+	return day.AddDate(0, 0, diff)
+}
+
+// quickAddTask parses a single line into a task. With ?preview=true the
+// parsed result is returned without creating anything; otherwise the task
+// goes through the same validation and Repository.Create as POST /tasks.
+//
+// The body is either JSON {"text": "...", "timezone": "Europe/Berlin"} or
+// text/plain with the zone in ?tz=. Times are interpreted in that zone
+// (UTC by default).
+func quickAddTask(repo Repository, now func() time.Time) http.HandlerFunc {
+	const maxLineLen = 500
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		var req quickAddRequest
+		mt, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		if mt == "text/plain" {
+			b, err := io.ReadAll(io.LimitReader(r.Body, maxLineLen+1))
+			if err != nil {
+				writeJSON(w, http.StatusBadRequest, errResponse{Error: "invalid_body"})
+				return
+			}
+			req.Text = strings.TrimSpace(string(b))
+			req.Timezone = r.URL.Query().Get("tz")
+		} else if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeJSON(w, http.StatusBadRequest, errResponse{Error: "invalid_json"})
+			return
+		}
+
+		var vErrs []fieldError
+		if strings.TrimSpace(req.Text) == "" {
+			vErrs = append(vErrs, fieldError{Field: "text", Message: "text is required"})
+		} else if len(req.Text) > maxLineLen {
+			vErrs = append(vErrs, fieldError{Field: "text", Message: fmt.Sprintf("text must be at most %d characters", maxLineLen)})
+		}
+		if strings.ContainsAny(req.Text, "\r\n") {
+			vErrs = append(vErrs, fieldError{Field: "text", Message: "text must be a single line"})
+		}
+		loc := time.UTC
+		if req.Timezone != "" {
+			l, err := time.LoadLocation(req.Timezone)
+			if err != nil {
+				vErrs = append(vErrs, fieldError{Field: "timezone", Message: "unknown time zone " + req.Timezone})
+			} else {
+				loc = l
+			}
+		}
+		if len(vErrs) > 0 {
+			writeValidation(w, vErrs)
+			return
+		}
+
+		parsed, pErrs := parseQuickAdd(req.Text, now().In(loc))
+		in := TaskInput{
+			Title:    parsed.Title,
+			Tags:     parsed.Tags,
+			DueAt:    parsed.DueAt,
+			Priority: parsed.Priority,
+			Assignee: parsed.Assignee,
+			OwnerID:  callerID(r.Context()),
+		}
+		vErrs, err := checkTaskInput(r.Context(), repo, "", &in)
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, errResponse{Error: "unexpected_error"})
+			return
+		}
+		vErrs = append(pErrs, vErrs...)
+		if len(vErrs) > 0 {
+			writeValidation(w, vErrs)
+			return
+		}
+		parsed.Tags = in.Tags
+
+		if preview, _ := strconv.ParseBool(r.URL.Query().Get("preview")); preview {
+			writeJSON(w, http.StatusOK, parsed)
+			return
+		}
+
+		t, err := repo.Create(r.Context(), callerScope(r.Context()), in)
+		if errors.Is(err, ErrTitleRequired) {
+			writeValidation(w, []fieldError{{Field: "title", Message: "title is required"}})
+			return
+		}
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, errResponse{Error: "unexpected_error"})
+			return
+		}
+		writeJSON(w, http.StatusCreated, t)
+	}
+}
@@ -0,0 +1,155 @@
+package tasks
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func TestParseQuickAdd(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Fatalf("load location: %v", err)
+	}
+	// a Wednesday
+	now := time.Date(2026, 3, 4, 10, 0, 0, 0, berlin)
+	at := func(y int, m time.Month, d, h, mi int) *time.Time {
+		t := time.Date(y, m, d, h, mi, 0, 0, berlin)
+		return &t
+	}
+
+	tests := []struct {
+		name string
+		line string
+		want QuickAdd
+	}{
+		{"everything", "Pay rent tomorrow 9am #home !p1 @alice",
+			QuickAdd{Title: "Pay rent", DueAt: at(2026, 3, 5, 9, 0), Tags: []string{"home"}, Priority: 1, Assignee: "alice"}},
+		{"weekday is end of day", "call mom on friday", QuickAdd{Title: "call mom", DueAt: at(2026, 3, 6, 23, 59)}},
+		{"past time rolls over", "standup at 9:30", QuickAdd{Title: "standup", DueAt: at(2026, 3, 5, 9, 30)}},
+		{"future time is today", "lunch noon", QuickAdd{Title: "lunch", DueAt: at(2026, 3, 4, 12, 0)}},
+		{"next week", "ship it next week", QuickAdd{Title: "ship it", DueAt: at(2026, 3, 9, 23, 59)}},
+		{"relative hours", "review in 2 hours", QuickAdd{Title: "review", DueAt: at(2026, 3, 4, 12, 0)}},
+		{"passed month day rolls to next year", "taxes mar 1", QuickAdd{Title: "taxes", DueAt: at(2027, 3, 1, 23, 59)}},
+		{"day month year and spaced am", "book flights 5 april 2026 7 pm", QuickAdd{Title: "book flights", DueAt: at(2026, 4, 5, 19, 0)}},
+		{"tonight", "room 101 tonight", QuickAdd{Title: "room 101", DueAt: at(2026, 3, 4, 20, 0)}},
+		{"connector without date stays", "meet at the cafe", QuickAdd{Title: "meet at the cafe"}},
+		{"invalid date stays in title", "dinner 2026-02-30", QuickAdd{Title: "dinner 2026-02-30"}},
+		{"second date stays in title", "move today tomorrow", QuickAdd{Title: "move tomorrow", DueAt: at(2026, 3, 4, 23, 59)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, errs := parseQuickAdd(tt.line, now)
+			if len(errs) > 0 {
+				t.Fatalf("unexpected errors: %+v", errs)
+			}
+			if got.Title != tt.want.Title || got.Priority != tt.want.Priority || got.Assignee != tt.want.Assignee {
+				t.Fatalf("expected %+v, got %+v", tt.want, got)
+			}
+			if !slices.Equal(got.Tags, tt.want.Tags) {
+				t.Fatalf("expected tags %v, got %v", tt.want.Tags, got.Tags)
+			}
+			if compareTimes(got.DueAt, tt.want.DueAt) != 0 {
+				t.Fatalf("expected due %v, got %v", tt.want.DueAt, got.DueAt)
+			}
+		})
+	}
+
+	if _, errs := parseQuickAdd("pair @alice @bob", now); len(errs) != 1 || errs[0].Field != "text" {
+		t.Fatalf("expected one text error, got %+v", errs)
+	}
+}
+
+func TestQuickAdd_PreviewAndCreate(t *testing.T) {
+	repo := NewInMemoryRepo()
+	addUser(t, repo, "bob")
+	r := chi.NewRouter()
+	now := func() time.Time { return time.Date(2026, 3, 4, 22, 30, 0, 0, time.UTC) }
+	r.Post("/tasks/quick", quickAddTask(repo, now))
+
+	rec := doJSON(t, r, http.MethodPost, "/tasks/quick?preview=true",
+		`{"text":"Pay rent tomorrow 9am #Home !p2","timezone":"America/New_York"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d, body=%s", rec.Code, rec.Body.String())
+	}
+	var preview QuickAdd
+	if err := json.Unmarshal(rec.Body.Bytes(), &preview); err != nil {
+		t.Fatalf("failed to parse JSON: %v", err)
+	}
+	// 17:30 on March 4 in New York, so tomorrow is March 5 (EST, UTC-5)
+	want := time.Date(2026, 3, 5, 14, 0, 0, 0, time.UTC)
+	if preview.Title != "Pay rent" || preview.DueAt == nil || !preview.DueAt.Equal(want) {
+		t.Fatalf("unexpected preview: %+v", preview)
+	}
+	if !slices.Equal(preview.Tags, []string{"home"}) || preview.Priority != 2 {
+		t.Fatalf("expected normalized tags and priority, got %+v", preview)
+	}
+	if list, _ := repo.List(context.Background(), Scope{}, ListQuery{}); len(list) != 0 {
+		t.Fatalf("preview must not create tasks, found %+v", list)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/tasks/quick?tz=Europe/Berlin", strings.NewReader("standup 9:30 @bob\n"))
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	rec = httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d, body=%s", rec.Code, rec.Body.String())
+	}
+	var created Task
+	if err := json.Unmarshal(rec.Body.Bytes(), &created); err != nil {
+		t.Fatalf("failed to parse JSON: %v", err)
+	}
+	// 23:30 in Berlin, so 9:30 is the next morning (CET, UTC+1)
+	want = time.Date(2026, 3, 5, 8, 30, 0, 0, time.UTC)
+	if created.Title != "standup" || created.Assignee != "bob" || created.DueAt == nil || !created.DueAt.Equal(want) {
+		t.Fatalf("unexpected task: %+v", created)
+	}
+
+	for _, body := range []string{
+		`{"text":"x","timezone":"Mars/Olympus"}`,
+		`{"text":"#only #tags"}`,
+		`{"text":""}`,
+	} {
+		rec = doJSON(t, r, http.MethodPost, "/tasks/quick", body)
+		if rec.Code != http.StatusUnprocessableEntity {
+			t.Fatalf("expected 422 for %s, got %d", body, rec.Code)
+		}
+	}
+}
+
+func TestSQLiteRepo_DueAtPriorityAssignee(t *testing.T) {
+	repo := newTempDB(t)
+	ctx := context.Background()
+
+	due := time.Date(2026, 3, 5, 9, 0, 0, 0, time.FixedZone("CET", 3600))
+	for _, in := range []TaskInput{
+		{Title: "later", DueAt: &due, Priority: 1, Assignee: "alice"},
+		{Title: "whenever"},
+	} {
+		if _, err := repo.Create(ctx, Scope{}, in); err != nil {
+			t.Fatalf("create: %v", err)
+		}
+	}
+
+	list, err := repo.List(ctx, Scope{}, ListQuery{Sort: []SortKey{{Column: "due_at", Desc: true}}})
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	if len(list) != 2 || list[0].Title != "later" {
+		t.Fatalf("unexpected order: %+v", list)
+	}
+	got := list[0]
+	if got.DueAt == nil || !got.DueAt.Equal(due) || got.DueAt.Location() != time.UTC {
+		t.Fatalf("expected due %v in UTC, got %v", due, got.DueAt)
+	}
+	if got.Priority != 1 || got.Assignee != "alice" || list[1].DueAt != nil {
+		t.Fatalf("unexpected tasks: %+v", list)
+	}
+}
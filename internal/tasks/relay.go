@@ -0,0 +1,189 @@
+package tasks
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/cenkalti/backoff/v5"
+)
+
+// relayBatch is how many outbox events the relay reads at a time.
+const relayBatch = 100
+
+// Defaults of Relay.Retention and Relay.PruneInterval.
+const (
+	defaultOutboxRetention = 7 * 24 * time.Hour
+	defaultPruneInterval   = time.Hour
+)
+
+// Outbox is a queue of task events written in the transaction of their
+// change, as SQLiteRepo keeps one. Its ids increase in commit order.
+type Outbox interface {
+	// PendingOutbox lists the events not delivered yet, oldest first and
+	// at most limit of them.
+	PendingOutbox(ctx context.Context, limit int) ([]TaskEvent, error)
+	// MarkOutboxDelivered marks the events up to upToID delivered.
+	MarkOutboxDelivered(ctx context.Context, upToID int64) error
+	// PruneOutbox deletes events delivered before the given time and
+	// reports how many it deleted.
+	PruneOutbox(ctx context.Context, before time.Time) (int64, error)
+	// OutboxReady receives a value after events were written.
+	OutboxReady() <-chan struct{}
+}
+
+// OutboxSink receives the events relayed from an outbox, in order. Events
+// are relayed at least once: after a failure or a restart a sink may get
+// events it has seen before, and must tolerate them.
+type OutboxSink interface {
+	Publish(ctx context.Context, events []TaskEvent) error
+}
+
+// OutboxSinkFunc adapts a function to OutboxSink.
+type OutboxSinkFunc func(ctx context.Context, events []TaskEvent) error
+
+func (f OutboxSinkFunc) Publish(ctx context.Context, events []TaskEvent) error { return f(ctx, events) }
+
+// EventLogSink appends the events to the event log of repo. They keep
+// their outbox ids, so appending one again is harmless; the log must not
+// also be written through WithEvents, whose events take new ids.
+func EventLogSink(repo Repository) OutboxSink {
+	return OutboxSinkFunc(func(ctx context.Context, events []TaskEvent) error {
+		if _, err := repo.AppendEvents(ctx, events); err != nil {
+			return fmt.Errorf("log task events: %w", err)
+		}
+		return nil
+	})
+}
+
+// WebhookSink queues the events for the webhooks of repo subscribed to
+// them; a webhook gets each event once.
+func WebhookSink(repo Repository) OutboxSink {
+	return OutboxSinkFunc(func(ctx context.Context, events []TaskEvent) error {
+		for _, e := range events {
+			payload, err := json.Marshal(webhookPayload{EventID: e.ID, Event: e.Type, Task: e.Task, At: e.At})
+			if err != nil {
+				return err
+			}
+			if _, err := repo.EnqueueWebhookDeliveries(ctx, e, payload); err != nil {
+				return fmt.Errorf("queue webhook deliveries: %w", err)
+			}
+		}
+		return nil
+	})
+}
+
+// BrokerSink publishes the events to b.
+func BrokerSink(b *Broker) OutboxSink {
+	return OutboxSinkFunc(func(_ context.Context, events []TaskEvent) error {
+		for _, e := range events {
+			b.Publish(e)
+		}
+		return nil
+	})
+}
+
+// Relay hands the events of an outbox to its sinks. Each batch goes to
+// every sink in turn and is marked delivered once all of them took it; a
+// batch a sink fails is retried with exponential backoff, so no event
+// overtakes an earlier one. Delivered marks are stored, so after a restart
+// the relay resumes with the first event not delivered. Delivered events
+// are pruned once they are older than Retention.
+type Relay struct {
+	outbox Outbox
+	sinks  []OutboxSink
+
+	// PollInterval is how often the outbox is checked besides when its
+	// repository reports new events.
+	PollInterval time.Duration
+	// InitialInterval and MaxInterval bound the delay before a failed
+	// batch is tried again.
+	InitialInterval time.Duration
+	MaxInterval     time.Duration
+	// Retention is how long delivered events are kept, and PruneInterval
+	// how often those older are deleted; zero Retention keeps them.
+	Retention     time.Duration
+	PruneInterval time.Duration
+	// OnError, if set, is called with each failure.
+	OnError func(error)
+}
+
+func NewRelay(o Outbox, sinks ...OutboxSink) *Relay {
+	return &Relay{
+		outbox:          o,
+		sinks:           sinks,
+		PollInterval:    time.Second,
+		InitialInterval: 100 * time.Millisecond,
+		MaxInterval:     30 * time.Second,
+		Retention:       defaultOutboxRetention,
+		PruneInterval:   defaultPruneInterval,
+	}
+}
+
+// Run relays events until ctx is done.
+func (r *Relay) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.PollInterval)
+	defer ticker.Stop()
+	b := &backoff.ExponentialBackOff{
+		InitialInterval:     r.InitialInterval,
+		RandomizationFactor: backoff.DefaultRandomizationFactor,
+		Multiplier:          2,
+		MaxInterval:         r.MaxInterval,
+	}
+	b.Reset()
+	var pruned time.Time
+
+	for {
+		if r.Retention > 0 && time.Since(pruned) >= r.PruneInterval {
+			pruned = time.Now()
+			if _, err := r.outbox.PruneOutbox(ctx, pruned.Add(-r.Retention)); err != nil && ctx.Err() == nil && r.OnError != nil {
+				r.OnError(err)
+			}
+		}
+		ready, tick := r.outbox.OutboxReady(), ticker.C
+		var retry <-chan time.Time
+		if err := r.relay(ctx); err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			if r.OnError != nil {
+				r.OnError(err)
+			}
+			// only the backoff decides when to try again
+			ready, tick = nil, nil
+			retry = time.After(b.NextBackOff())
+		} else {
+			b.Reset()
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ready:
+		case <-tick:
+		case <-retry:
+		}
+	}
+}
+
+// relay hands the pending events to the sinks, a batch at a time.
+func (r *Relay) relay(ctx context.Context) error {
+	for {
+		events, err := r.outbox.PendingOutbox(ctx, relayBatch)
+		if err != nil || len(events) == 0 {
+			return err
+		}
+		for _, s := range r.sinks {
+			if err := s.Publish(ctx, events); err != nil {
+				return err
+			}
+		}
+		if err := r.outbox.MarkOutboxDelivered(ctx, events[len(events)-1].ID); err != nil {
+			return err
+		}
+		if len(events) < relayBatch {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,332 @@
+package tasks
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recordingSink records the events it gets and fails while fail is set.
+type recordingSink struct {
+	mu     sync.Mutex
+	events []TaskEvent
+	fail   bool
+}
+
+func (s *recordingSink) Publish(_ context.Context, events []TaskEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.fail {
+		return errors.New("sink unavailable")
+	}
+	s.events = append(s.events, events...)
+	return nil
+}
+
+func (s *recordingSink) setFail(fail bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.fail = fail
+}
+
+func (s *recordingSink) ids() []int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var out []int64
+	for _, e := range s.events {
+		out = append(out, e.ID)
+	}
+	return out
+}
+
+// startRelay runs a relay with short delays until the returned function
+// is called.
+func startRelay(t *testing.T, o Outbox, sinks ...OutboxSink) (stop func()) {
+	t.Helper()
+	relay := NewRelay(o, sinks...)
+	relay.PollInterval = 5 * time.Millisecond
+	relay.InitialInterval = 5 * time.Millisecond
+	relay.MaxInterval = 10 * time.Millisecond
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		relay.Run(ctx)
+	}()
+	stop = func() {
+		cancel()
+		<-done
+	}
+	t.Cleanup(stop)
+	return stop
+}
+
+// waitDelivered waits until the outbox has nothing pending.
+func waitDelivered(t *testing.T, o Outbox) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		pending, err := o.PendingOutbox(context.Background(), 1)
+		if err != nil {
+			t.Fatalf("pending: %v", err)
+		}
+		if len(pending) == 0 {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("events still pending: %+v", pending)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestSQLiteRepo_Outbox(t *testing.T) {
+	ctx := context.Background()
+	repo := newTempDB(t)
+	s := Scope{}
+
+	parent, err := repo.Create(ctx, s, TaskInput{Title: "parent"})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	child, err := repo.Create(ctx, s, TaskInput{Title: "child", ParentID: &parent.ID})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	done := true
+	if _, err := repo.Update(ctx, s, parent.ID, TaskPatch{Done: &done}); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	// failed and dry-run changes write nothing
+	if _, err := repo.Update(ctx, s, parent.ID+100, TaskPatch{Done: &done}); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+	missing := int64(999)
+	if _, err := repo.Create(ctx, s, TaskInput{Title: "x", ProjectID: &missing}); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+	if _, err := repo.Import(ctx, s, []ImportRow{{Input: TaskInput{Title: "dry"}}}, ImportSkip, true); err != nil {
+		t.Fatalf("import: %v", err)
+	}
+	if err := repo.Delete(ctx, s, parent.ID); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+
+	events, err := repo.PendingOutbox(ctx, 100)
+	if err != nil {
+		t.Fatalf("pending: %v", err)
+	}
+	want := []struct {
+		typ  string
+		task int64
+	}{
+		{EventCreated, parent.ID},
+		{EventCreated, child.ID},
+		{EventUpdated, parent.ID},
+		{EventDeleted, parent.ID},
+		{EventDeleted, child.ID},
+	}
+	if len(events) != len(want) {
+		t.Fatalf("expected %d events, got %+v", len(want), events)
+	}
+	for i, w := range want {
+		if e := events[i]; e.Type != w.typ || e.Task.ID != w.task || e.WorkspaceID != DefaultWorkspaceID {
+			t.Fatalf("event %d: expected %s of task %d, got %+v", i, w.typ, w.task, e)
+		}
+	}
+	if !events[2].Task.Done || events[4].Task.Title != "child" {
+		t.Fatalf("expected the events to carry the tasks, got %+v", events)
+	}
+
+	if err := repo.MarkOutboxDelivered(ctx, events[2].ID); err != nil {
+		t.Fatalf("mark: %v", err)
+	}
+	rest, err := repo.PendingOutbox(ctx, 100)
+	if err != nil {
+		t.Fatalf("pending: %v", err)
+	}
+	if len(rest) != 2 || rest[0].ID != events[3].ID {
+		t.Fatalf("expected the events after the delivered ones, got %+v", rest)
+	}
+}
+
+func TestRelay_ResumesInOrder(t *testing.T) {
+	ctx := context.Background()
+	dsn, err := SQLiteFileDSN(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("dsn error: %v", err)
+	}
+	open := func() *SQLiteRepo {
+		repo, err := NewSQLiteRepo(dsn)
+		if err != nil {
+			t.Fatalf("open error: %v", err)
+		}
+		if err := repo.ApplyMigrations(ctx); err != nil {
+			t.Fatalf("migrate error: %v", err)
+		}
+		return repo
+	}
+
+	repo := open()
+	var created []int64
+	for _, title := range []string{"one", "two", "three"} {
+		task, err := repo.Create(ctx, Scope{}, TaskInput{Title: title})
+		if err != nil {
+			t.Fatalf("create: %v", err)
+		}
+		created = append(created, task.ID)
+	}
+
+	// a failing sink holds the batch back, so it reaches the others again
+	first, flaky := &recordingSink{}, &recordingSink{fail: true}
+	stop := startRelay(t, repo, first, flaky)
+	time.Sleep(30 * time.Millisecond)
+	if len(flaky.ids()) != 0 {
+		t.Fatalf("expected nothing to pass the failing sink, got %v", flaky.ids())
+	}
+	flaky.setFail(false)
+	waitDelivered(t, repo)
+	stop()
+	delivered := flaky.ids()
+	if len(delivered) != 3 || !slices.IsSorted(delivered) {
+		t.Fatalf("expected 3 events in order, got %v", delivered)
+	}
+	if ids := first.ids(); len(ids) < 6 || !slices.Equal(ids[len(ids)-3:], delivered) {
+		t.Fatalf("expected the first sink to get the batch again, got %v", ids)
+	}
+
+	// changes made while no relay runs wait in the outbox
+	if _, err := repo.Create(ctx, Scope{}, TaskInput{Title: "four"}); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if err := repo.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+
+	repo = open()
+	t.Cleanup(func() { _ = repo.Close() })
+	after := &recordingSink{}
+	startRelay(t, repo, EventLogSink(repo), after)
+	waitDelivered(t, repo)
+	if ids := after.ids(); len(ids) != 1 || ids[0] <= delivered[2] {
+		t.Fatalf("expected only the pending event after the restart, got %v", ids)
+	}
+
+	// the log keeps the outbox ids, and appending them again changes nothing
+	if err := EventLogSink(repo).Publish(ctx, after.events); err != nil {
+		t.Fatalf("append again: %v", err)
+	}
+	logged, err := repo.Events(ctx, Scope{}, 0, 100)
+	if err != nil {
+		t.Fatalf("events: %v", err)
+	}
+	if len(logged) != 1 || logged[0].ID != after.events[0].ID || logged[0].Task.Title != "four" {
+		t.Fatalf("unexpected event log: %+v", logged)
+	}
+}
+
+func TestRelay_Prune(t *testing.T) {
+	ctx := context.Background()
+	repo := newTempDB(t)
+	a, err := repo.Create(ctx, Scope{}, TaskInput{Title: "a"})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	for _, title := range []string{"a1", "a2"} {
+		if _, err := repo.Update(ctx, Scope{}, a.ID, TaskPatch{Title: &title}); err != nil {
+			t.Fatalf("update: %v", err)
+		}
+	}
+	if _, err := repo.Create(ctx, Scope{}, TaskInput{Title: "b"}); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	// nothing is delivered yet, so nothing goes
+	if n, err := repo.PruneOutbox(ctx, time.Now().Add(time.Hour)); err != nil || n != 0 {
+		t.Fatalf("expected no pending event to be pruned, got %d, %v", n, err)
+	}
+
+	relay := NewRelay(repo, &recordingSink{})
+	relay.PollInterval = 5 * time.Millisecond
+	relay.Retention = time.Nanosecond
+	relay.PruneInterval = time.Millisecond
+	runCtx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		relay.Run(runCtx)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	// only the latest event of each task stays, for sync
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		var n int
+		if err := repo.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM outbox`).Scan(&n); err != nil {
+			t.Fatalf("count: %v", err)
+		}
+		if n == 2 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected the outbox to be pruned to 2 events, got %d", n)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	changes, err := repo.Changes(ctx, Scope{}, 0, 10)
+	if err != nil {
+		t.Fatalf("changes: %v", err)
+	}
+	if len(changes) != 2 || changes[0].Task.Title != "a2" || changes[1].Task.Title != "b" {
+		t.Fatalf("expected the latest changes to survive, got %+v", changes)
+	}
+}
+
+func TestRelay_Sinks(t *testing.T) {
+	forEachRepo(t, func(t *testing.T, repo Repository) {
+		ctx := context.Background()
+		hook, err := repo.CreateWebhook(ctx, Scope{}, "https://example.com/hook", webhookEvents, "s3cret")
+		if err != nil {
+			t.Fatalf("create webhook: %v", err)
+		}
+		b := NewBroker()
+		live, unsubscribe := b.Subscribe(10)
+		defer unsubscribe()
+
+		events := []TaskEvent{
+			{ID: 7, Type: EventCreated, Task: Task{ID: 1, Title: "a"}, WorkspaceID: DefaultWorkspaceID, At: time.Now().UTC()},
+			{ID: 9, Type: EventDeleted, Task: Task{ID: 1, Title: "a"}, WorkspaceID: DefaultWorkspaceID, At: time.Now().UTC()},
+		}
+		for range 2 { // relayed at least once
+			for _, sink := range []OutboxSink{EventLogSink(repo), WebhookSink(repo), BrokerSink(b)} {
+				if err := sink.Publish(ctx, events); err != nil {
+					t.Fatalf("publish: %v", err)
+				}
+			}
+		}
+
+		logged, err := repo.Events(ctx, Scope{}, 0, 100)
+		if err != nil {
+			t.Fatalf("events: %v", err)
+		}
+		if len(logged) != 2 || logged[0].ID != 7 || logged[1].ID != 9 {
+			t.Fatalf("expected each event logged once with its id, got %+v", logged)
+		}
+		deliveries, err := repo.ListWebhookDeliveries(ctx, Scope{}, hook.ID, 100)
+		if err != nil {
+			t.Fatalf("deliveries: %v", err)
+		}
+		if len(deliveries) != 2 || deliveries[0].EventID != 9 || deliveries[1].EventID != 7 {
+			t.Fatalf("expected one delivery per event, got %+v", deliveries)
+		}
+		if e := <-live; e.ID != 7 {
+			t.Fatalf("expected event 7 on the broker, got %+v", e)
+		}
+	})
+}
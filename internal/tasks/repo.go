@@ -1,56 +1,1610 @@
 package tasks
 
 import (
+	"cmp"
+	"context"
 	"errors"
+	"maps"
+	"math"
+	"slices"
+	"strings"
 	"sync"
 	"time"
 )
 
-var ErrTitleRequired = errors.New("title required")
+var (
+	ErrTitleRequired = errors.New("title required")
+	ErrNotFound      = errors.New("not found")
+	ErrConflict      = errors.New("conflict")
+	// ErrDeleted reports a change to a task that was deleted.
+	ErrDeleted = errors.New("deleted")
+)
 
+// Repository methods act within the workspace of their Scope; records of
+// other workspaces, and projects and tasks the scope cannot see, are
+// reported as ErrNotFound.
 type Repository interface {
-	Create(title string) (Task, error)
-	List() ([]Task, error)
+	// Create reports ErrNotFound if the project or parent is not in scope.
+	Create(ctx context.Context, s Scope, in TaskInput) (Task, error)
+	// CreateTree creates a task and all of its subtasks atomically and
+	// returns them depth-first, parents before children.
+	CreateTree(ctx context.Context, s Scope, root TaskTree) ([]Task, error)
+	Get(ctx context.Context, s Scope, id int64) (Task, error)
+	List(ctx context.Context, s Scope, q ListQuery) ([]Task, error)
+	// Stream calls fn with each task List would return, in order, without
+	// holding them all in memory; it stops at the first error from fn.
+	Stream(ctx context.Context, s Scope, q ListQuery, fn func(Task) error) error
+	Update(ctx context.Context, s Scope, id int64, p TaskPatch) (Task, error)
+	// Delete removes a task together with its subtasks.
+	Delete(ctx context.Context, s Scope, id int64) error
+	// Assign and Unassign add or remove one assignee and are idempotent.
+	// They report ErrNotFound if the task is not in scope or the user is
+	// not in its workspace.
+	Assign(ctx context.Context, s Scope, taskID, userID int64) (Task, error)
+	Unassign(ctx context.Context, s Scope, taskID, userID int64) (Task, error)
+	// Import applies rows atomically, resolving conflicts with strategy.
+	// A dry run reports the outcomes without keeping any change; the ids
+	// of tasks it would create are left zero.
+	Import(ctx context.Context, s Scope, rows []ImportRow, strategy ImportStrategy, dryRun bool) ([]ImportOutcome, error)
+	// Stats summarizes the tasks in scope; see StatsQuery.
+	Stats(ctx context.Context, s Scope, q StatsQuery) (Stats, error)
+
+	CreateProject(ctx context.Context, s Scope, name string, fields []FieldDef) (Project, error)
+	GetProject(ctx context.Context, s Scope, id int64) (Project, error)
+	ListProjects(ctx context.Context, s Scope) ([]Project, error)
+	// SetProjectFields replaces the project's field definitions. Stored
+	// values of fields that are no longer defined are discarded, and those
+	// of fields whose type or options change are converted, or discarded
+	// if they do not fit (see convertFieldValue).
+	SetProjectFields(ctx context.Context, s Scope, id int64, fields []FieldDef) (Project, error)
+
+	// ProjectRole is the scope's role on a visible project; admins act as
+	// owners of every project.
+	ProjectRole(ctx context.Context, s Scope, projectID int64) (Role, error)
+	// AddProjectMember reports ErrNotFound if the project is not visible or
+	// the user is not in the workspace, and ErrConflict if they already
+	// are a member.
+	AddProjectMember(ctx context.Context, s Scope, projectID, userID int64, role Role) (Member, error)
+	ListProjectMembers(ctx context.Context, s Scope, projectID int64) ([]Member, error)
+
+	// CreateView saves a view owned by the scope's user; ErrNotFound means
+	// the project it is shared in is not visible.
+	CreateView(ctx context.Context, s Scope, name, query string, projectID *int64) (View, error)
+	GetView(ctx context.Context, s Scope, id int64) (View, error)
+	ListViews(ctx context.Context, s Scope) ([]View, error)
+	DeleteView(ctx context.Context, s Scope, id int64) error
+
+	CreateTemplate(ctx context.Context, s Scope, name string, spec TemplateTask) (Template, error)
+	GetTemplate(ctx context.Context, s Scope, id int64) (Template, error)
+	ListTemplates(ctx context.Context, s Scope) ([]Template, error)
+	DeleteTemplate(ctx context.Context, s Scope, id int64) error
+
+	// CreateWorkspace creates a workspace together with its first admin
+	// user; a taken user name reports ErrConflict.
+	CreateWorkspace(ctx context.Context, name, adminName, tokenHash string) (Workspace, User, error)
+	ListWorkspaces(ctx context.Context) ([]Workspace, error)
+
+	// CreateUser adds a user to the scope's workspace. User names are
+	// unique across workspaces; a taken name reports ErrConflict.
+	CreateUser(ctx context.Context, s Scope, name string, admin bool, tokenHash string) (User, error)
+	GetUser(ctx context.Context, s Scope, id int64) (User, error)
+	ListUsers(ctx context.Context, s Scope) ([]User, error)
+	// UserByTokenHash authenticates a request, so it runs before any
+	// workspace is known and searches all of them.
+	UserByTokenHash(ctx context.Context, tokenHash string) (User, error)
+	// SetFeedToken replaces the calendar feed token of the scope's user,
+	// so earlier feed URLs stop working. An empty hash only revokes.
+	SetFeedToken(ctx context.Context, s Scope, tokenHash string) error
+	// UserByFeedTokenHash finds the user a calendar feed URL belongs to.
+	UserByFeedTokenHash(ctx context.Context, tokenHash string) (User, error)
+
+	// AppendEvents adds events to the event log and returns them with
+	// their ids, which increase in the order events are appended. An
+	// event that has an id keeps it, and is skipped if it is logged
+	// already, so events relayed from an outbox can be appended again.
+	AppendEvents(ctx context.Context, events []TaskEvent) ([]TaskEvent, error)
+	// Events lists the logged events of the scope's workspace with ids
+	// above afterID, oldest first and at most limit of them. It does not
+	// check which of their tasks the scope may see; see eventVisible.
+	Events(ctx context.Context, s Scope, afterID int64, limit int) ([]TaskEvent, error)
+	// LastEventID is the id of the latest event of the scope's workspace,
+	// or 0 if there is none.
+	LastEventID(ctx context.Context, s Scope) (int64, error)
+
+	// SyncPosition is the position of the latest task change in the
+	// scope's workspace, or 0 if there is none. Every change takes a
+	// higher position than the ones before it.
+	SyncPosition(ctx context.Context, s Scope) (int64, error)
+	// Changes lists the tasks of the scope's workspace changed after the
+	// position since, each once as of its latest change, ordered by the
+	// position of that change and at most limit of them. The ID of each
+	// event is its position, and deleted tasks come as EventDeleted
+	// tombstones. Like Events it does not check which tasks the scope may
+	// see.
+	Changes(ctx context.Context, s Scope, since int64, limit int) ([]TaskEvent, error)
+	// ChangeAt is the latest change of the task id in the scope's
+	// workspace at or before the position pos, that is the task as a
+	// client synced up to pos last saw it. It reports ErrNotFound if the
+	// task was not changed by then.
+	ChangeAt(ctx context.Context, s Scope, id, pos int64) (TaskEvent, error)
+	// MergeUpdate applies the members of p whose attribute was last
+	// changed no later than changedAt, taking changedAt as their new
+	// change time, and reports the clocks of the attributes it left
+	// alone. A change to a deleted task reports ErrDeleted.
+	MergeUpdate(ctx context.Context, s Scope, id int64, p TaskPatch, changedAt time.Time) (Task, []FieldClock, error)
+	// MergeDelete deletes a task, with its subtasks, unless an attribute
+	// of it was changed after changedAt; then it keeps the task and
+	// reports the clocks of those attributes. Deleting a deleted task
+	// does nothing.
+	MergeDelete(ctx context.Context, s Scope, id int64, changedAt time.Time) ([]FieldClock, error)
+
+	CreateWebhook(ctx context.Context, s Scope, url string, events []string, secret string) (Webhook, error)
+	GetWebhook(ctx context.Context, s Scope, id int64) (Webhook, error)
+	ListWebhooks(ctx context.Context, s Scope) ([]Webhook, error)
+	// SetWebhookActive turns a webhook on or off; turning it on also
+	// clears its failures.
+	SetWebhookActive(ctx context.Context, s Scope, id int64, active bool) (Webhook, error)
+	// DeleteWebhook removes a webhook together with its deliveries.
+	DeleteWebhook(ctx context.Context, s Scope, id int64) error
+	// EnqueueWebhookDeliveries queues payload, due now, for every active
+	// webhook of e's workspace subscribed to its type, and reports how
+	// many it queued. Webhooks that have a delivery of the event already
+	// are skipped.
+	EnqueueWebhookDeliveries(ctx context.Context, e TaskEvent, payload []byte) (int, error)
+	// ListWebhookDeliveries lists the deliveries of a webhook, newest
+	// first and at most limit of them.
+	ListWebhookDeliveries(ctx context.Context, s Scope, webhookID int64, limit int) ([]WebhookDelivery, error)
+	// RedeliverWebhook queues the payload of an earlier delivery again,
+	// due now, as a new delivery.
+	RedeliverWebhook(ctx context.Context, s Scope, webhookID, deliveryID int64) (WebhookDelivery, error)
+	// DueWebhookDeliveries lists the pending deliveries of active webhooks
+	// in all workspaces that are due by now, oldest first, leaving out
+	// those of the webhooks in skip.
+	DueWebhookDeliveries(ctx context.Context, now time.Time, limit int, skip []int64) ([]DueDelivery, error)
+	// RecordWebhookAttempt stores the outcome of an attempt at a delivery
+	// and updates the failures of its webhook.
+	RecordWebhookAttempt(ctx context.Context, deliveryID int64, a WebhookAttempt) error
 }
 
 type InMemoryRepo struct {
-	mu    sync.Mutex
-	seq   int64
-	store map[int64]Task
+	mu          sync.Mutex
+	seq         int64
+	store       map[int64]Task
+	projectSeq  int64
+	projects    map[int64]Project
+	members     map[int64]map[int64]Member // project id, then user id
+	templateSeq int64
+	templates   map[int64]Template
+	viewSeq     int64
+	views       map[int64]View
+	userSeq     int64
+	users       map[int64]User
+	userTokens  map[string]int64
+	feedTokens  map[string]int64 // calendar feed token hash to user id
+	wsSeq       int64
+	workspaces  map[int64]Workspace
+	eventSeq    int64
+	events      []TaskEvent // in id order
+	webhookSeq  int64
+	webhooks    map[int64]Webhook
+	deliverySeq int64
+	deliveries  []WebhookDelivery // in id order
+	changeSeq   int64
+	changes     []TaskEvent                    // task changes by position, for sync
+	clocks      map[int64]map[string]time.Time // attribute change times by task id
 }
 
 func NewInMemoryRepo() *InMemoryRepo {
 	return &InMemoryRepo{
-		store: make(map[int64]Task),
+		store:      make(map[int64]Task),
+		projects:   make(map[int64]Project),
+		members:    make(map[int64]map[int64]Member),
+		templates:  make(map[int64]Template),
+		views:      make(map[int64]View),
+		users:      make(map[int64]User),
+		userTokens: make(map[string]int64),
+		feedTokens: make(map[string]int64),
+		webhooks:   make(map[int64]Webhook),
+		clocks:     make(map[int64]map[string]time.Time),
+		wsSeq:      DefaultWorkspaceID,
+		workspaces: map[int64]Workspace{
+			DefaultWorkspaceID: {ID: DefaultWorkspaceID, Name: "default", CreatedAt: time.Now().UTC()},
+		},
 	}
 }
 
-func (r *InMemoryRepo) Create(title string) (Task, error) {
-	if title == "" {
+func (r *InMemoryRepo) Create(_ context.Context, s Scope, in TaskInput) (Task, error) {
+	if in.Title == "" {
 		return Task{}, ErrTitleRequired
 	}
 
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
+	if err := r.checkRefs(s, in); err != nil {
+		return Task{}, err
+	}
+	t := r.insert(s, in)
+	r.changed(EventCreated, t)
+	return t, nil
+}
+
+func (r *InMemoryRepo) CreateTree(_ context.Context, s Scope, root TaskTree) ([]Task, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// check everything up front so a bad node leaves nothing behind
+	var check func(n TaskTree, top bool) error
+	check = func(n TaskTree, top bool) error {
+		if n.Title == "" {
+			return ErrTitleRequired
+		}
+		in := n.TaskInput
+		if !top {
+			in.ParentID = nil
+		}
+		if err := r.checkRefs(s, in); err != nil {
+			return err
+		}
+		for _, c := range n.Subtasks {
+			if err := check(c, false); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := check(root, true); err != nil {
+		return nil, err
+	}
+
+	var out []Task
+	var create func(n TaskTree, parent *int64)
+	create = func(n TaskTree, parent *int64) {
+		in := n.TaskInput
+		if parent != nil {
+			in.ParentID = parent
+		}
+		t := r.insert(s, in)
+		r.changed(EventCreated, t)
+		out = append(out, cloneTask(t))
+		for _, c := range n.Subtasks {
+			create(c, &t.ID)
+		}
+	}
+	create(root, nil)
+	return out, nil
+}
+
+// checkRefs reports ErrNotFound when in points at a project, parent or
+// assignee outside the scope's workspace. Callers hold r.mu.
+func (r *InMemoryRepo) checkRefs(s Scope, in TaskInput) error {
+	if in.ProjectID != nil {
+		if p, ok := r.projects[*in.ProjectID]; !ok || p.workspaceID != s.workspace() {
+			return ErrNotFound
+		}
+	}
+	if in.ParentID != nil {
+		if t, ok := r.store[*in.ParentID]; !ok || t.workspaceID != s.workspace() {
+			return ErrNotFound
+		}
+	}
+	for _, id := range in.AssigneeIDs {
+		if u, ok := r.users[id]; !ok || u.WorkspaceID != s.workspace() {
+			return ErrNotFound
+		}
+	}
+	return nil
+}
+
+// insert stores a new task built from in. Callers hold r.mu.
+func (r *InMemoryRepo) insert(s Scope, in TaskInput) Task {
 	r.seq++
 	t := Task{
-		ID:        r.seq,
-		Title:     title,
-		Done:      false,
-		CreatedAt: time.Now().UTC(),
+		workspaceID: s.workspace(),
+		ID:          r.seq,
+		Title:       in.Title,
+		Done:        false,
+		ProjectID:   in.ProjectID,
+		ParentID:    in.ParentID,
+		Tags:        sortedTags(in.Tags),
+		Checklist:   slices.Clone(in.Checklist),
+		Fields:      cloneFields(in.Fields),
+		DueAt:       utcTime(in.DueAt),
+		Priority:    in.Priority,
+		Assignee:    in.Assignee,
+		AssigneeIDs: sortedIDs(in.AssigneeIDs),
+		OwnerID:     in.OwnerID,
+		CreatedAt:   time.Now().UTC(),
+		ICalUID:     in.ICalUID,
 	}
 	r.store[t.ID] = t
-	return t, nil
+	return cloneTask(t)
 }
 
-func (r *InMemoryRepo) List() ([]Task, error) {
+// visible mirrors scopeWhere: a restricted scope sees the tasks it owns or
+// is assigned to and those of projects it is a member of. Callers hold r.mu.
+func (r *InMemoryRepo) visible(s Scope, t Task) bool {
+	if t.workspaceID != s.workspace() {
+		return false
+	}
+	if !s.restricted() || involves(t, s.UserID) {
+		return true
+	}
+	if t.ProjectID == nil {
+		return false
+	}
+	_, ok := r.members[*t.ProjectID][s.UserID]
+	return ok
+}
+
+// projectVisible mirrors projectWhere. Callers hold r.mu.
+func (r *InMemoryRepo) projectVisible(s Scope, p Project) bool {
+	if p.workspaceID != s.workspace() {
+		return false
+	}
+	if !s.restricted() {
+		return true
+	}
+	_, ok := r.members[p.ID][s.UserID]
+	return ok
+}
+
+func (r *InMemoryRepo) Get(_ context.Context, s Scope, id int64) (Task, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	t, ok := r.store[id]
+	if !ok || !r.visible(s, t) {
+		return Task{}, ErrNotFound
+	}
+	return cloneTask(t), nil
+}
+
+func (r *InMemoryRepo) List(_ context.Context, s Scope, q ListQuery) ([]Task, error) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
 	out := make([]Task, 0, len(r.store))
 	for _, t := range r.store {
-		out = append(out, t)
+		if r.visible(s, t) && matchesQuery(t, q) {
+			out = append(out, cloneTask(t))
+		}
+	}
+	sortTasks(out, q.Sort)
+	return page(out, q.Limit, q.Offset), nil
+}
+
+// Stream implements Repository.Stream on top of List; the store is in
+// memory already.
+func (r *InMemoryRepo) Stream(ctx context.Context, s Scope, q ListQuery, fn func(Task) error) error {
+	tasks, err := r.List(ctx, s, q)
+	if err != nil {
+		return err
+	}
+	for _, t := range tasks {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := fn(t); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *InMemoryRepo) Update(_ context.Context, s Scope, id int64, p TaskPatch) (Task, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	t, ok := r.store[id]
+	if !ok || !r.visible(s, t) {
+		return Task{}, ErrNotFound
+	}
+	if p.Title != nil && *p.Title == "" {
+		return Task{}, ErrTitleRequired
+	}
+	t = r.patch(t, p, time.Now().UTC())
+	return cloneTask(t), nil
+}
+
+// patch applies p to t, stores the result and records the change, taking
+// at as the change time of the attributes p sets. Callers hold r.mu.
+func (r *InMemoryRepo) patch(t Task, p TaskPatch, at time.Time) Task {
+	t = patched(t, p, time.Now().UTC())
+	r.store[t.ID] = t
+	for _, f := range patchFields(p) {
+		if r.clocks[t.ID] == nil {
+			r.clocks[t.ID] = make(map[string]time.Time)
+		}
+		r.clocks[t.ID][f] = at
+	}
+	r.changed(EventUpdated, t)
+	return t
+}
+
+func (r *InMemoryRepo) Delete(_ context.Context, s Scope, id int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if t, ok := r.store[id]; !ok || !r.visible(s, t) {
+		return ErrNotFound
+	}
+	r.remove(id)
+	return nil
+}
+
+// remove deletes a task with its subtasks, like ON DELETE CASCADE on
+// parent_id, and records the changes. Callers hold r.mu.
+func (r *InMemoryRepo) remove(id int64) {
+	doomed := []int64{id}
+	for len(doomed) > 0 {
+		id, doomed = doomed[0], doomed[1:]
+		r.changed(EventDeleted, r.store[id])
+		delete(r.store, id)
+		delete(r.clocks, id)
+		for _, t := range r.store {
+			if t.ParentID != nil && *t.ParentID == id {
+				doomed = append(doomed, t.ID)
+			}
+		}
+	}
+}
+
+// changed records changes of type typ to ts for Changes. Callers hold
+// r.mu.
+func (r *InMemoryRepo) changed(typ string, ts ...Task) {
+	now := time.Now().UTC()
+	for _, t := range ts {
+		r.changeSeq++
+		r.changes = append(r.changes, TaskEvent{ID: r.changeSeq, Type: typ, Task: cloneTask(t), WorkspaceID: t.workspaceID, At: now})
+	}
+}
+
+// patched returns a copy of t with p applied at now.
+func patched(t Task, p TaskPatch, now time.Time) Task {
+	t = cloneTask(t)
+	if p.Title != nil {
+		t.Title = *p.Title
+	}
+	if p.Done != nil {
+		t.Done = *p.Done
+		if !t.Done {
+			t.CompletedAt = nil
+		} else if t.CompletedAt == nil {
+			t.CompletedAt = &now
+		}
+	}
+	if p.Tags != nil {
+		t.Tags = sortedTags(*p.Tags)
+	}
+	if p.Checklist != nil {
+		t.Checklist = slices.Clone(*p.Checklist)
+		if len(t.Checklist) == 0 {
+			t.Checklist = nil
+		}
+	}
+	if p.ClearDueAt {
+		t.DueAt = nil
+	} else if p.DueAt != nil {
+		t.DueAt = utcTime(p.DueAt)
+	}
+	if p.Priority != nil {
+		t.Priority = *p.Priority
+	}
+	if p.Assignee != nil {
+		t.Assignee = *p.Assignee
+	}
+	if p.AssigneeID != 0 && !slices.Contains(t.AssigneeIDs, p.AssigneeID) {
+		t.AssigneeIDs = sortedIDs(append(slices.Clone(t.AssigneeIDs), p.AssigneeID))
+	}
+	return t
+}
+
+// syncFields are the task attributes that keep a change time for
+// merging, by their JSON names.
+var syncFields = []string{"title", "done", "tags", "checklist", "due_at", "priority", "assignee"}
+
+// patchFields lists the attributes p sets, in the order of syncFields.
+func patchFields(p TaskPatch) []string {
+	set := []bool{p.Title != nil, p.Done != nil, p.Tags != nil, p.Checklist != nil, p.DueAt != nil || p.ClearDueAt, p.Priority != nil, p.Assignee != nil}
+	var out []string
+	for i, f := range syncFields {
+		if set[i] {
+			out = append(out, f)
+		}
+	}
+	return out
+}
+
+// withoutFields returns p without the members for the attributes of
+// clocks.
+func withoutFields(p TaskPatch, clocks []FieldClock) TaskPatch {
+	for _, c := range clocks {
+		switch c.Field {
+		case "title":
+			p.Title = nil
+		case "done":
+			p.Done = nil
+		case "tags":
+			p.Tags = nil
+		case "checklist":
+			p.Checklist = nil
+		case "due_at":
+			p.DueAt, p.ClearDueAt = nil, false
+		case "priority":
+			p.Priority = nil
+		case "assignee":
+			p.Assignee, p.AssigneeID = nil, 0
+		}
+	}
+	return p
+}
+
+// clocksAfter lists the clocks of the named attributes that are later
+// than at, in the order of fields.
+func clocksAfter(clocks map[string]time.Time, fields []string, at time.Time) []FieldClock {
+	var out []FieldClock
+	for _, f := range fields {
+		if c, ok := clocks[f]; ok && c.After(at) {
+			out = append(out, FieldClock{Field: f, ChangedAt: c})
+		}
+	}
+	return out
+}
+
+func (r *InMemoryRepo) Import(_ context.Context, s Scope, rows []ImportRow, strategy ImportStrategy, dryRun bool) ([]ImportOutcome, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// plan every row first so a bad one leaves nothing behind
+	out := make([]ImportOutcome, len(rows))
+	uids := make(map[string]bool) // taken by earlier rows of this import
+	for i := range rows {
+		row := &rows[i]
+		if id, ok := r.importConflict(s, *row); ok {
+			switch strategy {
+			case ImportSkip:
+				out[i] = ImportOutcome{Action: "skipped", ID: id}
+				continue
+			case ImportOverwrite:
+				out[i] = ImportOutcome{Action: "updated", ID: id}
+				continue
+			}
+			// a duplicate cannot share the calendar UID
+			row.Input.ICalUID = ""
+		}
+		if row.Input.Title == "" {
+			return nil, ErrTitleRequired
+		}
+		if err := r.checkRefs(s, row.Input); err != nil {
+			return nil, err
+		}
+		if p := row.ParentRow; p != nil && (*p < 0 || *p >= i) {
+			return nil, ErrNotFound
+		}
+		if uid := row.Input.ICalUID; uid != "" {
+			// mirrors the UNIQUE index on (workspace_id, ical_uid)
+			if uids[uid] || r.uidTaken(s, uid) {
+				return nil, ErrConflict
+			}
+			uids[uid] = true
+		}
+		out[i] = ImportOutcome{Action: "created"}
+	}
+	if dryRun {
+		return out, nil
+	}
+
+	for i, row := range rows {
+		switch out[i].Action {
+		case "updated":
+			r.patch(r.store[out[i].ID], row.Patch, time.Now().UTC())
+		case "created":
+			if p := row.ParentRow; p != nil {
+				parent := out[*p].ID
+				row.Input.ParentID = &parent
+			}
+			t := r.insert(s, row.Input)
+			if row.Done {
+				t = patched(t, TaskPatch{Done: &row.Done}, time.Now().UTC())
+				r.store[t.ID] = t
+			}
+			r.changed(EventCreated, t)
+			out[i].ID = t.ID
+		}
+	}
+	return out, nil
+}
+
+// importConflict mirrors the SQLite importConflict. Callers hold r.mu.
+func (r *InMemoryRepo) importConflict(s Scope, row ImportRow) (int64, bool) {
+	if row.ID != nil {
+		if t, ok := r.store[*row.ID]; ok && r.visible(s, t) {
+			return t.ID, true
+		}
+	}
+	if row.Input.ICalUID != "" {
+		for _, t := range r.store {
+			if t.ICalUID == row.Input.ICalUID && r.visible(s, t) {
+				return t.ID, true
+			}
+		}
+	}
+	return 0, false
+}
+
+// uidTaken reports whether any task of the workspace has the calendar UID.
+// Callers hold r.mu.
+func (r *InMemoryRepo) uidTaken(s Scope, uid string) bool {
+	for _, t := range r.store {
+		if t.workspaceID == s.workspace() && t.ICalUID == uid {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *InMemoryRepo) Assign(_ context.Context, s Scope, taskID, userID int64) (Task, error) {
+	return r.setAssigned(s, taskID, userID, true)
+}
+
+func (r *InMemoryRepo) Unassign(_ context.Context, s Scope, taskID, userID int64) (Task, error) {
+	return r.setAssigned(s, taskID, userID, false)
+}
+
+func (r *InMemoryRepo) setAssigned(s Scope, taskID, userID int64, assigned bool) (Task, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	t, ok := r.store[taskID]
+	if !ok || !r.visible(s, t) {
+		return Task{}, ErrNotFound
+	}
+	if u, ok := r.users[userID]; !ok || u.WorkspaceID != s.workspace() {
+		return Task{}, ErrNotFound
+	}
+	t = cloneTask(t)
+	if assigned {
+		t.AssigneeIDs = sortedIDs(append(t.AssigneeIDs, userID))
+	} else {
+		t.AssigneeIDs = slices.DeleteFunc(t.AssigneeIDs, func(id int64) bool { return id == userID })
+		if len(t.AssigneeIDs) == 0 {
+			t.AssigneeIDs = nil
+		}
+	}
+	r.store[taskID] = t
+	r.changed(EventUpdated, t)
+	return cloneTask(t), nil
+}
+
+func (r *InMemoryRepo) Stats(_ context.Context, s Scope, q StatsQuery) (Stats, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	st := Stats{Daily: statsDays(q.From, q.To)}
+	day := func(t time.Time) (int, bool) {
+		d := t.UTC().Truncate(24 * time.Hour)
+		if d.Before(q.From) || d.After(q.To) {
+			return 0, false
+		}
+		return int(d.Sub(q.From) / (24 * time.Hour)), true
+	}
+	var cycles []int64
+	for _, t := range r.store {
+		if !r.visible(s, t) || (q.ProjectID != nil && (t.ProjectID == nil || *t.ProjectID != *q.ProjectID)) {
+			continue
+		}
+		switch {
+		case t.Done:
+			st.ByStatus.Done++
+		case t.DueAt != nil && t.DueAt.Before(q.Now):
+			st.ByStatus.Open++
+			st.ByStatus.Overdue++
+		default:
+			st.ByStatus.Open++
+		}
+		if i, ok := day(t.CreatedAt); ok {
+			st.Daily[i].Created++
+		}
+		if t.CompletedAt == nil {
+			continue
+		}
+		if i, ok := day(*t.CompletedAt); ok {
+			st.Daily[i].Completed++
+			cycles = append(cycles, int64(math.Round(t.CompletedAt.Sub(t.CreatedAt).Seconds())))
+		}
+	}
+	slices.Sort(cycles)
+	st.CycleTime = CycleTime{
+		Count: len(cycles),
+		P50:   nearestRank(cycles, 50),
+		P90:   nearestRank(cycles, 90),
+		P95:   nearestRank(cycles, 95),
+	}
+	return st, nil
+}
+
+func (r *InMemoryRepo) CreateProject(_ context.Context, s Scope, name string, fields []FieldDef) (Project, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.projectSeq++
+	p := Project{
+		workspaceID: s.workspace(),
+		ID:          r.projectSeq,
+		Name:        name,
+		Fields:      slices.Clone(fields),
+		CreatedAt:   time.Now().UTC(),
+	}
+	if p.Fields == nil {
+		p.Fields = []FieldDef{}
+	}
+	r.projects[p.ID] = p
+	if s.UserID != 0 {
+		r.members[p.ID] = map[int64]Member{
+			s.UserID: {UserID: s.UserID, Name: r.users[s.UserID].Name, Role: RoleOwner, CreatedAt: p.CreatedAt},
+		}
+	}
+	return p, nil
+}
+
+func (r *InMemoryRepo) GetProject(_ context.Context, s Scope, id int64) (Project, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	p, ok := r.projects[id]
+	if !ok || !r.projectVisible(s, p) {
+		return Project{}, ErrNotFound
+	}
+	return p, nil
+}
+
+func (r *InMemoryRepo) ListProjects(_ context.Context, s Scope) ([]Project, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	out := make([]Project, 0, len(r.projects))
+	for _, p := range r.projects {
+		if r.projectVisible(s, p) {
+			out = append(out, p)
+		}
+	}
+	slices.SortFunc(out, func(a, b Project) int { return cmp.Compare(a.ID, b.ID) })
+	return out, nil
+}
+
+func (r *InMemoryRepo) SetProjectFields(_ context.Context, s Scope, id int64, fields []FieldDef) (Project, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	p, ok := r.projects[id]
+	if !ok || !r.projectVisible(s, p) {
+		return Project{}, ErrNotFound
+	}
+	p.Fields = slices.Clone(fields)
+	if p.Fields == nil {
+		p.Fields = []FieldDef{}
+	}
+	r.projects[id] = p
+
+	for tid, t := range r.store {
+		if t.ProjectID == nil || *t.ProjectID != id {
+			continue
+		}
+		t.Fields = cloneFields(t.Fields)
+		for name, v := range t.Fields {
+			def, ok := findField(p.Fields, name)
+			if ok {
+				v, ok = convertFieldValue(def, v)
+			}
+			if ok {
+				t.Fields[name] = v
+			} else {
+				delete(t.Fields, name)
+			}
+		}
+		if len(t.Fields) == 0 {
+			t.Fields = nil
+		}
+		r.store[tid] = t
+	}
+	return p, nil
+}
+
+func (r *InMemoryRepo) ProjectRole(_ context.Context, s Scope, projectID int64) (Role, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	p, ok := r.projects[projectID]
+	if !ok || !r.projectVisible(s, p) {
+		return "", ErrNotFound
+	}
+	if !s.restricted() {
+		return RoleOwner, nil
+	}
+	return r.members[projectID][s.UserID].Role, nil
+}
+
+func (r *InMemoryRepo) AddProjectMember(_ context.Context, s Scope, projectID, userID int64, role Role) (Member, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	p, ok := r.projects[projectID]
+	if !ok || !r.projectVisible(s, p) {
+		return Member{}, ErrNotFound
+	}
+	u, ok := r.users[userID]
+	if !ok || u.WorkspaceID != s.workspace() {
+		return Member{}, ErrNotFound
+	}
+	if _, ok := r.members[projectID][userID]; ok {
+		return Member{}, ErrConflict
+	}
+	m := Member{UserID: userID, Name: u.Name, Role: role, CreatedAt: time.Now().UTC()}
+	if r.members[projectID] == nil {
+		r.members[projectID] = make(map[int64]Member)
+	}
+	r.members[projectID][userID] = m
+	return m, nil
+}
+
+func (r *InMemoryRepo) ListProjectMembers(_ context.Context, s Scope, projectID int64) ([]Member, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	p, ok := r.projects[projectID]
+	if !ok || !r.projectVisible(s, p) {
+		return nil, ErrNotFound
+	}
+	out := make([]Member, 0, len(r.members[projectID]))
+	for _, m := range r.members[projectID] {
+		out = append(out, m)
+	}
+	slices.SortFunc(out, func(a, b Member) int { return cmp.Compare(a.UserID, b.UserID) })
+	return out, nil
+}
+
+func (r *InMemoryRepo) CreateView(_ context.Context, s Scope, name, query string, projectID *int64) (View, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if projectID != nil {
+		if p, ok := r.projects[*projectID]; !ok || !r.projectVisible(s, p) {
+			return View{}, ErrNotFound
+		}
+	}
+	r.viewSeq++
+	v := View{
+		workspaceID: s.workspace(),
+		ID:          r.viewSeq,
+		Name:        name,
+		Query:       query,
+		ProjectID:   projectID,
+		CreatedAt:   time.Now().UTC(),
+	}
+	if s.UserID != 0 {
+		owner := s.UserID
+		v.OwnerID = &owner
+	}
+	r.views[v.ID] = v
+	return v, nil
+}
+
+// viewVisible mirrors viewWhere. Callers hold r.mu.
+func (r *InMemoryRepo) viewVisible(s Scope, v View) bool {
+	if v.workspaceID != s.workspace() {
+		return false
+	}
+	if !s.restricted() || (v.OwnerID != nil && *v.OwnerID == s.UserID) {
+		return true
+	}
+	if v.ProjectID == nil {
+		return false
+	}
+	_, ok := r.members[*v.ProjectID][s.UserID]
+	return ok
+}
+
+func (r *InMemoryRepo) GetView(_ context.Context, s Scope, id int64) (View, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	v, ok := r.views[id]
+	if !ok || !r.viewVisible(s, v) {
+		return View{}, ErrNotFound
+	}
+	return v, nil
+}
+
+func (r *InMemoryRepo) ListViews(_ context.Context, s Scope) ([]View, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	out := make([]View, 0, len(r.views))
+	for _, v := range r.views {
+		if r.viewVisible(s, v) {
+			out = append(out, v)
+		}
+	}
+	slices.SortFunc(out, func(a, b View) int { return cmp.Compare(a.ID, b.ID) })
+	return out, nil
+}
+
+func (r *InMemoryRepo) DeleteView(_ context.Context, s Scope, id int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if v, ok := r.views[id]; !ok || !r.viewVisible(s, v) {
+		return ErrNotFound
+	}
+	delete(r.views, id)
+	return nil
+}
+
+func (r *InMemoryRepo) CreateTemplate(_ context.Context, s Scope, name string, spec TemplateTask) (Template, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.templateSeq++
+	tpl := newTemplate(r.templateSeq, name, spec, time.Now().UTC())
+	tpl.workspaceID = s.workspace()
+	r.templates[tpl.ID] = tpl
+	return tpl, nil
+}
+
+func (r *InMemoryRepo) GetTemplate(_ context.Context, s Scope, id int64) (Template, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	tpl, ok := r.templates[id]
+	if !ok || tpl.workspaceID != s.workspace() {
+		return Template{}, ErrNotFound
+	}
+	return tpl, nil
+}
+
+func (r *InMemoryRepo) ListTemplates(_ context.Context, s Scope) ([]Template, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	out := make([]Template, 0, len(r.templates))
+	for _, tpl := range r.templates {
+		if tpl.workspaceID == s.workspace() {
+			out = append(out, tpl)
+		}
 	}
+	slices.SortFunc(out, func(a, b Template) int { return cmp.Compare(a.ID, b.ID) })
 	return out, nil
 }
+
+func (r *InMemoryRepo) DeleteTemplate(_ context.Context, s Scope, id int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if tpl, ok := r.templates[id]; !ok || tpl.workspaceID != s.workspace() {
+		return ErrNotFound
+	}
+	delete(r.templates, id)
+	return nil
+}
+
+func (r *InMemoryRepo) CreateWorkspace(_ context.Context, name, adminName, tokenHash string) (Workspace, User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.checkNewUser(r.wsSeq+1, adminName, tokenHash); err != nil {
+		return Workspace{}, User{}, err
+	}
+	r.wsSeq++
+	ws := Workspace{ID: r.wsSeq, Name: name, CreatedAt: time.Now().UTC()}
+	r.workspaces[ws.ID] = ws
+	return ws, r.insertUser(ws.ID, adminName, true, tokenHash), nil
+}
+
+func (r *InMemoryRepo) ListWorkspaces(_ context.Context) ([]Workspace, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	out := make([]Workspace, 0, len(r.workspaces))
+	for _, ws := range r.workspaces {
+		out = append(out, ws)
+	}
+	slices.SortFunc(out, func(a, b Workspace) int { return cmp.Compare(a.ID, b.ID) })
+	return out, nil
+}
+
+func (r *InMemoryRepo) CreateUser(_ context.Context, s Scope, name string, admin bool, tokenHash string) (User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.checkNewUser(s.workspace(), name, tokenHash); err != nil {
+		return User{}, err
+	}
+	return r.insertUser(s.workspace(), name, admin, tokenHash), nil
+}
+
+// checkNewUser mirrors the UNIQUE constraints of the users table. Callers
+// hold r.mu.
+func (r *InMemoryRepo) checkNewUser(workspaceID int64, name, tokenHash string) error {
+	for _, u := range r.users {
+		if u.WorkspaceID == workspaceID && u.Name == name {
+			return ErrConflict
+		}
+	}
+	if _, ok := r.userTokens[tokenHash]; ok {
+		return ErrConflict
+	}
+	return nil
+}
+
+// insertUser stores a new user. Callers hold r.mu.
+func (r *InMemoryRepo) insertUser(workspaceID int64, name string, admin bool, tokenHash string) User {
+	r.userSeq++
+	u := User{ID: r.userSeq, WorkspaceID: workspaceID, Name: name, Admin: admin, CreatedAt: time.Now().UTC()}
+	r.users[u.ID] = u
+	r.userTokens[tokenHash] = u.ID
+	return u
+}
+
+func (r *InMemoryRepo) GetUser(_ context.Context, s Scope, id int64) (User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	u, ok := r.users[id]
+	if !ok || u.WorkspaceID != s.workspace() {
+		return User{}, ErrNotFound
+	}
+	return u, nil
+}
+
+func (r *InMemoryRepo) ListUsers(_ context.Context, s Scope) ([]User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	out := make([]User, 0, len(r.users))
+	for _, u := range r.users {
+		if u.WorkspaceID == s.workspace() {
+			out = append(out, u)
+		}
+	}
+	slices.SortFunc(out, func(a, b User) int { return cmp.Compare(a.ID, b.ID) })
+	return out, nil
+}
+
+func (r *InMemoryRepo) UserByTokenHash(_ context.Context, tokenHash string) (User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	id, ok := r.userTokens[tokenHash]
+	if !ok {
+		return User{}, ErrNotFound
+	}
+	return r.users[id], nil
+}
+
+func (r *InMemoryRepo) SetFeedToken(_ context.Context, s Scope, tokenHash string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if u, ok := r.users[s.UserID]; !ok || u.WorkspaceID != s.workspace() {
+		return ErrNotFound
+	}
+	for h, id := range r.feedTokens {
+		if id == s.UserID {
+			delete(r.feedTokens, h)
+		}
+	}
+	if tokenHash != "" {
+		r.feedTokens[tokenHash] = s.UserID
+	}
+	return nil
+}
+
+func (r *InMemoryRepo) UserByFeedTokenHash(_ context.Context, tokenHash string) (User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	id, ok := r.feedTokens[tokenHash]
+	if !ok {
+		return User{}, ErrNotFound
+	}
+	return r.users[id], nil
+}
+
+func matchesQuery(t Task, q ListQuery) bool {
+	if q.ProjectID != nil && (t.ProjectID == nil || *t.ProjectID != *q.ProjectID) {
+		return false
+	}
+	if q.ParentID != nil && (t.ParentID == nil || *t.ParentID != *q.ParentID) {
+		return false
+	}
+	if q.Done != nil && t.Done != *q.Done {
+		return false
+	}
+	if q.IDs != nil && !slices.Contains(q.IDs, t.ID) {
+		return false
+	}
+	if q.ProjectIDs != nil && (t.ProjectID == nil || !slices.Contains(q.ProjectIDs, *t.ProjectID)) {
+		return false
+	}
+	if q.ParentIDs != nil && (t.ParentID == nil || !slices.Contains(q.ParentIDs, *t.ParentID)) {
+		return false
+	}
+	if t.ID <= q.AfterID {
+		return false
+	}
+	if q.Tag != "" && !slices.Contains(t.Tags, q.Tag) {
+		return false
+	}
+	if q.ICalUID != "" && t.ICalUID != q.ICalUID {
+		return false
+	}
+	if q.AssigneeID != nil && !slices.Contains(t.AssigneeIDs, *q.AssigneeID) {
+		return false
+	}
+	if q.InvolvedUserID != nil && !involves(t, *q.InvolvedUserID) {
+		return false
+	}
+	for _, f := range q.Fields {
+		if !f.matches(t.Fields[f.Name]) {
+			return false
+		}
+	}
+	return true
+}
+
+// page applies LIMIT and OFFSET like SQLiteRepo; a zero limit means all.
+func page(ts []Task, limit, offset int) []Task {
+	ts = ts[min(offset, len(ts)):]
+	if limit > 0 && limit < len(ts) {
+		ts = ts[:limit]
+	}
+	return ts
+}
+
+// involves reports whether the user owns t or is assigned to it.
+func involves(t Task, userID int64) bool {
+	return (t.OwnerID != nil && *t.OwnerID == userID) || slices.Contains(t.AssigneeIDs, userID)
+}
+
+// sortTasks applies keys in order and falls back to ascending id, mirroring
+// the ORDER BY that SQLiteRepo builds.
+func sortTasks(ts []Task, keys []SortKey) {
+	slices.SortFunc(ts, func(a, b Task) int {
+		for _, k := range keys {
+			var c int
+			switch {
+			case k.Field != "":
+				c = compareFieldValues(a.Fields[k.Field], b.Fields[k.Field])
+			case k.Column == "title":
+				c = strings.Compare(a.Title, b.Title)
+			case k.Column == "created_at":
+				c = a.CreatedAt.Compare(b.CreatedAt)
+			case k.Column == "due_at":
+				c = compareTimes(a.DueAt, b.DueAt)
+			case k.Column == "priority":
+				c = cmp.Compare(a.Priority, b.Priority)
+			case k.Column == "id":
+				c = cmp.Compare(a.ID, b.ID)
+			}
+			if k.Desc {
+				c = -c
+			}
+			if c != 0 {
+				return c
+			}
+		}
+		return cmp.Compare(a.ID, b.ID)
+	})
+}
+
+// compareTimes orders nil before any time, like NULL in SQLite.
+func compareTimes(a, b *time.Time) int {
+	switch {
+	case a == nil && b == nil:
+		return 0
+	case a == nil:
+		return -1
+	case b == nil:
+		return 1
+	}
+	return a.Compare(*b)
+}
+
+func utcTime(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	u := t.UTC()
+	return &u
+}
+
+// cloneTask copies the slices and maps of t so callers cannot mutate
+// repository state.
+func cloneTask(t Task) Task {
+	t.Tags = slices.Clone(t.Tags)
+	t.Checklist = slices.Clone(t.Checklist)
+	t.Fields = cloneFields(t.Fields)
+	t.AssigneeIDs = slices.Clone(t.AssigneeIDs)
+	return t
+}
+
+func cloneFields(m map[string]any) map[string]any {
+	if len(m) == 0 {
+		return nil
+	}
+	out := make(map[string]any, len(m))
+	for k, v := range m {
+		out[k] = v
+	}
+	return out
+}
+
+func sortedIDs(ids []int64) []int64 {
+	if len(ids) == 0 {
+		return nil
+	}
+	out := slices.Clone(ids)
+	slices.Sort(out)
+	return slices.Compact(out)
+}
+
+func sortedTags(tags []string) []string {
+	if len(tags) == 0 {
+		return nil
+	}
+	out := slices.Clone(tags)
+	slices.Sort(out)
+	return slices.Compact(out)
+}
+
+func (r *InMemoryRepo) AppendEvents(_ context.Context, events []TaskEvent) ([]TaskEvent, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	out := make([]TaskEvent, len(events))
+	for i, e := range events {
+		if e.ID == 0 {
+			r.eventSeq++
+			e.ID = r.eventSeq
+		}
+		out[i] = e
+		j, found := slices.BinarySearchFunc(r.events, e.ID, func(e TaskEvent, id int64) int { return cmp.Compare(e.ID, id) })
+		if found {
+			continue
+		}
+		r.eventSeq = max(r.eventSeq, e.ID)
+		e.Task = cloneTask(e.Task)
+		r.events = slices.Insert(r.events, j, e)
+	}
+	return out, nil
+}
+
+func (r *InMemoryRepo) Events(_ context.Context, s Scope, afterID int64, limit int) ([]TaskEvent, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	i, _ := slices.BinarySearchFunc(r.events, afterID+1, func(e TaskEvent, id int64) int { return cmp.Compare(e.ID, id) })
+	var out []TaskEvent
+	for _, e := range r.events[i:] {
+		if len(out) == limit {
+			break
+		}
+		if e.WorkspaceID == s.workspace() {
+			e.Task = cloneTask(e.Task)
+			out = append(out, e)
+		}
+	}
+	return out, nil
+}
+
+func (r *InMemoryRepo) LastEventID(_ context.Context, s Scope) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i := len(r.events) - 1; i >= 0; i-- {
+		if r.events[i].WorkspaceID == s.workspace() {
+			return r.events[i].ID, nil
+		}
+	}
+	return 0, nil
+}
+
+func (r *InMemoryRepo) CreateWebhook(_ context.Context, s Scope, url string, events []string, secret string) (Webhook, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.webhookSeq++
+	h := Webhook{
+		workspaceID: s.workspace(),
+		ID:          r.webhookSeq,
+		URL:         url,
+		Events:      slices.Clone(events),
+		Secret:      secret,
+		Active:      true,
+		CreatedAt:   time.Now().UTC(),
+	}
+	r.webhooks[h.ID] = h
+	return h, nil
+}
+
+// webhook returns a webhook of the scope's workspace. Callers hold r.mu.
+func (r *InMemoryRepo) webhook(s Scope, id int64) (Webhook, error) {
+	h, ok := r.webhooks[id]
+	if !ok || h.workspaceID != s.workspace() {
+		return Webhook{}, ErrNotFound
+	}
+	h.Events = slices.Clone(h.Events)
+	return h, nil
+}
+
+func (r *InMemoryRepo) GetWebhook(_ context.Context, s Scope, id int64) (Webhook, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.webhook(s, id)
+}
+
+func (r *InMemoryRepo) ListWebhooks(_ context.Context, s Scope) ([]Webhook, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	out := []Webhook{}
+	for id := range r.webhooks {
+		if h, err := r.webhook(s, id); err == nil {
+			out = append(out, h)
+		}
+	}
+	slices.SortFunc(out, func(a, b Webhook) int { return cmp.Compare(a.ID, b.ID) })
+	return out, nil
+}
+
+func (r *InMemoryRepo) SetWebhookActive(_ context.Context, s Scope, id int64, active bool) (Webhook, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	h, err := r.webhook(s, id)
+	if err != nil {
+		return Webhook{}, err
+	}
+	h.Active = active
+	if active {
+		h.Failures = 0
+	}
+	r.webhooks[id] = h
+	return h, nil
+}
+
+func (r *InMemoryRepo) DeleteWebhook(_ context.Context, s Scope, id int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, err := r.webhook(s, id); err != nil {
+		return err
+	}
+	delete(r.webhooks, id)
+	r.deliveries = slices.DeleteFunc(r.deliveries, func(d WebhookDelivery) bool { return d.WebhookID == id })
+	return nil
+}
+
+func (r *InMemoryRepo) EnqueueWebhookDeliveries(_ context.Context, e TaskEvent, payload []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var ids []int64
+	for id, h := range r.webhooks {
+		if h.workspaceID != e.WorkspaceID || !h.Active || !slices.Contains(h.Events, e.Type) {
+			continue
+		}
+		queued := slices.ContainsFunc(r.deliveries, func(d WebhookDelivery) bool {
+			return d.WebhookID == id && d.EventID == e.ID && d.RedeliveryOf == nil
+		})
+		if !queued {
+			ids = append(ids, id)
+		}
+	}
+	slices.Sort(ids)
+	now := time.Now().UTC()
+	for _, id := range ids {
+		r.queueDelivery(WebhookDelivery{WebhookID: id, EventID: e.ID, Event: e.Type, Payload: payload}, now)
+	}
+	return len(ids), nil
+}
+
+// queueDelivery adds d as a pending delivery due at now. Callers hold r.mu.
+func (r *InMemoryRepo) queueDelivery(d WebhookDelivery, now time.Time) WebhookDelivery {
+	r.deliverySeq++
+	d.ID = r.deliverySeq
+	d.Payload = slices.Clone(d.Payload)
+	d.Status = DeliveryPending
+	d.Attempts = 0
+	d.NextAttemptAt = &now
+	d.LastAttemptAt = nil
+	d.ResponseStatus = 0
+	d.LastError = ""
+	d.CreatedAt = now
+	r.deliveries = append(r.deliveries, d)
+	return d
+}
+
+func (r *InMemoryRepo) ListWebhookDeliveries(_ context.Context, s Scope, webhookID int64, limit int) ([]WebhookDelivery, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, err := r.webhook(s, webhookID); err != nil {
+		return nil, err
+	}
+	out := []WebhookDelivery{}
+	for i := len(r.deliveries) - 1; i >= 0 && len(out) < limit; i-- {
+		if d := r.deliveries[i]; d.WebhookID == webhookID {
+			out = append(out, d)
+		}
+	}
+	return out, nil
+}
+
+func (r *InMemoryRepo) RedeliverWebhook(_ context.Context, s Scope, webhookID, deliveryID int64) (WebhookDelivery, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, err := r.webhook(s, webhookID); err != nil {
+		return WebhookDelivery{}, err
+	}
+	i := slices.IndexFunc(r.deliveries, func(d WebhookDelivery) bool { return d.ID == deliveryID && d.WebhookID == webhookID })
+	if i < 0 {
+		return WebhookDelivery{}, ErrNotFound
+	}
+	d := r.deliveries[i]
+	d.RedeliveryOf = &deliveryID
+	return r.queueDelivery(d, time.Now().UTC()), nil
+}
+
+func (r *InMemoryRepo) DueWebhookDeliveries(_ context.Context, now time.Time, limit int, skip []int64) ([]DueDelivery, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var out []DueDelivery
+	for _, d := range r.deliveries {
+		if len(out) == limit {
+			break
+		}
+		h := r.webhooks[d.WebhookID]
+		if d.Status == DeliveryPending && h.Active && !d.NextAttemptAt.After(now) && !slices.Contains(skip, d.WebhookID) {
+			out = append(out, DueDelivery{WebhookDelivery: d, URL: h.URL, Secret: h.Secret})
+		}
+	}
+	return out, nil
+}
+
+func (r *InMemoryRepo) RecordWebhookAttempt(_ context.Context, deliveryID int64, a WebhookAttempt) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	i := slices.IndexFunc(r.deliveries, func(d WebhookDelivery) bool { return d.ID == deliveryID })
+	if i < 0 {
+		return ErrNotFound
+	}
+	d := &r.deliveries[i]
+	at := a.At
+	d.Attempts++
+	d.LastAttemptAt = &at
+	d.ResponseStatus = a.StatusCode
+	d.LastError = a.Error
+	d.NextAttemptAt = a.Retry
+	h := r.webhooks[d.WebhookID]
+	switch {
+	case a.Error == "":
+		d.Status = DeliverySucceeded
+		h.Failures = 0
+	case a.Retry == nil:
+		d.Status = DeliveryFailed
+		h.Failures++
+	default:
+		h.Failures++
+	}
+	if a.DisableAfter > 0 && h.Failures >= a.DisableAfter {
+		h.Active = false
+	}
+	r.webhooks[d.WebhookID] = h
+	return nil
+}
+
+func (r *InMemoryRepo) SyncPosition(_ context.Context, s Scope) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i := len(r.changes) - 1; i >= 0; i-- {
+		if r.changes[i].WorkspaceID == s.workspace() {
+			return r.changes[i].ID, nil
+		}
+	}
+	return 0, nil
+}
+
+func (r *InMemoryRepo) Changes(_ context.Context, s Scope, since int64, limit int) ([]TaskEvent, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// positions are indexes plus one
+	from := int(min(max(since, 0), int64(len(r.changes))))
+	latest := make(map[int64]int) // task id to index of its latest change
+	for i, e := range r.changes[from:] {
+		if e.WorkspaceID == s.workspace() {
+			latest[e.Task.ID] = from + i
+		}
+	}
+	idx := slices.Sorted(maps.Values(latest))
+	out := make([]TaskEvent, 0, min(len(idx), limit))
+	for _, i := range idx[:min(len(idx), limit)] {
+		e := r.changes[i]
+		e.Task = cloneTask(e.Task)
+		out = append(out, e)
+	}
+	return out, nil
+}
+
+func (r *InMemoryRepo) ChangeAt(_ context.Context, s Scope, id, pos int64) (TaskEvent, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	to := int(min(max(pos, 0), int64(len(r.changes))))
+	for _, e := range slices.Backward(r.changes[:to]) {
+		if e.Task.ID == id && e.WorkspaceID == s.workspace() {
+			e.Task = cloneTask(e.Task)
+			return e, nil
+		}
+	}
+	return TaskEvent{}, ErrNotFound
+}
+
+// tombstone reports whether the task id of the scope's workspace was
+// deleted. Callers hold r.mu.
+func (r *InMemoryRepo) tombstone(s Scope, id int64) bool {
+	if _, ok := r.store[id]; ok {
+		return false
+	}
+	for _, e := range slices.Backward(r.changes) {
+		if e.Task.ID == id {
+			return e.Type == EventDeleted && e.WorkspaceID == s.workspace()
+		}
+	}
+	return false
+}
+
+func (r *InMemoryRepo) MergeUpdate(_ context.Context, s Scope, id int64, p TaskPatch, changedAt time.Time) (Task, []FieldClock, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	t, ok := r.store[id]
+	if !ok || !r.visible(s, t) {
+		if r.tombstone(s, id) {
+			return Task{}, nil, ErrDeleted
+		}
+		return Task{}, nil, ErrNotFound
+	}
+	if p.Title != nil && *p.Title == "" {
+		return Task{}, nil, ErrTitleRequired
+	}
+	stale := clocksAfter(r.clocks[id], patchFields(p), changedAt)
+	if p = withoutFields(p, stale); len(patchFields(p)) > 0 {
+		t = r.patch(t, p, changedAt.UTC())
+	}
+	return cloneTask(t), stale, nil
+}
+
+func (r *InMemoryRepo) MergeDelete(_ context.Context, s Scope, id int64, changedAt time.Time) ([]FieldClock, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	t, ok := r.store[id]
+	if !ok || !r.visible(s, t) {
+		if r.tombstone(s, id) {
+			return nil, nil
+		}
+		return nil, ErrNotFound
+	}
+	if newer := clocksAfter(r.clocks[id], syncFields, changedAt); len(newer) > 0 {
+		return newer, nil
+	}
+	r.remove(id)
+	return nil, nil
+}
@@ -0,0 +1,92 @@
+package tasks
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+)
+
+// AppendEvents implements Repository.AppendEvents in a single transaction;
+// the task is stored as its JSON.
+func (r *SQLiteRepo) AppendEvents(ctx context.Context, events []TaskEvent) ([]TaskEvent, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	out := make([]TaskEvent, len(events))
+	for i, e := range events {
+		task, err := json.Marshal(e.Task)
+		if err != nil {
+			return nil, err
+		}
+		var id any // a new one unless the event has it
+		if e.ID != 0 {
+			id = e.ID
+		}
+		res, err := tx.ExecContext(ctx, `
+			INSERT INTO task_events (id, workspace_id, type, task_id, task, at) VALUES (?, ?, ?, ?, ?, ?)
+			ON CONFLICT (id) DO NOTHING
+		`, id, e.WorkspaceID, e.Type, e.Task.ID, string(task), e.At.UTC().Format(time.RFC3339Nano))
+		if err != nil {
+			return nil, err
+		}
+		if e.ID == 0 {
+			if e.ID, err = res.LastInsertId(); err != nil {
+				return nil, err
+			}
+		}
+		out[i] = e
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (r *SQLiteRepo) Events(ctx context.Context, s Scope, afterID int64, limit int) ([]TaskEvent, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT id, workspace_id, type, task, at FROM task_events
+		WHERE workspace_id = ? AND id > ?
+		ORDER BY id ASC
+		LIMIT ?
+	`, s.workspace(), afterID, limit)
+	if err != nil {
+		return nil, err
+	}
+	return scanEvents(rows)
+}
+
+// scanEvents reads rows of id, workspace_id, type, task and at.
+func scanEvents(rows *sql.Rows) ([]TaskEvent, error) {
+	defer func() { _ = rows.Close() }()
+
+	var out []TaskEvent
+	for rows.Next() {
+		var (
+			e        TaskEvent
+			task, at string
+		)
+		if err := rows.Scan(&e.ID, &e.WorkspaceID, &e.Type, &task, &at); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(task), &e.Task); err != nil {
+			return nil, err
+		}
+		if ts, err := time.Parse(time.RFC3339Nano, at); err == nil {
+			e.At = ts
+		}
+		out = append(out, e)
+	}
+	return out, rows.Err()
+}
+
+func (r *SQLiteRepo) LastEventID(ctx context.Context, s Scope) (int64, error) {
+	var id int64
+	err := r.db.QueryRowContext(ctx, `
+		SELECT COALESCE(MAX(id), 0) FROM task_events WHERE workspace_id = ?
+	`, s.workspace()).Scan(&id)
+	return id, err
+}
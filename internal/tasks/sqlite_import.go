@@ -0,0 +1,121 @@
+package tasks
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+)
+
+// Import implements Repository.Import in a single transaction; a dry run
+// rolls it back.
+func (r *SQLiteRepo) Import(ctx context.Context, s Scope, rows []ImportRow, strategy ImportStrategy, dryRun bool) ([]ImportOutcome, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	now := time.Now().UTC()
+	out := make([]ImportOutcome, len(rows))
+	for i, row := range rows {
+		id, found, err := importConflict(ctx, tx, s, row)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case found && strategy == ImportSkip:
+			out[i] = ImportOutcome{Action: "skipped", ID: id}
+			continue
+		case found && strategy == ImportOverwrite:
+			if err := patchTask(ctx, tx, s, id, row.Patch, now); err != nil {
+				return nil, err
+			}
+			if err := touchFields(ctx, tx, id, patchFields(row.Patch), now); err != nil {
+				return nil, err
+			}
+			out[i] = ImportOutcome{Action: "updated", ID: id}
+			continue
+		case found:
+			// a duplicate cannot share the calendar UID
+			row.Input.ICalUID = ""
+		}
+
+		if row.Input.Title == "" {
+			return nil, ErrTitleRequired
+		}
+		if p := row.ParentRow; p != nil {
+			if *p < 0 || *p >= i {
+				return nil, ErrNotFound
+			}
+			parent := out[*p].ID
+			row.Input.ParentID = &parent
+		}
+		t, err := insertTask(ctx, tx, s, row.Input, now)
+		if isUniqueViolation(err) {
+			// the UID belongs to a task the scope cannot see
+			return nil, ErrConflict
+		}
+		if err != nil {
+			return nil, err
+		}
+		if row.Done {
+			if err := patchTask(ctx, tx, s, t.ID, TaskPatch{Done: &row.Done}, now); err != nil {
+				return nil, err
+			}
+		}
+		out[i] = ImportOutcome{Action: "created", ID: t.ID}
+	}
+
+	if dryRun {
+		for i := range out {
+			if out[i].Action == "created" {
+				out[i].ID = 0
+			}
+		}
+		return out, nil
+	}
+	for _, o := range out {
+		typ := EventUpdated
+		switch o.Action {
+		case "created":
+			typ = EventCreated
+		case "updated":
+		default:
+			continue
+		}
+		t, err := queryTask(ctx, tx, Scope{WorkspaceID: s.WorkspaceID}, o.ID)
+		if err != nil {
+			return nil, err
+		}
+		if err := writeOutbox(ctx, tx, s, typ, now, t); err != nil {
+			return nil, err
+		}
+	}
+	if err := r.commit(tx); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// importConflict finds the task in scope that row names by id or else by
+// calendar UID.
+func importConflict(ctx context.Context, tx *sql.Tx, s Scope, row ImportRow) (int64, bool, error) {
+	var id int64
+	if row.ID != nil {
+		where := taskWhere(s, *row.ID)
+		err := tx.QueryRowContext(ctx, `SELECT t.id FROM tasks t WHERE `+where.sql, where.args...).Scan(&id)
+		if err != sql.ErrNoRows {
+			return id, err == nil, err
+		}
+	}
+	if row.Input.ICalUID != "" {
+		conds, args := scopeWhere(s)
+		conds, args = append(conds, "t.ical_uid = ?"), append(args, row.Input.ICalUID)
+		err := tx.QueryRowContext(ctx, `SELECT t.id FROM tasks t WHERE `+strings.Join(conds, " AND "), args...).Scan(&id)
+		if err != sql.ErrNoRows {
+			return id, err == nil, err
+		}
+	}
+	return 0, false, nil
+}
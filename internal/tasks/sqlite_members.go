@@ -0,0 +1,103 @@
+package tasks
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+func (r *SQLiteRepo) ProjectRole(ctx context.Context, s Scope, projectID int64) (Role, error) {
+	where, args := projectWhere(s, projectID)
+	if err := r.db.QueryRowContext(ctx, `SELECT p.id FROM projects p `+where, args...).Scan(new(int64)); err != nil {
+		if err == sql.ErrNoRows {
+			return "", ErrNotFound
+		}
+		return "", err
+	}
+	if !s.restricted() {
+		return RoleOwner, nil
+	}
+	var role Role
+	err := r.db.QueryRowContext(ctx, `
+		SELECT role FROM project_members WHERE project_id = ? AND user_id = ?
+	`, projectID, s.UserID).Scan(&role)
+	if err == sql.ErrNoRows {
+		return "", ErrNotFound
+	}
+	return role, err
+}
+
+func (r *SQLiteRepo) AddProjectMember(ctx context.Context, s Scope, projectID, userID int64, role Role) (Member, error) {
+	now := time.Now().UTC()
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return Member{}, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	where, args := projectWhere(s, projectID)
+	if err := tx.QueryRowContext(ctx, `SELECT p.id FROM projects p `+where, args...).Scan(new(int64)); err != nil {
+		if err == sql.ErrNoRows {
+			return Member{}, ErrNotFound
+		}
+		return Member{}, err
+	}
+	m := Member{UserID: userID, Role: role, CreatedAt: now}
+	err = tx.QueryRowContext(ctx, `
+		SELECT name FROM users WHERE id = ? AND workspace_id = ?
+	`, userID, s.workspace()).Scan(&m.Name)
+	if err == sql.ErrNoRows {
+		return Member{}, ErrNotFound
+	}
+	if err != nil {
+		return Member{}, err
+	}
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO project_members (project_id, user_id, role, created_at) VALUES (?, ?, ?, ?)
+	`, projectID, userID, role, now.Format(time.RFC3339Nano))
+	if isUniqueViolation(err) {
+		return Member{}, ErrConflict
+	}
+	if err != nil {
+		return Member{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return Member{}, err
+	}
+	return m, nil
+}
+
+func (r *SQLiteRepo) ListProjectMembers(ctx context.Context, s Scope, projectID int64) ([]Member, error) {
+	where, args := projectWhere(s, projectID)
+	if err := r.db.QueryRowContext(ctx, `SELECT p.id FROM projects p `+where, args...).Scan(new(int64)); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT m.user_id, u.name, m.role, m.created_at
+		FROM project_members m JOIN users u ON u.id = m.user_id
+		WHERE m.project_id = ?
+		ORDER BY m.user_id ASC
+	`, projectID)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	out := []Member{}
+	for rows.Next() {
+		var m Member
+		var created string
+		if err := rows.Scan(&m.UserID, &m.Name, &m.Role, &created); err != nil {
+			return nil, err
+		}
+		if ts, err := time.Parse(time.RFC3339Nano, created); err == nil {
+			m.CreatedAt = ts
+		}
+		out = append(out, m)
+	}
+	return out, rows.Err()
+}
@@ -0,0 +1,79 @@
+package tasks
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+)
+
+// writeOutbox records an event of type typ for each of ts in the outbox,
+// in the transaction of the change, so the change and its events are
+// committed together or not at all.
+func writeOutbox(ctx context.Context, tx *sql.Tx, s Scope, typ string, at time.Time, ts ...Task) error {
+	for _, t := range ts {
+		task, err := json.Marshal(t)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO outbox (workspace_id, type, task_id, task, at) VALUES (?, ?, ?, ?, ?)
+		`, s.workspace(), typ, t.ID, string(task), at.Format(time.RFC3339Nano)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// commit commits tx and wakes the relay of the outbox.
+func (r *SQLiteRepo) commit(tx *sql.Tx) error {
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	select {
+	case r.outboxReady <- struct{}{}:
+	default: // a wake-up is pending already
+	}
+	return nil
+}
+
+// PendingOutbox implements Outbox.PendingOutbox.
+func (r *SQLiteRepo) PendingOutbox(ctx context.Context, limit int) ([]TaskEvent, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT id, workspace_id, type, task, at FROM outbox
+		WHERE delivered_at IS NULL
+		ORDER BY id ASC
+		LIMIT ?
+	`, limit)
+	if err != nil {
+		return nil, err
+	}
+	return scanEvents(rows)
+}
+
+// MarkOutboxDelivered implements Outbox.MarkOutboxDelivered.
+func (r *SQLiteRepo) MarkOutboxDelivered(ctx context.Context, upToID int64) error {
+	now := time.Now().UTC()
+	_, err := r.db.ExecContext(ctx, `
+		UPDATE outbox SET delivered_at = ? WHERE delivered_at IS NULL AND id <= ?
+	`, formatTime(&now), upToID)
+	return err
+}
+
+// PruneOutbox implements Outbox.PruneOutbox. The latest event of each task
+// is kept whatever its age, as sync reads changes and tombstones from the
+// outbox (see Changes).
+func (r *SQLiteRepo) PruneOutbox(ctx context.Context, before time.Time) (int64, error) {
+	res, err := r.db.ExecContext(ctx, `
+		DELETE FROM outbox
+		WHERE delivered_at < ?
+			AND EXISTS (SELECT 1 FROM outbox n WHERE n.task_id = outbox.task_id AND n.id > outbox.id)
+	`, formatTime(&before))
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// OutboxReady implements Outbox.OutboxReady.
+func (r *SQLiteRepo) OutboxReady() <-chan struct{} { return r.outboxReady }
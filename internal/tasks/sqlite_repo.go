@@ -3,8 +3,11 @@ package tasks
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
+	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 	"time"
 
@@ -15,6 +18,8 @@ import (
 
 type SQLiteRepo struct {
 	db *sql.DB
+	// outboxReady has a value after events were written to the outbox.
+	outboxReady chan struct{}
 }
 
 func NewSQLiteRepo(dsn string) (*SQLiteRepo, error) {
@@ -31,21 +36,92 @@ func NewSQLiteRepo(dsn string) (*SQLiteRepo, error) {
 		_ = db.Close()
 		return nil, err
 	}
-	return &SQLiteRepo{db: db}, nil
+	return &SQLiteRepo{db: db, outboxReady: make(chan struct{}, 1)}, nil
 }
 
 func (r *SQLiteRepo) Close() error { return r.db.Close() }
 
 // Create implements Repository.Create with basic validation
-func (r *SQLiteRepo) Create(title string) (Task, error) {
-	if strings.TrimSpace(title) == "" {
+func (r *SQLiteRepo) Create(ctx context.Context, s Scope, in TaskInput) (Task, error) {
+	if strings.TrimSpace(in.Title) == "" {
 		return Task{}, ErrTitleRequired
 	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return Task{}, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
 	now := time.Now().UTC()
-	res, err := r.db.Exec(`
-		INSERT INTO tasks (title, done, created_at)
-		VALUES (?, 0, ?)
-	`, title, now.Format(time.RFC3339Nano))
+	t, err := insertTask(ctx, tx, s, in, now)
+	if err != nil {
+		return Task{}, err
+	}
+	if err := writeOutbox(ctx, tx, s, EventCreated, now, t); err != nil {
+		return Task{}, err
+	}
+	if err := r.commit(tx); err != nil {
+		return Task{}, err
+	}
+	return t, nil
+}
+
+// CreateTree implements Repository.CreateTree in a single transaction.
+func (r *SQLiteRepo) CreateTree(ctx context.Context, s Scope, root TaskTree) ([]Task, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	now := time.Now().UTC()
+	var out []Task
+	var create func(n TaskTree, parent *int64) error
+	create = func(n TaskTree, parent *int64) error {
+		if strings.TrimSpace(n.Title) == "" {
+			return ErrTitleRequired
+		}
+		in := n.TaskInput
+		if parent != nil {
+			in.ParentID = parent
+		}
+		t, err := insertTask(ctx, tx, s, in, now)
+		if err != nil {
+			return err
+		}
+		out = append(out, t)
+		for _, c := range n.Subtasks {
+			if err := create(c, &t.ID); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := create(root, nil); err != nil {
+		return nil, err
+	}
+	if err := writeOutbox(ctx, tx, s, EventCreated, now, out...); err != nil {
+		return nil, err
+	}
+	if err := r.commit(tx); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// insertTask writes a task row and its tags, checklist, field values and
+// assignees into the scope's workspace.
+func insertTask(ctx context.Context, tx *sql.Tx, s Scope, in TaskInput, now time.Time) (Task, error) {
+	if err := checkTaskRefs(ctx, tx, s, in); err != nil {
+		return Task{}, err
+	}
+	assignees := sortedIDs(in.AssigneeIDs)
+
+	res, err := tx.ExecContext(ctx, `
+		INSERT INTO tasks (workspace_id, title, done, project_id, parent_id, due_at, priority, assignee, owner_id, created_at, ical_uid)
+		VALUES (?, ?, 0, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, s.workspace(), in.Title, in.ProjectID, in.ParentID, formatTime(in.DueAt), in.Priority, nullString(in.Assignee), in.OwnerID, now.Format(time.RFC3339Nano), nullString(in.ICalUID))
 	if err != nil {
 		return Task{}, err
 	}
@@ -53,21 +129,461 @@ func (r *SQLiteRepo) Create(title string) (Task, error) {
 	if err != nil {
 		return Task{}, err
 	}
+	tags := sortedTags(in.Tags)
+	for _, tag := range tags {
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO task_tags (task_id, tag) VALUES (?, ?)
+		`, id, tag); err != nil {
+			return Task{}, err
+		}
+	}
+	for i, it := range in.Checklist {
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO checklist_items (task_id, position, text, done)
+			VALUES (?, ?, ?, ?)
+		`, id, i, it.Text, it.Done); err != nil {
+			return Task{}, err
+		}
+	}
+	for name, v := range in.Fields {
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO task_field_values (task_id, project_id, name, value)
+			VALUES (?, ?, ?, ?)
+		`, id, in.ProjectID, name, toSQLFieldValue(v)); err != nil {
+			return Task{}, err
+		}
+	}
+	for _, uid := range assignees {
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO task_assignees (task_id, user_id) VALUES (?, ?)
+		`, id, uid); err != nil {
+			return Task{}, err
+		}
+	}
+	return inputTask(id, in, now), nil
+}
+
+// inputTask is the task id created from in at now.
+func inputTask(id int64, in TaskInput, now time.Time) Task {
 	return Task{
-		ID:        id,
-		Title:     title,
-		Done:      false,
-		CreatedAt: now,
-	}, nil
+		ID:          id,
+		Title:       in.Title,
+		Done:        false,
+		ProjectID:   in.ProjectID,
+		ParentID:    in.ParentID,
+		Tags:        sortedTags(in.Tags),
+		Checklist:   slices.Clone(in.Checklist),
+		Fields:      cloneFields(in.Fields),
+		DueAt:       utcTime(in.DueAt),
+		Priority:    in.Priority,
+		Assignee:    in.Assignee,
+		AssigneeIDs: sortedIDs(in.AssigneeIDs),
+		OwnerID:     in.OwnerID,
+		CreatedAt:   now,
+		ICalUID:     in.ICalUID,
+	}
+}
+
+// checkTaskRefs reports ErrNotFound when in points at a project, parent or
+// assignee outside the scope's workspace.
+func checkTaskRefs(ctx context.Context, tx *sql.Tx, s Scope, in TaskInput) error {
+	if in.ProjectID != nil {
+		if err := tx.QueryRowContext(ctx, `SELECT id FROM projects WHERE id = ? AND workspace_id = ?`, *in.ProjectID, s.workspace()).Scan(new(int64)); err != nil {
+			if err == sql.ErrNoRows {
+				return ErrNotFound
+			}
+			return err
+		}
+	}
+	if in.ParentID != nil {
+		if err := tx.QueryRowContext(ctx, `SELECT id FROM tasks WHERE id = ? AND workspace_id = ?`, *in.ParentID, s.workspace()).Scan(new(int64)); err != nil {
+			if err == sql.ErrNoRows {
+				return ErrNotFound
+			}
+			return err
+		}
+	}
+	for _, uid := range in.AssigneeIDs {
+		if err := tx.QueryRowContext(ctx, `SELECT id FROM users WHERE id = ? AND workspace_id = ?`, uid, s.workspace()).Scan(new(int64)); err != nil {
+			if err == sql.ErrNoRows {
+				return ErrNotFound
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// Get implements Repository.Get
+func (r *SQLiteRepo) Get(ctx context.Context, s Scope, id int64) (Task, error) {
+	return queryTask(ctx, r.db, s, id)
+}
+
+func queryTask(ctx context.Context, db querier, s Scope, id int64) (Task, error) {
+	out, err := queryTasks(ctx, db, taskWhere(s, id), sqlFragment{sql: "t.id ASC"}, nil)
+	if err != nil {
+		return Task{}, err
+	}
+	if len(out) == 0 {
+		return Task{}, ErrNotFound
+	}
+	return out[0], nil
 }
 
 // List implements Repository.List
-func (r *SQLiteRepo) List() ([]Task, error) {
-	rows, err := r.db.Query(`
-		SELECT id, title, done, created_at
-		FROM tasks
-		ORDER BY id ASC
+func (r *SQLiteRepo) List(ctx context.Context, s Scope, q ListQuery) ([]Task, error) {
+	return queryTasks(ctx, r.db, listWhere(s, q), listOrder(q), q.Select)
+}
+
+// streamBatch is how many rows Stream reads before loading their children.
+const streamBatch = 100
+
+// Stream implements Repository.Stream. It reads the task rows from one
+// open cursor and loads the children of each batch of streamBatch tasks
+// by id, so memory stays bounded however many tasks match.
+func (r *SQLiteRepo) Stream(ctx context.Context, s Scope, q ListQuery, fn func(Task) error) error {
+	where, order := listWhere(s, q), listOrder(q)
+	names, cols := selectColumns(q.Select)
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT `+cols+`
+		FROM tasks t
+		WHERE `+where.sql+`
+		ORDER BY `+order.sql, slices.Concat(where.args, order.args)...)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = rows.Close() }()
+
+	batch := make([]Task, 0, streamBatch)
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		ids := sqlFragment{sql: "(?" + strings.Repeat(", ?", len(batch)-1) + ")"}
+		for _, t := range batch {
+			ids.args = append(ids.args, t.ID)
+		}
+		if err := loadChildren(ctx, r.db, batch, ids, q.Select); err != nil {
+			return err
+		}
+		for _, t := range batch {
+			if err := fn(t); err != nil {
+				return err
+			}
+		}
+		batch = batch[:0]
+		return nil
+	}
+	for rows.Next() {
+		t, err := scanTask(rows, names)
+		if err != nil {
+			return err
+		}
+		if batch = append(batch, t); len(batch) == streamBatch {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	return flush()
+}
+
+// Update implements Repository.Update in a single transaction.
+func (r *SQLiteRepo) Update(ctx context.Context, s Scope, id int64, p TaskPatch) (Task, error) {
+	if p.Title != nil && strings.TrimSpace(*p.Title) == "" {
+		return Task{}, ErrTitleRequired
+	}
+	now := time.Now().UTC()
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return Task{}, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if err := patchTask(ctx, tx, s, id, p, now); err != nil {
+		return Task{}, err
+	}
+	if err := touchFields(ctx, tx, id, patchFields(p), now); err != nil {
+		return Task{}, err
+	}
+	// as the workspace sees it, even if the change hid it from the caller
+	t, err := queryTask(ctx, tx, Scope{WorkspaceID: s.WorkspaceID}, id)
+	if err != nil {
+		return Task{}, err
+	}
+	if err := writeOutbox(ctx, tx, s, EventUpdated, now, t); err != nil {
+		return Task{}, err
+	}
+	if err := r.commit(tx); err != nil {
+		return Task{}, err
+	}
+	return t, nil
+}
+
+// Delete relies on ON DELETE CASCADE for subtasks and child rows. It reads
+// the task and its subtasks first, so the outbox events can carry them.
+func (r *SQLiteRepo) Delete(ctx context.Context, s Scope, id int64) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	where := taskWhere(s, id)
+	if err := tx.QueryRowContext(ctx, `SELECT t.id FROM tasks t WHERE `+where.sql, where.args...).Scan(new(int64)); err != nil {
+		if err == sql.ErrNoRows {
+			return ErrNotFound
+		}
+		return err
+	}
+	if err := deleteTask(ctx, tx, s, id); err != nil {
+		return err
+	}
+	return r.commit(tx)
+}
+
+// deleteTask deletes the task id with its subtasks and writes their
+// events to the outbox.
+func deleteTask(ctx context.Context, tx *sql.Tx, s Scope, id int64) error {
+	gone, err := querySubtree(ctx, tx, id)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM tasks WHERE id = ?`, id); err != nil {
+		return err
+	}
+	return writeOutbox(ctx, tx, s, EventDeleted, time.Now().UTC(), gone...)
+}
+
+// querySubtree reads the task id and its subtasks, parents first.
+func querySubtree(ctx context.Context, db querier, id int64) ([]Task, error) {
+	// subtasks are created after their parent, so id order lists parents first
+	return queryTasks(ctx, db, sqlFragment{sql: `t.id IN (
+		WITH RECURSIVE tree(id) AS (
+			SELECT ?
+			UNION ALL
+			SELECT c.id FROM tasks c JOIN tree ON c.parent_id = tree.id
+		)
+		SELECT id FROM tree
+	)`, args: []any{id}}, sqlFragment{sql: "t.id ASC"}, nil)
+}
+
+// patchTask applies p to the task id in scope, or reports ErrNotFound.
+func patchTask(ctx context.Context, tx *sql.Tx, s Scope, id int64, p TaskPatch, now time.Time) error {
+	where := taskWhere(s, id)
+	if err := tx.QueryRowContext(ctx, `SELECT t.id FROM tasks t WHERE `+where.sql, where.args...).Scan(new(int64)); err != nil {
+		if err == sql.ErrNoRows {
+			return ErrNotFound
+		}
+		return err
+	}
+
+	var sets []string
+	var args []any
+	if p.Title != nil {
+		sets, args = append(sets, "title = ?"), append(args, *p.Title)
+	}
+	if p.Done != nil {
+		// completed_at keeps the first completion until the task is reopened
+		sets = append(sets, "done = ?", "completed_at = CASE WHEN ? THEN COALESCE(completed_at, ?) END")
+		args = append(args, *p.Done, *p.Done, formatTime(&now))
+	}
+	if p.ClearDueAt {
+		sets = append(sets, "due_at = NULL")
+	} else if p.DueAt != nil {
+		sets, args = append(sets, "due_at = ?"), append(args, formatTime(p.DueAt))
+	}
+	if p.Priority != nil {
+		sets, args = append(sets, "priority = ?"), append(args, *p.Priority)
+	}
+	if p.Assignee != nil {
+		sets, args = append(sets, "assignee = ?"), append(args, nullString(*p.Assignee))
+	}
+	if len(sets) > 0 {
+		if _, err := tx.ExecContext(ctx, `UPDATE tasks SET `+strings.Join(sets, ", ")+` WHERE id = ?`, append(args, id)...); err != nil {
+			return err
+		}
+	}
+	if p.AssigneeID != 0 {
+		if _, err := tx.ExecContext(ctx, `
+			INSERT OR IGNORE INTO task_assignees (task_id, user_id) VALUES (?, ?)
+		`, id, p.AssigneeID); err != nil {
+			return err
+		}
+	}
+	if p.Tags != nil {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM task_tags WHERE task_id = ?`, id); err != nil {
+			return err
+		}
+		for _, tag := range sortedTags(*p.Tags) {
+			if _, err := tx.ExecContext(ctx, `INSERT INTO task_tags (task_id, tag) VALUES (?, ?)`, id, tag); err != nil {
+				return err
+			}
+		}
+	}
+	if p.Checklist != nil {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM checklist_items WHERE task_id = ?`, id); err != nil {
+			return err
+		}
+		for i, it := range *p.Checklist {
+			if _, err := tx.ExecContext(ctx, `
+				INSERT INTO checklist_items (task_id, position, text, done)
+				VALUES (?, ?, ?, ?)
+			`, id, i, it.Text, it.Done); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Assign implements Repository.Assign
+func (r *SQLiteRepo) Assign(ctx context.Context, s Scope, taskID, userID int64) (Task, error) {
+	return r.setAssigned(ctx, s, taskID, userID, `
+		INSERT INTO task_assignees (task_id, user_id) VALUES (?, ?) ON CONFLICT DO NOTHING
 	`)
+}
+
+// Unassign implements Repository.Unassign
+func (r *SQLiteRepo) Unassign(ctx context.Context, s Scope, taskID, userID int64) (Task, error) {
+	return r.setAssigned(ctx, s, taskID, userID, `
+		DELETE FROM task_assignees WHERE task_id = ? AND user_id = ?
+	`)
+}
+
+// setAssigned runs stmt with the task and user id once both are known to
+// be in scope.
+func (r *SQLiteRepo) setAssigned(ctx context.Context, s Scope, taskID, userID int64, stmt string) (Task, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return Task{}, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	where := taskWhere(s, taskID)
+	if err := tx.QueryRowContext(ctx, `SELECT t.id FROM tasks t WHERE `+where.sql, where.args...).Scan(new(int64)); err != nil {
+		if err == sql.ErrNoRows {
+			return Task{}, ErrNotFound
+		}
+		return Task{}, err
+	}
+	if err := tx.QueryRowContext(ctx, `SELECT id FROM users WHERE id = ? AND workspace_id = ?`, userID, s.workspace()).Scan(new(int64)); err != nil {
+		if err == sql.ErrNoRows {
+			return Task{}, ErrNotFound
+		}
+		return Task{}, err
+	}
+	if _, err := tx.ExecContext(ctx, stmt, taskID, userID); err != nil {
+		return Task{}, err
+	}
+	// as the workspace sees it, even if the change hid it from the caller
+	t, err := queryTask(ctx, tx, Scope{WorkspaceID: s.WorkspaceID}, taskID)
+	if err != nil {
+		return Task{}, err
+	}
+	if err := writeOutbox(ctx, tx, s, EventUpdated, time.Now().UTC(), t); err != nil {
+		return Task{}, err
+	}
+	if err := r.commit(tx); err != nil {
+		return Task{}, err
+	}
+	return t, nil
+}
+
+// taskColumns are the columns behind Task's scalar attributes, keyed by
+// their JSON names.
+var taskColumns = []struct{ name, col string }{
+	{"id", "t.id"},
+	{"title", "t.title"},
+	{"done", "t.done"},
+	{"project_id", "t.project_id"},
+	{"parent_id", "t.parent_id"},
+	{"due_at", "t.due_at"},
+	{"priority", "t.priority"},
+	{"assignee", "t.assignee"},
+	{"owner_id", "t.owner_id"},
+	{"created_at", "t.created_at"},
+	{"completed_at", "t.completed_at"},
+	{"ical_uid", "t.ical_uid"},
+}
+
+// selects reports whether the attribute name is in sel; nil selects all.
+func selects(sel []string, name string) bool {
+	return sel == nil || slices.Contains(sel, name)
+}
+
+// selectColumns returns the JSON names and the SELECT list of the columns
+// sel needs. The id is always loaded.
+func selectColumns(sel []string) ([]string, string) {
+	var names, cols []string
+	for _, c := range taskColumns {
+		if c.name == "id" || selects(sel, c.name) {
+			names, cols = append(names, c.name), append(cols, c.col)
+		}
+	}
+	return names, strings.Join(cols, ", ")
+}
+
+// scanTask reads a row of the columns named by selectColumns.
+func scanTask(rows *sql.Rows, names []string) (Task, error) {
+	var t Task
+	var created, due, assignee, completed, uid sql.NullString
+	dests := make([]any, len(names))
+	for i, name := range names {
+		switch name {
+		case "id":
+			dests[i] = &t.ID
+		case "title":
+			dests[i] = &t.Title
+		case "done":
+			dests[i] = &t.Done
+		case "project_id":
+			dests[i] = &t.ProjectID
+		case "parent_id":
+			dests[i] = &t.ParentID
+		case "due_at":
+			dests[i] = &due
+		case "priority":
+			dests[i] = &t.Priority
+		case "assignee":
+			dests[i] = &assignee
+		case "owner_id":
+			dests[i] = &t.OwnerID
+		case "created_at":
+			dests[i] = &created
+		case "completed_at":
+			dests[i] = &completed
+		case "ical_uid":
+			dests[i] = &uid
+		}
+	}
+	if err := rows.Scan(dests...); err != nil {
+		return Task{}, err
+	}
+	if ts, err := time.Parse(time.RFC3339Nano, created.String); err == nil {
+		t.CreatedAt = ts
+	}
+	t.DueAt = parseNullTime(due)
+	t.CompletedAt = parseNullTime(completed)
+	t.Assignee = assignee.String
+	t.ICalUID = uid.String
+	return t, nil
+}
+
+// queryTasks loads the tasks matching where, then their tags, checklist
+// items, custom field values and assignees with one query each. Only the
+// attributes in sel are loaded; nil loads all of them.
+func queryTasks(ctx context.Context, db querier, where, order sqlFragment, sel []string) ([]Task, error) {
+	names, cols := selectColumns(sel)
+	rows, err := db.QueryContext(ctx, `
+		SELECT `+cols+`
+		FROM tasks t
+		WHERE `+where.sql+`
+		ORDER BY `+order.sql, slices.Concat(where.args, order.args)...)
 	if err != nil {
 		return nil, err
 	}
@@ -75,33 +591,884 @@ func (r *SQLiteRepo) List() ([]Task, error) {
 
 	var out []Task
 	for rows.Next() {
-		var t Task
+		t, err := scanTask(rows, names)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(out) == 0 {
+		return out, nil
+	}
+
+	// the same page of ids, so child rows of other tasks are not loaded
+	ids := sqlFragment{
+		sql:  `(SELECT t.id FROM tasks t WHERE ` + where.sql + ` ORDER BY ` + order.sql + `)`,
+		args: slices.Concat(where.args, order.args),
+	}
+	if err := loadChildren(ctx, db, out, ids, sel); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// loadChildren fills in the tags, checklist items, custom field values and
+// assignees in sel of the tasks selected by ids, with one query each.
+func loadChildren(ctx context.Context, db querier, out []Task, ids sqlFragment, sel []string) error {
+	index := make(map[int64]int, len(out))
+	for i, t := range out {
+		index[t.ID] = i
+	}
+	if selects(sel, "tags") {
+		err := eachRow(ctx, db, `
+			SELECT task_id, tag FROM task_tags
+			WHERE task_id IN `+ids.sql+`
+			ORDER BY task_id, tag
+		`, ids.args, func(rows *sql.Rows) error {
+			var id int64
+			var tag string
+			if err := rows.Scan(&id, &tag); err != nil {
+				return err
+			}
+			if i, ok := index[id]; ok {
+				out[i].Tags = append(out[i].Tags, tag)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if selects(sel, "checklist") {
+		err := eachRow(ctx, db, `
+			SELECT task_id, text, done FROM checklist_items
+			WHERE task_id IN `+ids.sql+`
+			ORDER BY task_id, position
+		`, ids.args, func(rows *sql.Rows) error {
+			var id int64
+			var it ChecklistItem
+			if err := rows.Scan(&id, &it.Text, &it.Done); err != nil {
+				return err
+			}
+			if i, ok := index[id]; ok {
+				out[i].Checklist = append(out[i].Checklist, it)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if selects(sel, "fields") {
+		err := eachRow(ctx, db, `
+			SELECT v.task_id, v.name, v.value, f.type
+			FROM task_field_values v
+			JOIN project_fields f ON f.project_id = v.project_id AND f.name = v.name
+			WHERE v.task_id IN `+ids.sql+`
+		`, ids.args, func(rows *sql.Rows) error {
+			var (
+				id   int64
+				name string
+				raw  any
+				typ  FieldType
+			)
+			if err := rows.Scan(&id, &name, &raw, &typ); err != nil {
+				return err
+			}
+			i, ok := index[id]
+			if !ok {
+				return nil
+			}
+			if out[i].Fields == nil {
+				out[i].Fields = make(map[string]any)
+			}
+			out[i].Fields[name] = fromSQLFieldValue(typ, raw)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if selects(sel, "assignee_ids") {
+		err := eachRow(ctx, db, `
+			SELECT task_id, user_id FROM task_assignees
+			WHERE task_id IN `+ids.sql+`
+			ORDER BY task_id, user_id
+		`, ids.args, func(rows *sql.Rows) error {
+			var id, uid int64
+			if err := rows.Scan(&id, &uid); err != nil {
+				return err
+			}
+			if i, ok := index[id]; ok {
+				out[i].AssigneeIDs = append(out[i].AssigneeIDs, uid)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// querier runs queries on the database or in a transaction, which sees
+// its own changes.
+type querier interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+}
+
+func eachRow(ctx context.Context, db querier, query string, args []any, fn func(*sql.Rows) error) error {
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = rows.Close() }()
+	for rows.Next() {
+		if err := fn(rows); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// scopeWhere returns the conditions restricting tasks t to scope s.
+func scopeWhere(s Scope) ([]string, []any) {
+	conds, args := []string{"t.workspace_id = ?"}, []any{s.workspace()}
+	if s.restricted() {
+		conds = append(conds, `(t.owner_id = ?
+			OR t.id IN (SELECT task_id FROM task_assignees WHERE user_id = ?)
+			OR t.project_id IN (SELECT project_id FROM project_members WHERE user_id = ?))`)
+		args = append(args, s.UserID, s.UserID, s.UserID)
+	}
+	return conds, args
+}
+
+func taskWhere(s Scope, id int64) sqlFragment {
+	conds, args := scopeWhere(s)
+	conds = append(conds, "t.id = ?")
+	args = append(args, id)
+	return sqlFragment{sql: strings.Join(conds, " AND "), args: args}
+}
+
+func listWhere(s Scope, q ListQuery) sqlFragment {
+	conds, args := scopeWhere(s)
+	if q.ProjectID != nil {
+		conds = append(conds, "t.project_id = ?")
+		args = append(args, *q.ProjectID)
+	}
+	if q.ParentID != nil {
+		conds = append(conds, "t.parent_id = ?")
+		args = append(args, *q.ParentID)
+	}
+	if q.Done != nil {
+		conds = append(conds, "t.done = ?")
+		args = append(args, *q.Done)
+	}
+	for _, in := range []struct {
+		col string
+		ids []int64
+	}{{"t.id", q.IDs}, {"t.project_id", q.ProjectIDs}, {"t.parent_id", q.ParentIDs}} {
+		if in.ids == nil {
+			continue
+		}
+		if len(in.ids) == 0 {
+			conds = append(conds, "0")
+			continue
+		}
+		conds = append(conds, in.col+" IN (?"+strings.Repeat(", ?", len(in.ids)-1)+")")
+		for _, id := range in.ids {
+			args = append(args, id)
+		}
+	}
+	if q.AfterID > 0 {
+		conds = append(conds, "t.id > ?")
+		args = append(args, q.AfterID)
+	}
+	if q.Tag != "" {
+		conds = append(conds, "EXISTS (SELECT 1 FROM task_tags tg WHERE tg.task_id = t.id AND tg.tag = ?)")
+		args = append(args, q.Tag)
+	}
+	if q.ICalUID != "" {
+		conds = append(conds, "t.ical_uid = ?")
+		args = append(args, q.ICalUID)
+	}
+	if q.AssigneeID != nil {
+		conds = append(conds, "EXISTS (SELECT 1 FROM task_assignees a WHERE a.task_id = t.id AND a.user_id = ?)")
+		args = append(args, *q.AssigneeID)
+	}
+	if q.InvolvedUserID != nil {
+		conds = append(conds, "(t.owner_id = ? OR EXISTS (SELECT 1 FROM task_assignees a WHERE a.task_id = t.id AND a.user_id = ?))")
+		args = append(args, *q.InvolvedUserID, *q.InvolvedUserID)
+	}
+	for _, f := range q.Fields {
+		op := filterOps[f.Op]
+		if f.Op == "ne" {
+			// a missing value counts as "not equal"
+			conds = append(conds, `NOT EXISTS (SELECT 1 FROM task_field_values v
+				WHERE v.task_id = t.id AND v.name = ? AND v.value = ?)`)
+		} else {
+			conds = append(conds, `EXISTS (SELECT 1 FROM task_field_values v
+				WHERE v.task_id = t.id AND v.name = ? AND v.value `+op+` ?)`)
+		}
+		args = append(args, f.Name, toSQLFieldValue(f.Value))
+	}
+	return sqlFragment{sql: strings.Join(conds, " AND "), args: args}
+}
+
+type sqlFragment struct {
+	sql  string
+	args []any
+}
+
+// listOrder returns the ORDER BY clause for q, followed by its LIMIT and
+// OFFSET when it is paged.
+func listOrder(q ListQuery) sqlFragment {
+	var parts []string
+	var args []any
+	for _, k := range q.Sort {
+		dir := " ASC"
+		if k.Desc {
+			dir = " DESC"
+		}
+		switch {
+		case k.Field != "":
+			parts = append(parts, `(SELECT v.value FROM task_field_values v
+				WHERE v.task_id = t.id AND v.name = ?)`+dir)
+			args = append(args, k.Field)
+		case k.Column == "title", k.Column == "created_at", k.Column == "id",
+			k.Column == "due_at", k.Column == "priority":
+			parts = append(parts, "t."+k.Column+dir)
+		}
+	}
+	parts = append(parts, "t.id ASC")
+	order := strings.Join(parts, ", ")
+	if q.Limit > 0 || q.Offset > 0 {
+		limit := q.Limit
+		if limit == 0 {
+			limit = -1 // SQLite has no OFFSET without LIMIT
+		}
+		order += " LIMIT ? OFFSET ?"
+		args = append(args, limit, q.Offset)
+	}
+	return sqlFragment{sql: order, args: args}
+}
+
+func (r *SQLiteRepo) CreateProject(ctx context.Context, s Scope, name string, fields []FieldDef) (Project, error) {
+	now := time.Now().UTC()
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return Project{}, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	res, err := tx.ExecContext(ctx, `
+		INSERT INTO projects (workspace_id, name, created_at) VALUES (?, ?, ?)
+	`, s.workspace(), name, now.Format(time.RFC3339Nano))
+	if err != nil {
+		return Project{}, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return Project{}, err
+	}
+	if err := upsertProjectFields(ctx, tx, id, fields); err != nil {
+		return Project{}, err
+	}
+	if s.UserID != 0 {
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO project_members (project_id, user_id, role, created_at) VALUES (?, ?, ?, ?)
+		`, id, s.UserID, RoleOwner, now.Format(time.RFC3339Nano)); err != nil {
+			return Project{}, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return Project{}, err
+	}
+	p := Project{ID: id, Name: name, Fields: fields, CreatedAt: now}
+	if p.Fields == nil {
+		p.Fields = []FieldDef{}
+	}
+	return p, nil
+}
+
+func (r *SQLiteRepo) GetProject(ctx context.Context, s Scope, id int64) (Project, error) {
+	where, args := projectWhere(s, id)
+	ps, err := r.queryProjects(ctx, where, args...)
+	if err != nil {
+		return Project{}, err
+	}
+	if len(ps) == 0 {
+		return Project{}, ErrNotFound
+	}
+	return ps[0], nil
+}
+
+func (r *SQLiteRepo) ListProjects(ctx context.Context, s Scope) ([]Project, error) {
+	where, args := projectWhere(s, 0)
+	return r.queryProjects(ctx, where, args...)
+}
+
+// projectWhere restricts projects p to those visible in s and, when id is
+// not zero, to that project.
+func projectWhere(s Scope, id int64) (string, []any) {
+	where, args := `WHERE p.workspace_id = ?`, []any{s.workspace()}
+	if s.restricted() {
+		where += ` AND p.id IN (SELECT project_id FROM project_members WHERE user_id = ?)`
+		args = append(args, s.UserID)
+	}
+	if id != 0 {
+		where += ` AND p.id = ?`
+		args = append(args, id)
+	}
+	return where, args
+}
+
+func (r *SQLiteRepo) SetProjectFields(ctx context.Context, s Scope, id int64, fields []FieldDef) (Project, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return Project{}, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	where, args := projectWhere(s, id)
+	if err := tx.QueryRowContext(ctx, `SELECT p.id FROM projects p `+where, args...).Scan(new(int64)); err != nil {
+		if err == sql.ErrNoRows {
+			return Project{}, ErrNotFound
+		}
+		return Project{}, err
+	}
+
+	old, err := queryFieldDefs(ctx, tx, id)
+	if err != nil {
+		return Project{}, err
+	}
+	keep := make([]any, 0, len(fields)+1)
+	keep = append(keep, id)
+	marks := make([]string, 0, len(fields))
+	for _, f := range fields {
+		keep = append(keep, f.Name)
+		marks = append(marks, "?")
+	}
+	del := `DELETE FROM project_fields WHERE project_id = ?`
+	if len(marks) > 0 {
+		del += ` AND name NOT IN (` + strings.Join(marks, ",") + `)`
+	}
+	// values of dropped fields go with them via ON DELETE CASCADE
+	if _, err := tx.ExecContext(ctx, del, keep...); err != nil {
+		return Project{}, err
+	}
+	if err := upsertProjectFields(ctx, tx, id, fields); err != nil {
+		return Project{}, err
+	}
+	for _, f := range fields {
+		o, ok := findField(old, f.Name)
+		if !ok || (o.Type == f.Type && slices.Equal(o.Options, f.Options)) {
+			continue
+		}
+		if err := convertFieldValues(ctx, tx, id, o, f); err != nil {
+			return Project{}, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return Project{}, err
+	}
+	return r.GetProject(ctx, s, id)
+}
+
+// convertFieldValues carries the stored values of a field over from its
+// definition from to to, deleting those that do not fit.
+func convertFieldValues(ctx context.Context, tx *sql.Tx, projectID int64, from, to FieldDef) error {
+	values := make(map[int64]any)
+	err := eachRow(ctx, tx, `
+		SELECT task_id, value FROM task_field_values WHERE project_id = ? AND name = ?
+	`, []any{projectID, from.Name}, func(rows *sql.Rows) error {
+		var (
+			id  int64
+			raw any
+		)
+		if err := rows.Scan(&id, &raw); err != nil {
+			return err
+		}
+		values[id] = fromSQLFieldValue(from.Type, raw)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for id, v := range values {
+		var err error
+		if v, ok := convertFieldValue(to, v); ok {
+			_, err = tx.ExecContext(ctx, `
+				UPDATE task_field_values SET value = ? WHERE task_id = ? AND name = ?
+			`, toSQLFieldValue(v), id, to.Name)
+		} else {
+			_, err = tx.ExecContext(ctx, `
+				DELETE FROM task_field_values WHERE task_id = ? AND name = ?
+			`, id, to.Name)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// queryFieldDefs reads the field definitions of a project in order.
+func queryFieldDefs(ctx context.Context, db querier, projectID int64) ([]FieldDef, error) {
+	var out []FieldDef
+	err := eachRow(ctx, db, `
+		SELECT name, type, options, required FROM project_fields
+		WHERE project_id = ?
+		ORDER BY position
+	`, []any{projectID}, func(rows *sql.Rows) error {
+		var (
+			f    FieldDef
+			opts string
+		)
+		if err := rows.Scan(&f.Name, &f.Type, &opts, &f.Required); err != nil {
+			return err
+		}
+		if err := json.Unmarshal([]byte(opts), &f.Options); err != nil {
+			return fmt.Errorf("project %d field %s: %w", projectID, f.Name, err)
+		}
+		out = append(out, f)
+		return nil
+	})
+	return out, err
+}
+
+func upsertProjectFields(ctx context.Context, tx *sql.Tx, projectID int64, fields []FieldDef) error {
+	for i, f := range fields {
+		opts, err := json.Marshal(f.Options)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO project_fields (project_id, name, type, options, required, position)
+			VALUES (?, ?, ?, ?, ?, ?)
+			ON CONFLICT (project_id, name) DO UPDATE SET
+				type = excluded.type,
+				options = excluded.options,
+				required = excluded.required,
+				position = excluded.position
+		`, projectID, f.Name, string(f.Type), string(opts), f.Required, i); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *SQLiteRepo) queryProjects(ctx context.Context, where string, args ...any) ([]Project, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT p.id, p.name, p.created_at
+		FROM projects p `+where+`
+		ORDER BY p.id ASC
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	out := []Project{}
+	index := make(map[int64]int)
+	for rows.Next() {
+		p := Project{Fields: []FieldDef{}}
 		var created string
-		if err := rows.Scan(&t.ID, &t.Title, &t.Done, &created); err != nil {
+		if err := rows.Scan(&p.ID, &p.Name, &created); err != nil {
 			return nil, err
 		}
 		if ts, err := time.Parse(time.RFC3339Nano, created); err == nil {
-			t.CreatedAt = ts
+			p.CreatedAt = ts
 		}
-		out = append(out, t)
+		index[p.ID] = len(out)
+		out = append(out, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	frows, err := r.db.QueryContext(ctx, `
+		SELECT f.project_id, f.name, f.type, f.options, f.required
+		FROM project_fields f
+		WHERE f.project_id IN (SELECT p.id FROM projects p `+where+`)
+		ORDER BY f.project_id, f.position
+	`, args...)
+	if err != nil {
+		return nil, err
 	}
-	return out, rows.Err()
+	defer func() { _ = frows.Close() }()
+	for frows.Next() {
+		var (
+			pid  int64
+			f    FieldDef
+			opts string
+		)
+		if err := frows.Scan(&pid, &f.Name, &f.Type, &opts, &f.Required); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(opts), &f.Options); err != nil {
+			return nil, fmt.Errorf("project %d field %s: %w", pid, f.Name, err)
+		}
+		if i, ok := index[pid]; ok {
+			out[i].Fields = append(out[i].Fields, f)
+		}
+	}
+	return out, frows.Err()
 }
 
-// ApplyMigrations ensures schema exists
-func (r *SQLiteRepo) ApplyMigrations(ctx context.Context) error {
-	_, err := r.db.ExecContext(ctx, `
+// migrations are applied in order; PRAGMA user_version records how many
+// have run. Never edit an entry once released, append a new one instead.
+var migrations = []string{
+	`
 CREATE TABLE IF NOT EXISTS tasks (
 	id INTEGER PRIMARY KEY AUTOINCREMENT,
 	title TEXT NOT NULL,
 	done INTEGER NOT NULL DEFAULT 0,
 	created_at TEXT NOT NULL
 );
-	`)
-	return err
+	`,
+	`
+CREATE TABLE projects (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	name TEXT NOT NULL,
+	created_at TEXT NOT NULL
+);
+CREATE TABLE project_fields (
+	project_id INTEGER NOT NULL REFERENCES projects(id) ON DELETE CASCADE,
+	name TEXT NOT NULL,
+	type TEXT NOT NULL,
+	options TEXT NOT NULL DEFAULT 'null',
+	required INTEGER NOT NULL DEFAULT 0,
+	position INTEGER NOT NULL DEFAULT 0,
+	PRIMARY KEY (project_id, name)
+);
+ALTER TABLE tasks ADD COLUMN project_id INTEGER REFERENCES projects(id) ON DELETE SET NULL;
+CREATE INDEX idx_tasks_project ON tasks(project_id);
+CREATE TABLE task_field_values (
+	task_id INTEGER NOT NULL REFERENCES tasks(id) ON DELETE CASCADE,
+	project_id INTEGER NOT NULL,
+	name TEXT NOT NULL,
+	value,
+	PRIMARY KEY (task_id, name),
+	FOREIGN KEY (project_id, name) REFERENCES project_fields(project_id, name) ON DELETE CASCADE
+);
+CREATE INDEX idx_task_field_values_name ON task_field_values(name, value);
+	`,
+	`
+ALTER TABLE tasks ADD COLUMN parent_id INTEGER REFERENCES tasks(id) ON DELETE CASCADE;
+CREATE INDEX idx_tasks_parent ON tasks(parent_id);
+CREATE TABLE task_tags (
+	task_id INTEGER NOT NULL REFERENCES tasks(id) ON DELETE CASCADE,
+	tag TEXT NOT NULL,
+	PRIMARY KEY (task_id, tag)
+);
+CREATE INDEX idx_task_tags_tag ON task_tags(tag);
+CREATE TABLE checklist_items (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	task_id INTEGER NOT NULL REFERENCES tasks(id) ON DELETE CASCADE,
+	position INTEGER NOT NULL,
+	text TEXT NOT NULL,
+	done INTEGER NOT NULL DEFAULT 0
+);
+CREATE INDEX idx_checklist_items_task ON checklist_items(task_id, position);
+CREATE TABLE templates (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	name TEXT NOT NULL,
+	spec TEXT NOT NULL,
+	created_at TEXT NOT NULL
+);
+	`,
+	`
+ALTER TABLE tasks ADD COLUMN due_at TEXT;
+ALTER TABLE tasks ADD COLUMN priority INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE tasks ADD COLUMN assignee TEXT;
+CREATE INDEX idx_tasks_due ON tasks(due_at);
+	`,
+	`
+CREATE TABLE users (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	name TEXT NOT NULL UNIQUE,
+	admin INTEGER NOT NULL DEFAULT 0,
+	token_hash TEXT NOT NULL UNIQUE,
+	created_at TEXT NOT NULL
+);
+ALTER TABLE tasks ADD COLUMN owner_id INTEGER REFERENCES users(id) ON DELETE SET NULL;
+CREATE INDEX idx_tasks_owner ON tasks(owner_id);
+	`,
+	`
+CREATE TABLE workspaces (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	name TEXT NOT NULL,
+	created_at TEXT NOT NULL
+);
+INSERT INTO workspaces (id, name, created_at) VALUES (1, 'default', strftime('%Y-%m-%dT%H:%M:%fZ', 'now'));
+ALTER TABLE tasks ADD COLUMN workspace_id INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE projects ADD COLUMN workspace_id INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE templates ADD COLUMN workspace_id INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE users ADD COLUMN workspace_id INTEGER NOT NULL DEFAULT 1;
+CREATE INDEX idx_tasks_workspace ON tasks(workspace_id, id);
+CREATE INDEX idx_projects_workspace ON projects(workspace_id);
+CREATE INDEX idx_templates_workspace ON templates(workspace_id);
+CREATE INDEX idx_users_workspace ON users(workspace_id);
+	`,
+	`
+CREATE TABLE project_members (
+	project_id INTEGER NOT NULL REFERENCES projects(id) ON DELETE CASCADE,
+	user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	role TEXT NOT NULL,
+	created_at TEXT NOT NULL,
+	PRIMARY KEY (project_id, user_id)
+);
+CREATE INDEX idx_project_members_user ON project_members(user_id, project_id);
+	`,
+	`
+CREATE TABLE task_assignees (
+	task_id INTEGER NOT NULL REFERENCES tasks(id) ON DELETE CASCADE,
+	user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	PRIMARY KEY (task_id, user_id)
+);
+CREATE INDEX idx_task_assignees_user ON task_assignees(user_id, task_id);
+	`,
+	`
+ALTER TABLE tasks ADD COLUMN completed_at TEXT;
+CREATE INDEX idx_tasks_workspace_completed ON tasks(workspace_id, completed_at);
+	`,
+	`
+CREATE TABLE views (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	workspace_id INTEGER NOT NULL REFERENCES workspaces(id),
+	owner_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
+	project_id INTEGER REFERENCES projects(id) ON DELETE CASCADE,
+	name TEXT NOT NULL,
+	query TEXT NOT NULL,
+	created_at TEXT NOT NULL
+);
+CREATE INDEX idx_views_workspace ON views(workspace_id);
+	`,
+	`
+ALTER TABLE users ADD COLUMN feed_token_hash TEXT;
+CREATE UNIQUE INDEX idx_users_feed_token ON users(feed_token_hash);
+ALTER TABLE tasks ADD COLUMN ical_uid TEXT;
+CREATE UNIQUE INDEX idx_tasks_ical_uid ON tasks(workspace_id, ical_uid);
+	`,
+	`
+CREATE TABLE task_events (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	workspace_id INTEGER NOT NULL,
+	type TEXT NOT NULL,
+	task_id INTEGER NOT NULL,
+	task TEXT NOT NULL,
+	at TEXT NOT NULL
+);
+CREATE INDEX idx_task_events_workspace ON task_events(workspace_id, id);
+	`,
+	`
+CREATE TABLE webhooks (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	workspace_id INTEGER NOT NULL,
+	url TEXT NOT NULL,
+	events TEXT NOT NULL,
+	secret TEXT NOT NULL,
+	active INTEGER NOT NULL DEFAULT 1,
+	failures INTEGER NOT NULL DEFAULT 0,
+	created_at TEXT NOT NULL
+);
+CREATE INDEX idx_webhooks_workspace ON webhooks(workspace_id);
+CREATE TABLE webhook_deliveries (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	webhook_id INTEGER NOT NULL REFERENCES webhooks(id) ON DELETE CASCADE,
+	event_id INTEGER NOT NULL,
+	event TEXT NOT NULL,
+	payload TEXT NOT NULL,
+	status TEXT NOT NULL,
+	attempts INTEGER NOT NULL DEFAULT 0,
+	next_attempt_at TEXT,
+	last_attempt_at TEXT,
+	response_status INTEGER NOT NULL DEFAULT 0,
+	last_error TEXT NOT NULL DEFAULT '',
+	redelivery_of INTEGER,
+	created_at TEXT NOT NULL
+);
+CREATE INDEX idx_webhook_deliveries_due ON webhook_deliveries(status, next_attempt_at);
+CREATE INDEX idx_webhook_deliveries_webhook ON webhook_deliveries(webhook_id, id);
+	`,
+	`
+CREATE TABLE outbox (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	workspace_id INTEGER NOT NULL,
+	type TEXT NOT NULL,
+	task_id INTEGER NOT NULL,
+	task TEXT NOT NULL,
+	at TEXT NOT NULL,
+	delivered_at TEXT
+);
+CREATE INDEX idx_outbox_pending ON outbox(id) WHERE delivered_at IS NULL;
+-- relayed events keep their outbox id in the event log, so start above it
+INSERT INTO sqlite_sequence (name, seq) SELECT 'outbox', COALESCE(MAX(id), 0) FROM task_events;
+CREATE INDEX idx_webhook_deliveries_event ON webhook_deliveries(event_id, webhook_id);
+	`,
+	`
+CREATE TABLE task_field_clocks (
+	task_id INTEGER NOT NULL REFERENCES tasks(id) ON DELETE CASCADE,
+	field TEXT NOT NULL,
+	changed_at TEXT NOT NULL,
+	PRIMARY KEY (task_id, field)
+);
+CREATE INDEX idx_outbox_workspace ON outbox(workspace_id, id);
+CREATE INDEX idx_outbox_task ON outbox(task_id, id);
+	`,
+	`
+CREATE TABLE task_streams (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	workspace_id INTEGER NOT NULL,
+	version INTEGER NOT NULL DEFAULT 0
+);
+CREATE TABLE task_stream_events (
+	seq INTEGER PRIMARY KEY AUTOINCREMENT,
+	task_id INTEGER NOT NULL REFERENCES task_streams(id),
+	version INTEGER NOT NULL,
+	type TEXT NOT NULL,
+	data TEXT NOT NULL,
+	at TEXT NOT NULL,
+	UNIQUE (task_id, version)
+);
+CREATE TABLE task_snapshots (
+	task_id INTEGER PRIMARY KEY REFERENCES task_streams(id),
+	version INTEGER NOT NULL,
+	state TEXT NOT NULL
+);
+-- streams take the ids of their tasks, so start above any task id given out
+INSERT INTO sqlite_sequence (name, seq) SELECT 'task_streams', COALESCE(MAX(seq), 0) FROM sqlite_sequence WHERE name = 'tasks';
+	`,
+	`
+-- user names are unique per workspace; SQLite cannot drop the column's
+-- UNIQUE, so the table is rebuilt, keeping ids and the id sequence
+CREATE TABLE users_new (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	name TEXT NOT NULL,
+	admin INTEGER NOT NULL DEFAULT 0,
+	token_hash TEXT NOT NULL UNIQUE,
+	created_at TEXT NOT NULL,
+	workspace_id INTEGER NOT NULL DEFAULT 1,
+	feed_token_hash TEXT,
+	UNIQUE (workspace_id, name)
+);
+INSERT INTO users_new (id, name, admin, token_hash, created_at, workspace_id, feed_token_hash)
+	SELECT id, name, admin, token_hash, created_at, workspace_id, feed_token_hash FROM users;
+DELETE FROM sqlite_sequence WHERE name = 'users_new';
+INSERT INTO sqlite_sequence (name, seq) SELECT 'users_new', seq FROM sqlite_sequence WHERE name = 'users';
+DROP TABLE users;
+ALTER TABLE users_new RENAME TO users;
+CREATE UNIQUE INDEX idx_users_feed_token ON users(feed_token_hash);
+	`,
+}
+
+// ApplyMigrations brings the schema up to date. Foreign keys are off while
+// migrations run, so a table can be rebuilt without its references firing,
+// and checked before each migration commits.
+func (r *SQLiteRepo) ApplyMigrations(ctx context.Context) error {
+	conn, err := r.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = conn.Close() }()
+
+	var version int
+	if err := conn.QueryRowContext(ctx, `PRAGMA user_version`).Scan(&version); err != nil {
+		return err
+	}
+	if version == len(migrations) {
+		return nil
+	}
+	if _, err := conn.ExecContext(ctx, `PRAGMA foreign_keys = OFF`); err != nil {
+		return err
+	}
+	// the connection goes back to the pool
+	defer func() { _, _ = conn.ExecContext(context.Background(), `PRAGMA foreign_keys = ON`) }()
+
+	for i := version; i < len(migrations); i++ {
+		tx, err := conn.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, migrations[i]); err != nil {
+			_ = tx.Rollback()
+			return fmt.Errorf("migration %d: %w", i+1, err)
+		}
+		if err := checkForeignKeys(ctx, tx); err != nil {
+			_ = tx.Rollback()
+			return fmt.Errorf("migration %d: %w", i+1, err)
+		}
+		if _, err := tx.ExecContext(ctx, fmt.Sprintf(`PRAGMA user_version = %d`, i+1)); err != nil {
+			_ = tx.Rollback()
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkForeignKeys reports the first row that references a missing one.
+func checkForeignKeys(ctx context.Context, tx *sql.Tx) error {
+	rows, err := tx.QueryContext(ctx, `PRAGMA foreign_key_check`)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = rows.Close() }()
+	if rows.Next() {
+		var (
+			table, parent string
+			rowid         sql.NullInt64
+			fk            int
+		)
+		if err := rows.Scan(&table, &rowid, &parent, &fk); err != nil {
+			return err
+		}
+		return fmt.Errorf("row %d of %s references a missing row of %s", rowid.Int64, table, parent)
+	}
+	return rows.Err()
+}
+
+// sortableTime is RFC 3339 in UTC with a fixed number of fractional
+// digits, so stored values sort chronologically as text.
+const sortableTime = "2006-01-02T15:04:05.000000000Z07:00"
+
+func formatTime(t *time.Time) any {
+	if t == nil {
+		return nil
+	}
+	return t.UTC().Format(sortableTime)
+}
+
+func parseNullTime(s sql.NullString) *time.Time {
+	if !s.Valid {
+		return nil
+	}
+	t, err := time.Parse(time.RFC3339Nano, s.String)
+	if err != nil {
+		return nil
+	}
+	return &t
+}
+
+func nullString(s string) any {
+	if s == "" {
+		return nil
+	}
+	return s
 }
 
-// Helper to build DSN like: file:/absolute/path?_pragma=busy_timeout(5000)
+// Helper to build DSN like: file:/absolute/path?_pragma=busy_timeout(5000)&_pragma=foreign_keys(1)
+// foreign_keys is per connection, so it has to be part of the DSN for every pooled connection to enforce it.
 func SQLiteFileDSN(path string) (string, error) {
 	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
 		return "", err
@@ -110,5 +1477,5 @@ func SQLiteFileDSN(path string) (string, error) {
 	if err != nil {
 		return "", err
 	}
-	return "file:" + filepath.ToSlash(abs) + "?_pragma=busy_timeout(5000)", nil
+	return "file:" + filepath.ToSlash(abs) + "?_pragma=busy_timeout(5000)&_pragma=foreign_keys(1)", nil
 }
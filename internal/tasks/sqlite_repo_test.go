@@ -2,6 +2,7 @@ package tasks
 
 import (
 	"context"
+	"errors"
 	"os"
 	"path/filepath"
 	"testing"
@@ -31,8 +32,9 @@ func newTempDB(t *testing.T) *SQLiteRepo {
 
 func TestSQLiteRepo_CreateAndList(t *testing.T) {
 	repo := newTempDB(t)
+	ctx := context.Background()
 
-	_, err := repo.Create("") // validation
+	_, err := repo.Create(ctx, Scope{}, TaskInput{}) // validation
 	if err == nil {
 		t.Fatalf("expected ErrTitleRequired")
 	}
@@ -40,7 +42,7 @@ func TestSQLiteRepo_CreateAndList(t *testing.T) {
 		t.Fatalf("expected ErrTitleRequired, got %v", err)
 	}
 
-	a, err := repo.Create("first")
+	a, err := repo.Create(ctx, Scope{}, TaskInput{Title: "first"})
 	if err != nil {
 		t.Fatalf("create first: %v", err)
 	}
@@ -48,7 +50,7 @@ func TestSQLiteRepo_CreateAndList(t *testing.T) {
 		t.Fatalf("bad first task: %+v", a)
 	}
 
-	b, err := repo.Create("second")
+	b, err := repo.Create(ctx, Scope{}, TaskInput{Title: "second"})
 	if err != nil {
 		t.Fatalf("create second: %v", err)
 	}
@@ -56,7 +58,7 @@ func TestSQLiteRepo_CreateAndList(t *testing.T) {
 		t.Fatalf("expected monotonic IDs: a=%d b=%d", a.ID, b.ID)
 	}
 
-	list, err := repo.List()
+	list, err := repo.List(ctx, Scope{}, ListQuery{})
 	if err != nil {
 		t.Fatalf("list error: %v", err)
 	}
@@ -67,3 +69,90 @@ func TestSQLiteRepo_CreateAndList(t *testing.T) {
 		t.Fatalf("unexpected order: %+v", list)
 	}
 }
+
+func TestRepo_DeleteSubtasks(t *testing.T) {
+	forEachRepo(t, func(t *testing.T, repo Repository) {
+		ctx := context.Background()
+		tree := TaskTree{TaskInput: TaskInput{Title: "trip"}, Subtasks: []TaskTree{
+			{TaskInput: TaskInput{Title: "pack"}, Subtasks: []TaskTree{{TaskInput: TaskInput{Title: "socks"}}}},
+		}}
+		if _, err := repo.CreateTree(ctx, Scope{}, tree); err != nil {
+			t.Fatalf("create: %v", err)
+		}
+		if _, err := repo.Create(ctx, Scope{}, TaskInput{Title: "other"}); err != nil {
+			t.Fatalf("create: %v", err)
+		}
+		if err := repo.Delete(ctx, Scope{}, 1); err != nil {
+			t.Fatalf("delete: %v", err)
+		}
+		list, err := repo.List(ctx, Scope{}, ListQuery{})
+		if err != nil {
+			t.Fatalf("list: %v", err)
+		}
+		if len(list) != 1 || list[0].Title != "other" {
+			t.Fatalf("expected only the unrelated task to be left, got %+v", list)
+		}
+		if err := repo.Delete(ctx, Scope{}, 1); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("expected ErrNotFound deleting again, got %v", err)
+		}
+	})
+}
+
+// TestSQLiteRepo_UserNamesPerWorkspace upgrades a database whose user
+// names were unique across workspaces.
+func TestSQLiteRepo_UserNamesPerWorkspace(t *testing.T) {
+	ctx := context.Background()
+	dsn, err := SQLiteFileDSN(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("dsn error: %v", err)
+	}
+	repo, err := NewSQLiteRepo(dsn)
+	if err != nil {
+		t.Fatalf("open error: %v", err)
+	}
+	t.Cleanup(func() { _ = repo.Close() })
+
+	all := migrations
+	migrations = all[:len(all)-1]
+	err = repo.ApplyMigrations(ctx)
+	migrations = all
+	if err != nil {
+		t.Fatalf("migrate error: %v", err)
+	}
+	alice, err := repo.CreateUser(ctx, Scope{}, "alice", false, "hash-alice")
+	if err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	bob, err := repo.CreateUser(ctx, Scope{}, "bob", false, "hash-bob")
+	if err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	p, err := repo.CreateProject(ctx, Scope{}, "p", nil)
+	if err != nil {
+		t.Fatalf("create project: %v", err)
+	}
+	if _, err := repo.AddProjectMember(ctx, Scope{}, p.ID, alice.ID, RoleEditor); err != nil {
+		t.Fatalf("add member: %v", err)
+	}
+	if _, err := repo.db.ExecContext(ctx, `DELETE FROM users WHERE id = ?`, bob.ID); err != nil {
+		t.Fatalf("delete user: %v", err)
+	}
+
+	if err := repo.ApplyMigrations(ctx); err != nil {
+		t.Fatalf("migrate error: %v", err)
+	}
+	// the rebuild neither cascades to references nor reuses ids
+	if members, err := repo.ListProjectMembers(ctx, Scope{}, p.ID); err != nil || len(members) != 1 || members[0].UserID != alice.ID {
+		t.Fatalf("expected alice to stay a member, got %+v, %v", members, err)
+	}
+	carol, err := repo.CreateUser(ctx, Scope{}, "carol", false, "hash-carol")
+	if err != nil || carol.ID <= bob.ID {
+		t.Fatalf("expected a new id above %d, got %+v, %v", bob.ID, carol, err)
+	}
+	if _, err := repo.CreateUser(ctx, Scope{}, "alice", false, "hash-alice2"); !errors.Is(err, ErrConflict) {
+		t.Fatalf("expected ErrConflict in the same workspace, got %v", err)
+	}
+	if _, _, err := repo.CreateWorkspace(ctx, "globex", "alice", "hash-alice3"); err != nil {
+		t.Fatalf("expected the name to be free in another workspace, got %v", err)
+	}
+}
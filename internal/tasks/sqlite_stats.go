@@ -0,0 +1,96 @@
+package tasks
+
+import (
+	"context"
+	"database/sql"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Stats implements Repository.Stats with one aggregate query per part.
+func (r *SQLiteRepo) Stats(ctx context.Context, s Scope, q StatsQuery) (Stats, error) {
+	conds, args := scopeWhere(s)
+	if q.ProjectID != nil {
+		conds = append(conds, "t.project_id = ?")
+		args = append(args, *q.ProjectID)
+	}
+	where := strings.Join(conds, " AND ")
+	from, to := q.From.Format(time.DateOnly), q.To.Format(time.DateOnly)
+
+	st := Stats{Daily: statsDays(q.From, q.To)}
+	err := r.db.QueryRowContext(ctx, `
+		SELECT
+			COALESCE(SUM(NOT t.done), 0),
+			COALESCE(SUM(t.done), 0),
+			COALESCE(SUM(NOT t.done AND t.due_at < ?), 0)
+		FROM tasks t
+		WHERE `+where, slices.Concat([]any{formatTime(&q.Now)}, args)...).Scan(&st.ByStatus.Open, &st.ByStatus.Done, &st.ByStatus.Overdue)
+	if err != nil {
+		return Stats{}, err
+	}
+
+	index := make(map[string]int, len(st.Daily))
+	for i, d := range st.Daily {
+		index[d.Date] = i
+	}
+	for _, col := range []string{"created_at", "completed_at"} {
+		err := eachRow(ctx, r.db, `
+			SELECT date(t.`+col+`) AS day, COUNT(*)
+			FROM tasks t
+			WHERE `+where+` AND date(t.`+col+`) BETWEEN ? AND ?
+			GROUP BY day
+		`, slices.Concat(args, []any{from, to}), func(rows *sql.Rows) error {
+			var day string
+			var n int
+			if err := rows.Scan(&day, &n); err != nil {
+				return err
+			}
+			i, ok := index[day]
+			if !ok {
+				return nil
+			}
+			if col == "created_at" {
+				st.Daily[i].Created = n
+			} else {
+				st.Daily[i].Completed = n
+			}
+			return nil
+		})
+		if err != nil {
+			return Stats{}, err
+		}
+	}
+
+	// nearest-rank percentiles: the row numbered ceil(p*n/100)
+	var p50, p90, p95 sql.NullInt64
+	err = r.db.QueryRowContext(ctx, `
+		WITH c AS (
+			SELECT CAST(ROUND((julianday(t.completed_at) - julianday(t.created_at)) * 86400) AS INTEGER) AS secs
+			FROM tasks t
+			WHERE `+where+` AND date(t.completed_at) BETWEEN ? AND ?
+		), r AS (
+			SELECT secs, ROW_NUMBER() OVER (ORDER BY secs) AS rn, COUNT(*) OVER () AS n FROM c
+		)
+		SELECT
+			COUNT(*),
+			MAX(CASE WHEN rn = (50 * n + 99) / 100 THEN secs END),
+			MAX(CASE WHEN rn = (90 * n + 99) / 100 THEN secs END),
+			MAX(CASE WHEN rn = (95 * n + 99) / 100 THEN secs END)
+		FROM r
+	`, slices.Concat(args, []any{from, to})...).Scan(&st.CycleTime.Count, &p50, &p90, &p95)
+	if err != nil {
+		return Stats{}, err
+	}
+	st.CycleTime.P50 = nullInt64(p50)
+	st.CycleTime.P90 = nullInt64(p90)
+	st.CycleTime.P95 = nullInt64(p95)
+	return st, nil
+}
+
+func nullInt64(n sql.NullInt64) *int64 {
+	if !n.Valid {
+		return nil
+	}
+	return &n.Int64
+}
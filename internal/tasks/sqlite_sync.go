@@ -0,0 +1,189 @@
+package tasks
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+)
+
+// The outbox is also the change log sync reads: its ids are the positions
+// of Changes, and its EventDeleted rows are the tombstones.
+
+// SyncPosition implements Repository.SyncPosition.
+func (r *SQLiteRepo) SyncPosition(ctx context.Context, s Scope) (int64, error) {
+	var pos int64
+	err := r.db.QueryRowContext(ctx, `
+		SELECT COALESCE(MAX(id), 0) FROM outbox WHERE workspace_id = ?
+	`, s.workspace()).Scan(&pos)
+	return pos, err
+}
+
+// Changes implements Repository.Changes with the latest outbox row of each
+// task.
+func (r *SQLiteRepo) Changes(ctx context.Context, s Scope, since int64, limit int) ([]TaskEvent, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT o.id, o.workspace_id, o.type, o.task, o.at FROM outbox o
+		WHERE o.workspace_id = ? AND o.id > ?
+			AND NOT EXISTS (SELECT 1 FROM outbox n WHERE n.task_id = o.task_id AND n.id > o.id)
+		ORDER BY o.id ASC
+		LIMIT ?
+	`, s.workspace(), since, limit)
+	if err != nil {
+		return nil, err
+	}
+	return scanEvents(rows)
+}
+
+// ChangeAt implements Repository.ChangeAt with the latest outbox row of the
+// task up to pos.
+func (r *SQLiteRepo) ChangeAt(ctx context.Context, s Scope, id, pos int64) (TaskEvent, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT id, workspace_id, type, task, at FROM outbox
+		WHERE workspace_id = ? AND task_id = ? AND id <= ?
+		ORDER BY id DESC
+		LIMIT 1
+	`, s.workspace(), id, pos)
+	if err != nil {
+		return TaskEvent{}, err
+	}
+	events, err := scanEvents(rows)
+	if err != nil {
+		return TaskEvent{}, err
+	}
+	if len(events) == 0 {
+		return TaskEvent{}, ErrNotFound
+	}
+	return events[0], nil
+}
+
+// MergeUpdate implements Repository.MergeUpdate in a single transaction.
+func (r *SQLiteRepo) MergeUpdate(ctx context.Context, s Scope, id int64, p TaskPatch, changedAt time.Time) (Task, []FieldClock, error) {
+	if p.Title != nil && strings.TrimSpace(*p.Title) == "" {
+		return Task{}, nil, ErrTitleRequired
+	}
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return Task{}, nil, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if err := mergeTarget(ctx, tx, s, id); err != nil {
+		return Task{}, nil, err
+	}
+	clocks, err := fieldClocks(ctx, tx, id)
+	if err != nil {
+		return Task{}, nil, err
+	}
+	stale := clocksAfter(clocks, patchFields(p), changedAt)
+	p = withoutFields(p, stale)
+	fields := patchFields(p)
+	if len(fields) == 0 {
+		t, err := queryTask(ctx, tx, s, id)
+		return t, stale, err
+	}
+
+	now := time.Now().UTC()
+	if err := patchTask(ctx, tx, s, id, p, now); err != nil {
+		return Task{}, nil, err
+	}
+	if err := touchFields(ctx, tx, id, fields, changedAt); err != nil {
+		return Task{}, nil, err
+	}
+	// as the workspace sees it, even if the change hid it from the caller
+	t, err := queryTask(ctx, tx, Scope{WorkspaceID: s.WorkspaceID}, id)
+	if err != nil {
+		return Task{}, nil, err
+	}
+	if err := writeOutbox(ctx, tx, s, EventUpdated, now, t); err != nil {
+		return Task{}, nil, err
+	}
+	if err := r.commit(tx); err != nil {
+		return Task{}, nil, err
+	}
+	return t, stale, nil
+}
+
+// MergeDelete implements Repository.MergeDelete in a single transaction.
+func (r *SQLiteRepo) MergeDelete(ctx context.Context, s Scope, id int64, changedAt time.Time) ([]FieldClock, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	switch err := mergeTarget(ctx, tx, s, id); {
+	case err == ErrDeleted:
+		return nil, nil
+	case err != nil:
+		return nil, err
+	}
+	clocks, err := fieldClocks(ctx, tx, id)
+	if err != nil {
+		return nil, err
+	}
+	if newer := clocksAfter(clocks, syncFields, changedAt); len(newer) > 0 {
+		return newer, nil
+	}
+	if err := deleteTask(ctx, tx, s, id); err != nil {
+		return nil, err
+	}
+	return nil, r.commit(tx)
+}
+
+// mergeTarget reports ErrDeleted if the task id of the scope's workspace
+// was deleted and ErrNotFound if the scope cannot see it otherwise.
+func mergeTarget(ctx context.Context, tx *sql.Tx, s Scope, id int64) error {
+	where := taskWhere(s, id)
+	err := tx.QueryRowContext(ctx, `SELECT t.id FROM tasks t WHERE `+where.sql, where.args...).Scan(new(int64))
+	if err != sql.ErrNoRows {
+		return err
+	}
+	var deleted bool
+	err = tx.QueryRowContext(ctx, `
+		SELECT type = ? FROM outbox WHERE task_id = ? AND workspace_id = ?
+		ORDER BY id DESC
+		LIMIT 1
+	`, EventDeleted, id, s.workspace()).Scan(&deleted)
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+	if deleted {
+		return ErrDeleted
+	}
+	return ErrNotFound
+}
+
+// fieldClocks reads the change times of the attributes of the task id.
+func fieldClocks(ctx context.Context, tx *sql.Tx, id int64) (map[string]time.Time, error) {
+	clocks := make(map[string]time.Time)
+	err := eachRow(ctx, tx, `SELECT field, changed_at FROM task_field_clocks WHERE task_id = ?`, []any{id}, func(rows *sql.Rows) error {
+		var (
+			field string
+			at    sql.NullString
+		)
+		if err := rows.Scan(&field, &at); err != nil {
+			return err
+		}
+		if t := parseNullTime(at); t != nil {
+			clocks[field] = *t
+		}
+		return nil
+	})
+	return clocks, err
+}
+
+// touchFields records at as the change time of the named attributes of
+// the task id.
+func touchFields(ctx context.Context, tx *sql.Tx, id int64, fields []string, at time.Time) error {
+	at = at.UTC()
+	for _, f := range fields {
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO task_field_clocks (task_id, field, changed_at) VALUES (?, ?, ?)
+			ON CONFLICT (task_id, field) DO UPDATE SET changed_at = excluded.changed_at
+		`, id, f, formatTime(&at)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
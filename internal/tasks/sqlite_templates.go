@@ -0,0 +1,84 @@
+package tasks
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+)
+
+func (r *SQLiteRepo) CreateTemplate(ctx context.Context, s Scope, name string, spec TemplateTask) (Template, error) {
+	body, err := json.Marshal(spec)
+	if err != nil {
+		return Template{}, err
+	}
+	now := time.Now().UTC()
+	res, err := r.db.ExecContext(ctx, `
+		INSERT INTO templates (workspace_id, name, spec, created_at) VALUES (?, ?, ?, ?)
+	`, s.workspace(), name, string(body), now.Format(time.RFC3339Nano))
+	if err != nil {
+		return Template{}, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return Template{}, err
+	}
+	return newTemplate(id, name, spec, now), nil
+}
+
+func (r *SQLiteRepo) GetTemplate(ctx context.Context, s Scope, id int64) (Template, error) {
+	out, err := r.queryTemplates(ctx, `WHERE workspace_id = ? AND id = ?`, s.workspace(), id)
+	if err != nil {
+		return Template{}, err
+	}
+	if len(out) == 0 {
+		return Template{}, ErrNotFound
+	}
+	return out[0], nil
+}
+
+func (r *SQLiteRepo) ListTemplates(ctx context.Context, s Scope) ([]Template, error) {
+	return r.queryTemplates(ctx, `WHERE workspace_id = ?`, s.workspace())
+}
+
+func (r *SQLiteRepo) DeleteTemplate(ctx context.Context, s Scope, id int64) error {
+	res, err := r.db.ExecContext(ctx, `DELETE FROM templates WHERE workspace_id = ? AND id = ?`, s.workspace(), id)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *SQLiteRepo) queryTemplates(ctx context.Context, where string, args ...any) ([]Template, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT id, name, spec, created_at FROM templates `+where+`
+		ORDER BY id ASC
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	out := []Template{}
+	for rows.Next() {
+		var (
+			id            int64
+			name          string
+			body, created string
+			spec          TemplateTask
+		)
+		if err := rows.Scan(&id, &name, &body, &created); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(body), &spec); err != nil {
+			return nil, err
+		}
+		ts, _ := time.Parse(time.RFC3339Nano, created)
+		out = append(out, newTemplate(id, name, spec, ts))
+	}
+	return out, rows.Err()
+}
@@ -0,0 +1,169 @@
+package tasks
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+func (r *SQLiteRepo) CreateWorkspace(ctx context.Context, name, adminName, tokenHash string) (Workspace, User, error) {
+	now := time.Now().UTC()
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return Workspace{}, User{}, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	res, err := tx.ExecContext(ctx, `
+		INSERT INTO workspaces (name, created_at) VALUES (?, ?)
+	`, name, now.Format(time.RFC3339Nano))
+	if err != nil {
+		return Workspace{}, User{}, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return Workspace{}, User{}, err
+	}
+	u, err := insertUser(ctx, tx, id, adminName, true, tokenHash, now)
+	if err != nil {
+		return Workspace{}, User{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return Workspace{}, User{}, err
+	}
+	return Workspace{ID: id, Name: name, CreatedAt: now}, u, nil
+}
+
+func (r *SQLiteRepo) ListWorkspaces(ctx context.Context) ([]Workspace, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT id, name, created_at FROM workspaces ORDER BY id ASC`)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	out := []Workspace{}
+	for rows.Next() {
+		var ws Workspace
+		var created string
+		if err := rows.Scan(&ws.ID, &ws.Name, &created); err != nil {
+			return nil, err
+		}
+		if ts, err := time.Parse(time.RFC3339Nano, created); err == nil {
+			ws.CreatedAt = ts
+		}
+		out = append(out, ws)
+	}
+	return out, rows.Err()
+}
+
+func (r *SQLiteRepo) CreateUser(ctx context.Context, s Scope, name string, admin bool, tokenHash string) (User, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return User{}, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	u, err := insertUser(ctx, tx, s.workspace(), name, admin, tokenHash, time.Now().UTC())
+	if err != nil {
+		return User{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return User{}, err
+	}
+	return u, nil
+}
+
+func insertUser(ctx context.Context, tx *sql.Tx, workspaceID int64, name string, admin bool, tokenHash string, now time.Time) (User, error) {
+	res, err := tx.ExecContext(ctx, `
+		INSERT INTO users (workspace_id, name, admin, token_hash, created_at) VALUES (?, ?, ?, ?, ?)
+	`, workspaceID, name, admin, tokenHash, now.Format(time.RFC3339Nano))
+	if isUniqueViolation(err) {
+		return User{}, ErrConflict
+	}
+	if err != nil {
+		return User{}, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return User{}, err
+	}
+	return User{ID: id, WorkspaceID: workspaceID, Name: name, Admin: admin, CreatedAt: now}, nil
+}
+
+func (r *SQLiteRepo) GetUser(ctx context.Context, s Scope, id int64) (User, error) {
+	return r.oneUser(ctx, `WHERE workspace_id = ? AND id = ?`, s.workspace(), id)
+}
+
+func (r *SQLiteRepo) ListUsers(ctx context.Context, s Scope) ([]User, error) {
+	return r.queryUsers(ctx, `WHERE workspace_id = ?`, s.workspace())
+}
+
+func (r *SQLiteRepo) UserByTokenHash(ctx context.Context, tokenHash string) (User, error) {
+	return r.oneUser(ctx, `WHERE token_hash = ?`, tokenHash)
+}
+
+func (r *SQLiteRepo) SetFeedToken(ctx context.Context, s Scope, tokenHash string) error {
+	res, err := r.db.ExecContext(ctx, `
+		UPDATE users SET feed_token_hash = ? WHERE id = ? AND workspace_id = ?
+	`, nullString(tokenHash), s.UserID, s.workspace())
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *SQLiteRepo) UserByFeedTokenHash(ctx context.Context, tokenHash string) (User, error) {
+	return r.oneUser(ctx, `WHERE feed_token_hash = ?`, tokenHash)
+}
+
+func (r *SQLiteRepo) oneUser(ctx context.Context, where string, args ...any) (User, error) {
+	out, err := r.queryUsers(ctx, where, args...)
+	if err != nil {
+		return User{}, err
+	}
+	if len(out) == 0 {
+		return User{}, ErrNotFound
+	}
+	return out[0], nil
+}
+
+func (r *SQLiteRepo) queryUsers(ctx context.Context, where string, args ...any) ([]User, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT id, workspace_id, name, admin, created_at FROM users `+where+`
+		ORDER BY id ASC
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	out := []User{}
+	for rows.Next() {
+		var u User
+		var created string
+		if err := rows.Scan(&u.ID, &u.WorkspaceID, &u.Name, &u.Admin, &created); err != nil {
+			return nil, err
+		}
+		if ts, err := time.Parse(time.RFC3339Nano, created); err == nil {
+			u.CreatedAt = ts
+		}
+		out = append(out, u)
+	}
+	return out, rows.Err()
+}
+
+func isUniqueViolation(err error) bool {
+	var se *sqlite.Error
+	return errors.As(err, &se) &&
+		(se.Code() == sqlite3.SQLITE_CONSTRAINT_UNIQUE || se.Code() == sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY)
+}
@@ -0,0 +1,102 @@
+package tasks
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+func (r *SQLiteRepo) CreateView(ctx context.Context, s Scope, name, query string, projectID *int64) (View, error) {
+	if projectID != nil {
+		where, args := projectWhere(s, *projectID)
+		if err := r.db.QueryRowContext(ctx, `SELECT p.id FROM projects p `+where, args...).Scan(new(int64)); err != nil {
+			if err == sql.ErrNoRows {
+				return View{}, ErrNotFound
+			}
+			return View{}, err
+		}
+	}
+	var owner *int64
+	if s.UserID != 0 {
+		owner = &s.UserID
+	}
+	now := time.Now().UTC()
+	res, err := r.db.ExecContext(ctx, `
+		INSERT INTO views (workspace_id, owner_id, project_id, name, query, created_at) VALUES (?, ?, ?, ?, ?, ?)
+	`, s.workspace(), owner, projectID, name, query, now.Format(time.RFC3339Nano))
+	if err != nil {
+		return View{}, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return View{}, err
+	}
+	return View{ID: id, Name: name, Query: query, ProjectID: projectID, OwnerID: owner, CreatedAt: now}, nil
+}
+
+func (r *SQLiteRepo) GetView(ctx context.Context, s Scope, id int64) (View, error) {
+	where, args := viewWhere(s)
+	out, err := r.queryViews(ctx, where+` AND v.id = ?`, append(args, id)...)
+	if err != nil {
+		return View{}, err
+	}
+	if len(out) == 0 {
+		return View{}, ErrNotFound
+	}
+	return out[0], nil
+}
+
+func (r *SQLiteRepo) ListViews(ctx context.Context, s Scope) ([]View, error) {
+	where, args := viewWhere(s)
+	return r.queryViews(ctx, where, args...)
+}
+
+func (r *SQLiteRepo) DeleteView(ctx context.Context, s Scope, id int64) error {
+	where, args := viewWhere(s)
+	res, err := r.db.ExecContext(ctx, `DELETE FROM views WHERE id IN (SELECT v.id FROM views v `+where+` AND v.id = ?)`, append(args, id)...)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// viewWhere restricts views v to those visible in s: a restricted scope
+// sees its own views and those shared in projects it is a member of.
+func viewWhere(s Scope) (string, []any) {
+	where, args := `WHERE v.workspace_id = ?`, []any{s.workspace()}
+	if s.restricted() {
+		where += ` AND (v.owner_id = ? OR v.project_id IN (SELECT project_id FROM project_members WHERE user_id = ?))`
+		args = append(args, s.UserID, s.UserID)
+	}
+	return where, args
+}
+
+func (r *SQLiteRepo) queryViews(ctx context.Context, where string, args ...any) ([]View, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT v.id, v.name, v.query, v.project_id, v.owner_id, v.created_at FROM views v `+where+`
+		ORDER BY v.id ASC
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	out := []View{}
+	for rows.Next() {
+		var v View
+		var created string
+		if err := rows.Scan(&v.ID, &v.Name, &v.Query, &v.ProjectID, &v.OwnerID, &created); err != nil {
+			return nil, err
+		}
+		if ts, err := time.Parse(time.RFC3339Nano, created); err == nil {
+			v.CreatedAt = ts
+		}
+		out = append(out, v)
+	}
+	return out, rows.Err()
+}
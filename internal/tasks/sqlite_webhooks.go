@@ -0,0 +1,303 @@
+package tasks
+
+import (
+	"context"
+	"database/sql"
+	"slices"
+	"strings"
+	"time"
+)
+
+// CreateWebhook implements Repository.CreateWebhook; the event types are
+// stored as a comma-separated list.
+func (r *SQLiteRepo) CreateWebhook(ctx context.Context, s Scope, url string, events []string, secret string) (Webhook, error) {
+	now := time.Now().UTC()
+	res, err := r.db.ExecContext(ctx, `
+		INSERT INTO webhooks (workspace_id, url, events, secret, created_at) VALUES (?, ?, ?, ?, ?)
+	`, s.workspace(), url, strings.Join(events, ","), secret, now.Format(time.RFC3339Nano))
+	if err != nil {
+		return Webhook{}, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return Webhook{}, err
+	}
+	return Webhook{ID: id, URL: url, Events: slices.Clone(events), Secret: secret, Active: true, CreatedAt: now}, nil
+}
+
+func (r *SQLiteRepo) GetWebhook(ctx context.Context, s Scope, id int64) (Webhook, error) {
+	out, err := r.queryWebhooks(ctx, `WHERE workspace_id = ? AND id = ?`, s.workspace(), id)
+	if err != nil {
+		return Webhook{}, err
+	}
+	if len(out) == 0 {
+		return Webhook{}, ErrNotFound
+	}
+	return out[0], nil
+}
+
+func (r *SQLiteRepo) ListWebhooks(ctx context.Context, s Scope) ([]Webhook, error) {
+	return r.queryWebhooks(ctx, `WHERE workspace_id = ?`, s.workspace())
+}
+
+func (r *SQLiteRepo) queryWebhooks(ctx context.Context, where string, args ...any) ([]Webhook, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT id, url, events, secret, active, failures, created_at FROM webhooks `+where+`
+		ORDER BY id ASC
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	out := []Webhook{}
+	for rows.Next() {
+		var (
+			h               Webhook
+			events, created string
+		)
+		if err := rows.Scan(&h.ID, &h.URL, &events, &h.Secret, &h.Active, &h.Failures, &created); err != nil {
+			return nil, err
+		}
+		h.Events = strings.Split(events, ",")
+		if ts, err := time.Parse(time.RFC3339Nano, created); err == nil {
+			h.CreatedAt = ts
+		}
+		out = append(out, h)
+	}
+	return out, rows.Err()
+}
+
+func (r *SQLiteRepo) SetWebhookActive(ctx context.Context, s Scope, id int64, active bool) (Webhook, error) {
+	res, err := r.db.ExecContext(ctx, `
+		UPDATE webhooks SET active = ?, failures = CASE WHEN ? THEN 0 ELSE failures END
+		WHERE workspace_id = ? AND id = ?
+	`, active, active, s.workspace(), id)
+	if err != nil {
+		return Webhook{}, err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return Webhook{}, err
+	} else if n == 0 {
+		return Webhook{}, ErrNotFound
+	}
+	return r.GetWebhook(ctx, s, id)
+}
+
+// DeleteWebhook implements Repository.DeleteWebhook; the deliveries go
+// with it through the foreign key.
+func (r *SQLiteRepo) DeleteWebhook(ctx context.Context, s Scope, id int64) error {
+	res, err := r.db.ExecContext(ctx, `DELETE FROM webhooks WHERE workspace_id = ? AND id = ?`, s.workspace(), id)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *SQLiteRepo) EnqueueWebhookDeliveries(ctx context.Context, e TaskEvent, payload []byte) (int, error) {
+	hooks, err := r.queryWebhooks(ctx, `WHERE workspace_id = ? AND active = 1`, e.WorkspaceID)
+	if err != nil {
+		return 0, err
+	}
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	now := time.Now().UTC()
+	n := 0
+	for _, h := range hooks {
+		if !slices.Contains(h.Events, e.Type) {
+			continue
+		}
+		var queued bool
+		if err := tx.QueryRowContext(ctx, `
+			SELECT EXISTS (SELECT 1 FROM webhook_deliveries WHERE event_id = ? AND webhook_id = ? AND redelivery_of IS NULL)
+		`, e.ID, h.ID).Scan(&queued); err != nil {
+			return 0, err
+		}
+		if queued {
+			continue
+		}
+		if _, err := insertDelivery(ctx, tx, WebhookDelivery{WebhookID: h.ID, EventID: e.ID, Event: e.Type, Payload: payload}, now); err != nil {
+			return 0, err
+		}
+		n++
+	}
+	return n, tx.Commit()
+}
+
+// insertDelivery adds d as a pending delivery due at now.
+func insertDelivery(ctx context.Context, tx *sql.Tx, d WebhookDelivery, now time.Time) (WebhookDelivery, error) {
+	res, err := tx.ExecContext(ctx, `
+		INSERT INTO webhook_deliveries (webhook_id, event_id, event, payload, status, next_attempt_at, redelivery_of, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`, d.WebhookID, d.EventID, d.Event, string(d.Payload), DeliveryPending, formatTime(&now), d.RedeliveryOf, formatTime(&now))
+	if err != nil {
+		return WebhookDelivery{}, err
+	}
+	if d.ID, err = res.LastInsertId(); err != nil {
+		return WebhookDelivery{}, err
+	}
+	d.Status = DeliveryPending
+	d.Attempts = 0
+	d.NextAttemptAt = &now
+	d.LastAttemptAt = nil
+	d.ResponseStatus = 0
+	d.LastError = ""
+	d.CreatedAt = now
+	return d, nil
+}
+
+const deliveryColumns = `d.id, d.webhook_id, d.event_id, d.event, d.payload, d.status, d.attempts,
+	d.next_attempt_at, d.last_attempt_at, d.response_status, d.last_error, d.redelivery_of, d.created_at`
+
+func scanDelivery(sc interface{ Scan(...any) error }, extra ...any) (WebhookDelivery, error) {
+	var (
+		d          WebhookDelivery
+		payload    string
+		next, last sql.NullString
+		created    string
+	)
+	dest := append([]any{&d.ID, &d.WebhookID, &d.EventID, &d.Event, &payload, &d.Status, &d.Attempts,
+		&next, &last, &d.ResponseStatus, &d.LastError, &d.RedeliveryOf, &created}, extra...)
+	if err := sc.Scan(dest...); err != nil {
+		return WebhookDelivery{}, err
+	}
+	d.Payload = []byte(payload)
+	d.NextAttemptAt = parseNullTime(next)
+	d.LastAttemptAt = parseNullTime(last)
+	if ts, err := time.Parse(time.RFC3339Nano, created); err == nil {
+		d.CreatedAt = ts
+	}
+	return d, nil
+}
+
+func (r *SQLiteRepo) ListWebhookDeliveries(ctx context.Context, s Scope, webhookID int64, limit int) ([]WebhookDelivery, error) {
+	if _, err := r.GetWebhook(ctx, s, webhookID); err != nil {
+		return nil, err
+	}
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT `+deliveryColumns+` FROM webhook_deliveries d
+		WHERE d.webhook_id = ?
+		ORDER BY d.id DESC
+		LIMIT ?
+	`, webhookID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	out := []WebhookDelivery{}
+	for rows.Next() {
+		d, err := scanDelivery(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, d)
+	}
+	return out, rows.Err()
+}
+
+func (r *SQLiteRepo) RedeliverWebhook(ctx context.Context, s Scope, webhookID, deliveryID int64) (WebhookDelivery, error) {
+	if _, err := r.GetWebhook(ctx, s, webhookID); err != nil {
+		return WebhookDelivery{}, err
+	}
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return WebhookDelivery{}, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	d, err := scanDelivery(tx.QueryRowContext(ctx, `
+		SELECT `+deliveryColumns+` FROM webhook_deliveries d WHERE d.id = ? AND d.webhook_id = ?
+	`, deliveryID, webhookID))
+	if err == sql.ErrNoRows {
+		return WebhookDelivery{}, ErrNotFound
+	} else if err != nil {
+		return WebhookDelivery{}, err
+	}
+	d.RedeliveryOf = &deliveryID
+	if d, err = insertDelivery(ctx, tx, d, time.Now().UTC()); err != nil {
+		return WebhookDelivery{}, err
+	}
+	return d, tx.Commit()
+}
+
+func (r *SQLiteRepo) DueWebhookDeliveries(ctx context.Context, now time.Time, limit int, skip []int64) ([]DueDelivery, error) {
+	skipped, args := "", []any{DeliveryPending, formatTime(&now)}
+	if len(skip) > 0 {
+		skipped = ` AND d.webhook_id NOT IN (?` + strings.Repeat(", ?", len(skip)-1) + `)`
+		for _, id := range skip {
+			args = append(args, id)
+		}
+	}
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT `+deliveryColumns+`, h.url, h.secret FROM webhook_deliveries d
+		JOIN webhooks h ON h.id = d.webhook_id
+		WHERE d.status = ? AND d.next_attempt_at <= ? AND h.active = 1`+skipped+`
+		ORDER BY d.id ASC
+		LIMIT ?
+	`, append(args, limit)...)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	var out []DueDelivery
+	for rows.Next() {
+		var due DueDelivery
+		if due.WebhookDelivery, err = scanDelivery(rows, &due.URL, &due.Secret); err != nil {
+			return nil, err
+		}
+		out = append(out, due)
+	}
+	return out, rows.Err()
+}
+
+func (r *SQLiteRepo) RecordWebhookAttempt(ctx context.Context, deliveryID int64, a WebhookAttempt) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	var webhookID int64
+	if err := tx.QueryRowContext(ctx, `SELECT webhook_id FROM webhook_deliveries WHERE id = ?`, deliveryID).Scan(&webhookID); err != nil {
+		if err == sql.ErrNoRows {
+			return ErrNotFound
+		}
+		return err
+	}
+	status, failures := DeliveryPending, `failures + 1`
+	switch {
+	case a.Error == "":
+		status, failures = DeliverySucceeded, `0`
+	case a.Retry == nil:
+		status = DeliveryFailed
+	}
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE webhook_deliveries
+		SET status = ?, attempts = attempts + 1, next_attempt_at = ?, last_attempt_at = ?, response_status = ?, last_error = ?
+		WHERE id = ?
+	`, status, formatTime(a.Retry), formatTime(&a.At), a.StatusCode, a.Error, deliveryID); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE webhooks SET failures = `+failures+` WHERE id = ?`, webhookID); err != nil {
+		return err
+	}
+	if a.DisableAfter > 0 {
+		if _, err := tx.ExecContext(ctx, `
+			UPDATE webhooks SET active = 0 WHERE id = ? AND failures >= ?
+		`, webhookID, a.DisableAfter); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,190 @@
+package tasks
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// sseBatch is how many logged events are read at a time.
+	sseBatch = 500
+	// sseRetry is the reconnection delay suggested to clients.
+	sseRetry = 3 * time.Second
+)
+
+// sseHeartbeat is how often an idle event stream sends a comment, so
+// proxies keep it open and dead clients are noticed.
+var sseHeartbeat = 15 * time.Second
+
+// eventFilter selects the events of an event stream.
+type eventFilter struct {
+	projectID *int64
+	tag       string
+	types     []string // all if empty
+}
+
+func parseEventFilter(r *http.Request) (eventFilter, int64, bool, []fieldError) {
+	var (
+		f    eventFilter
+		errs []fieldError
+	)
+	params := r.URL.Query()
+	if s := params.Get("project_id"); s != "" {
+		id, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			errs = append(errs, fieldError{Field: "project_id", Message: "project_id must be an integer"})
+		} else {
+			f.projectID = &id
+		}
+	}
+	f.tag = strings.ToLower(strings.TrimSpace(params.Get("tag")))
+	if s := params.Get("type"); s != "" {
+		for _, typ := range strings.Split(s, ",") {
+			typ = strings.TrimSpace(typ)
+			if _, ok := eventTypes[typ]; !ok {
+				errs = append(errs, fieldError{Field: "type", Message: "type must be a list of created, updated and deleted"})
+				break
+			}
+			f.types = append(f.types, typ)
+		}
+	}
+
+	// EventSource sends Last-Event-ID when it reconnects; the parameter
+	// lets a client resume on its first request.
+	last := r.Header.Get("Last-Event-ID")
+	if last == "" {
+		last = params.Get("last_event_id")
+	}
+	var after int64
+	if last != "" {
+		id, err := strconv.ParseInt(last, 10, 64)
+		if err != nil || id < 0 {
+			errs = append(errs, fieldError{Field: "Last-Event-ID", Message: "Last-Event-ID must be the id of an event"})
+		}
+		after = id
+	}
+	return f, after, last != "", errs
+}
+
+func (f eventFilter) matches(e TaskEvent) bool {
+	switch {
+	case f.projectID != nil && (e.Task.ProjectID == nil || *e.Task.ProjectID != *f.projectID):
+		return false
+	case f.tag != "" && !slices.Contains(e.Task.Tags, f.tag):
+		return false
+	case len(f.types) > 0 && !slices.Contains(f.types, e.Type):
+		return false
+	}
+	return true
+}
+
+type sseData struct {
+	Type string    `json:"type"`
+	Task Task      `json:"task"`
+	At   time.Time `json:"at"`
+}
+
+// taskEvents streams the event log as Server-Sent Events. It starts after
+// Last-Event-ID, or with the next change if there is none, and follows the
+// log for as long as the client stays: the broker only says when to read
+// it again, so a stream that falls behind loses nothing. Each event has
+// its log id, its type as the event name and the task as data.
+func taskEvents(repo Repository) http.HandlerFunc {
+	broker := brokerOf(repo)
+	return func(w http.ResponseWriter, r *http.Request) {
+		f, after, resume, vErrs := parseEventFilter(r)
+		if len(vErrs) > 0 {
+			w.Header().Set("Content-Type", "application/json")
+			writeValidation(w, vErrs)
+			return
+		}
+		ctx := r.Context()
+		s := callerScope(ctx)
+
+		// subscribe before finding where to start, so no change is missed
+		var (
+			wake        <-chan TaskEvent
+			done        <-chan struct{}
+			unsubscribe = func() {}
+		)
+		if broker != nil {
+			wake, unsubscribe = broker.Subscribe(watchBuffer)
+			done = broker.Done()
+		}
+		defer func() { unsubscribe() }()
+		if !resume {
+			var err error
+			if after, err = repo.LastEventID(ctx, s); err != nil {
+				w.Header().Set("Content-Type", "application/json")
+				writeJSON(w, http.StatusInternalServerError, errResponse{Error: "unexpected_error"})
+				return
+			}
+		}
+
+		rc := http.NewResponseController(w)
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("X-Accel-Buffering", "no")
+		w.WriteHeader(http.StatusOK)
+		if _, err := fmt.Fprintf(w, "retry: %d\n\n", sseRetry.Milliseconds()); err != nil {
+			return
+		}
+		_ = rc.Flush()
+
+		heartbeat := time.NewTicker(sseHeartbeat)
+		defer heartbeat.Stop()
+		for {
+			for {
+				events, err := repo.Events(ctx, s, after, sseBatch)
+				if err != nil {
+					return // the client reconnects and resumes
+				}
+				for _, e := range events {
+					after = e.ID
+					if !f.matches(e) {
+						continue
+					}
+					if ok, err := eventVisible(ctx, repo, s, e); err != nil {
+						return
+					} else if !ok {
+						continue
+					}
+					data, err := json.Marshal(sseData{Type: e.Type, Task: e.Task, At: e.At})
+					if err != nil {
+						return
+					}
+					if _, err := fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", e.ID, e.Type, data); err != nil {
+						return
+					}
+				}
+				if len(events) < sseBatch {
+					break
+				}
+			}
+			_ = rc.Flush()
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-done:
+				return
+			case _, ok := <-wake:
+				if !ok {
+					// dropped for falling behind; the log has the rest
+					unsubscribe()
+					wake, unsubscribe = broker.Subscribe(watchBuffer)
+				}
+			case <-heartbeat.C:
+				if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+					return
+				}
+				_ = rc.Flush()
+			}
+		}
+	}
+}
@@ -0,0 +1,180 @@
+package tasks
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testSSE struct {
+	id, event, comment string
+	data               sseData
+}
+
+// openEvents opens GET /tasks/events as token. lastID is sent as
+// Last-Event-ID unless it is empty.
+func openEvents(t *testing.T, srv *httptest.Server, token, query, lastID string) *bufio.Reader {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	t.Cleanup(cancel)
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"/tasks/events"+query, nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Accept", "text/event-stream")
+	if lastID != "" {
+		req.Header.Set("Last-Event-ID", lastID)
+	}
+	resp, err := srv.Client().Do(req)
+	if err != nil {
+		t.Fatalf("GET /tasks/events: %v", err)
+	}
+	t.Cleanup(func() { _ = resp.Body.Close() })
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200, got %d", resp.StatusCode)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("expected text/event-stream, got %q", ct)
+	}
+	br := bufio.NewReader(resp.Body)
+	if ev := readSSE(t, br); !strings.HasPrefix(ev.comment, "retry") {
+		t.Fatalf("expected the stream to start with retry, got %+v", ev)
+	}
+	return br
+}
+
+// readSSE reads the next event or comment; a retry field is reported as
+// the comment "retry".
+func readSSE(t *testing.T, br *bufio.Reader) testSSE {
+	t.Helper()
+	var ev testSSE
+	for {
+		line, err := br.ReadString('\n')
+		if err != nil {
+			t.Fatalf("read event: %v", err)
+		}
+		line = strings.TrimSuffix(line, "\n")
+		if line == "" {
+			return ev
+		}
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+		switch field {
+		case "":
+			ev.comment = value
+		case "retry":
+			ev.comment = "retry"
+		case "id":
+			ev.id = value
+		case "event":
+			ev.event = value
+		case "data":
+			if err := json.Unmarshal([]byte(value), &ev.data); err != nil {
+				t.Fatalf("failed to parse data %q: %v", value, err)
+			}
+		}
+	}
+}
+
+func TestTaskEvents_Stream(t *testing.T) {
+	forEachRepo(t, func(t *testing.T, repo Repository) {
+		repo = WithEvents(repo, NewBroker())
+		srv := httptest.NewServer(newAuthServer(repo))
+		t.Cleanup(srv.Close) // after the streams are closed
+		r := srv.Config.Handler
+
+		// not in the stream, which starts with the next change
+		createdID(t, r, testRootToken, "/tasks", `{"title":"before"}`)
+		all := openEvents(t, srv, testRootToken, "", "")
+		filtered := openEvents(t, srv, testRootToken, "?tag=ops&type=created,deleted", "")
+
+		untagged := createdID(t, r, testRootToken, "/tasks", `{"title":"untagged"}`)
+		id := createdID(t, r, testRootToken, "/tasks", `{"title":"ops","tags":["Ops"]}`)
+		doAs(t, r, testRootToken, http.MethodPatch, fmt.Sprintf("/tasks/%d", id), `{"done":true}`)
+		if err := repo.Delete(context.Background(), Scope{}, id); err != nil {
+			t.Fatalf("delete: %v", err)
+		}
+
+		var ids []string
+		for _, want := range []struct {
+			event string
+			task  int64
+		}{{EventCreated, untagged}, {EventCreated, id}, {EventUpdated, id}, {EventDeleted, id}} {
+			ev := readSSE(t, all)
+			if ev.event != want.event || ev.data.Type != want.event || ev.data.Task.ID != want.task {
+				t.Fatalf("expected %s of task %d, got %+v", want.event, want.task, ev)
+			}
+			ids = append(ids, ev.id)
+		}
+		if ids[0] == ids[1] || ids[1] == ids[2] {
+			t.Fatalf("expected distinct event ids, got %v", ids)
+		}
+		for _, want := range []string{EventCreated, EventDeleted} {
+			ev := readSSE(t, filtered)
+			if ev.event != want || ev.data.Task.ID != id {
+				t.Fatalf("expected %s of task %d, got %+v", want, id, ev)
+			}
+		}
+
+		// resuming replays the log after the given event
+		resumed := openEvents(t, srv, testRootToken, "", ids[1])
+		for _, want := range ids[2:] {
+			if ev := readSSE(t, resumed); ev.id != want {
+				t.Fatalf("expected event %s after resuming, got %+v", want, ev)
+			}
+		}
+	})
+}
+
+func TestTaskEvents_Scope(t *testing.T) {
+	srv := httptest.NewServer(newAuthServer(WithEvents(NewInMemoryRepo(), NewBroker())))
+	t.Cleanup(srv.Close) // after the streams are closed
+	r := srv.Config.Handler
+	globex := createTestWorkspace(t, r, "globex", "globex-admin")
+	alice := createTestUser(t, r, "alice", false)
+
+	events := openEvents(t, srv, alice, "", "")
+	createdID(t, r, globex, "/tasks", `{"title":"theirs"}`)
+	createdID(t, r, testRootToken, "/tasks", `{"title":"admin's"}`)
+	mine := createdID(t, r, alice, "/tasks", `{"title":"mine"}`)
+
+	if ev := readSSE(t, events); ev.data.Task.ID != mine {
+		t.Fatalf("expected only the user's own task, got %+v", ev)
+	}
+}
+
+func TestTaskEvents_Heartbeat(t *testing.T) {
+	defer func(d time.Duration) { sseHeartbeat = d }(sseHeartbeat)
+	sseHeartbeat = 10 * time.Millisecond
+
+	srv := httptest.NewServer(newAuthServer(WithEvents(NewInMemoryRepo(), NewBroker())))
+	t.Cleanup(srv.Close) // after the streams are closed
+
+	if ev := readSSE(t, openEvents(t, srv, testRootToken, "", "")); ev.comment != "heartbeat" {
+		t.Fatalf("expected a heartbeat, got %+v", ev)
+	}
+}
+
+func TestTaskEvents_Validation(t *testing.T) {
+	r := newAuthServer(NewInMemoryRepo())
+	req := httptest.NewRequest(http.MethodGet, "/tasks/events?project_id=x&type=created,renamed", nil)
+	req.Header.Set("Authorization", "Bearer "+testRootToken)
+	req.Header.Set("Last-Event-ID", "latest")
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("expected 422, got %d, body=%s", rec.Code, rec.Body.String())
+	}
+	var resp errResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to parse JSON: %v", err)
+	}
+	if len(resp.Details) != 3 {
+		t.Fatalf("expected 3 field errors, got %+v", resp.Details)
+	}
+}
@@ -0,0 +1,107 @@
+package tasks
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultStatsDays = 30
+	maxStatsDays     = 366
+)
+
+// getStats summarizes the caller's tasks for the range from..to (inclusive
+// UTC dates, defaulting to the last 30 days), optionally in one project.
+func getStats(repo Repository, now func() time.Time) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		q, vErrs, err := parseStatsQuery(r, repo, now().UTC())
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, errResponse{Error: "unexpected_error"})
+			return
+		}
+		if len(vErrs) > 0 {
+			writeValidation(w, vErrs)
+			return
+		}
+
+		st, err := repo.Stats(r.Context(), callerScope(r.Context()), q)
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, errResponse{Error: "unexpected_error"})
+			return
+		}
+		writeJSON(w, http.StatusOK, st)
+	}
+}
+
+func parseStatsQuery(r *http.Request, repo Repository, now time.Time) (StatsQuery, []fieldError, error) {
+	params := r.URL.Query()
+	q := StatsQuery{Now: now, To: now.Truncate(24 * time.Hour)}
+	var errs []fieldError
+
+	for _, p := range []struct {
+		name string
+		dst  *time.Time
+	}{{"to", &q.To}, {"from", &q.From}} {
+		s := params.Get(p.name)
+		if s == "" {
+			continue
+		}
+		d, err := time.Parse(time.DateOnly, s)
+		if err != nil {
+			errs = append(errs, fieldError{Field: p.name, Message: p.name + " must be a date (YYYY-MM-DD)"})
+			continue
+		}
+		*p.dst = d
+	}
+	if params.Get("from") == "" {
+		q.From = q.To.AddDate(0, 0, 1-defaultStatsDays)
+	}
+	if len(errs) == 0 {
+		switch days := int(q.To.Sub(q.From)/(24*time.Hour)) + 1; {
+		case days < 1:
+			errs = append(errs, fieldError{Field: "from", Message: "from must not be after to"})
+		case days > maxStatsDays:
+			errs = append(errs, fieldError{Field: "from", Message: fmt.Sprintf("the range may span at most %d days", maxStatsDays)})
+		}
+	}
+
+	if s := params.Get("project_id"); s != "" {
+		id, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			errs = append(errs, fieldError{Field: "project_id", Message: "project_id must be an integer"})
+		} else {
+			q.ProjectID = &id
+			_, err := repo.GetProject(r.Context(), callerScope(r.Context()), id)
+			if errors.Is(err, ErrNotFound) {
+				errs = append(errs, fieldError{Field: "project_id", Message: "project not found"})
+			} else if err != nil {
+				return StatsQuery{}, nil, err
+			}
+		}
+	}
+	return q, errs, nil
+}
+
+// statsDays returns one zeroed entry per day from from to to.
+func statsDays(from, to time.Time) []DayStats {
+	var out []DayStats
+	for d := from; !d.After(to); d = d.AddDate(0, 0, 1) {
+		out = append(out, DayStats{Date: d.Format(time.DateOnly)})
+	}
+	return out
+}
+
+// nearestRank returns the p-th percentile of sorted, or nil if it is empty.
+// The SQL in SQLiteRepo.Stats computes the same rank, ceil(p*n/100).
+func nearestRank(sorted []int64, p int) *int64 {
+	if len(sorted) == 0 {
+		return nil
+	}
+	v := sorted[(p*len(sorted)+99)/100-1]
+	return &v
+}
@@ -0,0 +1,130 @@
+package tasks
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// backdate rewrites a task's timestamps, which repositories otherwise set
+// from the clock.
+func backdate(t *testing.T, repo Repository, id int64, created time.Time, completed *time.Time) {
+	t.Helper()
+	switch r := repo.(type) {
+	case *InMemoryRepo:
+		r.mu.Lock()
+		task := r.store[id]
+		task.CreatedAt, task.CompletedAt = created, completed
+		r.store[id] = task
+		r.mu.Unlock()
+	case *SQLiteRepo:
+		_, err := r.db.Exec(`UPDATE tasks SET created_at = ?, completed_at = ? WHERE id = ?`,
+			created.Format(time.RFC3339Nano), formatTime(completed), id)
+		if err != nil {
+			t.Fatalf("backdate: %v", err)
+		}
+	case *EventSourcedRepo:
+		// the read model is what Stats reads
+		backdate(t, r.SQLiteRepo, id, created, completed)
+	default:
+		t.Fatalf("backdate: unsupported repository %T", repo)
+	}
+}
+
+func TestStats(t *testing.T) {
+	day := func(d int, h int) time.Time { return time.Date(2026, 3, d, h, 0, 0, 0, time.UTC) }
+	ptr := func(v time.Time) *time.Time { return &v }
+	now := day(6, 12)
+
+	forEachRepo(t, func(t *testing.T, repo Repository) {
+		ctx := context.Background()
+		p, err := repo.CreateProject(ctx, Scope{}, "p", nil)
+		if err != nil {
+			t.Fatalf("create project: %v", err)
+		}
+		tasks := []struct {
+			in        TaskInput
+			created   time.Time
+			completed *time.Time
+		}{
+			{TaskInput{Title: "a"}, day(1, 9), ptr(day(1, 10))},                  // 1h
+			{TaskInput{Title: "b"}, day(1, 9), ptr(day(2, 9))},                   // 24h
+			{TaskInput{Title: "c", ProjectID: &p.ID}, day(2, 0), ptr(day(4, 0))}, // 48h
+			{TaskInput{Title: "d", DueAt: ptr(day(5, 0))}, day(3, 8), nil},       // overdue
+			{TaskInput{Title: "e", DueAt: ptr(day(9, 0))}, day(4, 8), nil},
+			{TaskInput{Title: "f"}, day(20, 8), nil}, // outside the range
+		}
+		for _, tt := range tasks {
+			created, err := repo.Create(ctx, Scope{}, tt.in)
+			if err != nil {
+				t.Fatalf("create: %v", err)
+			}
+			if tt.completed != nil {
+				done := true
+				if _, err := repo.Update(ctx, Scope{}, created.ID, TaskPatch{Done: &done}); err != nil {
+					t.Fatalf("update: %v", err)
+				}
+			}
+			backdate(t, repo, created.ID, tt.created, tt.completed)
+		}
+
+		r := newTestServer(repo)
+		cases := []struct {
+			name  string
+			query string
+			want  Stats
+		}{
+			{"range", "?from=2026-03-01&to=2026-03-04", Stats{
+				ByStatus: StatusCounts{Open: 3, Done: 3, Overdue: 1},
+				Daily: []DayStats{
+					{Date: "2026-03-01", Created: 2, Completed: 1},
+					{Date: "2026-03-02", Created: 1, Completed: 1},
+					{Date: "2026-03-03", Created: 1},
+					{Date: "2026-03-04", Created: 1, Completed: 1},
+				},
+				CycleTime: CycleTime{Count: 3, P50: ptrInt64(86400), P90: ptrInt64(172800), P95: ptrInt64(172800)},
+			}},
+			{"project", "?from=2026-03-01&to=2026-03-02&project_id=1", Stats{
+				ByStatus: StatusCounts{Done: 1},
+				Daily: []DayStats{
+					{Date: "2026-03-01"},
+					{Date: "2026-03-02", Created: 1},
+				},
+				CycleTime: CycleTime{},
+			}},
+		}
+		for _, tc := range cases {
+			req := httptest.NewRequest(http.MethodGet, "/stats"+tc.query, nil)
+			rec := httptest.NewRecorder()
+			getStats(repo, func() time.Time { return now }).ServeHTTP(rec, req)
+			if rec.Code != http.StatusOK {
+				t.Fatalf("%s: expected 200, got %d, body=%s", tc.name, rec.Code, rec.Body.String())
+			}
+			var got Stats
+			if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+				t.Fatalf("%s: failed to parse JSON: %v", tc.name, err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Fatalf("%s: unexpected stats:\n got %s", tc.name, rec.Body.String())
+			}
+		}
+
+		for _, q := range []string{"?from=2026-03-05&to=2026-03-01", "?from=2025-01-01&to=2026-03-01", "?to=march", "?project_id=99"} {
+			rec := doJSON(t, r, http.MethodGet, "/stats"+q, "")
+			if rec.Code != http.StatusUnprocessableEntity {
+				t.Fatalf("%s: expected 422, got %d", q, rec.Code)
+			}
+		}
+		rec := doJSON(t, r, http.MethodGet, "/stats", "")
+		var def Stats
+		if err := json.Unmarshal(rec.Body.Bytes(), &def); err != nil || len(def.Daily) != defaultStatsDays {
+			t.Fatalf("expected %d days by default, got %s", defaultStatsDays, rec.Body.String())
+		}
+	})
+}
+
+func ptrInt64(v int64) *int64 { return &v }
@@ -0,0 +1,132 @@
+package tasks
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+const (
+	ndjsonType = "application/x-ndjson"
+	// streamFlushEvery is how many tasks are written between flushes.
+	streamFlushEvery = 100
+)
+
+// accepts reports whether the Accept header lists mediaType explicitly;
+// wildcards keep the default JSON response.
+func accepts(r *http.Request, mediaType string) bool {
+	for _, part := range strings.Split(r.Header.Get("Accept"), ",") {
+		if matchMediaType(part, mediaType) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchMediaType reports whether value is mediaType, carrying at least the
+// parameters mediaType has: "text/plain; charset=utf-8; format=todotxt"
+// matches "text/plain; format=todotxt" but "text/plain" does not.
+func matchMediaType(value, mediaType string) bool {
+	mt, params, err := mime.ParseMediaType(strings.TrimSpace(value))
+	if err != nil {
+		return false
+	}
+	want, wantParams, _ := mime.ParseMediaType(mediaType)
+	if mt != want {
+		return false
+	}
+	for k, v := range wantParams {
+		if params[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+// taskEncoder writes a streamed list of tasks in one format.
+type taskEncoder interface {
+	encode(t Task) error
+	// end completes the document after the last task, if any.
+	end() error
+	// fail ends a document cut short by an error. It reports false if the
+	// format has no way to say so; the response is then aborted instead.
+	fail() bool
+}
+
+// ndjsonEncoder writes one JSON object per line, as projected by render.
+type ndjsonEncoder struct {
+	enc    *json.Encoder
+	render func(Task) (any, error)
+}
+
+func newNDJSONEncoder(w io.Writer, render func(Task) (any, error)) *ndjsonEncoder {
+	return &ndjsonEncoder{enc: json.NewEncoder(w), render: render}
+}
+
+func (e *ndjsonEncoder) encode(t Task) error {
+	v, err := e.render(t)
+	if err != nil {
+		return err
+	}
+	return e.enc.Encode(v)
+}
+
+func (e *ndjsonEncoder) end() error { return nil }
+
+func (e *ndjsonEncoder) fail() bool {
+	return e.enc.Encode(errResponse{Error: "unexpected_error"}) == nil
+}
+
+// streamTasks writes the tasks matching q straight from Repository.Stream.
+// The response is flushed every streamFlushEvery tasks and stops quietly
+// when the client goes away. An error, including a timeout, before the
+// first task is a 500; after it the status is sent already, so enc.fail
+// ends the document instead.
+func streamTasks(w http.ResponseWriter, r *http.Request, repo Repository, s Scope, q ListQuery, contentType string, enc taskEncoder) {
+	ctx := r.Context()
+	rc := http.NewResponseController(w)
+	n := 0
+	start := func() {
+		w.Header().Set("Content-Type", contentType)
+		w.WriteHeader(http.StatusOK)
+	}
+	err := repo.Stream(ctx, s, q, func(t Task) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if n == 0 {
+			start()
+		}
+		if err := enc.encode(t); err != nil {
+			return err
+		}
+		if n++; n%streamFlushEvery == 0 {
+			_ = rc.Flush()
+		}
+		return nil
+	})
+	switch {
+	case errors.Is(ctx.Err(), context.Canceled):
+		// the client is gone
+		return
+	case err != nil && n == 0:
+		writeJSON(w, http.StatusInternalServerError, errResponse{Error: "unexpected_error"})
+		return
+	case err != nil:
+		if !enc.fail() {
+			panic(http.ErrAbortHandler)
+		}
+	default:
+		if n == 0 {
+			start()
+		}
+		if err := enc.end(); err != nil {
+			return
+		}
+	}
+	_ = rc.Flush()
+}
@@ -0,0 +1,145 @@
+package tasks
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGetTasks_NDJSON(t *testing.T) {
+	const n = 2*streamBatch + 50
+
+	forEachRepo(t, func(t *testing.T, repo Repository) {
+		ctx := context.Background()
+		for i := range n {
+			in := TaskInput{Title: fmt.Sprint("t", i), Tags: []string{fmt.Sprint("tag", i)}}
+			if _, err := repo.Create(ctx, Scope{}, in); err != nil {
+				t.Fatalf("create: %v", err)
+			}
+		}
+		r := newTestServer(repo)
+
+		req := httptest.NewRequest(http.MethodGet, "/tasks?sort=-id&fields=title,tags", nil)
+		req.Header.Set("Accept", "application/x-ndjson")
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d, body=%s", rec.Code, rec.Body.String())
+		}
+		if ct := rec.Header().Get("Content-Type"); ct != ndjsonType {
+			t.Fatalf("expected Content-Type %s, got %q", ndjsonType, ct)
+		}
+		if !rec.Flushed {
+			t.Fatalf("expected the stream to be flushed")
+		}
+		lines := strings.Split(strings.TrimSuffix(rec.Body.String(), "\n"), "\n")
+		if len(lines) != n {
+			t.Fatalf("expected %d lines, got %d", n, len(lines))
+		}
+		for i, line := range lines {
+			var got Task
+			if err := json.Unmarshal([]byte(line), &got); err != nil {
+				t.Fatalf("line %d: %v", i+1, err)
+			}
+			// children are loaded per batch, so check every task's own tag
+			want := n - 1 - i
+			if got.ID != int64(want+1) || got.Title != fmt.Sprint("t", want) || len(got.Tags) != 1 || got.Tags[0] != fmt.Sprint("tag", want) {
+				t.Fatalf("line %d: unexpected task %s", i+1, line)
+			}
+			if !got.CreatedAt.IsZero() {
+				t.Fatalf("line %d: expected only the selected fields, got %s", i+1, line)
+			}
+		}
+
+		// no tasks is an empty stream, not an error
+		req = httptest.NewRequest(http.MethodGet, "/tasks?tag=none", nil)
+		req.Header.Set("Accept", "application/json, application/x-ndjson")
+		rec = httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK || rec.Body.Len() != 0 {
+			t.Fatalf("expected an empty 200 stream, got %d, body=%s", rec.Code, rec.Body.String())
+		}
+	})
+}
+
+// cancelOnFlush cancels the request the first time the stream is flushed,
+// like a client that disconnects partway through.
+type cancelOnFlush struct {
+	*httptest.ResponseRecorder
+	cancel context.CancelFunc
+}
+
+func (w cancelOnFlush) Flush() {
+	w.ResponseRecorder.Flush()
+	w.cancel()
+}
+
+func TestGetTasks_NDJSONCancel(t *testing.T) {
+	repo := newTempDB(t)
+	for i := range 3 * streamFlushEvery {
+		if _, err := repo.Create(context.Background(), Scope{}, TaskInput{Title: fmt.Sprint("t", i)}); err != nil {
+			t.Fatalf("create: %v", err)
+		}
+	}
+	r := newTestServer(repo)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req := httptest.NewRequestWithContext(ctx, http.MethodGet, "/tasks", nil)
+	req.Header.Set("Accept", "application/x-ndjson")
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(cancelOnFlush{ResponseRecorder: rec, cancel: cancel}, req)
+
+	lines := 0
+	sc := bufio.NewScanner(rec.Body)
+	for sc.Scan() {
+		if strings.Contains(sc.Text(), "unexpected_error") {
+			t.Fatalf("expected the stream to stop quietly, got %s", sc.Text())
+		}
+		lines++
+	}
+	if lines != streamFlushEvery {
+		t.Fatalf("expected the stream to stop after %d lines, got %d", streamFlushEvery, lines)
+	}
+}
+
+// stallOnFlush holds the first flush of the stream until the request's
+// deadline passes, like an export that takes longer than the timeout.
+type stallOnFlush struct {
+	*httptest.ResponseRecorder
+	ctx context.Context
+}
+
+func (w stallOnFlush) Flush() {
+	w.ResponseRecorder.Flush()
+	<-w.ctx.Done()
+}
+
+func TestGetTasks_NDJSONDeadline(t *testing.T) {
+	repo := newTempDB(t)
+	for i := range 3 * streamFlushEvery {
+		if _, err := repo.Create(context.Background(), Scope{}, TaskInput{Title: fmt.Sprint("t", i)}); err != nil {
+			t.Fatalf("create: %v", err)
+		}
+	}
+	r := newTestServer(repo)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	req := httptest.NewRequestWithContext(ctx, http.MethodGet, "/tasks", nil)
+	req.Header.Set("Accept", "application/x-ndjson")
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(stallOnFlush{ResponseRecorder: rec, ctx: ctx}, req)
+
+	lines := strings.Split(strings.TrimSuffix(rec.Body.String(), "\n"), "\n")
+	if len(lines) != streamFlushEvery+1 || !strings.Contains(lines[len(lines)-1], "unexpected_error") {
+		t.Fatalf("expected %d tasks and an error marker, got %d lines ending %q", streamFlushEvery, len(lines), lines[len(lines)-1])
+	}
+}
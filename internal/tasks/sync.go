@@ -0,0 +1,506 @@
+package tasks
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// defaultSyncLimit is how many changes a pull returns by default.
+	defaultSyncLimit = 100
+	// maxSyncChanges is how many changes a push may carry.
+	maxSyncChanges = 500
+	maxClientIDLen = 100
+)
+
+// syncToken is where a client is in the sync of its workspace: after the
+// change at position pos and, while a first pull is still listing the
+// tasks, after the task afterID of that listing. Clients get it encoded
+// and treat it as opaque.
+type syncToken struct {
+	pos     int64
+	listing bool
+	afterID int64
+}
+
+func (t syncToken) String() string {
+	s := "c" + strconv.FormatInt(t.pos, 10)
+	if t.listing {
+		s = fmt.Sprintf("l%d.%d", t.pos, t.afterID)
+	}
+	return base64.RawURLEncoding.EncodeToString([]byte(s))
+}
+
+func parseSyncToken(s string) (syncToken, bool) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || len(b) < 2 {
+		return syncToken{}, false
+	}
+	var t syncToken
+	switch b[0] {
+	case 'c':
+		t.pos, err = strconv.ParseInt(string(b[1:]), 10, 64)
+	case 'l':
+		pos, after, ok := strings.Cut(string(b[1:]), ".")
+		if !ok {
+			return syncToken{}, false
+		}
+		t.listing = true
+		if t.pos, err = strconv.ParseInt(pos, 10, 64); err == nil {
+			t.afterID, err = strconv.ParseInt(after, 10, 64)
+		}
+	default:
+		return syncToken{}, false
+	}
+	if err != nil || t.pos < 0 || t.afterID < 0 {
+		return syncToken{}, false
+	}
+	return t, true
+}
+
+// syncChange is a task as a pull returns it: its state, or a tombstone if
+// it was deleted. ChangedAt is left out of the first pull's listing.
+type syncChange struct {
+	ID        int64      `json:"id"`
+	Deleted   bool       `json:"deleted,omitempty"`
+	Task      *Task      `json:"task,omitempty"`
+	ChangedAt *time.Time `json:"changed_at,omitempty"`
+}
+
+type syncPullResponse struct {
+	Changes []syncChange `json:"changes"`
+	Token   string       `json:"token"`
+	HasMore bool         `json:"has_more"`
+}
+
+// pullChanges serves GET /sync. Without since it lists every task the
+// caller can see, a page at a time, and then hands out a token for the
+// changes made since the listing began; with since it returns each task
+// changed after the token once, in its latest state, with tombstones for
+// deleted tasks and for tasks the caller could see as of the token but no
+// longer can. A client pulls until has_more is false and keeps the
+// last token for next time.
+func pullChanges(repo Repository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		var vErrs []fieldError
+		params := r.URL.Query()
+		limit := defaultSyncLimit
+		if s := params.Get("limit"); s != "" {
+			n, err := strconv.Atoi(s)
+			if err != nil || n < 1 || n > maxPageSize {
+				vErrs = append(vErrs, fieldError{Field: "limit", Message: fmt.Sprintf("limit must be an integer from 1 to %d", maxPageSize)})
+			}
+			limit = n
+		}
+		var (
+			tok   syncToken
+			start = !params.Has("since")
+		)
+		if !start {
+			var ok bool
+			if tok, ok = parseSyncToken(params.Get("since")); !ok {
+				vErrs = append(vErrs, fieldError{Field: "since", Message: "since must be a token from an earlier pull"})
+			}
+		}
+		if len(vErrs) > 0 {
+			writeValidation(w, vErrs)
+			return
+		}
+
+		ctx := r.Context()
+		s := callerScope(ctx)
+		if start {
+			// changes made while the listing is paged through are pulled
+			// after it, so none is missed
+			pos, err := repo.SyncPosition(ctx, s)
+			if err != nil {
+				writeJSON(w, http.StatusInternalServerError, errResponse{Error: "unexpected_error"})
+				return
+			}
+			tok = syncToken{pos: pos, listing: true}
+		}
+
+		out := syncPullResponse{Changes: []syncChange{}}
+		if tok.listing {
+			ts, err := repo.List(ctx, s, ListQuery{AfterID: tok.afterID, Limit: limit})
+			if err != nil {
+				writeJSON(w, http.StatusInternalServerError, errResponse{Error: "unexpected_error"})
+				return
+			}
+			for i := range ts {
+				out.Changes = append(out.Changes, syncChange{ID: ts[i].ID, Task: &ts[i]})
+			}
+			if len(ts) == limit {
+				tok.afterID = ts[len(ts)-1].ID
+				out.HasMore = true
+			} else {
+				tok = syncToken{pos: tok.pos}
+			}
+			out.Token = tok.String()
+			writeJSON(w, http.StatusOK, out)
+			return
+		}
+
+		// Changes does not filter by visibility, so read on until the page
+		// is full or the log is exhausted
+		since := tok.pos
+		for more := true; more && len(out.Changes) < limit; {
+			events, err := repo.Changes(ctx, s, tok.pos, limit)
+			if err != nil {
+				writeJSON(w, http.StatusInternalServerError, errResponse{Error: "unexpected_error"})
+				return
+			}
+			more = len(events) == limit
+			for _, e := range events {
+				if len(out.Changes) == limit {
+					more = true
+					break
+				}
+				tok.pos = e.ID
+				ok, err := eventVisible(ctx, repo, s, e)
+				if err != nil {
+					writeJSON(w, http.StatusInternalServerError, errResponse{Error: "unexpected_error"})
+					return
+				}
+				hidden := false
+				if !ok {
+					// a task the client had but may no longer see goes
+					// away like a deleted one
+					if hidden, err = visibleAt(ctx, repo, s, e.Task.ID, since); err != nil {
+						writeJSON(w, http.StatusInternalServerError, errResponse{Error: "unexpected_error"})
+						return
+					}
+					if !hidden {
+						continue
+					}
+				}
+				c := syncChange{ID: e.Task.ID, ChangedAt: &e.At}
+				if hidden || e.Type == EventDeleted {
+					c.Deleted = true
+				} else {
+					c.Task = &e.Task
+				}
+				out.Changes = append(out.Changes, c)
+			}
+			out.HasMore = more
+		}
+		out.Token = tok.String()
+		writeJSON(w, http.StatusOK, out)
+	}
+}
+
+// visibleAt reports whether s could see the task id as of the position
+// pos, by its latest change up to then.
+func visibleAt(ctx context.Context, repo Repository, s Scope, id, pos int64) (bool, error) {
+	e, err := repo.ChangeAt(ctx, s, id, pos)
+	if errors.Is(err, ErrNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return eventVisible(ctx, repo, s, e)
+}
+
+type syncPushRequest struct {
+	Changes []syncPushChange `json:"changes"`
+}
+
+// syncPushChange creates a task when it has a ClientID, and otherwise
+// updates or deletes the task ID as of ChangedAt. Fields holds the body
+// of POST /tasks or PATCH /tasks/{id}.
+type syncPushChange struct {
+	ID        *int64          `json:"id"`
+	ClientID  string          `json:"client_id"`
+	Fields    json.RawMessage `json:"fields"`
+	Deleted   bool            `json:"deleted"`
+	ChangedAt *time.Time      `json:"changed_at"`
+}
+
+type syncResult struct {
+	ID       int64  `json:"id,omitempty"`
+	ClientID string `json:"client_id,omitempty"`
+	// Status is created, updated, unchanged, deleted, kept, conflict or
+	// not_found.
+	Status string `json:"status"`
+	Task   *Task  `json:"task,omitempty"`
+}
+
+// syncConflict reports a client change the server did not take: Reason
+// newer means the server changed Field after the client did, and deleted
+// that the task was deleted.
+type syncConflict struct {
+	ID              int64           `json:"id"`
+	Field           string          `json:"field,omitempty"`
+	Reason          string          `json:"reason"`
+	ServerValue     json.RawMessage `json:"server_value,omitempty"`
+	ClientValue     json.RawMessage `json:"client_value,omitempty"`
+	ServerChangedAt *time.Time      `json:"server_changed_at,omitempty"`
+}
+
+type syncPushResponse struct {
+	Results   []syncResult   `json:"results"`
+	Conflicts []syncConflict `json:"conflicts"`
+}
+
+// syncOp is a validated change of a push.
+type syncOp struct {
+	change syncPushChange
+	in     TaskInput
+	patch  TaskPatch
+	at     time.Time
+	values map[string]json.RawMessage // the client's fields, for conflicts
+}
+
+// pushChanges serves POST /sync. Every change is checked before any is
+// applied; they are then applied in order. Updates are merged
+// attribute by attribute, the latest change winning: an attribute the
+// server changed after changed_at keeps its value and is reported as a
+// conflict, as is every change to a deleted task. A delete loses to any
+// later change of the task. changed_at in the future counts as now.
+func pushChanges(repo Repository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		var req syncPushRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeJSON(w, http.StatusBadRequest, errResponse{Error: "invalid_json"})
+			return
+		}
+		ops, vErrs, err := checkSyncChanges(r, repo, req.Changes)
+		var syntaxErr *json.SyntaxError
+		var typeErr *json.UnmarshalTypeError
+		switch {
+		case errors.As(err, &syntaxErr), errors.As(err, &typeErr):
+			writeJSON(w, http.StatusBadRequest, errResponse{Error: "invalid_json"})
+			return
+		case errors.Is(err, errForbidden):
+			writeJSON(w, http.StatusForbidden, errResponse{Error: "forbidden"})
+			return
+		case err != nil:
+			writeJSON(w, http.StatusInternalServerError, errResponse{Error: "unexpected_error"})
+			return
+		case len(vErrs) > 0:
+			writeValidation(w, vErrs)
+			return
+		}
+
+		ctx := r.Context()
+		s := callerScope(ctx)
+		out := syncPushResponse{Results: make([]syncResult, 0, len(ops)), Conflicts: []syncConflict{}}
+		for _, op := range ops {
+			c := op.change
+			if c.ID == nil {
+				t, err := repo.Create(ctx, s, op.in)
+				if err != nil {
+					writeJSON(w, http.StatusInternalServerError, errResponse{Error: "unexpected_error"})
+					return
+				}
+				out.Results = append(out.Results, syncResult{ID: t.ID, ClientID: c.ClientID, Status: "created", Task: &t})
+				continue
+			}
+
+			id := *c.ID
+			res := syncResult{ID: id}
+			var (
+				t     Task
+				stale []FieldClock
+				err   error
+			)
+			if c.Deleted {
+				res.Status = "deleted"
+				if stale, err = repo.MergeDelete(ctx, s, id, op.at); err == nil && len(stale) > 0 {
+					res.Status = "kept"
+					t, err = repo.Get(ctx, s, id)
+					res.Task = &t
+				}
+			} else {
+				res.Status = "updated"
+				t, stale, err = repo.MergeUpdate(ctx, s, id, op.patch, op.at)
+				if len(stale) == len(patchFields(op.patch)) {
+					res.Status = "unchanged"
+				}
+				res.Task = &t
+			}
+			switch {
+			case errors.Is(err, ErrDeleted):
+				out.Results = append(out.Results, syncResult{ID: id, Status: "conflict"})
+				out.Conflicts = append(out.Conflicts, syncConflict{ID: id, Reason: "deleted"})
+				continue
+			case errors.Is(err, ErrNotFound):
+				out.Results = append(out.Results, syncResult{ID: id, Status: "not_found"})
+				continue
+			case err != nil:
+				writeJSON(w, http.StatusInternalServerError, errResponse{Error: "unexpected_error"})
+				return
+			}
+			conflicts, err := staleConflicts(t, stale, op.values)
+			if err != nil {
+				writeJSON(w, http.StatusInternalServerError, errResponse{Error: "unexpected_error"})
+				return
+			}
+			out.Results = append(out.Results, res)
+			out.Conflicts = append(out.Conflicts, conflicts...)
+		}
+		writeJSON(w, http.StatusOK, out)
+	}
+}
+
+// checkSyncChanges validates the changes of a push and turns them into
+// operations. Error fields are prefixed with the index of their change.
+func checkSyncChanges(r *http.Request, repo Repository, changes []syncPushChange) ([]syncOp, []fieldError, error) {
+	ctx := r.Context()
+	if len(changes) > maxSyncChanges {
+		return nil, []fieldError{{Field: "changes", Message: fmt.Sprintf("at most %d changes are allowed", maxSyncChanges)}}, nil
+	}
+	var (
+		errs      []fieldError
+		ops       = make([]syncOp, len(changes))
+		clientIDs = make(map[string]bool)
+		now       = time.Now().UTC()
+	)
+	for i, c := range changes {
+		prefix := fmt.Sprintf("changes[%d].", i)
+		fail := func(field, msg string) {
+			errs = append(errs, fieldError{Field: prefix + field, Message: msg})
+		}
+		op := syncOp{change: c}
+		if len(c.Fields) > 0 && !bytes.Equal(c.Fields, []byte("null")) {
+			if err := json.Unmarshal(c.Fields, &op.values); err != nil {
+				return nil, nil, err
+			}
+		}
+
+		switch {
+		case (c.ID == nil) == (c.ClientID == ""):
+			fail("id", "exactly one of id and client_id is required")
+
+		case c.ID == nil:
+			switch {
+			case len(c.ClientID) > maxClientIDLen:
+				fail("client_id", fmt.Sprintf("client_id must be at most %d characters", maxClientIDLen))
+			case clientIDs[c.ClientID]:
+				fail("client_id", "client_id must be unique within a push")
+			}
+			clientIDs[c.ClientID] = true
+			if c.Deleted {
+				fail("deleted", "a new task cannot be deleted")
+			}
+			var req createTaskRequest
+			if op.values != nil {
+				if err := json.Unmarshal(c.Fields, &req); err != nil {
+					return nil, nil, err
+				}
+			}
+			op.in = TaskInput{
+				Title:       req.Title,
+				ProjectID:   req.ProjectID,
+				ParentID:    req.ParentID,
+				Tags:        req.Tags,
+				Checklist:   req.Checklist,
+				Fields:      req.Fields,
+				DueAt:       req.DueAt,
+				Priority:    req.Priority,
+				Assignee:    req.Assignee,
+				AssigneeIDs: req.AssigneeIDs,
+				OwnerID:     callerID(ctx),
+			}
+			fErrs, err := checkTaskInput(ctx, repo, prefix+"fields.", &op.in)
+			if err != nil {
+				return nil, nil, err
+			}
+			errs = append(errs, fErrs...)
+
+		default:
+			if c.ChangedAt == nil {
+				fail("changed_at", "changed_at is required")
+			} else {
+				op.at = c.ChangedAt.UTC()
+				if op.at.After(now) {
+					op.at = now
+				}
+			}
+			if c.Deleted {
+				if op.values != nil {
+					fail("fields", "a delete must not change fields")
+				}
+			} else {
+				var req updateTaskRequest
+				if op.values != nil {
+					if err := json.Unmarshal(c.Fields, &req); err != nil {
+						return nil, nil, err
+					}
+				}
+				op.patch = TaskPatch{
+					Title:     req.Title,
+					Done:      req.Done,
+					Tags:      req.Tags,
+					Checklist: req.Checklist,
+					DueAt:     req.DueAt.Value,
+					Priority:  req.Priority,
+					Assignee:  req.Assignee,
+				}
+				op.patch.ClearDueAt = req.DueAt.Set && req.DueAt.Value == nil
+				if len(patchFields(op.patch)) == 0 {
+					fail("fields", "fields must change at least one attribute")
+				}
+				pErrs, err := checkTaskPatch(ctx, repo, &op.patch)
+				if err != nil {
+					return nil, nil, err
+				}
+				for _, e := range pErrs {
+					fail("fields."+e.Field, e.Message)
+				}
+			}
+			// a task that is gone is reported when the change is applied
+			if err := checkTaskWritable(ctx, repo, *c.ID); err != nil && !errors.Is(err, ErrNotFound) {
+				return nil, nil, err
+			}
+		}
+		ops[i] = op
+	}
+	return ops, errs, nil
+}
+
+// staleConflicts reports the attributes a merge left alone, with their
+// values on t and in the client's change.
+func staleConflicts(t Task, stale []FieldClock, client map[string]json.RawMessage) ([]syncConflict, error) {
+	if len(stale) == 0 {
+		return nil, nil
+	}
+	b, err := json.Marshal(t)
+	if err != nil {
+		return nil, err
+	}
+	var server map[string]json.RawMessage
+	if err := json.Unmarshal(b, &server); err != nil {
+		return nil, err
+	}
+	out := make([]syncConflict, len(stale))
+	for i, c := range stale {
+		at := c.ChangedAt
+		out[i] = syncConflict{
+			ID:              t.ID,
+			Field:           c.Field,
+			Reason:          "newer",
+			ServerValue:     server[c.Field],
+			ClientValue:     client[c.Field],
+			ServerChangedAt: &at,
+		}
+		if out[i].ServerValue == nil {
+			// left out of the task as empty
+			out[i].ServerValue = json.RawMessage("null")
+		}
+	}
+	return out, nil
+}
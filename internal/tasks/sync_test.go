@@ -0,0 +1,288 @@
+package tasks
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+)
+
+// pullAll pulls with the given page size until has_more is false, from
+// since or from the start if since is empty, and returns the changes and
+// the last token.
+func pullAll(t *testing.T, r http.Handler, token, since string, limit int) ([]syncChange, string) {
+	t.Helper()
+	var out []syncChange
+	for first := true; ; first = false {
+		path := fmt.Sprintf("/sync?limit=%d", limit)
+		if !first || since != "" {
+			path += "&since=" + url.QueryEscape(since)
+		}
+		rec := doAs(t, r, token, http.MethodGet, path, "")
+		if rec.Code != http.StatusOK {
+			t.Fatalf("GET %s: expected 200, got %d, body=%s", path, rec.Code, rec.Body.String())
+		}
+		var page syncPullResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &page); err != nil {
+			t.Fatalf("failed to parse JSON: %v", err)
+		}
+		out, since = append(out, page.Changes...), page.Token
+		if !page.HasMore {
+			return out, since
+		}
+	}
+}
+
+func pushSync(t *testing.T, r http.Handler, token, body string) syncPushResponse {
+	t.Helper()
+	rec := doAs(t, r, token, http.MethodPost, "/sync", body)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("POST /sync: expected 200, got %d, body=%s", rec.Code, rec.Body.String())
+	}
+	var out syncPushResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &out); err != nil {
+		t.Fatalf("failed to parse JSON: %v", err)
+	}
+	return out
+}
+
+func TestSync_Pull(t *testing.T) {
+	forEachRepo(t, func(t *testing.T, repo Repository) {
+		ctx := context.Background()
+		r := newAuthServer(repo)
+		a := createdID(t, r, testRootToken, "/tasks", `{"title":"a"}`)
+		b := createdID(t, r, testRootToken, "/tasks", `{"title":"b"}`)
+		c := createdID(t, r, testRootToken, "/tasks", `{"title":"c","parent_id":`+fmt.Sprint(b)+`}`)
+
+		// the first pull lists every task, a page at a time
+		listed, token := pullAll(t, r, testRootToken, "", 2)
+		if len(listed) != 3 || listed[0].ID != a || listed[2].ID != c || listed[1].Task.Title != "b" {
+			t.Fatalf("expected the 3 tasks, got %+v", listed)
+		}
+		if changes, _ := pullAll(t, r, testRootToken, token, 2); len(changes) != 0 {
+			t.Fatalf("expected no changes yet, got %+v", changes)
+		}
+
+		for _, title := range []string{"a1", "a2"} {
+			if rec := doAs(t, r, testRootToken, http.MethodPatch, fmt.Sprintf("/tasks/%d", a), `{"title":"`+title+`"}`); rec.Code != http.StatusOK {
+				t.Fatalf("patch: expected 200, got %d", rec.Code)
+			}
+		}
+		if err := repo.Delete(ctx, Scope{}, b); err != nil {
+			t.Fatalf("delete: %v", err)
+		}
+		d := createdID(t, r, testRootToken, "/tasks", `{"title":"d"}`)
+
+		changes, next := pullAll(t, r, testRootToken, token, 2)
+		if len(changes) != 4 {
+			t.Fatalf("expected each changed task once, got %+v", changes)
+		}
+		want := []struct {
+			id      int64
+			deleted bool
+		}{{a, false}, {b, true}, {c, true}, {d, false}}
+		for i, w := range want {
+			ch := changes[i]
+			if ch.ID != w.id || ch.Deleted != w.deleted || (ch.Task == nil) != w.deleted || ch.ChangedAt == nil {
+				t.Fatalf("change %d: expected task %d deleted=%v, got %+v", i, w.id, w.deleted, ch)
+			}
+		}
+		if changes[0].Task.Title != "a2" {
+			t.Fatalf("expected the latest state, got %+v", changes[0].Task)
+		}
+		if again, _ := pullAll(t, r, testRootToken, next, 2); len(again) != 0 {
+			t.Fatalf("expected nothing after the last token, got %+v", again)
+		}
+
+		for _, since := range []string{"", "bm9wZQ", "!!"} {
+			rec := doAs(t, r, testRootToken, http.MethodGet, "/sync?since="+since, "")
+			if rec.Code != http.StatusUnprocessableEntity {
+				t.Fatalf("since=%q: expected 422, got %d, body=%s", since, rec.Code, rec.Body.String())
+			}
+		}
+	})
+}
+
+func TestSync_Push(t *testing.T) {
+	forEachRepo(t, func(t *testing.T, repo Repository) {
+		r := newAuthServer(repo)
+		id := createdID(t, r, testRootToken, "/tasks", `{"title":"draft"}`)
+		before := time.Now().UTC().Add(-time.Hour).Format(time.RFC3339Nano)
+		if rec := doAs(t, r, testRootToken, http.MethodPatch, fmt.Sprintf("/tasks/%d", id), `{"title":"server"}`); rec.Code != http.StatusOK {
+			t.Fatalf("patch: expected 200, got %d", rec.Code)
+		}
+
+		// an older client change loses the title but keeps the priority
+		out := pushSync(t, r, testRootToken, fmt.Sprintf(`{"changes":[
+			{"id":%d,"fields":{"title":"client","priority":2},"changed_at":%q},
+			{"client_id":"local-1","fields":{"title":"offline"}}
+		]}`, id, before))
+		if len(out.Results) != 2 {
+			t.Fatalf("expected 2 results, got %+v", out.Results)
+		}
+		if res := out.Results[0]; res.Status != "updated" || res.Task.Title != "server" || res.Task.Priority != 2 {
+			t.Fatalf("expected a partial update, got %+v", res)
+		}
+		if res := out.Results[1]; res.Status != "created" || res.ClientID != "local-1" || res.ID == 0 || res.Task.Title != "offline" {
+			t.Fatalf("expected a created task, got %+v", res)
+		}
+		if len(out.Conflicts) != 1 {
+			t.Fatalf("expected 1 conflict, got %+v", out.Conflicts)
+		}
+		if c := out.Conflicts[0]; c.ID != id || c.Field != "title" || c.Reason != "newer" ||
+			string(c.ServerValue) != `"server"` || string(c.ClientValue) != `"client"` || c.ServerChangedAt == nil {
+			t.Fatalf("unexpected conflict: %+v", c)
+		}
+
+		// a later one wins, and a clock ahead of the server counts as now
+		out = pushSync(t, r, testRootToken, fmt.Sprintf(`{"changes":[{"id":%d,"fields":{"title":"client"},"changed_at":"2999-01-01T00:00:00Z"}]}`, id))
+		if res := out.Results[0]; res.Status != "updated" || res.Task.Title != "client" || len(out.Conflicts) != 0 {
+			t.Fatalf("expected the client to win, got %+v", out)
+		}
+		rec := doAs(t, r, testRootToken, http.MethodPatch, fmt.Sprintf("/tasks/%d", id), `{"done":true}`)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("patch: expected 200, got %d", rec.Code)
+		}
+
+		// a delete loses to the later changes
+		out = pushSync(t, r, testRootToken, fmt.Sprintf(`{"changes":[{"id":%d,"deleted":true,"changed_at":%q}]}`, id, before))
+		if res := out.Results[0]; res.Status != "kept" || res.Task == nil {
+			t.Fatalf("expected the task kept, got %+v", out)
+		}
+		if len(out.Conflicts) != 2 || out.Conflicts[0].Field != "title" || out.Conflicts[1].Field != "done" || string(out.Conflicts[1].ServerValue) != "true" {
+			t.Fatalf("expected conflicts for title and done, got %+v", out.Conflicts)
+		}
+
+		now := time.Now().UTC().Format(time.RFC3339Nano)
+		out = pushSync(t, r, testRootToken, fmt.Sprintf(`{"changes":[
+			{"id":%d,"deleted":true,"changed_at":%q},
+			{"id":%d,"fields":{"done":false},"changed_at":%q},
+			{"id":%d,"deleted":true,"changed_at":%q},
+			{"id":999,"fields":{"done":true},"changed_at":%q}
+		]}`, id, now, id, now, id, now, now))
+		statuses := []string{"deleted", "conflict", "deleted", "not_found"}
+		for i, want := range statuses {
+			if out.Results[i].Status != want {
+				t.Fatalf("result %d: expected %s, got %+v", i, want, out.Results)
+			}
+		}
+		if len(out.Conflicts) != 1 || out.Conflicts[0].ID != id || out.Conflicts[0].Reason != "deleted" {
+			t.Fatalf("expected the change to the deleted task reported, got %+v", out.Conflicts)
+		}
+	})
+}
+
+func TestSync_PushValidation(t *testing.T) {
+	repo := NewInMemoryRepo()
+	r := newAuthServer(repo)
+	id := createdID(t, r, testRootToken, "/tasks", `{"title":"a"}`)
+
+	rec := doAs(t, r, testRootToken, http.MethodPost, "/sync", fmt.Sprintf(`{"changes":[
+		{"client_id":"x","fields":{"title":"ok"}},
+		{"id":%d,"client_id":"y"},
+		{"id":%d,"fields":{"title":""}},
+		{"id":%d,"fields":{"priority":1},"changed_at":"2024-01-01T00:00:00Z","deleted":true},
+		{"client_id":"x","fields":{"title":"dup"}}
+	]}`, id, id, id))
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("expected 422, got %d, body=%s", rec.Code, rec.Body.String())
+	}
+	var resp errResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to parse JSON: %v", err)
+	}
+	got := map[string]bool{}
+	for _, e := range resp.Details {
+		got[e.Field] = true
+	}
+	for _, f := range []string{"changes[1].id", "changes[2].changed_at", "changes[2].fields.title", "changes[3].fields", "changes[4].client_id"} {
+		if !got[f] {
+			t.Fatalf("expected an error for %s, got %+v", f, resp.Details)
+		}
+	}
+	if got["changes[0].fields.title"] {
+		t.Fatalf("unexpected error for a valid change: %+v", resp.Details)
+	}
+	// nothing was applied
+	if all, _ := repo.List(context.Background(), Scope{}, ListQuery{}); len(all) != 1 {
+		t.Fatalf("expected no task created, got %+v", all)
+	}
+
+	rec = doAs(t, r, testRootToken, http.MethodPost, "/sync", `{"changes":[{"client_id":"x","fields":{"title":1}}]}`)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d, body=%s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestSync_Scope(t *testing.T) {
+	forEachRepo(t, func(t *testing.T, repo Repository) {
+		ctx := context.Background()
+		r := newAuthServer(repo)
+		dev := createTestUser(t, r, "dev", false)
+		mine := createdID(t, r, dev, "/tasks", `{"title":"mine"}`)
+		gone := createdID(t, r, dev, "/tasks", `{"title":"gone"}`)
+		other := createdID(t, r, testRootToken, "/tasks", `{"title":"other"}`)
+
+		listed, token := pullAll(t, r, dev, "", 10)
+		if len(listed) != 2 || listed[0].ID != mine || listed[1].ID != gone {
+			t.Fatalf("expected only the user's tasks, got %+v", listed)
+		}
+
+		for _, id := range []int64{other, gone} {
+			if err := repo.Delete(ctx, Scope{}, id); err != nil {
+				t.Fatalf("delete: %v", err)
+			}
+		}
+		if rec := doAs(t, r, dev, http.MethodPatch, fmt.Sprintf("/tasks/%d", mine), `{"done":true}`); rec.Code != http.StatusOK {
+			t.Fatalf("patch: expected 200, got %d", rec.Code)
+		}
+		// a page of invisible changes does not end the pull early
+		changes, _ := pullAll(t, r, dev, token, 1)
+		if len(changes) != 2 || changes[0].ID != gone || !changes[0].Deleted || changes[1].ID != mine || !changes[1].Task.Done {
+			t.Fatalf("expected only the user's changes, got %+v", changes)
+		}
+
+		out := pushSync(t, r, dev, fmt.Sprintf(`{"changes":[{"id":%d,"fields":{"done":true},"changed_at":"2030-01-01T00:00:00Z"}]}`, gone))
+		if out.Results[0].Status != "conflict" || out.Conflicts[0].Reason != "deleted" {
+			t.Fatalf("expected a deleted conflict, got %+v", out)
+		}
+	})
+}
+
+func TestSync_LostAccess(t *testing.T) {
+	forEachRepo(t, func(t *testing.T, repo Repository) {
+		r := newAuthServer(repo)
+		dev := createTestUser(t, r, "dev", false)
+		devID := testUserID(t, r, dev)
+		handed := createdID(t, r, testRootToken, "/tasks", fmt.Sprintf(`{"title":"handed over","assignee_ids":[%d]}`, devID))
+		never := createdID(t, r, testRootToken, "/tasks", `{"title":"never seen"}`)
+
+		listed, token := pullAll(t, r, dev, "", 10)
+		if len(listed) != 1 || listed[0].ID != handed {
+			t.Fatalf("expected the assigned task, got %+v", listed)
+		}
+
+		if rec := doAs(t, r, testRootToken, http.MethodDelete, fmt.Sprintf("/tasks/%d/assignees/%d", handed, devID), ""); rec.Code != http.StatusOK {
+			t.Fatalf("unassign: expected 200, got %d", rec.Code)
+		}
+		if rec := doAs(t, r, testRootToken, http.MethodPatch, fmt.Sprintf("/tasks/%d", never), `{"done":true}`); rec.Code != http.StatusOK {
+			t.Fatalf("patch: expected 200, got %d", rec.Code)
+		}
+		// the task the user had goes away, the one never seen stays out
+		changes, token := pullAll(t, r, dev, token, 10)
+		if len(changes) != 1 || changes[0].ID != handed || !changes[0].Deleted || changes[0].Task != nil {
+			t.Fatalf("expected a tombstone for the unassigned task, got %+v", changes)
+		}
+
+		// and once gone, later changes of it are not sent again
+		if rec := doAs(t, r, testRootToken, http.MethodPatch, fmt.Sprintf("/tasks/%d", handed), `{"done":true}`); rec.Code != http.StatusOK {
+			t.Fatalf("patch: expected 200, got %d", rec.Code)
+		}
+		if changes, _ := pullAll(t, r, dev, token, 10); len(changes) != 0 {
+			t.Fatalf("expected no changes, got %+v", changes)
+		}
+	})
+}
@@ -0,0 +1,359 @@
+package tasks
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+const maxTemplateTasks = 100
+
+var placeholderRe = regexp.MustCompile(`\{\{\s*([A-Za-z_][A-Za-z0-9_]*)\s*\}\}`)
+
+// TemplateTask is the blueprint of a task created from a template. Title,
+// tags, checklist items and string field values may contain {{name}}
+// placeholders. Subtasks without a project_id inherit their parent's.
+type TemplateTask struct {
+	Title     string         `json:"title"`
+	ProjectID *int64         `json:"project_id,omitempty"`
+	Tags      []string       `json:"tags,omitempty"`
+	Checklist []string       `json:"checklist,omitempty"`
+	Fields    map[string]any `json:"fields,omitempty"`
+	Subtasks  []TemplateTask `json:"subtasks,omitempty"`
+}
+
+type Template struct {
+	workspaceID int64 // used by InMemoryRepo
+
+	ID           int64        `json:"id"`
+	Name         string       `json:"name"`
+	Task         TemplateTask `json:"task"`
+	Placeholders []string     `json:"placeholders"`
+	CreatedAt    time.Time    `json:"created_at"`
+}
+
+type templateRequest struct {
+	Name string       `json:"name"`
+	Task TemplateTask `json:"task"`
+}
+
+type instantiateRequest struct {
+	Values map[string]string `json:"values"`
+}
+
+func newTemplate(id int64, name string, spec TemplateTask, created time.Time) Template {
+	return Template{
+		ID:           id,
+		Name:         name,
+		Task:         spec,
+		Placeholders: spec.placeholders(),
+		CreatedAt:    created,
+	}
+}
+
+// walkStrings calls fn for every string that may hold placeholders and
+// stores its result back.
+func (t *TemplateTask) walkStrings(fn func(string) string) {
+	t.Title = fn(t.Title)
+	for i := range t.Tags {
+		t.Tags[i] = fn(t.Tags[i])
+	}
+	for i := range t.Checklist {
+		t.Checklist[i] = fn(t.Checklist[i])
+	}
+	for k, v := range t.Fields {
+		if s, ok := v.(string); ok {
+			t.Fields[k] = fn(s)
+		}
+	}
+	for i := range t.Subtasks {
+		t.Subtasks[i].walkStrings(fn)
+	}
+}
+
+func (t TemplateTask) clone() TemplateTask {
+	t.Tags = slices.Clone(t.Tags)
+	t.Checklist = slices.Clone(t.Checklist)
+	t.Fields = cloneFields(t.Fields)
+	subs := make([]TemplateTask, len(t.Subtasks))
+	for i, s := range t.Subtasks {
+		subs[i] = s.clone()
+	}
+	if len(subs) == 0 {
+		subs = nil
+	}
+	t.Subtasks = subs
+	return t
+}
+
+func (t TemplateTask) placeholders() []string {
+	seen := map[string]struct{}{}
+	c := t.clone()
+	c.walkStrings(func(s string) string {
+		for _, m := range placeholderRe.FindAllStringSubmatch(s, -1) {
+			seen[m[1]] = struct{}{}
+		}
+		return s
+	})
+	out := make([]string, 0, len(seen))
+	for k := range seen {
+		out = append(out, k)
+	}
+	slices.Sort(out)
+	return out
+}
+
+func (t TemplateTask) render(values map[string]string) TemplateTask {
+	c := t.clone()
+	c.walkStrings(func(s string) string {
+		return placeholderRe.ReplaceAllStringFunc(s, func(m string) string {
+			return values[placeholderRe.FindStringSubmatch(m)[1]]
+		})
+	})
+	return c
+}
+
+func (t TemplateTask) count() int {
+	n := 1
+	for _, s := range t.Subtasks {
+		n += s.count()
+	}
+	return n
+}
+
+// validateTemplateTask checks the parts of a template that do not depend
+// on placeholder values; everything else is validated on instantiation.
+func validateTemplateTask(r *http.Request, repo Repository, prefix string, t TemplateTask) ([]fieldError, error) {
+	var errs []fieldError
+	if strings.TrimSpace(t.Title) == "" {
+		errs = append(errs, fieldError{Field: prefix + "title", Message: "title is required"})
+	}
+	if t.ProjectID != nil {
+		_, err := repo.GetProject(r.Context(), callerScope(r.Context()), *t.ProjectID)
+		if errors.Is(err, ErrNotFound) {
+			errs = append(errs, fieldError{Field: prefix + "project_id", Message: "project not found"})
+		} else if err != nil {
+			return nil, err
+		}
+	}
+	for i, s := range t.Subtasks {
+		sub, err := validateTemplateTask(r, repo, fmt.Sprintf("%ssubtasks[%d].", prefix, i), s)
+		if err != nil {
+			return nil, err
+		}
+		errs = append(errs, sub...)
+	}
+	return errs, nil
+}
+
+// buildTree converts a rendered template into a TaskTree, validating each
+// node like POST /tasks would.
+func buildTree(r *http.Request, repo Repository, prefix string, t TemplateTask, inherited *int64) (TaskTree, []fieldError, error) {
+	project := t.ProjectID
+	if project == nil {
+		project = inherited
+	}
+	checklist := make([]ChecklistItem, 0, len(t.Checklist))
+	for _, text := range t.Checklist {
+		checklist = append(checklist, ChecklistItem{Text: text})
+	}
+	in := TaskInput{
+		Title:     t.Title,
+		ProjectID: project,
+		Tags:      t.Tags,
+		Checklist: checklist,
+		Fields:    t.Fields,
+		OwnerID:   callerID(r.Context()),
+	}
+	errs, err := checkTaskInput(r.Context(), repo, prefix, &in)
+	if err != nil {
+		return TaskTree{}, nil, err
+	}
+	node := TaskTree{TaskInput: in}
+	for i, s := range t.Subtasks {
+		child, cErrs, err := buildTree(r, repo, fmt.Sprintf("%ssubtasks[%d].", prefix, i), s, project)
+		if err != nil {
+			return TaskTree{}, nil, err
+		}
+		errs = append(errs, cErrs...)
+		node.Subtasks = append(node.Subtasks, child)
+	}
+	return node, errs, nil
+}
+
+func createTemplate(repo Repository) http.HandlerFunc {
+	const maxNameLen = 100
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		var req templateRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeJSON(w, http.StatusBadRequest, errResponse{Error: "invalid_json"})
+			return
+		}
+
+		var vErrs []fieldError
+		if strings.TrimSpace(req.Name) == "" {
+			vErrs = append(vErrs, fieldError{Field: "name", Message: "name is required"})
+		} else if len(req.Name) > maxNameLen {
+			vErrs = append(vErrs, fieldError{Field: "name", Message: fmt.Sprintf("name must be at most %d characters", maxNameLen)})
+		}
+		if n := req.Task.count(); n > maxTemplateTasks {
+			vErrs = append(vErrs, fieldError{Field: "task", Message: fmt.Sprintf("a template may create at most %d tasks", maxTemplateTasks)})
+		}
+		tErrs, err := validateTemplateTask(r, repo, "task.", req.Task)
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, errResponse{Error: "unexpected_error"})
+			return
+		}
+		vErrs = append(vErrs, tErrs...)
+		if len(vErrs) > 0 {
+			writeValidation(w, vErrs)
+			return
+		}
+
+		tpl, err := repo.CreateTemplate(r.Context(), callerScope(r.Context()), req.Name, req.Task)
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, errResponse{Error: "unexpected_error"})
+			return
+		}
+		writeJSON(w, http.StatusCreated, tpl)
+	}
+}
+
+func listTemplates(repo Repository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		tpls, err := repo.ListTemplates(r.Context(), callerScope(r.Context()))
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, errResponse{Error: "unexpected_error"})
+			return
+		}
+		writeJSON(w, http.StatusOK, tpls)
+	}
+}
+
+func getTemplate(repo Repository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		id, ok := pathID(r, "id")
+		if !ok {
+			writeJSON(w, http.StatusNotFound, errResponse{Error: "not_found"})
+			return
+		}
+		tpl, err := repo.GetTemplate(r.Context(), callerScope(r.Context()), id)
+		if errors.Is(err, ErrNotFound) {
+			writeJSON(w, http.StatusNotFound, errResponse{Error: "not_found"})
+			return
+		}
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, errResponse{Error: "unexpected_error"})
+			return
+		}
+		writeJSON(w, http.StatusOK, tpl)
+	}
+}
+
+func deleteTemplate(repo Repository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, ok := pathID(r, "id")
+		if !ok {
+			w.Header().Set("Content-Type", "application/json")
+			writeJSON(w, http.StatusNotFound, errResponse{Error: "not_found"})
+			return
+		}
+		err := repo.DeleteTemplate(r.Context(), callerScope(r.Context()), id)
+		if errors.Is(err, ErrNotFound) {
+			w.Header().Set("Content-Type", "application/json")
+			writeJSON(w, http.StatusNotFound, errResponse{Error: "not_found"})
+			return
+		}
+		if err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			writeJSON(w, http.StatusInternalServerError, errResponse{Error: "unexpected_error"})
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// instantiateTemplate renders the template with the request's values and
+// creates the resulting task tree in one transaction.
+func instantiateTemplate(repo Repository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		id, ok := pathID(r, "id")
+		if !ok {
+			writeJSON(w, http.StatusNotFound, errResponse{Error: "not_found"})
+			return
+		}
+		var req instantiateRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+			writeJSON(w, http.StatusBadRequest, errResponse{Error: "invalid_json"})
+			return
+		}
+
+		tpl, err := repo.GetTemplate(r.Context(), callerScope(r.Context()), id)
+		if errors.Is(err, ErrNotFound) {
+			writeJSON(w, http.StatusNotFound, errResponse{Error: "not_found"})
+			return
+		}
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, errResponse{Error: "unexpected_error"})
+			return
+		}
+
+		var vErrs []fieldError
+		for _, name := range tpl.Placeholders {
+			if _, ok := req.Values[name]; !ok {
+				vErrs = append(vErrs, fieldError{Field: "values." + name, Message: "missing value for placeholder " + name})
+			}
+		}
+		for name := range req.Values {
+			if !slices.Contains(tpl.Placeholders, name) {
+				vErrs = append(vErrs, fieldError{Field: "values." + name, Message: "unknown placeholder " + name})
+			}
+		}
+		if len(vErrs) > 0 {
+			sortFieldErrors(vErrs)
+			writeValidation(w, vErrs)
+			return
+		}
+
+		tree, vErrs, err := buildTree(r, repo, "task.", tpl.Task.render(req.Values), nil)
+		if errors.Is(err, errForbidden) {
+			writeJSON(w, http.StatusForbidden, errResponse{Error: "forbidden"})
+			return
+		}
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, errResponse{Error: "unexpected_error"})
+			return
+		}
+		if len(vErrs) > 0 {
+			writeValidation(w, vErrs)
+			return
+		}
+
+		created, err := repo.CreateTree(r.Context(), callerScope(r.Context()), tree)
+		if errors.Is(err, ErrNotFound) {
+			// a referenced project vanished between validation and insert
+			writeValidation(w, []fieldError{{Field: "task.project_id", Message: "project not found"}})
+			return
+		}
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, errResponse{Error: "unexpected_error"})
+			return
+		}
+		writeJSON(w, http.StatusCreated, created)
+	}
+}
@@ -0,0 +1,183 @@
+package tasks
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"testing"
+)
+
+func TestTemplateTask_PlaceholdersAndRender(t *testing.T) {
+	spec := TemplateTask{
+		Title:     "Release {{ version }}",
+		Tags:      []string{"release", "sprint-{{sprint}}"},
+		Checklist: []string{"tag {{version}}", "announce"},
+		Fields:    map[string]any{"owner": "{{owner}}", "points": 3.0},
+		Subtasks:  []TemplateTask{{Title: "Changelog for {{version}}"}},
+	}
+
+	got := spec.placeholders()
+	if want := []string{"owner", "sprint", "version"}; !slices.Equal(got, want) {
+		t.Fatalf("expected placeholders %v, got %v", want, got)
+	}
+
+	out := spec.render(map[string]string{"version": "1.4.0", "sprint": "12", "owner": "ops"})
+	if out.Title != "Release 1.4.0" || out.Tags[1] != "sprint-12" || out.Checklist[0] != "tag 1.4.0" {
+		t.Fatalf("unexpected render: %+v", out)
+	}
+	if out.Fields["owner"] != "ops" || out.Fields["points"] != 3.0 {
+		t.Fatalf("unexpected fields: %+v", out.Fields)
+	}
+	if out.Subtasks[0].Title != "Changelog for 1.4.0" {
+		t.Fatalf("unexpected subtask: %+v", out.Subtasks[0])
+	}
+	if spec.Title != "Release {{ version }}" || spec.Tags[1] != "sprint-{{sprint}}" {
+		t.Fatalf("render must not modify the template: %+v", spec)
+	}
+}
+
+func TestTemplates_Instantiate(t *testing.T) {
+	repo := NewInMemoryRepo()
+	r := newTestServer(repo)
+
+	rec := doJSON(t, r, http.MethodPost, "/templates", `{"name":"release","task":{
+		"title":"Release {{version}}",
+		"tags":["release"],
+		"checklist":["bump {{version}}","publish"],
+		"subtasks":[{"title":"Changelog"},{"title":"Announce {{version}}","tags":["comms"]}]
+	}}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d, body=%s", rec.Code, rec.Body.String())
+	}
+	var tpl Template
+	if err := json.Unmarshal(rec.Body.Bytes(), &tpl); err != nil {
+		t.Fatalf("failed to parse JSON: %v", err)
+	}
+	if !slices.Equal(tpl.Placeholders, []string{"version"}) {
+		t.Fatalf("unexpected placeholders: %v", tpl.Placeholders)
+	}
+
+	path := fmt.Sprintf("/templates/%d/instantiate", tpl.ID)
+	rec = doJSON(t, r, http.MethodPost, path, `{"values":{"verison":"2.0"}}`)
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("expected 422, got %d, body=%s", rec.Code, rec.Body.String())
+	}
+	var resp errResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to parse error JSON: %v", err)
+	}
+	if len(resp.Details) != 2 || resp.Details[0].Field != "values.verison" || resp.Details[1].Field != "values.version" {
+		t.Fatalf("unexpected details: %+v", resp.Details)
+	}
+
+	rec = doJSON(t, r, http.MethodPost, path, `{"values":{"version":"2.0"}}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d, body=%s", rec.Code, rec.Body.String())
+	}
+	var created []Task
+	if err := json.Unmarshal(rec.Body.Bytes(), &created); err != nil {
+		t.Fatalf("failed to parse JSON: %v", err)
+	}
+	if len(created) != 3 {
+		t.Fatalf("expected 3 tasks, got %d", len(created))
+	}
+	root := created[0]
+	if root.Title != "Release 2.0" || len(root.Checklist) != 2 || root.Checklist[0].Text != "bump 2.0" {
+		t.Fatalf("unexpected root: %+v", root)
+	}
+	for _, sub := range created[1:] {
+		if sub.ParentID == nil || *sub.ParentID != root.ID {
+			t.Fatalf("expected subtask of %d, got %+v", root.ID, sub)
+		}
+	}
+	if created[2].Title != "Announce 2.0" || !slices.Equal(created[2].Tags, []string{"comms"}) {
+		t.Fatalf("unexpected subtask: %+v", created[2])
+	}
+}
+
+func TestTemplates_RenderedValidation(t *testing.T) {
+	r := newTestServer(NewInMemoryRepo())
+
+	rec := doJSON(t, r, http.MethodPost, "/templates", `{"name":"x","task":{"title":"{{title}}","subtasks":[{"title":""}]}}`)
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("expected 422 for empty subtask title, got %d", rec.Code)
+	}
+
+	rec = doJSON(t, r, http.MethodPost, "/templates", `{"name":"x","task":{"title":"{{title}}"}}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d, body=%s", rec.Code, rec.Body.String())
+	}
+	rec = doJSON(t, r, http.MethodPost, "/templates/1/instantiate", `{"values":{"title":"  "}}`)
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("expected 422 for blank rendered title, got %d", rec.Code)
+	}
+	var resp errResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to parse error JSON: %v", err)
+	}
+	if resp.Details[0].Field != "task.title" {
+		t.Fatalf("unexpected details: %+v", resp.Details)
+	}
+}
+
+func TestSQLiteRepo_CreateTreeIsAtomic(t *testing.T) {
+	repo := newTempDB(t)
+	ctx := context.Background()
+
+	missing := int64(999)
+	_, err := repo.CreateTree(ctx, Scope{}, TaskTree{
+		TaskInput: TaskInput{Title: "root", Tags: []string{"a"}},
+		Subtasks: []TaskTree{
+			{TaskInput: TaskInput{Title: "ok", Checklist: []ChecklistItem{{Text: "x"}}}},
+			{TaskInput: TaskInput{Title: "bad", ProjectID: &missing}},
+		},
+	})
+	if err != ErrNotFound {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+	list, err := repo.List(ctx, Scope{}, ListQuery{})
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	if len(list) != 0 {
+		t.Fatalf("expected rollback, found %+v", list)
+	}
+
+	created, err := repo.CreateTree(ctx, Scope{}, TaskTree{
+		TaskInput: TaskInput{Title: "root", Tags: []string{"b", "a"}},
+		Subtasks: []TaskTree{
+			{TaskInput: TaskInput{Title: "child", Checklist: []ChecklistItem{{Text: "one"}, {Text: "two", Done: true}}}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("create tree: %v", err)
+	}
+	child, err := repo.Get(ctx, Scope{}, created[1].ID)
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	if child.ParentID == nil || *child.ParentID != created[0].ID {
+		t.Fatalf("expected parent %d, got %+v", created[0].ID, child)
+	}
+	if len(child.Checklist) != 2 || child.Checklist[1] != (ChecklistItem{Text: "two", Done: true}) {
+		t.Fatalf("unexpected checklist: %+v", child.Checklist)
+	}
+	root, err := repo.Get(ctx, Scope{}, created[0].ID)
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	if !slices.Equal(root.Tags, []string{"a", "b"}) {
+		t.Fatalf("unexpected tags: %v", root.Tags)
+	}
+
+	subs, err := repo.List(ctx, Scope{}, ListQuery{ParentID: &root.ID})
+	if err != nil || len(subs) != 1 {
+		t.Fatalf("expected one subtask, got %v (err=%v)", subs, err)
+	}
+	tagged, err := repo.List(ctx, Scope{}, ListQuery{Tag: "b"})
+	if err != nil || len(tagged) != 1 || tagged[0].ID != root.ID {
+		t.Fatalf("expected root by tag, got %v (err=%v)", tagged, err)
+	}
+}
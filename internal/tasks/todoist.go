@@ -0,0 +1,216 @@
+package tasks
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"time"
+)
+
+// todoistID is an id of a Todoist export; older exports have numbers
+// where newer ones have strings.
+type todoistID string
+
+func (id *todoistID) UnmarshalJSON(b []byte) error {
+	if bytes.Equal(b, []byte("null")) {
+		*id = ""
+		return nil
+	}
+	var s string
+	if err := json.Unmarshal(b, &s); err == nil {
+		*id = todoistID(s)
+		return nil
+	}
+	var n json.Number
+	if err := json.Unmarshal(b, &n); err != nil {
+		return err
+	}
+	*id = todoistID(n.String())
+	return nil
+}
+
+// todoistExport is the part of a Todoist JSON export, the resources of a
+// full sync, the import reads.
+type todoistExport struct {
+	Projects []todoistProject `json:"projects"`
+	Sections []todoistSection `json:"sections"`
+	Items    []todoistItem    `json:"items"`
+	Notes    []todoistNote    `json:"notes"`
+}
+
+type todoistProject struct {
+	ID         todoistID `json:"id"`
+	Name       string    `json:"name"`
+	IsArchived bool      `json:"is_archived"`
+	IsDeleted  bool      `json:"is_deleted"`
+	ChildOrder int       `json:"child_order"`
+}
+
+type todoistSection struct {
+	ID           todoistID `json:"id"`
+	Name         string    `json:"name"`
+	ProjectID    todoistID `json:"project_id"`
+	SectionOrder int       `json:"section_order"`
+	IsDeleted    bool      `json:"is_deleted"`
+}
+
+type todoistItem struct {
+	ID          todoistID `json:"id"`
+	Content     string    `json:"content"`
+	Description string    `json:"description"`
+	ProjectID   todoistID `json:"project_id"`
+	SectionID   todoistID `json:"section_id"`
+	ParentID    todoistID `json:"parent_id"`
+	Labels      []string  `json:"labels"`
+	Priority    int       `json:"priority"`
+	Due         *struct {
+		Date        string `json:"date"`
+		Timezone    string `json:"timezone"`
+		IsRecurring bool   `json:"is_recurring"`
+		String      string `json:"string"`
+	} `json:"due"`
+	Checked    bool `json:"checked"`
+	IsDeleted  bool `json:"is_deleted"`
+	ChildOrder int  `json:"child_order"`
+}
+
+type todoistNote struct {
+	ItemID    todoistID `json:"item_id"`
+	IsDeleted bool      `json:"is_deleted"`
+}
+
+// todoistPriority maps Todoist's priorities, 4 the most urgent and 1
+// none, onto 1-3 and 0.
+func todoistPriority(p int) int {
+	if p < 2 || p > 4 {
+		return 0
+	}
+	return 5 - p
+}
+
+// todoistDue reads a due date: a date, a floating date-time or a UTC
+// date-time. Floating times are placed in tz, or in UTC without one.
+func todoistDue(date, tz string) (time.Time, error) {
+	if t, err := time.Parse(time.DateOnly, date); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse(time.RFC3339, date); err == nil {
+		return t, nil
+	}
+	loc := time.UTC
+	if tz != "" {
+		if l, err := time.LoadLocation(tz); err == nil {
+			loc = l
+		}
+	}
+	return time.ParseInLocation("2006-01-02T15:04:05", date, loc)
+}
+
+// parseTodoist maps every active project onto a project whose enum field
+// "section" holds each item's section. Items become tasks with their
+// labels as tags, priority and due date; sub-items become subtasks.
+// Archived projects are left out, and descriptions, comments and
+// recurrence are reported.
+func parseTodoist(body io.Reader) (foreignExport, error) {
+	var x todoistExport
+	if err := json.NewDecoder(body).Decode(&x); err != nil {
+		return foreignExport{}, err
+	}
+	var exp foreignExport
+
+	slices.SortStableFunc(x.Projects, func(a, b todoistProject) int { return cmp.Compare(a.ChildOrder, b.ChildOrder) })
+	projects := make(map[todoistID]int) // project id to index in exp.projects
+	for _, p := range x.Projects {
+		switch {
+		case p.IsDeleted:
+		case p.IsArchived:
+			exp.skip("project:"+string(p.ID), p.Name, "archived project, its items are left out")
+		default:
+			projects[p.ID] = exp.project(p.Name, "section")
+		}
+	}
+	slices.SortStableFunc(x.Sections, func(a, b todoistSection) int { return cmp.Compare(a.SectionOrder, b.SectionOrder) })
+	sections := make(map[todoistID]string)
+	for _, s := range x.Sections {
+		if i, ok := projects[s.ProjectID]; ok && !s.IsDeleted {
+			sections[s.ID] = strings.TrimSpace(s.Name)
+			exp.addGroup(i, s.Name)
+		}
+	}
+	notes := make(map[todoistID]int)
+	for _, n := range x.Notes {
+		if !n.IsDeleted {
+			notes[n.ItemID]++
+		}
+	}
+
+	// parents go before their sub-items; an item whose parent is left out
+	// is imported on its own
+	items := make(map[todoistID]todoistItem)
+	for _, it := range x.Items {
+		if _, ok := projects[it.ProjectID]; ok && !it.IsDeleted {
+			items[it.ID] = it
+		}
+	}
+	children := make(map[todoistID][]todoistItem)
+	var roots []todoistItem
+	for _, it := range x.Items {
+		if _, ok := items[it.ID]; !ok {
+			continue
+		}
+		if _, ok := items[it.ParentID]; ok && it.ParentID != "" {
+			children[it.ParentID] = append(children[it.ParentID], it)
+		} else {
+			roots = append(roots, it)
+		}
+	}
+	byOrder := func(a, b todoistItem) int { return cmp.Compare(a.ChildOrder, b.ChildOrder) }
+	slices.SortStableFunc(roots, byOrder)
+
+	var add func(it todoistItem, parent *int)
+	add = func(it todoistItem, parent *int) {
+		source := "item:" + string(it.ID)
+		t := foreignTask{
+			source:   source,
+			uid:      string(it.ID) + "@todoist.com",
+			title:    strings.TrimSpace(it.Content),
+			done:     it.Checked,
+			project:  projects[it.ProjectID],
+			group:    sections[it.SectionID],
+			parent:   parent,
+			tags:     it.Labels,
+			priority: todoistPriority(it.Priority),
+		}
+		if d := it.Due; d != nil && d.Date != "" {
+			due, err := todoistDue(d.Date, d.Timezone)
+			if err != nil {
+				exp.skip(source, t.title, fmt.Sprintf("due date %q", d.Date))
+			} else {
+				t.dueAt = &due
+			}
+			if d.IsRecurring {
+				exp.skip(source, t.title, fmt.Sprintf("recurrence %q, only the next date is kept", d.String))
+			}
+		}
+		if strings.TrimSpace(it.Description) != "" {
+			exp.skip(source, t.title, "description")
+		}
+		if n := notes[it.ID]; n > 0 {
+			exp.skip(source, t.title, fmt.Sprintf("comments (%d)", n))
+		}
+		i := exp.add(t)
+		subs := children[it.ID]
+		slices.SortStableFunc(subs, byOrder)
+		for _, sub := range subs {
+			add(sub, &i)
+		}
+	}
+	for _, it := range roots {
+		add(it, nil)
+	}
+	return exp, nil
+}
@@ -0,0 +1,346 @@
+package tasks
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// todoTxtType is the todo.txt format (https://github.com/todotxt/todo.txt),
+// one task per line:
+//
+//	x 2030-01-02 2030-01-01 call the bank +Home_Admin @phone due:2030-01-05 pri:B id:7
+//	(A) 2030-01-01 file taxes +Home_Admin @money kind:federal id:8
+//
+// Priorities 1-4 are (A)-(D), projects are +name with spaces turned into
+// underscores, tags are @contexts and the remaining attributes are
+// key:value extensions. Custom fields use their own name as the key.
+// Words of a title that would read as any of these, or that start with a
+// backslash, are written with a backslash in front.
+const todoTxtType = "text/plain; format=todotxt"
+
+var (
+	todoTxtDate     = regexp.MustCompile(`^[0-9]{4}-[0-9]{2}-[0-9]{2}$`)
+	todoTxtPriority = regexp.MustCompile(`^\(([A-Z])\)$`)
+	todoTxtExt      = regexp.MustCompile(`^([A-Za-z][A-Za-z0-9_-]*):(\S+)$`)
+)
+
+// todoTxtProject is how a project name is written after the "+".
+func todoTxtProject(name string) string {
+	return strings.Join(strings.Fields(name), "_")
+}
+
+// todoTxtLetter maps a priority to its letter, "" for none.
+func todoTxtLetter(priority int) string {
+	if priority < 1 || priority > maxPriority {
+		return ""
+	}
+	return string(rune('A' + priority - 1))
+}
+
+// todoTxtLevel maps a priority letter back; everything after D is the
+// least urgent priority there is.
+func todoTxtLevel(letter byte) int {
+	return min(int(letter-'A')+1, maxPriority)
+}
+
+// todoTxtDue writes a due date without a time of day as a plain date.
+func todoTxtDue(t time.Time) string {
+	t = t.UTC()
+	if t.Equal(t.Truncate(24 * time.Hour)) {
+		return t.Format(time.DateOnly)
+	}
+	return t.Format(time.RFC3339)
+}
+
+// todoTxtValue formats a custom field value as an extension value. Values
+// with whitespace cannot be written and are left out.
+func todoTxtValue(v any) (string, bool) {
+	var s string
+	switch v := v.(type) {
+	case nil:
+		return "", false
+	case float64:
+		s = strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		s = fmt.Sprint(v)
+	}
+	return s, s != "" && !strings.ContainsFunc(s, unicode.IsSpace)
+}
+
+// todoTxtTitle escapes the words of a title that an import would take
+// for something else than title text.
+func todoTxtTitle(title string) string {
+	words := strings.Split(title, " ")
+	first := true
+	for i, w := range words {
+		if w == "" {
+			continue
+		}
+		if todoTxtMeta(w, first) {
+			words[i] = `\` + w
+		}
+		first = false
+	}
+	return strings.Join(words, " ")
+}
+
+// todoTxtMeta reports whether w reads as more than title text: a
+// project, context, extension or escaped word, or, as the first word of
+// the title, a date or priority.
+func todoTxtMeta(w string, first bool) bool {
+	switch {
+	case strings.HasPrefix(w, `\`):
+		return true
+	case len(w) > 1 && (w[0] == '+' || w[0] == '@'):
+		return true
+	case first && (todoTxtDate.MatchString(w) || todoTxtPriority.MatchString(w)):
+		return true
+	}
+	m := todoTxtExt.FindStringSubmatch(w)
+	return m != nil && !strings.HasPrefix(m[2], "//")
+}
+
+// todoTxtLine writes t as one todo.txt line, without the line break.
+// project is the task's project, if any.
+func todoTxtLine(t Task, project *Project) string {
+	var parts []string
+	if t.Done {
+		parts = append(parts, "x")
+		if t.CompletedAt != nil {
+			parts = append(parts, t.CompletedAt.UTC().Format(time.DateOnly))
+		}
+	} else if l := todoTxtLetter(t.Priority); l != "" {
+		parts = append(parts, "("+l+")")
+	}
+	parts = append(parts, t.CreatedAt.UTC().Format(time.DateOnly), todoTxtTitle(t.Title))
+	if project != nil {
+		parts = append(parts, "+"+todoTxtProject(project.Name))
+	}
+	for _, tag := range t.Tags {
+		parts = append(parts, "@"+tag)
+	}
+	if t.DueAt != nil {
+		parts = append(parts, "due:"+todoTxtDue(*t.DueAt))
+	}
+	if l := todoTxtLetter(t.Priority); t.Done && l != "" {
+		// completed tasks drop the (A) prefix, so keep it as an extension
+		parts = append(parts, "pri:"+l)
+	}
+	if t.ParentID != nil {
+		parts = append(parts, "parent:"+strconv.FormatInt(*t.ParentID, 10))
+	}
+	if t.Assignee != "" && !strings.ContainsFunc(t.Assignee, unicode.IsSpace) {
+		parts = append(parts, "assignee:"+t.Assignee)
+	}
+	names := make([]string, 0, len(t.Fields))
+	for name := range t.Fields {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		if s, ok := todoTxtValue(t.Fields[name]); ok {
+			parts = append(parts, name+":"+s)
+		}
+	}
+	parts = append(parts, "id:"+strconv.FormatInt(t.ID, 10))
+	return strings.Join(parts, " ")
+}
+
+// todoTxtEncoder writes one todo.txt line per task.
+type todoTxtEncoder struct {
+	w        io.Writer
+	projects map[int64]*Project
+}
+
+// newTodoTxtEncoder loads the projects visible in s, whose names the lines
+// refer to.
+func newTodoTxtEncoder(ctx context.Context, repo Repository, s Scope, w io.Writer) (*todoTxtEncoder, error) {
+	ps, err := repo.ListProjects(ctx, s)
+	if err != nil {
+		return nil, err
+	}
+	projects := make(map[int64]*Project, len(ps))
+	for i := range ps {
+		projects[ps[i].ID] = &ps[i]
+	}
+	return &todoTxtEncoder{w: w, projects: projects}, nil
+}
+
+func (e *todoTxtEncoder) encode(t Task) error {
+	var p *Project
+	if t.ProjectID != nil {
+		p = e.projects[*t.ProjectID]
+	}
+	_, err := io.WriteString(e.w, todoTxtLine(t, p)+"\n")
+	return err
+}
+
+func (e *todoTxtEncoder) end() error { return nil }
+
+func (e *todoTxtEncoder) fail() bool { return false }
+
+// readTodoTxtRecords parses a todo.txt body into import records, one per
+// non-blank line. +project names are resolved against projects.
+func readTodoTxtRecords(body io.Reader, projects []Project) ([]importRecord, []rowError, error) {
+	var (
+		out  []importRecord
+		errs []rowError
+	)
+	sc := bufio.NewScanner(body)
+	sc.Buffer(nil, maxImportBytes)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" {
+			continue
+		}
+		row := len(out) + 1
+		v, fErrs := parseTodoTxt(line, projects)
+		for _, fe := range fErrs {
+			errs = append(errs, rowError{Row: row, Field: fe.Field, Message: fe.Message})
+		}
+		rec, err := newImportRecord(v)
+		if err != nil {
+			return nil, nil, err
+		}
+		out = append(out, rec)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, nil, err
+	}
+	return out, errs, nil
+}
+
+// parseTodoTxt maps one todo.txt line onto the keys of an import record.
+// The completion and creation dates are set by the server and skipped.
+// Extensions that are neither a task attribute nor a custom field of the
+// task's project stay part of the title, as do URLs and words escaped
+// with a backslash, which loses it.
+func parseTodoTxt(line string, projects []Project) (map[string]any, []fieldError) {
+	v := map[string]any{"done": false, "priority": 0, "due_at": nil}
+	var errs []fieldError
+
+	words := strings.Fields(line)
+	if len(words) > 0 && words[0] == "x" {
+		v["done"] = true
+		words = words[1:]
+		for n := 0; n < 2 && len(words) > 0 && todoTxtDate.MatchString(words[0]); n++ {
+			words = words[1:]
+		}
+	}
+	if len(words) > 0 {
+		if m := todoTxtPriority.FindStringSubmatch(words[0]); m != nil {
+			v["priority"] = todoTxtLevel(m[1][0])
+			words = words[1:]
+		}
+	}
+	if len(words) > 0 && todoTxtDate.MatchString(words[0]) {
+		words = words[1:]
+	}
+
+	var project *Project
+	for _, w := range words {
+		if len(w) < 2 || w[0] != '+' {
+			continue
+		}
+		i := slices.IndexFunc(projects, func(p Project) bool {
+			return strings.EqualFold(todoTxtProject(p.Name), w[1:])
+		})
+		switch {
+		case i < 0:
+			errs = append(errs, fieldError{Field: "project_id", Message: "no project named " + w[1:]})
+		case project != nil && project.ID != projects[i].ID:
+			errs = append(errs, fieldError{Field: "project_id", Message: "a task belongs to one project at most"})
+		default:
+			project = &projects[i]
+		}
+	}
+	if project != nil {
+		v["project_id"] = project.ID
+	}
+
+	var (
+		title  []string
+		tags   = []string{}
+		fields = map[string]any{}
+	)
+	for _, w := range words {
+		if strings.HasPrefix(w, `\`) {
+			title = append(title, w[1:])
+			continue
+		}
+		if len(w) > 1 && w[0] == '+' {
+			continue
+		}
+		if len(w) > 1 && w[0] == '@' {
+			tags = append(tags, w[1:])
+			continue
+		}
+		m := todoTxtExt.FindStringSubmatch(w)
+		if m == nil || strings.HasPrefix(m[2], "//") {
+			title = append(title, w)
+			continue
+		}
+		key, val := m[1], m[2]
+		switch key {
+		case "id", "parent":
+			field := "id"
+			if key == "parent" {
+				field = "parent_id"
+			}
+			n, err := strconv.ParseInt(val, 10, 64)
+			if err != nil || n < 1 {
+				errs = append(errs, fieldError{Field: field, Message: key + " must be a positive integer"})
+				continue
+			}
+			v[field] = n
+		case "due":
+			t, err := time.Parse(time.RFC3339, val)
+			if err != nil {
+				t, err = time.Parse(time.DateOnly, val)
+			}
+			if err != nil {
+				errs = append(errs, fieldError{Field: "due_at", Message: "due must be a date (YYYY-MM-DD) or RFC3339 timestamp"})
+				continue
+			}
+			v["due_at"] = t
+		case "pri":
+			if len(val) != 1 || val[0] < 'A' || val[0] > 'Z' {
+				errs = append(errs, fieldError{Field: "priority", Message: "pri must be a letter from A to Z"})
+				continue
+			}
+			v["priority"] = todoTxtLevel(val[0])
+		case "assignee":
+			v["assignee"] = val
+		default:
+			var def FieldDef
+			var ok bool
+			if project != nil {
+				def, ok = findField(project.Fields, key)
+			}
+			if !ok {
+				title = append(title, w)
+				continue
+			}
+			fv, err := parseFieldValue(def, val)
+			if err != nil {
+				errs = append(errs, fieldError{Field: "fields." + key, Message: err.Error()})
+				continue
+			}
+			fields[key] = fv
+		}
+	}
+	v["title"] = strings.Join(title, " ")
+	v["tags"] = tags
+	if len(fields) > 0 {
+		v["fields"] = fields
+	}
+	return v, errs
+}
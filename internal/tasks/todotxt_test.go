@@ -0,0 +1,166 @@
+package tasks
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+const todoTxtProjectJSON = `{"name":"Home Admin","fields":[
+	{"name":"kind","type":"enum","options":["federal","state"]},
+	{"name":"hours","type":"number"},
+	{"name":"billable","type":"bool"}
+]}`
+
+func getTodoTxt(t *testing.T, r http.Handler) string {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, "/tasks", nil)
+	req.Header.Set("Accept", todoTxtType)
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != todoTxtType {
+		t.Fatalf("expected todo.txt, got %d %q", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	return rec.Body.String()
+}
+
+// comparableTasks lists the tasks without the timestamps the server sets.
+func comparableTasks(t *testing.T, r http.Handler) []Task {
+	t.Helper()
+	var list []Task
+	if err := json.Unmarshal(doJSON(t, r, http.MethodGet, "/tasks", "").Body.Bytes(), &list); err != nil {
+		t.Fatalf("failed to parse JSON: %v", err)
+	}
+	for i := range list {
+		list[i].CreatedAt, list[i].CompletedAt = time.Time{}, nil
+	}
+	return list
+}
+
+func TestTodoTxt_RoundTrip(t *testing.T) {
+	for name, newRepo := range map[string]func() Repository{
+		"memory": func() Repository { return NewInMemoryRepo() },
+		"sqlite": func() Repository { return newTempDB(t) },
+	} {
+		t.Run(name, func(t *testing.T) {
+			repo := newRepo()
+			addUser(t, repo, "sam")
+			r := newTestServer(repo)
+			doJSON(t, r, http.MethodPost, "/projects", todoTxtProjectJSON)
+			doJSON(t, r, http.MethodPost, "/tasks", `{"title":"file taxes","project_id":1,"tags":["money"],"priority":1,
+				"due_at":"2030-04-15T00:00:00Z","assignee":"sam","fields":{"kind":"federal","hours":2.5,"billable":false}}`)
+			doJSON(t, r, http.MethodPost, "/tasks", `{"title":"find receipts","project_id":1,"parent_id":1,"due_at":"2030-04-10T17:30:00Z"}`)
+			doJSON(t, r, http.MethodPost, "/tasks", `{"title":"call the bank","tags":["phone","errands"],"priority":2}`)
+			doJSON(t, r, http.MethodPatch, "/tasks/3", `{"done":true}`)
+
+			body := getTodoTxt(t, r)
+			lines := strings.Split(strings.TrimSuffix(body, "\n"), "\n")
+			if len(lines) != 3 {
+				t.Fatalf("expected 3 lines, got %q", body)
+			}
+			for i, want := range []string{
+				`^\(A\) \d{4}-\d{2}-\d{2} file taxes \+Home_Admin @money due:2030-04-15 assignee:sam billable:false hours:2.5 kind:federal id:1$`,
+				`^\d{4}-\d{2}-\d{2} find receipts \+Home_Admin due:2030-04-10T17:30:00Z parent:1 id:2$`,
+				`^x \d{4}-\d{2}-\d{2} \d{4}-\d{2}-\d{2} call the bank @errands @phone pri:B id:3$`,
+			} {
+				if !regexp.MustCompile(want).MatchString(lines[i]) {
+					t.Fatalf("line %d: expected %s, got %q", i+1, want, lines[i])
+				}
+			}
+
+			// the same tasks again are recognized by id
+			if code, rep := doImport(t, r, "?format=todotxt", "text/plain", body); code != http.StatusOK || rep.Skipped != 3 {
+				t.Fatalf("reimport: unexpected report %d %+v", code, rep)
+			}
+
+			// and a fresh server ends up with the same tasks; like every
+			// import, parents have to exist before their subtasks come in
+			otherRepo := newRepo()
+			addUser(t, otherRepo, "sam")
+			other := newTestServer(otherRepo)
+			doJSON(t, other, http.MethodPost, "/projects", todoTxtProjectJSON)
+			for _, part := range []string{lines[0], lines[1] + "\n" + lines[2]} {
+				if code, rep := doImport(t, other, "", todoTxtType, part); code != http.StatusOK || len(rep.Errors) != 0 {
+					t.Fatalf("import: unexpected report %d %+v", code, rep)
+				}
+			}
+			if got, want := comparableTasks(t, other), comparableTasks(t, r); !reflect.DeepEqual(got, want) {
+				t.Fatalf("round trip changed the tasks:\n got %+v\nwant %+v", got, want)
+			}
+			if got := getTodoTxt(t, other); got != body {
+				t.Fatalf("expected the same export, got %q want %q", got, body)
+			}
+		})
+	}
+}
+
+func TestTodoTxt_TitleRoundTrip(t *testing.T) {
+	titles := []string{
+		"email bob@example.com re: +1 offer id:3",
+		"ratio 3:1",
+		"see http://x",
+		"(B) 2030-01-01 ask @home about kind:state",
+		`due:tomorrow is not a date \ nor \+a project`,
+	}
+	r := newTestServer(NewInMemoryRepo())
+	doJSON(t, r, http.MethodPost, "/projects", todoTxtProjectJSON)
+	for i, title := range titles {
+		body, _ := json.Marshal(map[string]any{"title": title, "project_id": 1})
+		if rec := doJSON(t, r, http.MethodPost, "/tasks", string(body)); rec.Code != http.StatusCreated {
+			t.Fatalf("create %q: expected 201, got %d, body=%s", title, rec.Code, rec.Body.String())
+		}
+		if i%2 == 0 {
+			doJSON(t, r, http.MethodPatch, fmt.Sprintf("/tasks/%d", i+1), `{"done":true}`)
+		}
+	}
+	body := getTodoTxt(t, r)
+
+	other := newTestServer(NewInMemoryRepo())
+	doJSON(t, other, http.MethodPost, "/projects", todoTxtProjectJSON)
+	if code, rep := doImport(t, other, "", todoTxtType, body); code != http.StatusOK || len(rep.Errors) != 0 {
+		t.Fatalf("import: unexpected report %d %+v", code, rep)
+	}
+	if got, want := comparableTasks(t, other), comparableTasks(t, r); !reflect.DeepEqual(got, want) {
+		t.Fatalf("round trip changed the tasks:\n got %+v\nwant %+v", got, want)
+	}
+}
+
+func TestTodoTxt_Import(t *testing.T) {
+	r := newTestServer(NewInMemoryRepo())
+	doJSON(t, r, http.MethodPost, "/projects", todoTxtProjectJSON)
+
+	body := "x 2030-01-02 2030-01-01 (C) read https://example.com/faq +home_admin note:later kind:state\n" +
+		"\n" +
+		"(F) water plants @Garden\n"
+	if code, rep := doImport(t, r, "?format=todotxt", "text/plain", body); code != http.StatusOK || rep.Created != 2 {
+		t.Fatalf("import: unexpected report %d %+v", code, rep)
+	}
+	list := comparableTasks(t, r)
+	if len(list) != 2 {
+		t.Fatalf("expected 2 tasks, got %+v", list)
+	}
+	read, water := list[0], list[1]
+	if read.Title != "read https://example.com/faq note:later" || !read.Done || read.Priority != 3 ||
+		read.ProjectID == nil || read.Fields["kind"] != "state" {
+		t.Fatalf("unexpected task %+v", read)
+	}
+	if water.Title != "water plants" || water.Done || water.Priority != maxPriority || len(water.Tags) != 1 || water.Tags[0] != "garden" {
+		t.Fatalf("unexpected task %+v", water)
+	}
+
+	bad := "a +nowhere\nb due:soon pri:7 +Home_Admin hours:many\n"
+	if code, rep := doImport(t, r, "?format=todotxt", "text/plain", bad); code != http.StatusUnprocessableEntity || len(rep.Errors) != 4 {
+		t.Fatalf("invalid lines: unexpected report %d %+v", code, rep)
+	}
+
+	// plain text is not todo.txt unless asked for
+	if code, _ := doImport(t, r, "", "text/plain", body); code != http.StatusBadRequest {
+		t.Fatalf("text/plain: expected 400, got %d", code)
+	}
+}
@@ -0,0 +1,174 @@
+package tasks
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"time"
+)
+
+// trelloDoneLists are list names whose cards count as done, besides the
+// cards whose due date is marked complete.
+var trelloDoneLists = []string{"done", "complete", "completed", "finished"}
+
+// trelloBoard is the part of a Trello board's JSON export the import
+// reads.
+type trelloBoard struct {
+	Name       string            `json:"name"`
+	Labels     []trelloLabel     `json:"labels"`
+	Lists      []trelloList      `json:"lists"`
+	Cards      []trelloCard      `json:"cards"`
+	Checklists []trelloChecklist `json:"checklists"`
+	Actions    []trelloAction    `json:"actions"`
+}
+
+type trelloLabel struct {
+	ID    string `json:"id"`
+	Name  string `json:"name"`
+	Color string `json:"color"`
+}
+
+type trelloList struct {
+	ID     string  `json:"id"`
+	Name   string  `json:"name"`
+	Closed bool    `json:"closed"`
+	Pos    float64 `json:"pos"`
+}
+
+type trelloCard struct {
+	ID          string            `json:"id"`
+	Name        string            `json:"name"`
+	Desc        string            `json:"desc"`
+	Closed      bool              `json:"closed"`
+	IDList      string            `json:"idList"`
+	IDLabels    []string          `json:"idLabels"`
+	IDMembers   []string          `json:"idMembers"`
+	Due         *time.Time        `json:"due"`
+	DueComplete bool              `json:"dueComplete"`
+	Attachments []json.RawMessage `json:"attachments"`
+	Pos         float64           `json:"pos"`
+}
+
+type trelloChecklist struct {
+	IDCard     string            `json:"idCard"`
+	Pos        float64           `json:"pos"`
+	CheckItems []trelloCheckItem `json:"checkItems"`
+}
+
+type trelloCheckItem struct {
+	Name  string  `json:"name"`
+	State string  `json:"state"`
+	Pos   float64 `json:"pos"`
+}
+
+// trelloAction is an entry of the board's activity; only comments are
+// of interest.
+type trelloAction struct {
+	Type string `json:"type"`
+	Data struct {
+		Card struct {
+			ID string `json:"id"`
+		} `json:"card"`
+	} `json:"data"`
+}
+
+// parseTrello maps a board export onto a project whose enum field "list"
+// holds each card's list. Cards become tasks with their labels as tags,
+// their checklists merged into one and their due date; a card is done if
+// its due date is complete or its list is called done. Archived lists and
+// cards are left out, and descriptions, comments, attachments and members
+// are reported.
+func parseTrello(body io.Reader) (foreignExport, error) {
+	var b trelloBoard
+	if err := json.NewDecoder(body).Decode(&b); err != nil {
+		return foreignExport{}, err
+	}
+	var exp foreignExport
+	project := exp.project(b.Name, "list")
+
+	slices.SortStableFunc(b.Lists, func(x, y trelloList) int { return cmp.Compare(x.Pos, y.Pos) })
+	lists := make(map[string]int, len(b.Lists)) // list id to index in b.Lists
+	for i, l := range b.Lists {
+		lists[l.ID] = i
+		if l.Closed {
+			exp.skip("list:"+l.ID, l.Name, "archived list, its cards are left out")
+			continue
+		}
+		exp.addGroup(project, l.Name)
+	}
+	labels := make(map[string]string, len(b.Labels))
+	for _, l := range b.Labels {
+		labels[l.ID] = cmp.Or(l.Name, l.Color)
+	}
+	slices.SortStableFunc(b.Checklists, func(x, y trelloChecklist) int { return cmp.Compare(x.Pos, y.Pos) })
+	checklists := make(map[string][]trelloChecklist)
+	for _, cl := range b.Checklists {
+		checklists[cl.IDCard] = append(checklists[cl.IDCard], cl)
+	}
+	comments := make(map[string]int)
+	for _, a := range b.Actions {
+		if a.Type == "commentCard" {
+			comments[a.Data.Card.ID]++
+		}
+	}
+
+	// board order: by list, then by position in the list
+	slices.SortStableFunc(b.Cards, func(x, y trelloCard) int {
+		return cmp.Or(cmp.Compare(lists[x.IDList], lists[y.IDList]), cmp.Compare(x.Pos, y.Pos))
+	})
+	for _, c := range b.Cards {
+		i, listed := lists[c.IDList]
+		if listed && b.Lists[i].Closed {
+			continue
+		}
+		source := "card:" + c.ID
+		if c.Closed {
+			exp.skip(source, c.Name, "archived card")
+			continue
+		}
+		t := foreignTask{
+			source:  source,
+			uid:     c.ID + "@trello.com",
+			title:   strings.TrimSpace(c.Name),
+			done:    c.DueComplete,
+			project: project,
+			dueAt:   c.Due,
+		}
+		if listed {
+			t.group = strings.TrimSpace(b.Lists[i].Name)
+			t.done = t.done || slices.ContainsFunc(trelloDoneLists, func(s string) bool { return strings.EqualFold(s, t.group) })
+		}
+		for _, id := range c.IDLabels {
+			if l, ok := labels[id]; ok {
+				t.tags = append(t.tags, l)
+			}
+		}
+		for _, cl := range checklists[c.ID] {
+			items := slices.Clone(cl.CheckItems)
+			slices.SortStableFunc(items, func(x, y trelloCheckItem) int { return cmp.Compare(x.Pos, y.Pos) })
+			for _, it := range items {
+				t.checklist = append(t.checklist, ChecklistItem{Text: strings.TrimSpace(it.Name), Done: it.State == "complete"})
+			}
+		}
+
+		if n := len(checklists[c.ID]); n > 1 {
+			exp.skip(source, t.title, fmt.Sprintf("%d checklists merged into one", n))
+		}
+		if strings.TrimSpace(c.Desc) != "" {
+			exp.skip(source, t.title, "description")
+		}
+		for _, n := range []struct {
+			count int
+			what  string
+		}{{comments[c.ID], "comments"}, {len(c.Attachments), "attachments"}, {len(c.IDMembers), "members"}} {
+			if n.count > 0 {
+				exp.skip(source, t.title, fmt.Sprintf("%s (%d)", n.what, n.count))
+			}
+		}
+		exp.add(t)
+	}
+	return exp, nil
+}
@@ -0,0 +1,168 @@
+package tasks
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+
+	"github.com/s1natex/tasks-api-GO/internal/middleware"
+)
+
+var userNameRe = regexp.MustCompile(`^[a-z0-9][a-z0-9._-]{0,62}$`)
+
+type createUserRequest struct {
+	Name  string `json:"name"`
+	Admin bool   `json:"admin"`
+}
+
+// createdUser is returned once on creation; only the token's hash is kept.
+type createdUser struct {
+	User
+	Token string `json:"token"`
+}
+
+// callerScope is the repository scope of the request's principal. Without
+// authentication every request acts as an admin of the default workspace.
+func callerScope(ctx context.Context) Scope {
+	p, ok := middleware.PrincipalFromContext(ctx)
+	if !ok {
+		return Scope{}
+	}
+	return Scope{WorkspaceID: p.WorkspaceID, UserID: p.UserID, Admin: p.Admin}
+}
+
+// callerID is the owner recorded on tasks the caller creates.
+func callerID(ctx context.Context) *int64 {
+	p, ok := middleware.PrincipalFromContext(ctx)
+	if !ok || p.UserID == 0 {
+		return nil
+	}
+	id := p.UserID
+	return &id
+}
+
+func callerIsAdmin(ctx context.Context) bool {
+	p, ok := middleware.PrincipalFromContext(ctx)
+	return !ok || p.Admin
+}
+
+// callerIsOperator reports whether the caller runs the deployment rather
+// than a single workspace: the shared secret, or anyone when
+// authentication is disabled.
+func callerIsOperator(ctx context.Context) bool {
+	p, ok := middleware.PrincipalFromContext(ctx)
+	return !ok || (p.Admin && p.UserID == 0)
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func newToken() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "tsk_" + base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// LookupPrincipal resolves user tokens for middleware.AuthConfig.Lookup.
+func LookupPrincipal(repo Repository) middleware.PrincipalLookup {
+	return func(ctx context.Context, credential string) (middleware.Principal, bool, error) {
+		u, err := repo.UserByTokenHash(ctx, hashToken(credential))
+		if errors.Is(err, ErrNotFound) {
+			return middleware.Principal{}, false, nil
+		}
+		if err != nil {
+			return middleware.Principal{}, false, err
+		}
+		return middleware.Principal{UserID: u.ID, WorkspaceID: u.WorkspaceID, Name: u.Name, Admin: u.Admin}, true, nil
+	}
+}
+
+// createUser registers an account and returns its API token. Only admins
+// may create users.
+func createUser(repo Repository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		if !callerIsAdmin(r.Context()) {
+			writeJSON(w, http.StatusForbidden, errResponse{Error: "forbidden"})
+			return
+		}
+		var req createUserRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeJSON(w, http.StatusBadRequest, errResponse{Error: "invalid_json"})
+			return
+		}
+		if !userNameRe.MatchString(req.Name) {
+			writeValidation(w, []fieldError{{Field: "name", Message: fmt.Sprintf("name must match %s", userNameRe)}})
+			return
+		}
+
+		token, err := newToken()
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, errResponse{Error: "unexpected_error"})
+			return
+		}
+		u, err := repo.CreateUser(r.Context(), callerScope(r.Context()), req.Name, req.Admin, hashToken(token))
+		if errors.Is(err, ErrConflict) {
+			writeJSON(w, http.StatusConflict, errResponse{Error: "conflict"})
+			return
+		}
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, errResponse{Error: "unexpected_error"})
+			return
+		}
+		writeJSON(w, http.StatusCreated, createdUser{User: u, Token: token})
+	}
+}
+
+func listUsers(repo Repository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		if !callerIsAdmin(r.Context()) {
+			writeJSON(w, http.StatusForbidden, errResponse{Error: "forbidden"})
+			return
+		}
+		users, err := repo.ListUsers(r.Context(), callerScope(r.Context()))
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, errResponse{Error: "unexpected_error"})
+			return
+		}
+		writeJSON(w, http.StatusOK, users)
+	}
+}
+
+// getMe returns the caller's account. The shared secret and disabled
+// authentication have none.
+func getMe(repo Repository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		id := callerID(r.Context())
+		if id == nil {
+			writeJSON(w, http.StatusNotFound, errResponse{Error: "not_found"})
+			return
+		}
+		u, err := repo.GetUser(r.Context(), callerScope(r.Context()), *id)
+		if errors.Is(err, ErrNotFound) {
+			writeJSON(w, http.StatusNotFound, errResponse{Error: "not_found"})
+			return
+		}
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, errResponse{Error: "unexpected_error"})
+			return
+		}
+		writeJSON(w, http.StatusOK, u)
+	}
+}
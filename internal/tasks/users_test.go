@@ -0,0 +1,173 @@
+package tasks
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/s1natex/tasks-api-GO/internal/middleware"
+)
+
+const testRootToken = "root-secret"
+
+func newAuthServer(repo Repository) *chi.Mux {
+	r := chi.NewRouter()
+	r.Use(middleware.AuthMiddleware(middleware.AuthConfig{
+		Mode:         middleware.AuthBearer,
+		BearerToken:  testRootToken,
+		SkipPrefixes: []string{"/ical/"},
+		Lookup:       LookupPrincipal(repo),
+	}))
+	RegisterRoutes(r, repo)
+	return r
+}
+
+func doAs(t *testing.T, r http.Handler, token, method, path, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	return rec
+}
+
+// createTestUser creates a user with the shared secret and returns its token.
+func createTestUser(t *testing.T, r http.Handler, name string, admin bool) string {
+	t.Helper()
+	rec := doAs(t, r, testRootToken, http.MethodPost, "/users", fmt.Sprintf(`{"name":%q,"admin":%t}`, name, admin))
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("create user %s: expected 201, got %d, body=%s", name, rec.Code, rec.Body.String())
+	}
+	var u createdUser
+	if err := json.Unmarshal(rec.Body.Bytes(), &u); err != nil {
+		t.Fatalf("failed to parse JSON: %v", err)
+	}
+	return u.Token
+}
+
+// addUser creates a user directly in repo, for tests that only need the
+// name to exist, e.g. as an assignee.
+func addUser(t *testing.T, repo Repository, name string) {
+	t.Helper()
+	if _, err := repo.CreateUser(context.Background(), Scope{}, name, false, "hash-"+name); err != nil {
+		t.Fatalf("create user %s: %v", name, err)
+	}
+}
+
+func TestUsers_TaskOwnership(t *testing.T) {
+	forEachRepo(t, func(t *testing.T, repo Repository) {
+		r := newAuthServer(repo)
+		alice := createTestUser(t, r, "alice", false)
+		bob := createTestUser(t, r, "bob", false)
+		admin := createTestUser(t, r, "ops", true)
+
+		rec := doAs(t, r, alice, http.MethodPost, "/tasks", `{"title":"alice's"}`)
+		if rec.Code != http.StatusCreated {
+			t.Fatalf("expected 201, got %d, body=%s", rec.Code, rec.Body.String())
+		}
+		var task Task
+		if err := json.Unmarshal(rec.Body.Bytes(), &task); err != nil {
+			t.Fatalf("failed to parse JSON: %v", err)
+		}
+		if task.OwnerID == nil {
+			t.Fatalf("expected owner_id to be set: %+v", task)
+		}
+		doAs(t, r, bob, http.MethodPost, "/tasks", `{"title":"bob's"}`)
+		path := fmt.Sprintf("/tasks/%d", task.ID)
+
+		tests := []struct {
+			name     string
+			token    string
+			method   string
+			path     string
+			body     string
+			wantCode int
+			wantLen  int
+		}{
+			{"owner lists own", alice, http.MethodGet, "/tasks", "", http.StatusOK, 1},
+			{"other lists own", bob, http.MethodGet, "/tasks", "", http.StatusOK, 1},
+			{"admin lists all", admin, http.MethodGet, "/tasks", "", http.StatusOK, 2},
+			{"shared secret lists all", testRootToken, http.MethodGet, "/tasks", "", http.StatusOK, 2},
+			{"owner gets", alice, http.MethodGet, path, "", http.StatusOK, -1},
+			{"other cannot get", bob, http.MethodGet, path, "", http.StatusNotFound, -1},
+			{"other cannot update", bob, http.MethodPatch, path, `{"done":true}`, http.StatusNotFound, -1},
+			{"other cannot use as parent", bob, http.MethodPost, "/tasks", fmt.Sprintf(`{"title":"x","parent_id":%d}`, task.ID), http.StatusUnprocessableEntity, -1},
+			{"owner updates", alice, http.MethodPatch, path, `{"done":true}`, http.StatusOK, -1},
+			{"admin updates", admin, http.MethodPatch, path, `{"priority":2}`, http.StatusOK, -1},
+			{"user cannot create users", alice, http.MethodPost, "/users", `{"name":"eve"}`, http.StatusForbidden, -1},
+			{"user cannot list users", alice, http.MethodGet, "/users", "", http.StatusForbidden, -1},
+			{"unknown token", "tsk_nope", http.MethodGet, "/tasks", "", http.StatusUnauthorized, -1},
+		}
+		for _, tt := range tests {
+			rec := doAs(t, r, tt.token, tt.method, tt.path, tt.body)
+			if rec.Code != tt.wantCode {
+				t.Fatalf("%s: expected %d, got %d, body=%s", tt.name, tt.wantCode, rec.Code, rec.Body.String())
+			}
+			if tt.wantLen >= 0 {
+				var list []Task
+				if err := json.Unmarshal(rec.Body.Bytes(), &list); err != nil {
+					t.Fatalf("%s: failed to parse JSON: %v", tt.name, err)
+				}
+				if len(list) != tt.wantLen {
+					t.Fatalf("%s: expected %d tasks, got %+v", tt.name, tt.wantLen, list)
+				}
+			}
+		}
+
+		rec = doAs(t, r, alice, http.MethodGet, path, "")
+		if err := json.Unmarshal(rec.Body.Bytes(), &task); err != nil {
+			t.Fatalf("failed to parse JSON: %v", err)
+		}
+		if !task.Done || task.Priority != 2 {
+			t.Fatalf("expected both updates applied, got %+v", task)
+		}
+
+		rec = doAs(t, r, alice, http.MethodGet, "/me", "")
+		if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"name":"alice"`) {
+			t.Fatalf("unexpected /me: %d %s", rec.Code, rec.Body.String())
+		}
+		rec = doAs(t, r, testRootToken, http.MethodPost, "/users", `{"name":"alice"}`)
+		if rec.Code != http.StatusConflict {
+			t.Fatalf("expected 409 for duplicate name, got %d", rec.Code)
+		}
+	})
+}
+
+func TestUpdateTask_Patch(t *testing.T) {
+	repo := NewInMemoryRepo()
+	addUser(t, repo, "bob")
+	r := newTestServer(repo)
+	rec := doJSON(t, r, http.MethodPost, "/tasks", `{"title":"a","tags":["x"],"due_at":"2026-03-05T09:00:00Z","assignee":"bob"}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d, body=%s", rec.Code, rec.Body.String())
+	}
+
+	rec = doJSON(t, r, http.MethodPatch, "/tasks/1", `{"title":"b","tags":["Y","y"],"due_at":null}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d, body=%s", rec.Code, rec.Body.String())
+	}
+	var got Task
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatalf("failed to parse JSON: %v", err)
+	}
+	if got.Title != "b" || len(got.Tags) != 1 || got.Tags[0] != "y" || got.DueAt != nil || got.Assignee != "bob" {
+		t.Fatalf("unexpected task after patch: %+v", got)
+	}
+
+	for _, body := range []string{`{"title":" "}`, `{"priority":9}`, `{"assignee":"a b"}`, `{"assignee":"carol"}`} {
+		rec = doJSON(t, r, http.MethodPatch, "/tasks/1", body)
+		if rec.Code != http.StatusUnprocessableEntity {
+			t.Fatalf("expected 422 for %s, got %d", body, rec.Code)
+		}
+	}
+	if rec = doJSON(t, r, http.MethodPatch, "/tasks/99", `{}`); rec.Code != http.StatusNotFound {
+		t.Fatalf("expected 404, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,254 @@
+package tasks
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+type viewRequest struct {
+	Name      string `json:"name"`
+	Query     string `json:"query"`
+	ProjectID *int64 `json:"project_id"`
+}
+
+// viewResponse reports the problems of a stored query that no longer
+// validates, e.g. after one of its fields was removed from the project.
+type viewResponse struct {
+	View
+	Problems []fieldError `json:"problems,omitempty"`
+}
+
+// viewParams are the GET /tasks parameters a view may store, besides
+// fields.<name> filters.
+var viewParams = map[string]bool{
+	"project_id": true, "parent_id": true, "tag": true, "done": true,
+	"assignee_id": true, "sort": true, "limit": true, "offset": true,
+}
+
+// checkViewQuery parses a stored query the way GET /tasks parses its URL.
+func checkViewQuery(r *http.Request, repo Repository, query string) (ListQuery, []fieldError, error) {
+	params, err := url.ParseQuery(query)
+	if err != nil {
+		return ListQuery{}, []fieldError{{Field: "query", Message: "query must be a URL query string"}}, nil
+	}
+	var errs []fieldError
+	for key := range params {
+		if !viewParams[key] && !strings.HasPrefix(key, "fields.") {
+			errs = append(errs, fieldError{Field: "query." + key, Message: "unknown parameter " + key})
+		}
+	}
+	q, qErrs, err := parseListQuery(r, repo, params)
+	if err != nil {
+		return ListQuery{}, nil, err
+	}
+	for _, e := range qErrs {
+		errs = append(errs, fieldError{Field: "query." + e.Field, Message: e.Message})
+	}
+	sortFieldErrors(errs)
+	return q, errs, nil
+}
+
+func (v View) response(r *http.Request, repo Repository) (viewResponse, error) {
+	_, problems, err := checkViewQuery(r, repo, v.Query)
+	return viewResponse{View: v, Problems: problems}, err
+}
+
+func createView(repo Repository) http.HandlerFunc {
+	const maxNameLen = 100
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		var req viewRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeJSON(w, http.StatusBadRequest, errResponse{Error: "invalid_json"})
+			return
+		}
+
+		var vErrs []fieldError
+		if strings.TrimSpace(req.Name) == "" {
+			vErrs = append(vErrs, fieldError{Field: "name", Message: "name is required"})
+		} else if len(req.Name) > maxNameLen {
+			vErrs = append(vErrs, fieldError{Field: "name", Message: fmt.Sprintf("name must be at most %d characters", maxNameLen)})
+		}
+		_, qErrs, err := checkViewQuery(r, repo, req.Query)
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, errResponse{Error: "unexpected_error"})
+			return
+		}
+		vErrs = append(vErrs, qErrs...)
+		if req.ProjectID != nil {
+			// sharing a view in a project changes what its members see
+			err := requireRole(r.Context(), repo, *req.ProjectID, RoleEditor)
+			switch {
+			case errors.Is(err, ErrNotFound):
+				vErrs = append(vErrs, fieldError{Field: "project_id", Message: "project not found"})
+			case errors.Is(err, errForbidden):
+				writeJSON(w, http.StatusForbidden, errResponse{Error: "forbidden"})
+				return
+			case err != nil:
+				writeJSON(w, http.StatusInternalServerError, errResponse{Error: "unexpected_error"})
+				return
+			}
+		}
+		if len(vErrs) > 0 {
+			writeValidation(w, vErrs)
+			return
+		}
+
+		// store the canonical form so equal queries compare equal
+		params, _ := url.ParseQuery(req.Query)
+		v, err := repo.CreateView(r.Context(), callerScope(r.Context()), req.Name, params.Encode(), req.ProjectID)
+		if errors.Is(err, ErrNotFound) {
+			writeValidation(w, []fieldError{{Field: "project_id", Message: "project not found"}})
+			return
+		}
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, errResponse{Error: "unexpected_error"})
+			return
+		}
+		writeJSON(w, http.StatusCreated, viewResponse{View: v})
+	}
+}
+
+func listViews(repo Repository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		views, err := repo.ListViews(r.Context(), callerScope(r.Context()))
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, errResponse{Error: "unexpected_error"})
+			return
+		}
+		out := make([]viewResponse, 0, len(views))
+		for _, v := range views {
+			resp, err := v.response(r, repo)
+			if err != nil {
+				writeJSON(w, http.StatusInternalServerError, errResponse{Error: "unexpected_error"})
+				return
+			}
+			out = append(out, resp)
+		}
+		writeJSON(w, http.StatusOK, out)
+	}
+}
+
+func getView(repo Repository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		id, ok := pathID(r, "id")
+		if !ok {
+			writeJSON(w, http.StatusNotFound, errResponse{Error: "not_found"})
+			return
+		}
+		v, err := repo.GetView(r.Context(), callerScope(r.Context()), id)
+		if errors.Is(err, ErrNotFound) {
+			writeJSON(w, http.StatusNotFound, errResponse{Error: "not_found"})
+			return
+		}
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, errResponse{Error: "unexpected_error"})
+			return
+		}
+		resp, err := v.response(r, repo)
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, errResponse{Error: "unexpected_error"})
+			return
+		}
+		writeJSON(w, http.StatusOK, resp)
+	}
+}
+
+// deleteView removes a view. Members who can see a shared view may only
+// delete it if they created it or own its project.
+func deleteView(repo Repository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		id, ok := pathID(r, "id")
+		if !ok {
+			writeJSON(w, http.StatusNotFound, errResponse{Error: "not_found"})
+			return
+		}
+		s := callerScope(r.Context())
+		v, err := repo.GetView(r.Context(), s, id)
+		if errors.Is(err, ErrNotFound) {
+			writeJSON(w, http.StatusNotFound, errResponse{Error: "not_found"})
+			return
+		}
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, errResponse{Error: "unexpected_error"})
+			return
+		}
+		if s.restricted() && (v.OwnerID == nil || *v.OwnerID != s.UserID) {
+			err := requireRole(r.Context(), repo, *v.ProjectID, RoleOwner)
+			switch {
+			case errors.Is(err, ErrNotFound):
+				writeJSON(w, http.StatusNotFound, errResponse{Error: "not_found"})
+				return
+			case errors.Is(err, errForbidden):
+				writeJSON(w, http.StatusForbidden, errResponse{Error: "forbidden"})
+				return
+			case err != nil:
+				writeJSON(w, http.StatusInternalServerError, errResponse{Error: "unexpected_error"})
+				return
+			}
+		}
+
+		if err := repo.DeleteView(r.Context(), s, id); errors.Is(err, ErrNotFound) {
+			writeJSON(w, http.StatusNotFound, errResponse{Error: "not_found"})
+			return
+		} else if err != nil {
+			writeJSON(w, http.StatusInternalServerError, errResponse{Error: "unexpected_error"})
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// listViewTasks runs a view's query like GET /tasks would. The request may
+// override the stored limit and offset to page through the results, and
+// picks the representation with fields, include and Accept as on GET /tasks.
+func listViewTasks(repo Repository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		id, ok := pathID(r, "id")
+		if !ok {
+			writeJSON(w, http.StatusNotFound, errResponse{Error: "not_found"})
+			return
+		}
+		v, err := repo.GetView(r.Context(), callerScope(r.Context()), id)
+		if errors.Is(err, ErrNotFound) {
+			writeJSON(w, http.StatusNotFound, errResponse{Error: "not_found"})
+			return
+		}
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, errResponse{Error: "unexpected_error"})
+			return
+		}
+
+		query, _ := url.ParseQuery(v.Query)
+		for _, key := range []string{"limit", "offset"} {
+			if s := r.URL.Query().Get(key); s != "" {
+				query.Set(key, s)
+			}
+		}
+		q, vErrs, err := checkViewQuery(r, repo, query.Encode())
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, errResponse{Error: "unexpected_error"})
+			return
+		}
+		proj, pErrs := parseProjection(r.URL.Query())
+		if vErrs = append(vErrs, pErrs...); len(vErrs) > 0 {
+			writeValidation(w, vErrs)
+			return
+		}
+		writeTasks(w, r, repo, q, proj)
+	}
+}
@@ -0,0 +1,120 @@
+package tasks
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestSavedViews(t *testing.T) {
+	forEachRepo(t, func(t *testing.T, repo Repository) {
+		r := newAuthServer(repo)
+		owner := createTestUser(t, r, "olivia", false)
+		viewer := createTestUser(t, r, "vic", false)
+		outsider := createTestUser(t, r, "otto", false)
+
+		project := createdID(t, r, owner, "/projects", `{"name":"p","fields":[{"name":"points","type":"number"}]}`)
+		doAs(t, r, owner, http.MethodPost, fmt.Sprintf("/projects/%d/members", project), fmt.Sprintf(`{"user_id":%d,"role":"viewer"}`, testUserID(t, r, viewer)))
+		var ids []int64
+		for _, pts := range []int{1, 5, 3, 8} {
+			ids = append(ids, createdID(t, r, owner, "/tasks", fmt.Sprintf(`{"title":"t%d","project_id":%d,"fields":{"points":%d}}`, pts, project, pts)))
+		}
+		query := fmt.Sprintf("project_id=%d&fields.points[gte]=3&sort=-fields.points&limit=2", project)
+		shared := createdID(t, r, owner, "/views", fmt.Sprintf(`{"name":"big","query":%q,"project_id":%d}`, query, project))
+		private := createdID(t, r, owner, "/views", `{"name":"mine","query":"done=false"}`)
+
+		tests := []struct {
+			name     string
+			token    string
+			method   string
+			path     string
+			body     string
+			wantCode int
+			wantIDs  []int64 // ids of listed tasks or views
+		}{
+			{"owner lists views", owner, http.MethodGet, "/views", "", http.StatusOK, []int64{shared, private}},
+			{"member sees shared view", viewer, http.MethodGet, "/views", "", http.StatusOK, []int64{shared}},
+			{"outsider sees none", outsider, http.MethodGet, "/views", "", http.StatusOK, []int64{}},
+			{"view runs its query", viewer, http.MethodGet, fmt.Sprintf("/views/%d/tasks", shared), "", http.StatusOK, []int64{ids[3], ids[1]}},
+			{"request pages through", viewer, http.MethodGet, fmt.Sprintf("/views/%d/tasks?offset=2", shared), "", http.StatusOK, []int64{ids[2]}},
+			{"GET /tasks pages too", owner, http.MethodGet, "/tasks?" + query + "&offset=1", "", http.StatusOK, []int64{ids[1], ids[2]}},
+			{"outsider cannot run view", outsider, http.MethodGet, fmt.Sprintf("/views/%d/tasks", shared), "", http.StatusNotFound, nil},
+			{"member cannot see private view", viewer, http.MethodGet, fmt.Sprintf("/views/%d", private), "", http.StatusNotFound, nil},
+			{"viewer cannot share", viewer, http.MethodPost, "/views", fmt.Sprintf(`{"name":"x","project_id":%d}`, project), http.StatusForbidden, nil},
+			{"viewer cannot delete", viewer, http.MethodDelete, fmt.Sprintf("/views/%d", shared), "", http.StatusForbidden, nil},
+			{"unknown parameter", owner, http.MethodPost, "/views", `{"name":"x","query":"colour=red"}`, http.StatusUnprocessableEntity, nil},
+			{"invalid query", owner, http.MethodPost, "/views", `{"name":"x","query":"limit=0&sort=nope"}`, http.StatusUnprocessableEntity, nil},
+			{"name required", owner, http.MethodPost, "/views", `{"query":"done=true"}`, http.StatusUnprocessableEntity, nil},
+			{"bad page size", owner, http.MethodGet, "/tasks?limit=501", "", http.StatusUnprocessableEntity, nil},
+		}
+		for _, tt := range tests {
+			rec := doAs(t, r, tt.token, tt.method, tt.path, tt.body)
+			if rec.Code != tt.wantCode {
+				t.Fatalf("%s: expected %d, got %d, body=%s", tt.name, tt.wantCode, rec.Code, rec.Body.String())
+			}
+			if tt.wantIDs == nil {
+				continue
+			}
+			var list []struct {
+				ID int64 `json:"id"`
+			}
+			if err := json.Unmarshal(rec.Body.Bytes(), &list); err != nil {
+				t.Fatalf("%s: failed to parse JSON: %v", tt.name, err)
+			}
+			got := []int64{}
+			for _, v := range list {
+				got = append(got, v.ID)
+			}
+			if !slices.Equal(got, tt.wantIDs) {
+				t.Fatalf("%s: expected %v, got %s", tt.name, tt.wantIDs, rec.Body.String())
+			}
+		}
+
+		// a view's tasks come in the projections and formats of GET /tasks
+		rec := doAs(t, r, viewer, http.MethodGet, fmt.Sprintf("/views/%d/tasks?fields=title", shared), "")
+		var projected []map[string]any
+		if err := json.Unmarshal(rec.Body.Bytes(), &projected); err != nil {
+			t.Fatalf("failed to parse JSON: %v", err)
+		}
+		if len(projected) != 2 || len(projected[0]) != 2 || projected[0]["title"] != "t8" {
+			t.Fatalf("expected id and title only, got %s", rec.Body.String())
+		}
+		req := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/views/%d/tasks", shared), nil)
+		req.Header.Set("Authorization", "Bearer "+viewer)
+		req.Header.Set("Accept", ndjsonType)
+		rec = httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		if ct := rec.Header().Get("Content-Type"); rec.Code != http.StatusOK || ct != ndjsonType || strings.Count(rec.Body.String(), "\n") != 2 {
+			t.Fatalf("expected two NDJSON lines, got %d %q %s", rec.Code, ct, rec.Body.String())
+		}
+
+		// removing a field the view filters on invalidates it
+		rec = doAs(t, r, owner, http.MethodPut, fmt.Sprintf("/projects/%d/fields", project), `{"fields":[]}`)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("set fields: expected 200, got %d", rec.Code)
+		}
+		rec = doAs(t, r, owner, http.MethodGet, fmt.Sprintf("/views/%d", shared), "")
+		var v viewResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &v); err != nil {
+			t.Fatalf("failed to parse JSON: %v", err)
+		}
+		if len(v.Problems) != 2 || v.Problems[0].Field != "query.fields.points[gte]" || v.Problems[1].Field != "query.sort" {
+			t.Fatalf("expected problems for the removed field, got %s", rec.Body.String())
+		}
+		rec = doAs(t, r, viewer, http.MethodGet, fmt.Sprintf("/views/%d/tasks", shared), "")
+		if rec.Code != http.StatusUnprocessableEntity || !strings.Contains(rec.Body.String(), "unknown field points") {
+			t.Fatalf("expected 422 for a stale view, got %d %s", rec.Code, rec.Body.String())
+		}
+
+		if rec := doAs(t, r, owner, http.MethodDelete, fmt.Sprintf("/views/%d", shared), ""); rec.Code != http.StatusNoContent {
+			t.Fatalf("delete: expected 204, got %d", rec.Code)
+		}
+		if rec := doAs(t, r, viewer, http.MethodGet, fmt.Sprintf("/views/%d", shared), ""); rec.Code != http.StatusNotFound {
+			t.Fatalf("expected 404 after delete, got %d", rec.Code)
+		}
+	})
+}
@@ -0,0 +1,577 @@
+package tasks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"slices"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/cenkalti/backoff/v5"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	// webhookBatch is how many due deliveries the worker reads at a time.
+	webhookBatch = 100
+	// webhookConcurrency is how many webhooks the worker sends to at once.
+	webhookConcurrency = 8
+	// defaultDeliveryLimit is how many deliveries a log lists by default.
+	defaultDeliveryLimit = 50
+)
+
+var webhookDeliveriesTotal = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "webhook_deliveries_total",
+		Help: "Total number of webhook delivery attempts",
+	},
+	[]string{"result"},
+)
+
+func init() {
+	prometheus.MustRegister(webhookDeliveriesTotal)
+}
+
+// webhookEvents are the event types a webhook subscribes to by default,
+// in the order they are listed.
+var webhookEvents = []string{EventCreated, EventUpdated, EventDeleted}
+
+// webhookPayload is the body POSTed for an event.
+type webhookPayload struct {
+	EventID int64     `json:"event_id"`
+	Event   string    `json:"event"`
+	Task    Task      `json:"task"`
+	At      time.Time `json:"at"`
+}
+
+// webhookSignature signs a delivery the way receivers check it: the hex
+// HMAC-SHA256, keyed with the webhook secret, of the timestamp header, a
+// dot and the body. Signing the timestamp lets receivers reject replays.
+func webhookSignature(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+type webhookRequest struct {
+	URL    string   `json:"url"`
+	Events []string `json:"events"`
+	Secret string   `json:"secret"`
+}
+
+// createdWebhook shows the secret, which is not returned again.
+type createdWebhook struct {
+	Webhook
+	Secret string `json:"secret"`
+}
+
+// createWebhook subscribes a URL to the task events of the workspace. The
+// secret is generated unless given. Only admins manage webhooks, as they
+// see every task of the workspace.
+func createWebhook(repo Repository) http.HandlerFunc {
+	const maxSecretLen = 200
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		if !callerIsAdmin(r.Context()) {
+			writeJSON(w, http.StatusForbidden, errResponse{Error: "forbidden"})
+			return
+		}
+		var req webhookRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeJSON(w, http.StatusBadRequest, errResponse{Error: "invalid_json"})
+			return
+		}
+
+		var vErrs []fieldError
+		if u, err := url.Parse(req.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			vErrs = append(vErrs, fieldError{Field: "url", Message: "url must be an absolute http or https URL"})
+		}
+		events := webhookEvents
+		if req.Events != nil {
+			events = nil
+			for _, typ := range webhookEvents {
+				if slices.Contains(req.Events, typ) {
+					events = append(events, typ)
+				}
+			}
+			if len(events) == 0 || slices.ContainsFunc(req.Events, func(typ string) bool { return !slices.Contains(webhookEvents, typ) }) {
+				vErrs = append(vErrs, fieldError{Field: "events", Message: "events must be a non-empty list of created, updated and deleted"})
+			}
+		}
+		if len(req.Secret) > maxSecretLen {
+			vErrs = append(vErrs, fieldError{Field: "secret", Message: fmt.Sprintf("secret must be at most %d characters", maxSecretLen)})
+		}
+		if len(vErrs) > 0 {
+			writeValidation(w, vErrs)
+			return
+		}
+
+		secret := req.Secret
+		if secret == "" {
+			var err error
+			if secret, err = newToken(); err != nil {
+				writeJSON(w, http.StatusInternalServerError, errResponse{Error: "unexpected_error"})
+				return
+			}
+		}
+		h, err := repo.CreateWebhook(r.Context(), callerScope(r.Context()), req.URL, events, secret)
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, errResponse{Error: "unexpected_error"})
+			return
+		}
+		writeJSON(w, http.StatusCreated, createdWebhook{Webhook: h, Secret: h.Secret})
+	}
+}
+
+func listWebhooks(repo Repository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		if !callerIsAdmin(r.Context()) {
+			writeJSON(w, http.StatusForbidden, errResponse{Error: "forbidden"})
+			return
+		}
+		hooks, err := repo.ListWebhooks(r.Context(), callerScope(r.Context()))
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, errResponse{Error: "unexpected_error"})
+			return
+		}
+		writeJSON(w, http.StatusOK, hooks)
+	}
+}
+
+func getWebhook(repo Repository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		if !callerIsAdmin(r.Context()) {
+			writeJSON(w, http.StatusForbidden, errResponse{Error: "forbidden"})
+			return
+		}
+		id, ok := pathID(r, "id")
+		if !ok {
+			writeJSON(w, http.StatusNotFound, errResponse{Error: "not_found"})
+			return
+		}
+		h, err := repo.GetWebhook(r.Context(), callerScope(r.Context()), id)
+		if errors.Is(err, ErrNotFound) {
+			writeJSON(w, http.StatusNotFound, errResponse{Error: "not_found"})
+			return
+		}
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, errResponse{Error: "unexpected_error"})
+			return
+		}
+		writeJSON(w, http.StatusOK, h)
+	}
+}
+
+type webhookPatch struct {
+	Active *bool `json:"active"`
+}
+
+// updateWebhook turns a webhook on or off. Turning on a webhook that was
+// disabled for failing resets its failures; the deliveries it gave up on
+// stay failed and can be redelivered.
+func updateWebhook(repo Repository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		if !callerIsAdmin(r.Context()) {
+			writeJSON(w, http.StatusForbidden, errResponse{Error: "forbidden"})
+			return
+		}
+		id, ok := pathID(r, "id")
+		if !ok {
+			writeJSON(w, http.StatusNotFound, errResponse{Error: "not_found"})
+			return
+		}
+		var req webhookPatch
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeJSON(w, http.StatusBadRequest, errResponse{Error: "invalid_json"})
+			return
+		}
+		if req.Active == nil {
+			writeValidation(w, []fieldError{{Field: "active", Message: "active is required"}})
+			return
+		}
+		h, err := repo.SetWebhookActive(r.Context(), callerScope(r.Context()), id, *req.Active)
+		if errors.Is(err, ErrNotFound) {
+			writeJSON(w, http.StatusNotFound, errResponse{Error: "not_found"})
+			return
+		}
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, errResponse{Error: "unexpected_error"})
+			return
+		}
+		writeJSON(w, http.StatusOK, h)
+	}
+}
+
+func deleteWebhook(repo Repository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		if !callerIsAdmin(r.Context()) {
+			writeJSON(w, http.StatusForbidden, errResponse{Error: "forbidden"})
+			return
+		}
+		id, ok := pathID(r, "id")
+		if !ok {
+			writeJSON(w, http.StatusNotFound, errResponse{Error: "not_found"})
+			return
+		}
+		if err := repo.DeleteWebhook(r.Context(), callerScope(r.Context()), id); errors.Is(err, ErrNotFound) {
+			writeJSON(w, http.StatusNotFound, errResponse{Error: "not_found"})
+			return
+		} else if err != nil {
+			writeJSON(w, http.StatusInternalServerError, errResponse{Error: "unexpected_error"})
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// listWebhookDeliveries is the delivery log of a webhook, newest first.
+func listWebhookDeliveries(repo Repository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		if !callerIsAdmin(r.Context()) {
+			writeJSON(w, http.StatusForbidden, errResponse{Error: "forbidden"})
+			return
+		}
+		id, ok := pathID(r, "id")
+		if !ok {
+			writeJSON(w, http.StatusNotFound, errResponse{Error: "not_found"})
+			return
+		}
+		limit := defaultDeliveryLimit
+		if s := r.URL.Query().Get("limit"); s != "" {
+			n, err := strconv.Atoi(s)
+			if err != nil || n < 1 || n > maxPageSize {
+				writeValidation(w, []fieldError{{Field: "limit", Message: fmt.Sprintf("limit must be an integer from 1 to %d", maxPageSize)}})
+				return
+			}
+			limit = n
+		}
+		out, err := repo.ListWebhookDeliveries(r.Context(), callerScope(r.Context()), id, limit)
+		if errors.Is(err, ErrNotFound) {
+			writeJSON(w, http.StatusNotFound, errResponse{Error: "not_found"})
+			return
+		}
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, errResponse{Error: "unexpected_error"})
+			return
+		}
+		writeJSON(w, http.StatusOK, out)
+	}
+}
+
+// redeliverWebhook queues the payload of a logged delivery again, as a new
+// delivery that the worker sends like any other.
+func redeliverWebhook(repo Repository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		if !callerIsAdmin(r.Context()) {
+			writeJSON(w, http.StatusForbidden, errResponse{Error: "forbidden"})
+			return
+		}
+		id, ok := pathID(r, "id")
+		deliveryID, dok := pathID(r, "delivery_id")
+		if !ok || !dok {
+			writeJSON(w, http.StatusNotFound, errResponse{Error: "not_found"})
+			return
+		}
+		d, err := repo.RedeliverWebhook(r.Context(), callerScope(r.Context()), id, deliveryID)
+		if errors.Is(err, ErrNotFound) {
+			writeJSON(w, http.StatusNotFound, errResponse{Error: "not_found"})
+			return
+		}
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, errResponse{Error: "unexpected_error"})
+			return
+		}
+		writeJSON(w, http.StatusAccepted, d)
+	}
+}
+
+// WebhookWorker sends the queued webhook deliveries of every workspace. A
+// delivery succeeds on a 2xx response; otherwise it is retried with
+// exponential backoff until MaxAttempts, and a webhook whose attempts fail
+// DisableAfter times in a row is turned off.
+//
+// Up to Concurrency webhooks are sent to at once, each by a sender of its
+// own that posts its deliveries one at a time and in order, so a slow
+// receiver only holds up its own deliveries.
+type WebhookWorker struct {
+	repo   Repository
+	broker *Broker
+
+	// Client posts the deliveries. The default one refuses to connect to
+	// loopback, private and link-local addresses; see webhookDialControl.
+	Client      *http.Client
+	Concurrency int
+	// PollInterval is how often the queue is checked for retries that
+	// came due; new events wake the worker right away.
+	PollInterval time.Duration
+	MaxAttempts  int
+	DisableAfter int
+	// InitialInterval and MaxInterval bound the delay between attempts,
+	// which doubles after each failure.
+	InitialInterval time.Duration
+	MaxInterval     time.Duration
+
+	mu      sync.Mutex
+	busy    map[int64]bool // webhooks with a running sender
+	senders sync.WaitGroup
+	idle    chan struct{} // has a value after a sender finished
+}
+
+// NewWebhookWorker returns a worker for the deliveries queued in repo,
+// woken by the events of b, which may be nil.
+func NewWebhookWorker(repo Repository, b *Broker) *WebhookWorker {
+	return &WebhookWorker{
+		repo:            repo,
+		broker:          b,
+		Client:          newWebhookClient(),
+		Concurrency:     webhookConcurrency,
+		PollInterval:    time.Second,
+		MaxAttempts:     8,
+		DisableAfter:    15,
+		InitialInterval: 30 * time.Second,
+		MaxInterval:     time.Hour,
+		busy:            make(map[int64]bool),
+		idle:            make(chan struct{}, 1),
+	}
+}
+
+// errBlockedAddress is the error of a webhook receiver at an address the
+// server must not reach for a tenant.
+var errBlockedAddress = errors.New("webhook receiver address is not allowed")
+
+// cgnat is the shared address space of carrier-grade NAT, RFC 6598.
+var cgnat = netip.MustParsePrefix("100.64.0.0/10")
+
+// newWebhookClient returns the client of the deliveries: it connects
+// directly, never through a proxy, and only to public addresses.
+func newWebhookClient() *http.Client {
+	dialer := &net.Dialer{Timeout: 5 * time.Second, Control: webhookDialControl}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return &http.Client{Timeout: 10 * time.Second, Transport: transport}
+}
+
+// webhookDialControl refuses connections to loopback, private, link-local
+// (which includes cloud metadata at 169.254.169.254), shared, multicast
+// and unspecified addresses. It runs on the resolved address of every
+// connection, redirects included, so a host name cannot sidestep it.
+func webhookDialControl(_, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip, err := netip.ParseAddr(host)
+	if err != nil {
+		return err
+	}
+	ip = ip.Unmap()
+	if !ip.IsGlobalUnicast() || ip.IsPrivate() || cgnat.Contains(ip) {
+		return errBlockedAddress
+	}
+	return nil
+}
+
+// Run sends deliveries as they come due until ctx is done. Deliveries are
+// stored before they are sent, so a restart picks up where it stopped.
+func (w *WebhookWorker) Run(ctx context.Context) {
+	var wake <-chan TaskEvent
+	unsubscribe := func() {}
+	if w.broker != nil {
+		wake, unsubscribe = w.broker.Subscribe(watchBuffer)
+	}
+	defer func() { unsubscribe() }()
+	ticker := time.NewTicker(w.PollInterval)
+	defer ticker.Stop()
+	// the senders post with ctx, so they stop soon after it is done
+	defer w.senders.Wait()
+
+	for {
+		w.process(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-w.idle:
+		case _, ok := <-wake:
+			if !ok {
+				// the queue has everything, so after being dropped for
+				// falling behind it is enough to subscribe again; after
+				// the broker closed, the ticker keeps polling
+				unsubscribe()
+				wake, unsubscribe = nil, func() {}
+				select {
+				case <-w.broker.Done():
+				default:
+					wake, unsubscribe = w.broker.Subscribe(watchBuffer)
+				}
+			}
+		}
+	}
+}
+
+// process starts senders for the webhooks with deliveries that are due,
+// a batch at a time, until Concurrency senders run.
+func (w *WebhookWorker) process(ctx context.Context) {
+	for ctx.Err() == nil {
+		busy := w.busyWebhooks()
+		if len(busy) >= w.Concurrency {
+			return // a sender that finishes wakes Run
+		}
+		due, err := w.repo.DueWebhookDeliveries(ctx, time.Now().UTC(), webhookBatch, busy)
+		if err != nil {
+			return // tried again on the next tick
+		}
+		var hooks []int64
+		byHook := make(map[int64][]DueDelivery)
+		for _, d := range due {
+			if byHook[d.WebhookID] == nil {
+				hooks = append(hooks, d.WebhookID)
+			}
+			byHook[d.WebhookID] = append(byHook[d.WebhookID], d)
+		}
+		for _, id := range hooks {
+			if !w.send(ctx, id, byHook[id]) {
+				return
+			}
+		}
+		if len(due) < webhookBatch {
+			return
+		}
+	}
+}
+
+// busyWebhooks lists the webhooks with a running sender.
+func (w *WebhookWorker) busyWebhooks() []int64 {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	ids := make([]int64, 0, len(w.busy))
+	for id := range w.busy {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// send starts a sender that delivers ds, the due deliveries of the
+// webhook id, in order. It reports false when Concurrency senders run
+// already.
+func (w *WebhookWorker) send(ctx context.Context, id int64, ds []DueDelivery) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if len(w.busy) >= w.Concurrency {
+		return false
+	}
+	w.busy[id] = true
+	w.senders.Add(1)
+	go func() {
+		defer w.senders.Done()
+		for _, d := range ds {
+			if ctx.Err() != nil {
+				break
+			}
+			w.deliver(ctx, d)
+		}
+		w.mu.Lock()
+		delete(w.busy, id)
+		w.mu.Unlock()
+		select {
+		case w.idle <- struct{}{}:
+		default: // a wake-up is pending already
+		}
+	}()
+	return true
+}
+
+func (w *WebhookWorker) deliver(ctx context.Context, d DueDelivery) {
+	now := time.Now().UTC()
+	a := WebhookAttempt{At: now, DisableAfter: w.DisableAfter}
+	a.StatusCode, a.Error = w.post(ctx, d, now)
+	if ctx.Err() != nil {
+		return // shutting down; the delivery stays due
+	}
+
+	result := DeliverySucceeded
+	if a.Error != "" {
+		result = DeliveryFailed
+		if attempt := d.Attempts + 1; attempt < w.MaxAttempts {
+			retry := now.Add(w.retryDelay(attempt))
+			a.Retry = &retry
+			result = "retrying"
+		}
+	}
+	webhookDeliveriesTotal.WithLabelValues(result).Inc()
+	_ = w.repo.RecordWebhookAttempt(ctx, d.ID, a)
+}
+
+// post sends d, signed, and returns the response status and the error of
+// a failed attempt.
+func (w *WebhookWorker) post(ctx context.Context, d DueDelivery, now time.Time) (int, string) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.URL, bytes.NewReader(d.Payload))
+	if err != nil {
+		return 0, err.Error()
+	}
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "tasks-api-webhooks")
+	req.Header.Set("X-Webhook-Event", d.Event)
+	req.Header.Set("X-Webhook-Delivery", strconv.FormatInt(d.ID, 10))
+	req.Header.Set("X-Webhook-Timestamp", timestamp)
+	req.Header.Set("X-Webhook-Signature", webhookSignature(d.Secret, timestamp, d.Payload))
+
+	resp, err := w.Client.Do(req)
+	if err != nil {
+		return 0, err.Error()
+	}
+	// drain a little, so the connection can be reused
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	_ = resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Sprintf("unexpected status %d", resp.StatusCode)
+	}
+	return resp.StatusCode, ""
+}
+
+// retryDelay is the delay before the attempt after the given one.
+func (w *WebhookWorker) retryDelay(attempt int) time.Duration {
+	b := &backoff.ExponentialBackOff{
+		InitialInterval:     w.InitialInterval,
+		RandomizationFactor: backoff.DefaultRandomizationFactor,
+		Multiplier:          2,
+		MaxInterval:         w.MaxInterval,
+	}
+	b.Reset()
+	var d time.Duration
+	for range attempt {
+		d = b.NextBackOff()
+	}
+	return d
+}
@@ -0,0 +1,319 @@
+package tasks
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type receivedHook struct {
+	header http.Header
+	body   []byte
+}
+
+// newReceiver is a webhook endpoint answering with the status codes of
+// respond in turn, then with the last one, and reporting each request.
+func newReceiver(t *testing.T, respond ...int) (*httptest.Server, <-chan receivedHook, *atomic.Int64) {
+	t.Helper()
+	got := make(chan receivedHook, 100)
+	var n atomic.Int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		i := int(n.Add(1)) - 1
+		got <- receivedHook{header: r.Header.Clone(), body: body}
+		w.WriteHeader(respond[min(i, len(respond)-1)])
+	}))
+	t.Cleanup(srv.Close)
+	return srv, got, &n
+}
+
+func nextHook(t *testing.T, got <-chan receivedHook) receivedHook {
+	t.Helper()
+	select {
+	case h := <-got:
+		return h
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for a delivery")
+		return receivedHook{}
+	}
+}
+
+// startWorker runs a webhook worker for repo with short delays until the
+// test ends.
+func startWorker(t *testing.T, repo Repository, tune func(*WebhookWorker)) {
+	t.Helper()
+	w := NewWebhookWorker(repo, brokerOf(repo))
+	w.Client = &http.Client{Timeout: 10 * time.Second} // the receivers listen on loopback
+	w.PollInterval = 5 * time.Millisecond
+	w.InitialInterval = 10 * time.Millisecond
+	w.MaxInterval = 20 * time.Millisecond
+	if tune != nil {
+		tune(w)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		w.Run(ctx)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+}
+
+// deliveryLog waits until the log of a webhook satisfies ok and returns it.
+func deliveryLog(t *testing.T, r http.Handler, hook int64, ok func([]WebhookDelivery) bool) []WebhookDelivery {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		var log []WebhookDelivery
+		rec := doAs(t, r, testRootToken, http.MethodGet, fmt.Sprintf("/webhooks/%d/deliveries", hook), "")
+		if err := json.Unmarshal(rec.Body.Bytes(), &log); err != nil {
+			t.Fatalf("failed to parse JSON: %v, body=%s", err, rec.Body.String())
+		}
+		if ok(log) {
+			return log
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("unexpected delivery log: %s", rec.Body.String())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestWebhooks_Delivery(t *testing.T) {
+	forEachRepo(t, func(t *testing.T, repo Repository) {
+		repo = WithEvents(repo, NewBroker())
+		r := newAuthServer(repo)
+		receiver, got, _ := newReceiver(t, http.StatusInternalServerError, http.StatusNoContent)
+		hook := createdID(t, r, testRootToken, "/webhooks", fmt.Sprintf(`{"url":%q,"events":["created"],"secret":"s3cret"}`, receiver.URL))
+		startWorker(t, repo, nil)
+
+		id := createdID(t, r, testRootToken, "/tasks", `{"title":"ship it"}`)
+		doAs(t, r, testRootToken, http.MethodPatch, fmt.Sprintf("/tasks/%d", id), `{"done":true}`)
+
+		// the first attempt fails and is retried
+		first, retried := nextHook(t, got), nextHook(t, got)
+		if string(first.body) != string(retried.body) {
+			t.Fatalf("expected the same payload again, got %s and %s", first.body, retried.body)
+		}
+		h := retried.header
+		if h.Get("X-Webhook-Event") != EventCreated || h.Get("Content-Type") != "application/json" {
+			t.Fatalf("unexpected headers: %v", h)
+		}
+		if want := webhookSignature("s3cret", h.Get("X-Webhook-Timestamp"), retried.body); h.Get("X-Webhook-Signature") != want {
+			t.Fatalf("expected signature %s, got %s", want, h.Get("X-Webhook-Signature"))
+		}
+		var payload webhookPayload
+		if err := json.Unmarshal(retried.body, &payload); err != nil {
+			t.Fatalf("failed to parse payload: %v", err)
+		}
+		if payload.Event != EventCreated || payload.Task.ID != id || payload.EventID == 0 {
+			t.Fatalf("unexpected payload: %s", retried.body)
+		}
+
+		log := deliveryLog(t, r, hook, func(log []WebhookDelivery) bool {
+			return len(log) == 1 && log[0].Status == DeliverySucceeded
+		})
+		d := log[0]
+		if d.Attempts != 2 || d.ResponseStatus != http.StatusNoContent || d.LastError != "" || d.NextAttemptAt != nil {
+			t.Fatalf("unexpected delivery: %+v", d)
+		}
+		if h.Get("X-Webhook-Delivery") != fmt.Sprint(d.ID) {
+			t.Fatalf("expected delivery id %d, got %s", d.ID, h.Get("X-Webhook-Delivery"))
+		}
+
+		rec := doAs(t, r, testRootToken, http.MethodPost, fmt.Sprintf("/webhooks/%d/deliveries/%d/redeliver", hook, d.ID), "")
+		if rec.Code != http.StatusAccepted {
+			t.Fatalf("expected 202, got %d, body=%s", rec.Code, rec.Body.String())
+		}
+		if again := nextHook(t, got); string(again.body) != string(first.body) {
+			t.Fatalf("expected the payload to be redelivered, got %s", again.body)
+		}
+		log = deliveryLog(t, r, hook, func(log []WebhookDelivery) bool {
+			return len(log) == 2 && log[0].Status == DeliverySucceeded
+		})
+		if log[0].RedeliveryOf == nil || *log[0].RedeliveryOf != d.ID || log[0].Attempts != 1 {
+			t.Fatalf("unexpected redelivery: %+v", log[0])
+		}
+		if rec := doAs(t, r, testRootToken, http.MethodPost, fmt.Sprintf("/webhooks/%d/deliveries/%d/redeliver", hook, d.ID+100), ""); rec.Code != http.StatusNotFound {
+			t.Fatalf("expected 404, got %d", rec.Code)
+		}
+	})
+}
+
+func TestWebhooks_DisableAfterFailures(t *testing.T) {
+	forEachRepo(t, func(t *testing.T, repo Repository) {
+		repo = WithEvents(repo, NewBroker())
+		r := newAuthServer(repo)
+		receiver, _, hits := newReceiver(t, http.StatusServiceUnavailable)
+		hook := createdID(t, r, testRootToken, "/webhooks", fmt.Sprintf(`{"url":%q}`, receiver.URL))
+		startWorker(t, repo, func(w *WebhookWorker) {
+			w.MaxAttempts = 2
+			w.DisableAfter = 3
+		})
+
+		createdID(t, r, testRootToken, "/tasks", `{"title":"one"}`)
+		deliveryLog(t, r, hook, func(log []WebhookDelivery) bool {
+			return len(log) == 1 && log[0].Status == DeliveryFailed
+		})
+		if n := hits.Load(); n != 2 {
+			t.Fatalf("expected 2 attempts, got %d", n)
+		}
+
+		createdID(t, r, testRootToken, "/tasks", `{"title":"two"}`)
+		log := deliveryLog(t, r, hook, func(log []WebhookDelivery) bool {
+			return len(log) == 2 && log[0].Attempts == 1
+		})
+		if log[0].Status != DeliveryPending || log[0].ResponseStatus != http.StatusServiceUnavailable || log[0].LastError == "" {
+			t.Fatalf("unexpected delivery: %+v", log[0])
+		}
+
+		var h Webhook
+		rec := doAs(t, r, testRootToken, http.MethodGet, fmt.Sprintf("/webhooks/%d", hook), "")
+		if err := json.Unmarshal(rec.Body.Bytes(), &h); err != nil {
+			t.Fatalf("failed to parse JSON: %v", err)
+		}
+		if h.Active || h.Failures != 3 {
+			t.Fatalf("expected the webhook to be disabled after 3 failures, got %+v", h)
+		}
+
+		// a disabled webhook gets no new deliveries and sends none
+		createdID(t, r, testRootToken, "/tasks", `{"title":"three"}`)
+		time.Sleep(50 * time.Millisecond)
+		if n := hits.Load(); n != 3 {
+			t.Fatalf("expected no attempts while disabled, got %d", n)
+		}
+		deliveryLog(t, r, hook, func(log []WebhookDelivery) bool { return len(log) == 2 })
+
+		rec = doAs(t, r, testRootToken, http.MethodPatch, fmt.Sprintf("/webhooks/%d", hook), `{"active":true}`)
+		if err := json.Unmarshal(rec.Body.Bytes(), &h); err != nil {
+			t.Fatalf("failed to parse JSON: %v", err)
+		}
+		if !h.Active || h.Failures != 0 {
+			t.Fatalf("expected the webhook to be enabled again, got %+v", h)
+		}
+		deliveryLog(t, r, hook, func(log []WebhookDelivery) bool {
+			return log[0].Status == DeliveryFailed && log[0].Attempts == 2
+		})
+
+		if rec := doAs(t, r, testRootToken, http.MethodDelete, fmt.Sprintf("/webhooks/%d", hook), ""); rec.Code != http.StatusNoContent {
+			t.Fatalf("expected 204, got %d", rec.Code)
+		}
+		if rec := doAs(t, r, testRootToken, http.MethodGet, fmt.Sprintf("/webhooks/%d/deliveries", hook), ""); rec.Code != http.StatusNotFound {
+			t.Fatalf("expected 404, got %d", rec.Code)
+		}
+	})
+}
+
+func TestWebhooks_Validation(t *testing.T) {
+	r := newAuthServer(NewInMemoryRepo())
+	alice := createTestUser(t, r, "alice", false)
+
+	if rec := doAs(t, r, alice, http.MethodPost, "/webhooks", `{"url":"https://example.com/hook"}`); rec.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 for a non-admin, got %d", rec.Code)
+	}
+	if rec := doAs(t, r, alice, http.MethodGet, "/webhooks", ""); rec.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 for a non-admin, got %d", rec.Code)
+	}
+
+	rec := doAs(t, r, testRootToken, http.MethodPost, "/webhooks", `{"url":"ftp://example.com","events":["created","renamed"],"secret":"`+strings.Repeat("x", 201)+`"}`)
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("expected 422, got %d, body=%s", rec.Code, rec.Body.String())
+	}
+	var resp errResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to parse JSON: %v", err)
+	}
+	if len(resp.Details) != 3 {
+		t.Fatalf("expected 3 field errors, got %+v", resp.Details)
+	}
+	if rec := doAs(t, r, testRootToken, http.MethodPost, "/webhooks", `{"url":"https://example.com","events":[]}`); rec.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("expected 422 for no events, got %d", rec.Code)
+	}
+
+	rec = doAs(t, r, testRootToken, http.MethodPost, "/webhooks", `{"url":"https://example.com/hook","events":["deleted","created"]}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d, body=%s", rec.Code, rec.Body.String())
+	}
+	var created createdWebhook
+	if err := json.Unmarshal(rec.Body.Bytes(), &created); err != nil {
+		t.Fatalf("failed to parse JSON: %v", err)
+	}
+	if !strings.HasPrefix(created.Secret, "tsk_") || strings.Join(created.Events, ",") != "created,deleted" || !created.Active {
+		t.Fatalf("unexpected webhook: %s", rec.Body.String())
+	}
+	rec = doAs(t, r, testRootToken, http.MethodGet, fmt.Sprintf("/webhooks/%d", created.ID), "")
+	if strings.Contains(rec.Body.String(), created.Secret) {
+		t.Fatalf("the secret must only be shown on creation: %s", rec.Body.String())
+	}
+	if rec := doAs(t, r, testRootToken, http.MethodPatch, fmt.Sprintf("/webhooks/%d", created.ID), `{}`); rec.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("expected 422 without active, got %d", rec.Code)
+	}
+	if rec := doAs(t, r, testRootToken, http.MethodGet, fmt.Sprintf("/webhooks/%d/deliveries?limit=0", created.ID), ""); rec.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("expected 422 for limit=0, got %d", rec.Code)
+	}
+}
+
+func TestWebhooks_SlowReceiver(t *testing.T) {
+	repo := WithEvents(NewInMemoryRepo(), NewBroker())
+	r := newAuthServer(repo)
+	release := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	t.Cleanup(slow.Close)
+	t.Cleanup(func() { close(release) })
+	fast, got, _ := newReceiver(t, http.StatusNoContent)
+	createdID(t, r, testRootToken, "/webhooks", fmt.Sprintf(`{"url":%q,"events":["created"]}`, slow.URL))
+	createdID(t, r, testRootToken, "/webhooks", fmt.Sprintf(`{"url":%q,"events":["created"]}`, fast.URL))
+	startWorker(t, repo, nil)
+
+	// the slow receiver holds up neither other webhooks nor later events
+	for range 3 {
+		createdID(t, r, testRootToken, "/tasks", `{"title":"ship it"}`)
+		nextHook(t, got)
+	}
+}
+
+func TestWebhookDialControl(t *testing.T) {
+	tests := []struct {
+		address string
+		allowed bool
+	}{
+		{"93.184.216.34:443", true},
+		{"[2606:2800:220:1:248:1893:25c8:1946]:443", true},
+		{"127.0.0.1:80", false},
+		{"10.1.2.3:80", false},
+		{"172.16.0.1:80", false},
+		{"192.168.1.1:80", false},
+		{"100.64.0.1:80", false},
+		{"169.254.169.254:80", false},
+		{"0.0.0.0:80", false},
+		{"[::1]:80", false},
+		{"[fd00::1]:80", false},
+		{"[fe80::1]:80", false},
+		{"[::ffff:127.0.0.1]:80", false},
+	}
+	for _, tt := range tests {
+		if err := webhookDialControl("tcp", tt.address, nil); (err == nil) != tt.allowed {
+			t.Fatalf("%s: expected allowed=%t, got %v", tt.address, tt.allowed, err)
+		}
+	}
+
+	// the default client does not reach a receiver on loopback
+	receiver, _, n := newReceiver(t, http.StatusNoContent)
+	w := NewWebhookWorker(NewInMemoryRepo(), nil)
+	if _, msg := w.post(context.Background(), DueDelivery{URL: receiver.URL}, time.Now()); !strings.Contains(msg, errBlockedAddress.Error()) || n.Load() != 0 {
+		t.Fatalf("expected the delivery to be refused, got %q", msg)
+	}
+}
@@ -0,0 +1,86 @@
+package tasks
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+type createWorkspaceRequest struct {
+	Name  string `json:"name"`
+	Admin string `json:"admin"`
+}
+
+type createdWorkspace struct {
+	Workspace
+	Admin createdUser `json:"admin"`
+}
+
+// createWorkspace provisions a workspace and its first admin, whose token
+// is returned once. Only the deployment operator may call it.
+func createWorkspace(repo Repository) http.HandlerFunc {
+	const maxNameLen = 100
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		if !callerIsOperator(r.Context()) {
+			writeJSON(w, http.StatusForbidden, errResponse{Error: "forbidden"})
+			return
+		}
+		var req createWorkspaceRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeJSON(w, http.StatusBadRequest, errResponse{Error: "invalid_json"})
+			return
+		}
+
+		var vErrs []fieldError
+		if strings.TrimSpace(req.Name) == "" {
+			vErrs = append(vErrs, fieldError{Field: "name", Message: "name is required"})
+		} else if len(req.Name) > maxNameLen {
+			vErrs = append(vErrs, fieldError{Field: "name", Message: fmt.Sprintf("name must be at most %d characters", maxNameLen)})
+		}
+		if !userNameRe.MatchString(req.Admin) {
+			vErrs = append(vErrs, fieldError{Field: "admin", Message: fmt.Sprintf("admin must match %s", userNameRe)})
+		}
+		if len(vErrs) > 0 {
+			writeValidation(w, vErrs)
+			return
+		}
+
+		token, err := newToken()
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, errResponse{Error: "unexpected_error"})
+			return
+		}
+		ws, u, err := repo.CreateWorkspace(r.Context(), req.Name, req.Admin, hashToken(token))
+		if errors.Is(err, ErrConflict) {
+			writeJSON(w, http.StatusConflict, errResponse{Error: "conflict"})
+			return
+		}
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, errResponse{Error: "unexpected_error"})
+			return
+		}
+		writeJSON(w, http.StatusCreated, createdWorkspace{Workspace: ws, Admin: createdUser{User: u, Token: token}})
+	}
+}
+
+func listWorkspaces(repo Repository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		if !callerIsOperator(r.Context()) {
+			writeJSON(w, http.StatusForbidden, errResponse{Error: "forbidden"})
+			return
+		}
+		out, err := repo.ListWorkspaces(r.Context())
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, errResponse{Error: "unexpected_error"})
+			return
+		}
+		writeJSON(w, http.StatusOK, out)
+	}
+}
@@ -0,0 +1,406 @@
+package tasks
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coder/websocket"
+	"github.com/coder/websocket/wsjson"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	// wsSendBuffer is how many messages a connection may fall behind
+	// before it is closed as a slow consumer.
+	wsSendBuffer = 256
+	// wsWriteTimeout bounds writing one message to a client.
+	wsWriteTimeout = 10 * time.Second
+	// wsMaxMessage bounds a message from a client.
+	wsMaxMessage = 1 << 20
+	// wsMaxSubscriptions bounds the subscriptions of one connection.
+	wsMaxSubscriptions = 100
+)
+
+var (
+	wsConnections = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "ws_connections",
+		Help: "Number of open WebSocket connections",
+	})
+	wsConnectionsTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "ws_connections_total",
+		Help: "Total number of accepted WebSocket connections",
+	})
+	wsMessagesTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "ws_messages_total",
+			Help: "Total number of WebSocket messages",
+		},
+		[]string{"direction"},
+	)
+	wsSlowConsumersTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "ws_slow_consumer_disconnects_total",
+		Help: "Total number of WebSocket connections closed for falling behind",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(wsConnections, wsConnectionsTotal, wsMessagesTotal, wsSlowConsumersTotal)
+}
+
+// wsQuery selects the changes a subscription is notified of; unset
+// members match every task.
+type wsQuery struct {
+	ProjectID  *int64 `json:"project_id,omitempty"`
+	Tag        string `json:"tag,omitempty"`
+	AssigneeID *int64 `json:"assignee_id,omitempty"`
+}
+
+func (q wsQuery) matches(t Task) bool {
+	switch {
+	case q.ProjectID != nil && (t.ProjectID == nil || *t.ProjectID != *q.ProjectID):
+		return false
+	case q.Tag != "" && !slices.Contains(t.Tags, q.Tag):
+		return false
+	case q.AssigneeID != nil && !slices.Contains(t.AssigneeIDs, *q.AssigneeID):
+		return false
+	}
+	return true
+}
+
+// wsRequest is a message from a client. ID names the subscription of
+// subscribe and unsubscribe, and is echoed in the reply to a mutation.
+type wsRequest struct {
+	Type   string          `json:"type"`
+	ID     string          `json:"id"`
+	Query  wsQuery         `json:"query"`
+	TaskID int64           `json:"task_id"`
+	Task   json.RawMessage `json:"task"` // POST /tasks or PATCH /tasks/{id} body
+}
+
+// wsReply is a message to a client: a reply to a request, or an event for
+// the subscriptions it matches.
+type wsReply struct {
+	Type          string       `json:"type"`
+	ID            string       `json:"id,omitempty"`
+	Event         string       `json:"event,omitempty"`
+	Subscriptions []string     `json:"subscriptions,omitempty"`
+	Task          *Task        `json:"task,omitempty"`
+	At            *time.Time   `json:"at,omitempty"`
+	Error         string       `json:"error,omitempty"`
+	Details       []fieldError `json:"details,omitempty"`
+}
+
+// serveWebSocket upgrades an authenticated request to a connection on
+// which the client subscribes to task changes and makes changes of its
+// own with the validation and permissions of the REST routes. A client
+// that stops reading is disconnected instead of buffering without bound.
+func serveWebSocket(repo Repository) http.HandlerFunc {
+	broker := brokerOf(repo)
+	return func(w http.ResponseWriter, r *http.Request) {
+		conn, err := websocket.Accept(w, r, &websocket.AcceptOptions{
+			// credentials come in a header or the URL, never a cookie, so
+			// other origins cannot act for a user
+			InsecureSkipVerify: true,
+		})
+		if err != nil {
+			return // Accept has replied
+		}
+		conn.SetReadLimit(wsMaxMessage)
+		wsConnections.Inc()
+		wsConnectionsTotal.Inc()
+		defer wsConnections.Dec()
+
+		// the request context ends with the handshake's timeout, so the
+		// connection keeps only its values
+		ctx, cancel := context.WithCancel(context.WithoutCancel(r.Context()))
+		defer cancel()
+		c := &wsConn{
+			conn:  conn,
+			repo:  repo,
+			scope: callerScope(ctx),
+			out:   make(chan wsReply, wsSendBuffer),
+			subs:  make(map[string]wsQuery),
+		}
+		c.run(ctx, cancel, broker)
+	}
+}
+
+type wsConn struct {
+	conn  *websocket.Conn
+	repo  Repository
+	scope Scope
+	out   chan wsReply
+
+	mu   sync.Mutex
+	subs map[string]wsQuery
+}
+
+func (c *wsConn) run(ctx context.Context, cancel context.CancelFunc, broker *Broker) {
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer cancel()
+		c.write(ctx)
+	}()
+	if broker != nil {
+		events, unsubscribe := broker.Subscribe(wsSendBuffer)
+		defer unsubscribe()
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer cancel()
+			c.notify(ctx, events, broker.Done())
+		}()
+	}
+
+	for {
+		_, data, err := c.conn.Read(ctx)
+		if err != nil {
+			break
+		}
+		wsMessagesTotal.WithLabelValues("in").Inc()
+		reply := wsReply{Type: "error", Error: "invalid_json"}
+		var req wsRequest
+		if err := json.Unmarshal(data, &req); err == nil {
+			reply = c.handle(ctx, req)
+		}
+		if !c.send(ctx, reply) {
+			break
+		}
+	}
+	cancel()
+	wg.Wait()
+	_ = c.conn.CloseNow()
+}
+
+// send queues a message for the client and reports false, after closing
+// the connection, if the client has fallen too far behind.
+func (c *wsConn) send(ctx context.Context, m wsReply) bool {
+	select {
+	case c.out <- m:
+		return true
+	case <-ctx.Done():
+		return false
+	default:
+		wsSlowConsumersTotal.Inc()
+		_ = c.conn.Close(websocket.StatusTryAgainLater, "slow consumer")
+		return false
+	}
+}
+
+func (c *wsConn) write(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case m := <-c.out:
+			wctx, cancel := context.WithTimeout(ctx, wsWriteTimeout)
+			err := wsjson.Write(wctx, c.conn, m)
+			cancel()
+			if err != nil {
+				return
+			}
+			wsMessagesTotal.WithLabelValues("out").Inc()
+		}
+	}
+}
+
+// notify queues the events matching the subscriptions, once per event.
+func (c *wsConn) notify(ctx context.Context, events <-chan TaskEvent, shutdown <-chan struct{}) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-shutdown:
+			_ = c.conn.Close(websocket.StatusGoingAway, "server shutting down")
+			return
+		case e, ok := <-events:
+			if !ok {
+				select {
+				case <-shutdown:
+					_ = c.conn.Close(websocket.StatusGoingAway, "server shutting down")
+				default:
+					// dropped by the broker for falling behind
+					wsSlowConsumersTotal.Inc()
+					_ = c.conn.Close(websocket.StatusTryAgainLater, "slow consumer")
+				}
+				return
+			}
+			ids := c.matching(e.Task)
+			if len(ids) == 0 {
+				continue
+			}
+			if ok, err := eventVisible(ctx, c.repo, c.scope, e); err != nil || !ok {
+				continue
+			}
+			task, at := e.Task, e.At
+			if !c.send(ctx, wsReply{Type: "event", Event: e.Type, Subscriptions: ids, Task: &task, At: &at}) {
+				return
+			}
+		}
+	}
+}
+
+func (c *wsConn) matching(t Task) []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var ids []string
+	for id, q := range c.subs {
+		if q.matches(t) {
+			ids = append(ids, id)
+		}
+	}
+	slices.Sort(ids)
+	return ids
+}
+
+func (c *wsConn) handle(ctx context.Context, req wsRequest) wsReply {
+	switch req.Type {
+	case "subscribe":
+		return c.subscribe(req)
+	case "unsubscribe":
+		c.mu.Lock()
+		_, ok := c.subs[req.ID]
+		delete(c.subs, req.ID)
+		c.mu.Unlock()
+		if !ok {
+			return wsReply{Type: "error", ID: req.ID, Error: "not_found"}
+		}
+		return wsReply{Type: "unsubscribed", ID: req.ID}
+	case "create":
+		t, err := c.create(ctx, req.Task)
+		return wsResult(req.ID, t, err)
+	case "update":
+		t, err := c.update(ctx, req.TaskID, req.Task)
+		return wsResult(req.ID, t, err)
+	case "delete":
+		if err := checkTaskWritable(ctx, c.repo, req.TaskID); err != nil {
+			return wsError(req.ID, err)
+		}
+		if err := c.repo.Delete(ctx, c.scope, req.TaskID); err != nil {
+			return wsError(req.ID, err)
+		}
+		return wsReply{Type: "deleted", ID: req.ID}
+	default:
+		return wsReply{Type: "error", ID: req.ID, Error: "validation_error", Details: []fieldError{{
+			Field:   "type",
+			Message: "type must be subscribe, unsubscribe, create, update or delete",
+		}}}
+	}
+}
+
+func (c *wsConn) subscribe(req wsRequest) wsReply {
+	if req.ID == "" {
+		return wsReply{Type: "error", Error: "validation_error", Details: []fieldError{{Field: "id", Message: "id is required"}}}
+	}
+	q := req.Query
+	q.Tag = strings.ToLower(strings.TrimSpace(q.Tag))
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.subs[req.ID]; ok {
+		return wsReply{Type: "error", ID: req.ID, Error: "conflict"}
+	}
+	if len(c.subs) >= wsMaxSubscriptions {
+		return wsReply{Type: "error", ID: req.ID, Error: "too_many_subscriptions"}
+	}
+	c.subs[req.ID] = q
+	return wsReply{Type: "subscribed", ID: req.ID}
+}
+
+// wsMutationErr carries the field errors of a rejected mutation.
+type wsMutationErr []fieldError
+
+func (e wsMutationErr) Error() string { return "validation_error" }
+
+func (c *wsConn) create(ctx context.Context, body json.RawMessage) (Task, error) {
+	var req createTaskRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		return Task{}, errInvalidJSON
+	}
+	in := TaskInput{
+		Title:       req.Title,
+		ProjectID:   req.ProjectID,
+		ParentID:    req.ParentID,
+		Tags:        req.Tags,
+		Checklist:   req.Checklist,
+		Fields:      req.Fields,
+		DueAt:       req.DueAt,
+		Priority:    req.Priority,
+		Assignee:    req.Assignee,
+		AssigneeIDs: req.AssigneeIDs,
+		OwnerID:     callerID(ctx),
+	}
+	vErrs, err := checkTaskInput(ctx, c.repo, "", &in)
+	if err != nil {
+		return Task{}, err
+	}
+	if len(vErrs) > 0 {
+		return Task{}, wsMutationErr(vErrs)
+	}
+	return c.repo.Create(ctx, c.scope, in)
+}
+
+func (c *wsConn) update(ctx context.Context, id int64, body json.RawMessage) (Task, error) {
+	var req updateTaskRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		return Task{}, errInvalidJSON
+	}
+	p := TaskPatch{
+		Title:     req.Title,
+		Done:      req.Done,
+		Tags:      req.Tags,
+		Checklist: req.Checklist,
+		DueAt:     req.DueAt.Value,
+		Priority:  req.Priority,
+		Assignee:  req.Assignee,
+	}
+	p.ClearDueAt = req.DueAt.Set && req.DueAt.Value == nil
+	vErrs, err := checkTaskPatch(ctx, c.repo, &p)
+	if err != nil {
+		return Task{}, err
+	}
+	if len(vErrs) > 0 {
+		return Task{}, wsMutationErr(vErrs)
+	}
+	if err := checkTaskWritable(ctx, c.repo, id); err != nil {
+		return Task{}, err
+	}
+	return c.repo.Update(ctx, c.scope, id, p)
+}
+
+var errInvalidJSON = errors.New("invalid json")
+
+func wsResult(id string, t Task, err error) wsReply {
+	if err != nil {
+		return wsError(id, err)
+	}
+	return wsReply{Type: "result", ID: id, Task: &t}
+}
+
+// wsError maps an error onto the codes of the REST responses.
+func wsError(id string, err error) wsReply {
+	var vErrs wsMutationErr
+	switch {
+	case errors.As(err, &vErrs):
+		sortFieldErrors(vErrs)
+		return wsReply{Type: "error", ID: id, Error: "validation_error", Details: vErrs}
+	case errors.Is(err, errInvalidJSON):
+		return wsReply{Type: "error", ID: id, Error: "invalid_json"}
+	case errors.Is(err, ErrTitleRequired):
+		return wsReply{Type: "error", ID: id, Error: "validation_error", Details: []fieldError{{Field: "title", Message: "title is required"}}}
+	case errors.Is(err, ErrNotFound):
+		return wsReply{Type: "error", ID: id, Error: "not_found"}
+	case errors.Is(err, errForbidden):
+		return wsReply{Type: "error", ID: id, Error: "forbidden"}
+	default:
+		return wsReply{Type: "error", ID: id, Error: "unexpected_error"}
+	}
+}
@@ -0,0 +1,177 @@
+package tasks
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coder/websocket"
+	"github.com/coder/websocket/wsjson"
+)
+
+// dialWS connects to /ws of srv as token.
+func dialWS(t *testing.T, srv *httptest.Server, token string) *websocket.Conn {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	conn, _, err := websocket.Dial(ctx, "ws"+strings.TrimPrefix(srv.URL, "http")+"/ws", &websocket.DialOptions{
+		HTTPHeader: http.Header{"Authorization": {"Bearer " + token}},
+	})
+	if err != nil {
+		t.Fatalf("dial /ws: %v", err)
+	}
+	t.Cleanup(func() { _ = conn.CloseNow() })
+	return conn
+}
+
+// wsCall sends req and returns the next message.
+func wsCall(t *testing.T, conn *websocket.Conn, req any) wsReply {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := wsjson.Write(ctx, conn, req); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	return wsNext(t, conn)
+}
+
+func wsNext(t *testing.T, conn *websocket.Conn) wsReply {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	var m wsReply
+	if err := wsjson.Read(ctx, conn, &m); err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	return m
+}
+
+func TestWebSocket_SubscribeAndMutate(t *testing.T) {
+	forEachRepo(t, func(t *testing.T, repo Repository) {
+		srv := httptest.NewServer(newAuthServer(WithEvents(repo, NewBroker())))
+		t.Cleanup(srv.Close)
+		r := srv.Config.Handler
+		project := createdID(t, r, testRootToken, "/projects", `{"name":"board"}`)
+
+		watcher := dialWS(t, srv, testRootToken)
+		for _, req := range []map[string]any{
+			{"type": "subscribe", "id": "board", "query": map[string]any{"project_id": project}},
+			{"type": "subscribe", "id": "urgent", "query": map[string]any{"tag": "Urgent"}},
+		} {
+			if m := wsCall(t, watcher, req); m.Type != "subscribed" || m.ID != req["id"] {
+				t.Fatalf("expected subscribed, got %+v", m)
+			}
+		}
+		if m := wsCall(t, watcher, map[string]any{"type": "subscribe", "id": "board"}); m.Error != "conflict" {
+			t.Fatalf("expected a conflict for a taken id, got %+v", m)
+		}
+
+		editor := dialWS(t, srv, testRootToken)
+		created := wsCall(t, editor, map[string]any{"type": "create", "id": "r1", "task": map[string]any{
+			"title": "card", "project_id": project, "tags": []string{"urgent"},
+		}})
+		if created.Type != "result" || created.ID != "r1" || created.Task == nil || created.Task.Title != "card" {
+			t.Fatalf("expected the created task, got %+v", created)
+		}
+		id := created.Task.ID
+
+		invalid := wsCall(t, editor, map[string]any{"type": "update", "id": "r2", "task_id": id, "task": map[string]any{"priority": 9}})
+		if invalid.Error != "validation_error" || len(invalid.Details) != 1 || invalid.Details[0].Field != "priority" {
+			t.Fatalf("expected a priority validation error, got %+v", invalid)
+		}
+		if m := wsCall(t, editor, map[string]any{"type": "update", "id": "r3", "task_id": id + 100, "task": map[string]any{"done": true}}); m.Error != "not_found" {
+			t.Fatalf("expected not_found, got %+v", m)
+		}
+		if m := wsCall(t, editor, map[string]any{"type": "update", "id": "r4", "task_id": id, "task": map[string]any{"done": true}}); m.Type != "result" || !m.Task.Done {
+			t.Fatalf("expected the updated task, got %+v", m)
+		}
+		createdID(t, r, testRootToken, "/tasks", `{"title":"elsewhere"}`)
+		if m := wsCall(t, editor, map[string]any{"type": "delete", "id": "r5", "task_id": id}); m.Type != "deleted" {
+			t.Fatalf("expected deleted, got %+v", m)
+		}
+
+		for _, want := range []string{EventCreated, EventUpdated, EventDeleted} {
+			m := wsNext(t, watcher)
+			if m.Type != "event" || m.Event != want || m.Task.ID != id {
+				t.Fatalf("expected %s of task %d, got %+v", want, id, m)
+			}
+			if len(m.Subscriptions) != 2 || m.Subscriptions[0] != "board" || m.Subscriptions[1] != "urgent" {
+				t.Fatalf("expected both subscriptions, got %v", m.Subscriptions)
+			}
+		}
+
+		if m := wsCall(t, watcher, map[string]any{"type": "unsubscribe", "id": "board"}); m.Type != "unsubscribed" {
+			t.Fatalf("expected unsubscribed, got %+v", m)
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := watcher.Write(ctx, websocket.MessageText, []byte("{")); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+		if m := wsNext(t, watcher); m.Error != "invalid_json" {
+			t.Fatalf("expected invalid_json, got %+v", m)
+		}
+	})
+}
+
+func TestWebSocket_Auth(t *testing.T) {
+	srv := httptest.NewServer(newAuthServer(WithEvents(NewInMemoryRepo(), NewBroker())))
+	t.Cleanup(srv.Close)
+	r := srv.Config.Handler
+	globex := createTestWorkspace(t, r, "globex", "globex-admin")
+	alice := createTestUser(t, r, "alice", false)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, resp, err := websocket.Dial(ctx, "ws"+strings.TrimPrefix(srv.URL, "http")+"/ws", nil)
+	if err == nil || resp == nil || resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("expected the handshake to be refused without credentials, got %v", err)
+	}
+
+	// browsers send the credential in the URL
+	conn, _, err := websocket.Dial(ctx, "ws"+strings.TrimPrefix(srv.URL, "http")+"/ws?access_token="+alice, nil)
+	if err != nil {
+		t.Fatalf("dial with access_token: %v", err)
+	}
+	t.Cleanup(func() { _ = conn.CloseNow() })
+	if m := wsCall(t, conn, map[string]any{"type": "subscribe", "id": "all"}); m.Type != "subscribed" {
+		t.Fatalf("expected subscribed, got %+v", m)
+	}
+
+	createdID(t, r, globex, "/tasks", `{"title":"theirs"}`)
+	createdID(t, r, testRootToken, "/tasks", `{"title":"admin's"}`)
+	mine := createdID(t, r, alice, "/tasks", `{"title":"mine"}`)
+	if m := wsNext(t, conn); m.Task == nil || m.Task.ID != mine {
+		t.Fatalf("expected only the user's own task, got %+v", m)
+	}
+}
+
+func TestWebSocket_SlowConsumer(t *testing.T) {
+	c := &wsConn{out: make(chan wsReply, 1)}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := websocket.Accept(w, r, nil)
+		if err != nil {
+			return
+		}
+		c.conn = conn
+		ctx := context.Background()
+		for c.send(ctx, wsReply{Type: "event"}) {
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	conn, _, err := websocket.Dial(ctx, "ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer func() { _ = conn.CloseNow() }()
+	_, _, err = conn.Read(ctx)
+	if websocket.CloseStatus(err) != websocket.StatusTryAgainLater {
+		t.Fatalf("expected the connection to be closed for falling behind, got %v", err)
+	}
+}
@@ -4,13 +4,16 @@ import (
 	"context"
 	_ "embed"
 	"encoding/json"
+	"fmt"
 	"log/slog"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
 	"strings"
 	"syscall"
 	"time"
+	_ "time/tzdata" // quick-add time zones; the runtime image has no zoneinfo
 
 	"github.com/go-chi/chi/v5"
 	chimw "github.com/go-chi/chi/v5/middleware"
@@ -58,22 +61,42 @@ func run(logger *slog.Logger) error {
 	if err != nil {
 		return err
 	}
-	sqliteRepo, err := tasks.NewSQLiteRepo(dsn)
+	db, err := openStore(envDefault("STORAGE", "sqlite"), dsn)
 	if err != nil {
 		return err
 	}
-	defer func() { _ = sqliteRepo.Close() }()
-	if err := sqliteRepo.ApplyMigrations(context.Background()); err != nil {
+	defer func() { _ = db.Close() }()
+	if err := db.ApplyMigrations(context.Background()); err != nil {
 		return err
 	}
 
-	app := newRouter(sqliteRepo, logger)
+	// the repository writes its events to an outbox in the transaction of
+	// each change; the relay below logs and publishes them
+	broker := tasks.NewBroker()
+	repo := tasks.WithBroker(db, broker)
+	authCfg := newAuthConfig(repo)
+
+	grpcAddr := envDefault("GRPC_ADDR", ":9090")
+	grpcLis, err := net.Listen("tcp", grpcAddr)
+	if err != nil {
+		return err
+	}
+	grpcSrv, grpcHealth := newGRPCServer(repo, broker, authCfg)
+
+	gwCtx, gwCancel := context.WithCancel(context.Background())
+	defer gwCancel()
+	gateway, err := newGateway(gwCtx, grpcAddr)
+	if err != nil {
+		return err
+	}
+
+	app := newRouter(repo, logger, authCfg, gateway)
 	health := healthRouter()
 
 	appSrv := &http.Server{Addr: ":8080", Handler: app, ReadHeaderTimeout: 5 * time.Second}
 	healthSrv := &http.Server{Addr: ":8081", Handler: health, ReadHeaderTimeout: 2 * time.Second}
 
-	errCh := make(chan error, 2)
+	errCh := make(chan error, 3)
 
 	go func() {
 		logger.Info("server_listen", slog.String("addr", appSrv.Addr))
@@ -81,6 +104,12 @@ func run(logger *slog.Logger) error {
 			errCh <- err
 		}
 	}()
+	go func() {
+		logger.Info("grpc_listen", slog.String("addr", grpcLis.Addr().String()))
+		if err := grpcSrv.Serve(grpcLis); err != nil {
+			errCh <- err
+		}
+	}()
 	go func() {
 		logger.Info("health_listen", slog.String("addr", healthSrv.Addr))
 		if err := healthSrv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
@@ -88,6 +117,25 @@ func run(logger *slog.Logger) error {
 		}
 	}()
 
+	bgCtx, stopBackground := context.WithCancel(context.Background())
+	relay := tasks.NewRelay(db,
+		tasks.EventLogSink(db),
+		tasks.WebhookSink(db),
+		tasks.BrokerSink(broker),
+	)
+	relay.OnError = func(err error) {
+		logger.Error("outbox_relay_error", slog.String("error", err.Error()))
+	}
+	relayDone, workerDone := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(relayDone)
+		relay.Run(bgCtx)
+	}()
+	go func() {
+		defer close(workerDone)
+		tasks.NewWebhookWorker(repo, broker).Run(bgCtx)
+	}()
+
 	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	defer stop()
 
@@ -101,18 +149,56 @@ func run(logger *slog.Logger) error {
 	logger.Info("shutdown_begin")
 	shutdownCtx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
 	defer cancel()
+	grpcHealth.Shutdown()
+	broker.Close() // ends event streams, which would hold up the shutdown
 	_ = appSrv.Shutdown(shutdownCtx)
+	stopped := make(chan struct{})
+	go func() {
+		grpcSrv.GracefulStop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-shutdownCtx.Done():
+		grpcSrv.Stop()
+	}
 	_ = healthSrv.Shutdown(context.Background())
+	// undelivered events and webhooks stay queued for the next start
+	stopBackground()
+	<-relayDone
+	<-workerDone
 	logger.Info("shutdown_complete")
 	return nil
 }
 
-func newRouter(repo tasks.Repository, logger *slog.Logger) *chi.Mux {
+// newAuthConfig is the authentication of both the HTTP and the gRPC server.
+func newAuthConfig(repo tasks.Repository) middleware.AuthConfig {
+	return middleware.AuthConfig{
+		Mode:          AuthModeFromEnv(),
+		APIKey:        strings.TrimSpace(os.Getenv("API_KEY")),
+		BearerToken:   strings.TrimSpace(os.Getenv("BEARER_TOKEN")),
+		SkipPaths:     []string{"/health", "/openapi.json", "/docs", "/metrics", "/.well-known/caldav"},
+		SkipPrefixes:  []string{"/ical/"}, // the feed token is in the URL
+		BasicPrefixes: []string{"/caldav/"},
+		Lookup:        tasks.LookupPrincipal(repo),
+	}
+}
+
+// newRouter serves the REST API; gateway, when not nil, serves /v1/ from
+// the gRPC server.
+func newRouter(repo tasks.Repository, logger *slog.Logger, authCfg middleware.AuthConfig, gateway http.Handler) *chi.Mux {
 	r := chi.NewRouter()
 
 	r.Use(chimw.RequestID)
 	r.Use(chimw.Recoverer)
-	r.Use(chimw.Timeout(15 * time.Second))
+	r.Use(middleware.Timeout(15*time.Second,
+		middleware.StreamRoute{Path: "/tasks/events"},
+		middleware.StreamRoute{Path: "/v1/tasks:watch"},
+		middleware.StreamRoute{Path: "/export"},
+		middleware.StreamRoute{Path: "/ws"},
+		middleware.StreamRoute{Method: http.MethodGet, Path: "/tasks", Accept: "application/x-ndjson"},
+		middleware.StreamRoute{Method: http.MethodGet, Path: "/views/*/tasks", Accept: "application/x-ndjson"},
+	))
 	r.Use(cors.Handler(cors.Options{
 		AllowedOrigins:   []string{"*"},
 		AllowedMethods:   []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
@@ -122,12 +208,6 @@ func newRouter(repo tasks.Repository, logger *slog.Logger) *chi.Mux {
 		MaxAge:           300,
 	}))
 
-	authCfg := middleware.AuthConfig{
-		Mode:        AuthModeFromEnv(),
-		APIKey:      strings.TrimSpace(os.Getenv("API_KEY")),
-		BearerToken: strings.TrimSpace(os.Getenv("BEARER_TOKEN")),
-		SkipPaths:   []string{"/health", "/openapi.json", "/docs", "/metrics"},
-	}
 	r.Use(middleware.AuthMiddleware(authCfg))
 
 	rps := floatFromEnv("RATE_LIMIT_RPS", 0)
@@ -164,6 +244,9 @@ func newRouter(repo tasks.Repository, logger *slog.Logger) *chi.Mux {
 	})
 
 	tasks.RegisterRoutes(r, repo)
+	if gateway != nil {
+		r.Handle("/v1/*", gateway)
+	}
 	return r
 }
 
@@ -194,6 +277,35 @@ func newLoggerFromEnv() *slog.Logger {
 	return slog.New(handler)
 }
 
+// store is a repository that keeps its events in an outbox.
+type store interface {
+	tasks.Repository
+	tasks.Outbox
+	ApplyMigrations(ctx context.Context) error
+	Close() error
+}
+
+// openStore opens the repository named by STORAGE on the database dsn:
+// "sqlite" keeps the tasks in tables, "events" as streams of events with
+// the tables as their read model.
+func openStore(kind, dsn string) (store, error) {
+	switch kind {
+	case "sqlite":
+		r, err := tasks.NewSQLiteRepo(dsn)
+		if err != nil {
+			return nil, err
+		}
+		return r, nil
+	case "events":
+		r, err := tasks.NewEventSourcedRepo(dsn)
+		if err != nil {
+			return nil, err
+		}
+		return r, nil
+	}
+	return nil, fmt.Errorf("unknown STORAGE %q", kind)
+}
+
 func envDefault(k, v string) string {
 	if s := strings.TrimSpace(os.Getenv(k)); s != "" {
 		return s